@@ -0,0 +1,287 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessTracker records every request sent through a transport created
+// with TestProxyVariables.Transport, and which recorded entry it
+// corresponds to, to find hot entries (accessed many times), cold entries
+// (never accessed) and how sequentially a test walks its recording. Set
+// TestProxyVariables.AccessTracker before starting the session and call
+// Report after StopTestProxy. Starting another session resets the tracker,
+// so a tracker reused across sessions reports the last one.
+type AccessTracker struct {
+	// Path is the file Report writes: CSV when it ends in .csv, JSON
+	// otherwise. A CSV report holds the accesses of each entry, and a
+	// second file next to it, with the extension replaced by
+	// ".accesses.csv", holds one row per access.
+	Path string
+
+	mu       sync.Mutex
+	accesses []Access
+	mode     string
+	// entries are the recorded entries, read when the session is stopped.
+	entries   []Entry
+	recording string
+	// unavailable is set when the recording is not on this machine.
+	unavailable bool
+}
+
+// Access is a single request made during a session.
+type Access struct {
+	Time time.Time `json:"time"`
+	// Entry is the index of the recorded entry the request matched, or -1
+	// when no recorded entry has its method and URI.
+	Entry int `json:"entry"`
+	// Duration is the time the proxy took to answer, which in playback is
+	// dominated by matching the request against the recording.
+	Duration   time.Duration `json:"duration"`
+	Goroutine  uint64        `json:"goroutine"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	StatusCode int           `json:"statusCode"`
+}
+
+// EntryAccesses counts the accesses of one recorded entry.
+type EntryAccesses struct {
+	Index    int    `json:"index"`
+	Method   string `json:"method"`
+	URI      string `json:"uri"`
+	Accesses int    `json:"accesses"`
+	// FirstAccess is the position of the first access among all accesses,
+	// or -1 for a cold entry.
+	FirstAccess int `json:"firstAccess"`
+}
+
+// AccessReport is the content of the file written by AccessTracker.Report.
+type AccessReport struct {
+	Recording string          `json:"recording"`
+	Mode      string          `json:"mode"`
+	Accesses  []Access        `json:"accesses"`
+	Entries   []EntryAccesses `json:"entries"`
+	Hot       []int           `json:"hot"`
+	Cold      []int           `json:"cold"`
+	// SequentialRatio is the fraction of accesses that matched the entry
+	// right after the one matched by the previous access.
+	SequentialRatio float64 `json:"sequentialRatio"`
+	// RecordingUnavailable is set when the recording was not on this
+	// machine when the session stopped, as when a remote proxy stores it.
+	// The accesses are then not resolved to entries.
+	RecordingUnavailable bool `json:"recordingUnavailable,omitempty"`
+}
+
+// NewAccessTracker returns an AccessTracker that reports to path.
+func NewAccessTracker(path string) *AccessTracker {
+	return &AccessTracker{Path: path}
+}
+
+// track records a request answered by the proxy.
+func (at *AccessTracker) track(start time.Time, method, uri, mode string, statusCode int) {
+	access := Access{
+		Time:       start,
+		Entry:      -1,
+		Duration:   time.Since(start),
+		Goroutine:  goroutineId(),
+		Method:     method,
+		URI:        uri,
+		StatusCode: statusCode,
+	}
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.mode = mode
+	at.accesses = append(at.accesses, access)
+}
+
+// reset forgets the accesses of the previous session. It is called by
+// StartTestProxy.
+func (at *AccessTracker) reset() {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.accesses, at.mode, at.entries, at.recording, at.unavailable = nil, "", nil, "", false
+}
+
+// finish reads the entries of the recording the session used. It is called
+// by StopTestProxy, before a compressed recording's working copy is removed.
+// A recording that is not on this machine, as when the proxy is remote, is
+// reported as unavailable rather than failing the stop.
+func (at *AccessTracker) finish(recording string) error {
+	rf, err := ReadRecordingFile(recording)
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	at.recording = recording
+	if errors.Is(err, fs.ErrNotExist) {
+		at.unavailable = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("access tracker: %w", err)
+	}
+	at.entries = rf.Entries
+	return nil
+}
+
+// Report resolves each access to a recorded entry and writes the report to
+// at.Path.
+func (at *AccessTracker) Report() error {
+	report := at.report()
+
+	ext := filepath.Ext(at.Path)
+	if !strings.EqualFold(ext, ".csv") {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(at.Path, data, 0o644)
+	}
+
+	data, err := report.entriesCSV()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(at.Path, data, 0o644); err != nil {
+		return err
+	}
+	if data, err = report.accessesCSV(); err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(at.Path, ext)+".accesses.csv", data, 0o644)
+}
+
+func (at *AccessTracker) report() AccessReport {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	report := AccessReport{
+		Recording: at.recording,
+		Mode:      at.mode,
+		Accesses:  append([]Access(nil), at.accesses...),
+		Entries:   make([]EntryAccesses, len(at.entries)),
+		Hot:       []int{},
+		Cold:      []int{},
+
+		RecordingUnavailable: at.unavailable,
+	}
+	for i, e := range at.entries {
+		report.Entries[i] = EntryAccesses{Index: i, Method: e.RequestMethod, URI: e.RequestUri, FirstAccess: -1}
+	}
+
+	// When recording, the proxy appends an entry per request. In playback
+	// it answers with the first unused entry with a matching request, so
+	// repeated requests walk successive entries.
+	used := make([]bool, len(at.entries))
+	sequential := 0
+	for n := range report.Accesses {
+		a := &report.Accesses[n]
+		if at.mode == "record" {
+			if n < len(at.entries) {
+				a.Entry = n
+			}
+		} else {
+			a.Entry = at.matchEntry(a, used)
+		}
+		if a.Entry < 0 {
+			continue
+		}
+		used[a.Entry] = true
+		entry := &report.Entries[a.Entry]
+		entry.Accesses++
+		if entry.FirstAccess < 0 {
+			entry.FirstAccess = n
+		}
+		if n > 0 && a.Entry == report.Accesses[n-1].Entry+1 {
+			sequential++
+		}
+	}
+	if len(report.Accesses) > 1 {
+		report.SequentialRatio = float64(sequential) / float64(len(report.Accesses)-1)
+	}
+
+	for _, e := range report.Entries {
+		switch {
+		case e.Accesses == 0:
+			report.Cold = append(report.Cold, e.Index)
+		case e.Accesses > 1:
+			report.Hot = append(report.Hot, e.Index)
+		}
+	}
+	return report
+}
+
+// matchEntry returns the first unused entry with the method and URI of a,
+// falling back to a used one for requests the proxy answers repeatedly.
+func (at *AccessTracker) matchEntry(a *Access, used []bool) int {
+	repeated := -1
+	for i, e := range at.entries {
+		if !strings.EqualFold(e.RequestMethod, a.Method) || e.RequestUri != a.URI {
+			continue
+		}
+		if !used[i] {
+			return i
+		}
+		if repeated < 0 {
+			repeated = i
+		}
+	}
+	return repeated
+}
+
+func (r AccessReport) entriesCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"index", "method", "uri", "accesses", "first_access"})
+	for _, e := range r.Entries {
+		w.Write([]string{strconv.Itoa(e.Index), e.Method, e.URI, strconv.Itoa(e.Accesses), strconv.Itoa(e.FirstAccess)})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (r AccessReport) accessesCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"access", "time", "duration_ms", "goroutine", "method", "uri", "status", "entry"})
+	for n, a := range r.Accesses {
+		w.Write([]string{
+			strconv.Itoa(n),
+			a.Time.Format(time.RFC3339Nano),
+			strconv.FormatFloat(float64(a.Duration)/float64(time.Millisecond), 'f', 3, 64),
+			strconv.FormatUint(a.Goroutine, 10),
+			a.Method,
+			a.URI,
+			strconv.Itoa(a.StatusCode),
+			strconv.Itoa(a.Entry),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// goroutineId parses the ID of the calling goroutine from its stack trace.
+// It is only used to tell concurrent callers apart in the report.
+func goroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,153 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessTracker(t *testing.T) {
+	const base = "https://account.table.core.windows.net"
+	dir := t.TempDir()
+	recording := filepath.Join(dir, "TestTracked.json")
+	rec := &RecordingFile{Entries: []Entry{
+		{RequestUri: base + "/a", RequestMethod: "GET", StatusCode: 200},
+		{RequestUri: base + "/b", RequestMethod: "GET", StatusCode: 200},
+		{RequestUri: base + "/a", RequestMethod: "GET", StatusCode: 200},
+	}}
+	if err := rec.WriteFile(recording); err != nil {
+		t.Fatal(err)
+	}
+
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = recording
+	tpv.AccessTracker = NewAccessTracker(filepath.Join(dir, "access.json"))
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	transport := tpv.Transport(sp.Client())
+	for _, path := range []string{"/a", "/a", "/a", "/missing"} {
+		req, err := http.NewRequest("GET", base+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := tpv.AccessTracker.Report(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(tpv.AccessTracker.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report AccessReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, a := range report.Accesses {
+		got = append(got, a.Entry)
+		if a.Goroutine == 0 || a.StatusCode != http.StatusOK {
+			t.Errorf("incomplete access: %+v", a)
+		}
+	}
+	if want := []int{0, 2, 0, -1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(report.Hot, []int{0}) || !reflect.DeepEqual(report.Cold, []int{1}) {
+		t.Errorf("got hot %v and cold %v, want [0] and [1]", report.Hot, report.Cold)
+	}
+
+	tpv.AccessTracker.Path = filepath.Join(dir, "access.csv")
+	if err := tpv.AccessTracker.Report(); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(tpv.AccessTracker.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "index,method,uri,accesses,first_access\n" +
+		"0,GET," + base + "/a,2,0\n" +
+		"1,GET," + base + "/b,0,-1\n" +
+		"2,GET," + base + "/a,1,1\n"
+	if string(data) != want {
+		t.Errorf("got CSV:\n%s\nwant:\n%s", data, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "access.accesses.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(report.Accesses)+1 || strings.Join(rows[0], ",") != "access,time,duration_ms,goroutine,method,uri,status,entry" {
+		t.Fatalf("got access rows %q", rows)
+	}
+	for n, a := range report.Accesses {
+		row := rows[n+1]
+		if row[0] != strconv.Itoa(n) || row[1] != a.Time.Format(time.RFC3339Nano) || row[3] != strconv.FormatUint(a.Goroutine, 10) ||
+			row[5] != a.URI || row[6] != "200" || row[7] != strconv.Itoa(a.Entry) {
+			t.Errorf("access %d: got row %q for %+v", n, row, a)
+		}
+		if ms, err := strconv.ParseFloat(row[2], 64); err != nil || ms < 0 {
+			t.Errorf("access %d: bad duration %q", n, row[2])
+		}
+	}
+}
+
+func TestAccessTrackerReusedWithRemoteProxy(t *testing.T) {
+	sp := newStubProxy(t)
+	tracker := NewAccessTracker(filepath.Join(t.TempDir(), "access.json"))
+	for i, path := range []string{"/first", "/second"} {
+		tpv := sp.variables(t, "record")
+		// The stub, like a remote proxy, stores no recording on this machine.
+		tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestRemote.json")
+		tpv.AccessTracker = tracker
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("GET", "https://account.table.core.windows.net"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(sp.Client()).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatalf("session %d: %v", i, err)
+		}
+	}
+
+	report := tracker.report()
+	if len(report.Accesses) != 1 || report.Accesses[0].URI != "https://account.table.core.windows.net/second" {
+		t.Errorf("got accesses %+v, want only the last session's", report.Accesses)
+	}
+	if !report.RecordingUnavailable || report.Accesses[0].Entry != -1 {
+		t.Errorf("got %+v for a recording that is not on this machine", report)
+	}
+}
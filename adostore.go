@@ -0,0 +1,251 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+)
+
+// adoAPIVersion is the api-version of the Azure DevOps Git REST API used by
+// ADORecordingStore.
+const adoAPIVersion = "7.1"
+
+// adoPushAttempts is the number of times ADORecordingStore.Save pushes a
+// recording when the branch moves between reading it and pushing.
+const adoPushAttempts = 3
+
+// ADORecordingStore is a RecordingStore that keeps recordings in an Azure
+// DevOps Git repository, committing each saved recording to Branch.
+type ADORecordingStore struct {
+	// OrganizationURL is the organization's URL, e.g.
+	// https://dev.azure.com/contoso.
+	OrganizationURL string
+	Project         string
+	// RepoID is the repository's name or ID.
+	RepoID string
+	// PAT is a personal access token with Code (Read & Write) scope.
+	PAT string
+	// Branch defaults to "main"; Directory, the repository directory of
+	// the recordings, defaults to "recordings".
+	Branch    string
+	Directory string
+	// ClientOptions configures the pipeline of the REST calls.
+	ClientOptions *policy.ClientOptions
+}
+
+// Load downloads the recording from the tip of Branch.
+func (store ADORecordingStore) Load(ctx context.Context, name string) ([]byte, error) {
+	data, found, err := store.getItem(ctx, name, "branch", store.branch())
+	if err == nil && !found {
+		err = fmt.Errorf("%s in %s: %w", store.itemPath(name), store.RepoID, ErrRecordingNotFound)
+	}
+	return data, err
+}
+
+// Save commits the recording to Branch, unless it is unchanged. The push
+// names the commit it builds on, so Azure DevOps rejects it with a
+// conflict when the branch has moved meanwhile, e.g. because another test
+// saved its recording; Save then retries on the new tip.
+func (store ADORecordingStore) Save(ctx context.Context, name string, data []byte) error {
+	for attempt := 1; ; attempt++ {
+		tip, err := store.branchTip(ctx)
+		if err != nil {
+			return err
+		}
+		existing, found, err := store.getItem(ctx, name, "commit", tip)
+		if err != nil {
+			return err
+		}
+		if found && bytes.Equal(existing, data) {
+			return nil
+		}
+		err = store.push(ctx, name, data, tip, found)
+		if err == nil || attempt == adoPushAttempts || !isConflict(err) {
+			return err
+		}
+	}
+}
+
+func (store ADORecordingStore) branch() string {
+	if store.Branch == "" {
+		return "main"
+	}
+	return store.Branch
+}
+
+func (store ADORecordingStore) itemPath(name string) string {
+	dir := store.Directory
+	if dir == "" {
+		dir = "recordings"
+	}
+	return path.Join("/", dir, name)
+}
+
+// repoURL returns the URL of the repository resource with the given
+// suffix and query.
+func (store ADORecordingStore) repoURL(suffix string, query url.Values) string {
+	query.Set("api-version", adoAPIVersion)
+	return fmt.Sprintf("%s/%s/_apis/git/repositories/%s/%s?%s", strings.TrimSuffix(store.OrganizationURL, "/"),
+		url.PathEscape(store.Project), url.PathEscape(store.RepoID), suffix, query.Encode())
+}
+
+// getItem downloads the file of the recording at the given version and
+// reports whether it exists.
+func (store ADORecordingStore) getItem(ctx context.Context, name, versionType, version string) ([]byte, bool, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodGet, store.repoURL("items", url.Values{
+		"path":                          {store.itemPath(name)},
+		"versionDescriptor.version":     {version},
+		"versionDescriptor.versionType": {versionType},
+		"$format":                       {"octetStream"},
+	}))
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if runtime.HasStatusCode(resp, http.StatusNotFound) {
+		return nil, false, nil
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, false, runtime.NewResponseError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, err == nil, err
+}
+
+// branchTip returns the ID of the commit Branch points to.
+func (store ADORecordingStore) branchTip(ctx context.Context) (string, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodGet, store.repoURL("refs", url.Values{"filter": {"heads/" + store.branch()}}))
+	if err != nil {
+		return "", err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return "", runtime.NewResponseError(resp)
+	}
+	var refs struct {
+		Value []struct {
+			Name     string `json:"name"`
+			ObjectID string `json:"objectId"`
+		} `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
+		return "", err
+	}
+	// The filter matches by prefix, so main also finds main-old.
+	for _, ref := range refs.Value {
+		if ref.Name == "refs/heads/"+store.branch() {
+			return ref.ObjectID, nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", store.branch(), store.RepoID)
+}
+
+// push commits the recording on top of the commit tip.
+func (store ADORecordingStore) push(ctx context.Context, name string, data []byte, tip string, exists bool) error {
+	changeType := "add"
+	if exists {
+		changeType = "edit"
+	}
+	type item struct {
+		Path string `json:"path"`
+	}
+	type content struct {
+		Content     string `json:"content"`
+		ContentType string `json:"contentType"`
+	}
+	type change struct {
+		ChangeType string  `json:"changeType"`
+		Item       item    `json:"item"`
+		NewContent content `json:"newContent"`
+	}
+	type commit struct {
+		Comment string   `json:"comment"`
+		Changes []change `json:"changes"`
+	}
+	type refUpdate struct {
+		Name        string `json:"name"`
+		OldObjectID string `json:"oldObjectId"`
+	}
+	body, err := json.Marshal(struct {
+		RefUpdates []refUpdate `json:"refUpdates"`
+		Commits    []commit    `json:"commits"`
+	}{
+		RefUpdates: []refUpdate{{Name: "refs/heads/" + store.branch(), OldObjectID: tip}},
+		Commits: []commit{{
+			Comment: "Update recording " + name,
+			Changes: []change{{
+				ChangeType: changeType,
+				Item:       item{Path: store.itemPath(name)},
+				NewContent: content{Content: base64.StdEncoding.EncodeToString(data), ContentType: "base64encoded"},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := runtime.NewRequest(ctx, http.MethodPost, store.repoURL("pushes", url.Values{}))
+	if err != nil {
+		return err
+	}
+	if err := req.SetBody(streaming.NopCloser(bytes.NewReader(body)), "application/json"); err != nil {
+		return err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusCreated) {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+// isConflict reports whether err is Azure DevOps rejecting a push whose
+// branch has moved.
+func isConflict(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusConflict
+}
+
+func (store ADORecordingStore) pipeline() runtime.Pipeline {
+	return runtime.NewPipeline("testproxy", "v0.0.0", runtime.PipelineOptions{
+		PerCall: []policy.Policy{adoPATPolicy{pat: store.PAT}},
+	}, store.ClientOptions)
+}
+
+// adoPATPolicy authenticates requests with a personal access token.
+type adoPATPolicy struct {
+	pat string
+}
+
+func (p adoPATPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+p.pat)))
+	return req.Next()
+}
@@ -0,0 +1,149 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// stubADORepo is an in-memory Azure DevOps Git repository with a single
+// branch, main.
+type stubADORepo struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	commits []map[string][]byte
+	pushes  []string
+	// racePushes is the number of pushes that find main moved by another
+	// client before they land.
+	racePushes int
+}
+
+func newStubADORepo(t *testing.T) *stubADORepo {
+	repo := &stubADORepo{commits: []map[string][]byte{{}}}
+	repo.Server = httptest.NewTLSServer(http.HandlerFunc(repo.serveHTTP))
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func commitID(i int) string { return fmt.Sprintf("%040d", i) }
+
+func (repo *stubADORepo) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if r.Header.Get("Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(":pat")) ||
+		r.URL.Query().Get("api-version") != adoAPIVersion {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	tip := len(repo.commits) - 1
+	switch r.URL.Path {
+	case "/contoso/Project X/_apis/git/repositories/recordings/refs":
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": []map[string]string{
+			{"name": "refs/heads/main-old", "objectId": commitID(99)},
+			{"name": "refs/heads/main", "objectId": commitID(tip)},
+		}})
+	case "/contoso/Project X/_apis/git/repositories/recordings/items":
+		q := r.URL.Query()
+		commit := tip
+		if q.Get("versionDescriptor.versionType") == "commit" {
+			fmt.Sscan(q.Get("versionDescriptor.version"), &commit)
+		}
+		data, ok := repo.commits[commit][q.Get("path")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case "/contoso/Project X/_apis/git/repositories/recordings/pushes":
+		var push struct {
+			RefUpdates []struct{ Name, OldObjectId string }
+			Commits    []struct {
+				Changes []struct {
+					ChangeType string
+					Item       struct{ Path string }
+					NewContent struct{ Content, ContentType string }
+				}
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&push)
+		if repo.racePushes > 0 {
+			repo.racePushes--
+			repo.commits = append(repo.commits, repo.commits[tip])
+			tip++
+		}
+		if push.RefUpdates[0].Name != "refs/heads/main" || push.RefUpdates[0].OldObjectId != commitID(tip) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		next := map[string][]byte{}
+		for k, v := range repo.commits[tip] {
+			next[k] = v
+		}
+		change := push.Commits[0].Changes[0]
+		data, _ := base64.StdEncoding.DecodeString(change.NewContent.Content)
+		next[change.Item.Path] = data
+		repo.commits = append(repo.commits, next)
+		repo.pushes = append(repo.pushes, change.ChangeType+" "+change.Item.Path)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestADORecordingStore(t *testing.T) {
+	repo := newStubADORepo(t)
+	store := ADORecordingStore{
+		OrganizationURL: repo.URL + "/contoso/",
+		Project:         "Project X",
+		RepoID:          "recordings",
+		PAT:             "pat",
+		ClientOptions:   &policy.ClientOptions{Transport: repo.Client()},
+	}
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "TestCreateTable.json"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Fatalf("expected ErrRecordingNotFound, got %v", err)
+	}
+	if err := store.Save(ctx, "TestCreateTable.json", []byte(`{"Entries": []}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Another client moves main twice; the third push lands.
+	repo.racePushes = 2
+	if err := store.Save(ctx, "TestCreateTable.json", []byte(`{"Entries": [{}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, "TestCreateTable.json", []byte(`{"Entries": [{}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Load(ctx, "TestCreateTable.json")
+	if err != nil || string(data) != `{"Entries": [{}]}` {
+		t.Fatalf("loaded %s, %v", data, err)
+	}
+	want := "[add /recordings/TestCreateTable.json edit /recordings/TestCreateTable.json]"
+	if got := fmt.Sprint(repo.pushes); got != want {
+		t.Errorf("pushed %s, want %s", got, want)
+	}
+
+	repo.racePushes = adoPushAttempts
+	if err := store.Save(ctx, "TestCreateTable.json", []byte(`{}`)); !isConflict(err) {
+		t.Errorf("expected a conflict once the attempts are used up, got %v", err)
+	}
+
+	store.PAT = "expired"
+	if _, err := store.Load(ctx, "TestCreateTable.json"); err == nil || errors.Is(err, ErrRecordingNotFound) {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
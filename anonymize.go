@@ -0,0 +1,257 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AnonymizeOptions control AnonymizeRecordingsWithOptions.
+type AnonymizeOptions struct {
+	// DryRun reports what would change without rewriting any file.
+	DryRun bool
+}
+
+// AnonymizeReport lists the recordings AnonymizeRecordings changed, or
+// would change in a dry run.
+type AnonymizeReport struct {
+	DryRun bool
+	Files  []AnonymizedFile
+}
+
+// AnonymizedFile counts the replacements made in one recording, by
+// location, e.g. "Entries[0].RequestUri" or "Variables.subscriptionId".
+type AnonymizedFile struct {
+	Path    string
+	Changes map[string]int
+}
+
+// Total is the number of replacements made in the file.
+func (af AnonymizedFile) Total() int {
+	total := 0
+	for _, n := range af.Changes {
+		total += n
+	}
+	return total
+}
+
+func (r AnonymizeReport) String() string {
+	verb := "replaced"
+	if r.DryRun {
+		verb = "would replace"
+	}
+	var b strings.Builder
+	for _, f := range r.Files {
+		fmt.Fprintf(&b, "%s: %s %d occurrences\n", f.Path, verb, f.Total())
+		locations := make([]string, 0, len(f.Changes))
+		for location := range f.Changes {
+			locations = append(locations, location)
+		}
+		sort.Strings(locations)
+		for _, location := range locations {
+			fmt.Fprintf(&b, "  %s: %d\n", location, f.Changes[location])
+		}
+	}
+	return b.String()
+}
+
+// AnonymizeRecordings replaces every occurrence of the keys of replacements
+// with their values in the recordings under dir: in request URIs, header
+// values, variables and bodies, including base64 encoded bodies, which are
+// decoded and re-encoded. URL-encoded occurrences are replaced too, and
+// keys that are GUIDs match regardless of case. Files are rewritten
+// atomically.
+func AnonymizeRecordings(dir string, replacements map[string]string) (AnonymizeReport, error) {
+	return AnonymizeRecordingsWithOptions(dir, replacements, AnonymizeOptions{})
+}
+
+// AnonymizeRecordingsWithOptions is AnonymizeRecordings with support for
+// a dry run.
+func AnonymizeRecordingsWithOptions(dir string, replacements map[string]string, opts AnonymizeOptions) (AnonymizeReport, error) {
+	report := AnonymizeReport{DryRun: opts.DryRun}
+	replacer := newAnonymizer(replacements)
+
+	infos, err := ListRecordings(dir)
+	if err != nil {
+		return report, err
+	}
+	for _, info := range infos {
+		if info.Err != nil {
+			return report, fmt.Errorf("%s: %w", info.Path, info.Err)
+		}
+		rec, err := ReadRecordingFile(info.Path)
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", info.Path, err)
+		}
+
+		changes := replacer.anonymizeRecording(rec)
+		if len(changes) == 0 {
+			continue
+		}
+		report.Files = append(report.Files, AnonymizedFile{Path: info.Path, Changes: changes})
+		if !opts.DryRun {
+			if err := rec.WriteFile(info.Path); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+var guidPattern = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+
+type anonymizer []struct {
+	pattern *regexp.Regexp
+	value   string
+}
+
+// newAnonymizer builds one pattern per distinct spelling of each key: as
+// is, query-escaped and path-escaped. Longer keys are tried first so a key
+// that contains another is replaced whole.
+func newAnonymizer(replacements map[string]string) anonymizer {
+	olds := make([]string, 0, len(replacements))
+	for old := range replacements {
+		if old != "" {
+			olds = append(olds, old)
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+
+	var a anonymizer
+	for _, old := range olds {
+		value := replacements[old]
+		flags := ""
+		if guidPattern.MatchString(old) {
+			flags = "(?i)"
+		}
+		seen := map[string]bool{}
+		for _, variant := range [][2]string{
+			{old, value},
+			{url.QueryEscape(old), url.QueryEscape(value)},
+			{url.PathEscape(old), url.PathEscape(value)},
+		} {
+			if seen[variant[0]] {
+				continue
+			}
+			seen[variant[0]] = true
+			a = append(a, struct {
+				pattern *regexp.Regexp
+				value   string
+			}{regexp.MustCompile(flags + regexp.QuoteMeta(variant[0])), variant[1]})
+		}
+	}
+	return a
+}
+
+// replace applies every replacement to s, escaping replacement values with
+// escape, and returns the result and the number of replacements made.
+func (a anonymizer) replace(s string, escape func(string) string) (string, int) {
+	count := 0
+	for _, r := range a {
+		value := escape(r.value)
+		s = r.pattern.ReplaceAllStringFunc(s, func(string) string {
+			count++
+			return value
+		})
+	}
+	return s, count
+}
+
+func (a anonymizer) anonymizeRecording(rec *RecordingFile) map[string]int {
+	changes := map[string]int{}
+	record := func(location string, n int) {
+		if n > 0 {
+			changes[location] += n
+		}
+	}
+	for i := range rec.Entries {
+		e := &rec.Entries[i]
+		at := fmt.Sprintf("Entries[%d]", i)
+		var n int
+		e.RequestUri, n = a.replace(e.RequestUri, unescaped)
+		record(at+".RequestUri", n)
+		record(at+".RequestHeaders", a.anonymizeHeaders(e.RequestHeaders))
+		e.RequestBody, n = a.anonymizeBody(e.RequestBody, e.RequestHeaders)
+		record(at+".RequestBody", n)
+		record(at+".ResponseHeaders", a.anonymizeHeaders(e.ResponseHeaders))
+		e.ResponseBody, n = a.anonymizeBody(e.ResponseBody, e.ResponseHeaders)
+		record(at+".ResponseBody", n)
+	}
+	for k, v := range rec.Variables {
+		var n int
+		rec.Variables[k], n = a.replace(v, unescaped)
+		record("Variables."+k, n)
+	}
+	return changes
+}
+
+func (a anonymizer) anonymizeHeaders(headers Headers) int {
+	total := 0
+	for name, values := range headers {
+		for i, v := range values {
+			var n int
+			values[i], n = a.replace(v, unescaped)
+			total += n
+		}
+		headers[name] = values
+	}
+	return total
+}
+
+// anonymizeBody replaces occurrences in a recorded body. JSON bodies are
+// edited in place, so their layout is kept; string bodies are decoded
+// first, and base64 bodies are decoded to their original bytes.
+func (a anonymizer) anonymizeBody(body json.RawMessage, headers Headers) (json.RawMessage, int) {
+	var s string
+	if err := json.Unmarshal(body, &s); err != nil {
+		replaced, n := a.replace(string(body), jsonEscape)
+		if n == 0 || !json.Valid([]byte(replaced)) {
+			return body, 0
+		}
+		return json.RawMessage(replaced), n
+	}
+
+	if _, base64Body, _ := bodyText(body, headers); base64Body {
+		if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+			replaced, n := a.replace(string(decoded), unescaped)
+			if n == 0 {
+				return body, 0
+			}
+			s = base64.StdEncoding.EncodeToString([]byte(replaced))
+			raw, err := marshalNoEscape(s)
+			if err != nil {
+				return body, 0
+			}
+			return raw, n
+		}
+	}
+	replaced, n := a.replace(s, unescaped)
+	if n == 0 {
+		return body, 0
+	}
+	raw, err := marshalNoEscape(replaced)
+	if err != nil {
+		return body, 0
+	}
+	return raw, n
+}
+
+// unescaped leaves replacement values as they are.
+func unescaped(s string) string { return s }
+
+// jsonEscape escapes s for use inside a JSON string literal.
+func jsonEscape(s string) string {
+	quoted, err := marshalNoEscape(s)
+	if err != nil {
+		return s
+	}
+	return string(quoted[1 : len(quoted)-1])
+}
@@ -0,0 +1,131 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	realSubscription = "72f988bf-86f1-41af-91ab-2d7cd011db47"
+	fakeSubscription = "00000000-0000-0000-0000-000000000000"
+)
+
+func writeAnonymizeFixture(t *testing.T) string {
+	dir := t.TempDir()
+	embedded := base64.StdEncoding.EncodeToString([]byte(`{"subscriptionId":"` + realSubscription + `"}`))
+	rec := &RecordingFile{
+		Entries: []Entry{
+			{
+				RequestUri:     "https://management.azure.com/subscriptions/" + strings.ToUpper(realSubscription) + "/resourceGroups?api-version=2021-04-01",
+				RequestMethod:  "GET",
+				RequestHeaders: Headers{"x-ms-client-principal": {"alice@contoso.com"}},
+				StatusCode:     200,
+				ResponseHeaders: Headers{
+					"Content-Type": {"application/json"},
+					"Location":     {"https://login.example.com/?upn=alice%40contoso.com"},
+				},
+				ResponseBody: json.RawMessage(`{"id":"/subscriptions/` + realSubscription + `/resourceGroups/rg"}`),
+			},
+			{
+				RequestUri:      "https://account.blob.core.windows.net/c/settings.json",
+				RequestMethod:   "GET",
+				StatusCode:      200,
+				ResponseHeaders: Headers{"Content-Type": {"application/octet-stream"}},
+				ResponseBody:    json.RawMessage(`"` + embedded + `"`),
+			},
+		},
+		Variables: map[string]string{"subscriptionId": realSubscription},
+	}
+	if err := rec.WriteFile(filepath.Join(dir, "TestLeaky.json")); err != nil {
+		t.Fatal(err)
+	}
+	clean := &RecordingFile{Entries: []Entry{{RequestUri: "https://example.com", RequestMethod: "GET", StatusCode: 200}}}
+	if err := clean.WriteFile(filepath.Join(dir, "TestClean.json")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+var anonymizeReplacements = map[string]string{
+	realSubscription:    fakeSubscription,
+	"alice@contoso.com": "user@example.com",
+}
+
+func TestAnonymizeRecordings(t *testing.T) {
+	dir := writeAnonymizeFixture(t)
+	report, err := AnonymizeRecordings(dir, anonymizeReplacements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || filepath.Base(report.Files[0].Path) != "TestLeaky.json" {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+	want := map[string]int{
+		"Entries[0].RequestUri":      1,
+		"Entries[0].RequestHeaders":  1,
+		"Entries[0].ResponseHeaders": 1,
+		"Entries[0].ResponseBody":    1,
+		"Entries[1].ResponseBody":    1,
+		"Variables.subscriptionId":   1,
+	}
+	for location, n := range want {
+		if report.Files[0].Changes[location] != n {
+			t.Errorf("%s: got %d changes, want %d\n%s", location, report.Files[0].Changes[location], n, report)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "TestLeaky.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.ToLower(string(data)); strings.Contains(s, realSubscription) || strings.Contains(s, "alice") {
+		t.Fatalf("recording still contains real values:\n%s", data)
+	}
+	if !strings.Contains(string(data), "upn=user%40example.com") {
+		t.Errorf("URL-encoded occurrence not replaced:\n%s", data)
+	}
+
+	rec, err := ReadRecordingFile(filepath.Join(dir, "TestLeaky.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := string(bodyBytes(rec.Entries[1].ResponseBody, rec.Entries[1].ResponseHeaders))
+	if decoded != `{"subscriptionId":"`+fakeSubscription+`"}` {
+		t.Errorf("base64 body decoded to %s", decoded)
+	}
+}
+
+func TestAnonymizeRecordingsDryRun(t *testing.T) {
+	dir := writeAnonymizeFixture(t)
+	before, err := os.ReadFile(filepath.Join(dir, "TestLeaky.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := AnonymizeRecordingsWithOptions(dir, anonymizeReplacements, AnonymizeOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || report.Files[0].Total() != 6 {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+	if !strings.Contains(report.String(), "would replace 6 occurrences") {
+		t.Errorf("dry run report does not say what would change:\n%s", report)
+	}
+
+	after, err := os.ReadFile(filepath.Join(dir, "TestLeaky.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatal("dry run rewrote the recording")
+	}
+}
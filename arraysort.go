@@ -0,0 +1,198 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// arraySort sorts the arrays at path in JSON bodies by the key of their
+// items; see AddArraySortNormalizer.
+type arraySort struct {
+	path    []string
+	sortKey string
+}
+
+// AddArraySortNormalizer sorts the arrays at jsonPath in JSON response
+// bodies by the value of sortKey in their items, compared as strings, so
+// list APIs that return items in a varying order give the same order in
+// record and playback, and across re-recordings. Items without sortKey are
+// placed last in their original order.
+//
+// jsonPath is a dot-separated list of property names from the root of the
+// body, optionally starting with "$"; a name followed by "[*]" applies the
+// rest of the path to every item of the array it names, as in
+// "$.value[*].tags". "$" alone is the body itself.
+//
+// Responses are sorted by transports created with tpv.Transport, and the
+// recording when StopTestProxy saves it.
+func AddArraySortNormalizer(tpv *TestProxyVariables, jsonPath string, sortKey string) error {
+	if sortKey == "" {
+		return fmt.Errorf("array sort normalizer for %q: the sort key is empty", jsonPath)
+	}
+	path, err := parseSortPath(jsonPath)
+	if err != nil {
+		return err
+	}
+	tpv.arraySorts = append(tpv.arraySorts, arraySort{path: path, sortKey: sortKey})
+	return nil
+}
+
+func parseSortPath(jsonPath string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(jsonPath, "$"), ".")
+	if trimmed == "" {
+		if jsonPath != "$" {
+			return nil, fmt.Errorf("invalid JSON path %q", jsonPath)
+		}
+		return nil, nil
+	}
+	path := strings.Split(trimmed, ".")
+	for _, name := range path {
+		if name = strings.TrimSuffix(name, "[*]"); name == "" || strings.ContainsAny(name, "[]*") {
+			return nil, fmt.Errorf("invalid JSON path %q", jsonPath)
+		}
+	}
+	return path, nil
+}
+
+// apply sorts the arrays of the decoded body v, reporting whether their
+// order changed.
+func (s arraySort) apply(v interface{}, path []string) bool {
+	if len(path) == 0 {
+		items, ok := v.([]interface{})
+		return ok && s.sortItems(items)
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	name, each := strings.CutSuffix(path[0], "[*]")
+	child, ok := obj[name]
+	if !ok {
+		return false
+	}
+	if !each {
+		return s.apply(child, path[1:])
+	}
+	items, _ := child.([]interface{})
+	changed := false
+	for _, item := range items {
+		if s.apply(item, path[1:]) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (s arraySort) sortItems(items []interface{}) bool {
+	key := func(item interface{}) (string, bool) {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		switch v := obj[s.sortKey].(type) {
+		case string:
+			return v, true
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return fmt.Sprint(v), true
+		}
+		return "", false
+	}
+	less := func(i, j int) bool {
+		ki, iok := key(items[i])
+		kj, jok := key(items[j])
+		if iok && jok {
+			return ki < kj
+		}
+		return iok && !jok
+	}
+	if sort.SliceIsSorted(items, less) {
+		return false
+	}
+	sort.SliceStable(items, less)
+	return true
+}
+
+// sortJSONArrays applies the normalizers of tpv to a JSON body, returning
+// it re-encoded when they changed it.
+func (tpv *TestProxyVariables) sortJSONArrays(body []byte) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, false
+	}
+	changed := false
+	for _, s := range tpv.arraySorts {
+		if s.apply(v, s.path) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	sorted, err := marshalNoEscape(v)
+	return sorted, err == nil
+}
+
+// sortResponseArrays sorts the arrays of a JSON response body. It is called
+// by TestProxyTransport.Do.
+func (tpv *TestProxyVariables) sortResponseArrays(resp *http.Response) error {
+	if len(tpv.arraySorts) == 0 || resp.Body == nil {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if sorted, ok := tpv.sortJSONArrays(body); ok {
+		body = sorted
+		resp.ContentLength = int64(len(body))
+		resp.Header.Del("Content-Length")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// sortRecordingArrays sorts the arrays of the JSON response bodies of the
+// saved recording. It is called by StopTestProxy in record mode.
+func (tpv *TestProxyVariables) sortRecordingArrays() error {
+	if len(tpv.arraySorts) == 0 {
+		return nil
+	}
+	rf, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i, e := range rf.Entries {
+		// Text and binary bodies are stored as strings.
+		if trimmed := bytes.TrimSpace(e.ResponseBody); len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+			continue
+		}
+		if sorted, ok := tpv.sortJSONArrays(e.ResponseBody); ok {
+			rf.Entries[i].ResponseBody = sorted
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return rf.WriteFile(tpv.CurrentRecordingPath)
+}
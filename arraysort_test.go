@@ -0,0 +1,100 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArraySortNormalizer(t *testing.T) {
+	tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: "playback"}
+	if err := AddArraySortNormalizer(tpv, "$.value", "RowKey"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddArraySortNormalizer(tpv, "value[*].tags", "name"); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"", "$.", "value..tags", "value[0]"} {
+		if err := AddArraySortNormalizer(tpv, path, "name"); err == nil {
+			t.Errorf("path %q was accepted", path)
+		}
+	}
+	if err := AddArraySortNormalizer(tpv, "$", ""); err == nil {
+		t.Error("an empty sort key was accepted")
+	}
+
+	body := `{"value":[{"RowKey":"c","tags":[{"name":"y"},{"name":"x"}]},{"other":1},{"RowKey":"a","n":1.50},{"RowKey":"b"}]}`
+	tpt := tpv.Transport(transporterFunc(func(req *http.Request) (*http.Response, error) {
+		contentType := "application/json; odata=minimalmetadata"
+		if strings.HasSuffix(req.URL.Path, "/text") {
+			contentType = "text/plain"
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {contentType}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}, nil
+	}))
+	get := func(url string) string {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		got, _ := io.ReadAll(resp.Body)
+		if resp.ContentLength != int64(len(got)) {
+			t.Errorf("got content length %d for a body of %d bytes", resp.ContentLength, len(got))
+		}
+		return string(got)
+	}
+	want := `{"value":[{"RowKey":"a","n":1.50},{"RowKey":"b"},{"RowKey":"c","tags":[{"name":"x"},{"name":"y"}]},{"other":1}]}`
+	if got := get("https://account.table.core.windows.net/Tables('t')"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := get("https://account.table.core.windows.net/text"); got != body {
+		t.Errorf("sorted a text body: %s", got)
+	}
+}
+
+func TestArraySortNormalizerRecording(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestArraySort.json")
+	if err := AddArraySortNormalizer(tpv, "$", "id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	// The stub proxy does not write recordings.
+	recording := `{"Entries":[{"RequestUri":"https://example.com/items","RequestMethod":"GET","StatusCode":200,` +
+		`"ResponseBody":[{"id":"2"},{"id":"1"}]},{"RequestUri":"https://example.com/text","RequestMethod":"GET","StatusCode":200,"ResponseBody":"[b, a]"}]}`
+	if err := os.WriteFile(tpv.CurrentRecordingPath, []byte(recording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := compactJSON(t, rf.Entries[0].ResponseBody); got != `[{"id":"1"},{"id":"2"}]` {
+		t.Errorf("got recorded body %s", got)
+	}
+	if got := string(rf.Entries[1].ResponseBody); got != `"[b, a]"` {
+		t.Errorf("got recorded text body %s", got)
+	}
+}
@@ -0,0 +1,169 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// transcriptBodyLimit is the number of bytes of a body the transcript
+// shows.
+const transcriptBodyLimit = 1024
+
+// transcriptRedactedResponseHeaders are redacted in transcripts, in
+// addition to the transport's RedactRequestHeaders.
+var transcriptRedactedResponseHeaders = []string{"Set-Cookie"}
+
+// transcriptState is the transcript file of the session's exchanges.
+type transcriptState struct {
+	mu      sync.Mutex
+	f       *os.File
+	err     error
+	entries int
+}
+
+// TranscriptPath returns where the transcript of the session is written
+// when ArtifactDir is set: <ArtifactDir>/<test name>/transcript.http, the
+// test name being the recording's path below its recordings directory.
+func (tpv *TestProxyVariables) TranscriptPath() string {
+	path := filepath.ToSlash(tpv.CurrentRecordingPath)
+	if i := strings.LastIndex(path, "/recordings/"); i >= 0 {
+		path = path[i+len("/recordings/"):]
+	} else {
+		path = filepath.Base(path)
+	}
+	name := strings.TrimSuffix(path, filepath.Ext(path))
+	return filepath.Join(tpv.ArtifactDir, filepath.FromSlash(name), "transcript.http")
+}
+
+// writeTranscript appends an exchange to the session's transcript,
+// creating the file for the first exchange of the session. Each exchange
+// is written at once, so the transcript of a crashed test is complete up
+// to its last answered request. It is called by TestProxyTransport.Do with
+// the request the observers see, its original URI and body.
+func (tpt *TestProxyTransport) writeTranscript(req *http.Request, uri string, body []byte, resp *http.Response, respErr error) {
+	tpv := tpt.variables
+	if tpv == nil || tpv.ArtifactDir == "" {
+		return
+	}
+
+	var b bytes.Buffer
+	redacted := tpt.RedactRequestHeaders
+	if redacted == nil {
+		redacted = DefaultRedactedRequestHeaders
+	}
+	fmt.Fprintf(&b, "%s %s\n", req.Method, uri)
+	writeTranscriptHeaders(&b, req.Header, redacted)
+	writeTranscriptBody(&b, req.Header.Get("Content-Type"), body, int64(len(body)))
+	switch {
+	case respErr != nil:
+		fmt.Fprintf(&b, "# no response: %v\n", respErr)
+	default:
+		fmt.Fprintf(&b, "# %s %s\n", resp.Proto, resp.Status)
+		writeTranscriptHeaders(&b, resp.Header, transcriptRedactedResponseHeaders)
+		// Only the start of the response body is read, and put back.
+		peeked, err := io.ReadAll(io.LimitReader(resp.Body, transcriptBodyLimit+1))
+		resp.Body = teeReadCloser{io.MultiReader(bytes.NewReader(peeked), resp.Body), resp.Body}
+		if err != nil {
+			fmt.Fprintf(&b, "# body could not be read: %v\n", err)
+		} else {
+			writeTranscriptBody(&b, resp.Header.Get("Content-Type"), peeked, resp.ContentLength)
+		}
+	}
+
+	tpv.transcript.mu.Lock()
+	defer tpv.transcript.mu.Unlock()
+	if tpv.transcript.err != nil {
+		return
+	}
+	if tpv.transcript.f == nil {
+		path := tpv.TranscriptPath()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tpv.transcript.err = err
+			tpv.warn(fmt.Errorf("writing transcript: %w", err))
+			return
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			tpv.transcript.err = err
+			tpv.warn(fmt.Errorf("writing transcript: %w", err))
+			return
+		}
+		tpv.transcript.f = f
+	}
+	tpv.transcript.entries++
+	fmt.Fprintf(tpv.transcript.f, "### %d\n%s\n", tpv.transcript.entries, b.Bytes())
+}
+
+// closeTranscript closes the transcript of the session, so the next
+// session starts a new one. It is called by StartTestProxy and
+// StopTestProxy.
+func (tpv *TestProxyVariables) closeTranscript() {
+	tpv.transcript.mu.Lock()
+	defer tpv.transcript.mu.Unlock()
+	if tpv.transcript.f != nil {
+		tpv.transcript.f.Close()
+	}
+	tpv.transcript.f, tpv.transcript.err, tpv.transcript.entries = nil, nil, 0
+}
+
+// writeTranscriptHeaders writes headers in sorted order, except those the
+// proxy consumes, with the values of the redacted ones replaced.
+func writeTranscriptHeaders(b *bytes.Buffer, headers http.Header, redacted []string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if !strings.HasPrefix(strings.ToLower(name), "x-recording-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			for _, r := range redacted {
+				if strings.EqualFold(name, r) {
+					value = RedactedHeaderValue
+				}
+			}
+			fmt.Fprintf(b, "%s: %s\n", name, value)
+		}
+	}
+}
+
+// writeTranscriptBody writes the first transcriptBodyLimit bytes of a text
+// body, whose full size is size, or -1 when unknown. Binary bodies are
+// only noted.
+func writeTranscriptBody(b *bytes.Buffer, contentType string, body []byte, size int64) {
+	if len(body) == 0 {
+		return
+	}
+	b.WriteByte('\n')
+	if contentType != "" && !isTextContentType(contentType) {
+		if size < 0 {
+			fmt.Fprintf(b, "# %s body\n", contentType)
+		} else {
+			fmt.Fprintf(b, "# %s body, %d bytes\n", contentType, size)
+		}
+		return
+	}
+	if len(body) <= transcriptBodyLimit {
+		b.Write(body)
+		b.WriteByte('\n')
+		return
+	}
+	b.Write(body[:transcriptBodyLimit])
+	if size >= 0 {
+		fmt.Fprintf(b, "\n# ... body truncated, %d bytes in total\n", size)
+	} else {
+		b.WriteString("\n# ... body truncated\n")
+	}
+}
@@ -0,0 +1,83 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactTranscript(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/Tables" {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret-cookie")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"TableName":"products","padding":"`+strings.Repeat("x", 2000)+`"}`)
+		return true
+	}
+	t.Setenv("TESTPROXY_ARTIFACTS", t.TempDir())
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "recordings", "TestTables", "create.json")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "https://account.table.core.windows.net/Tables", strings.NewReader(`{"TableName":"products"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "SharedKey account:secret-signature")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tpv.Transport(sp.Client()).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != len(`{"TableName":"products","padding":""}`)+2000 {
+		t.Errorf("the caller read %d bytes of the response", len(body))
+	}
+
+	// The exchange is on disk before the session stops.
+	path := filepath.Join(os.Getenv("TESTPROXY_ARTIFACTS"), "TestTables", "create", "transcript.http")
+	if tpv.TranscriptPath() != path {
+		t.Errorf("TranscriptPath is %s, want %s", tpv.TranscriptPath(), path)
+	}
+	transcript, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(transcript)
+	for _, want := range []string{
+		"### 1\nPOST https://account.table.core.windows.net/Tables\nAuthorization: Sanitized\nContent-Type: application/json\n\n{\"TableName\":\"products\"}\n",
+		"# HTTP/1.1 201 Created\n",
+		"Set-Cookie: Sanitized\n",
+		"\n{\"TableName\":\"products\",\"padding\":\"xxx",
+		"\n# ... body truncated, 2037 bytes in total\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("transcript does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"secret-signature", "secret-cookie", "x-recording-"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("transcript contains %q:\n%s", secret, got)
+		}
+	}
+	if strings.Count(got, "x") > transcriptBodyLimit {
+		t.Error("the response body was not truncated")
+	}
+}
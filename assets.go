@@ -0,0 +1,148 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AssetsFile is an assets.json file, which ties the recordings of a package
+// to a tag in an external assets repository instead of storing them in the
+// package's own repository.
+type AssetsFile struct {
+	AssetsRepo           string
+	AssetsRepoPrefixPath string
+	TagPrefix            string
+	Tag                  string
+}
+
+// ReadAssetsFile loads the assets.json at path.
+func ReadAssetsFile(path string) (*AssetsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	assets := &AssetsFile{}
+	if err := json.Unmarshal(data, assets); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return assets, nil
+}
+
+// PushResult is the outcome of PushAssets.
+type PushResult struct {
+	AssetsRepo string
+	// PreviousTag is the tag assets.json referenced before the push, and
+	// Tag the one the proxy wrote back to it. They are equal when there
+	// were no changes to push.
+	PreviousTag string
+	Tag         string
+}
+
+// Changed reports whether the push created a new tag.
+func (r PushResult) Changed() bool {
+	return r.Tag != r.PreviousTag
+}
+
+// ErrActiveRecordings is returned by PushAssets while record sessions of the
+// process have not been stopped, since their recordings are not saved yet.
+var ErrActiveRecordings = errors.New("record sessions are still active")
+
+// activeRecordings holds the record sessions started and not yet stopped.
+var activeRecordings = struct {
+	mu       sync.Mutex
+	sessions map[*TestProxyVariables]bool
+}{sessions: map[*TestProxyVariables]bool{}}
+
+// setRecordingActive adds tpv to or removes it from activeRecordings.
+func (tpv *TestProxyVariables) setRecordingActive(active bool) {
+	activeRecordings.mu.Lock()
+	defer activeRecordings.mu.Unlock()
+	if active {
+		activeRecordings.sessions[tpv] = true
+	} else {
+		delete(activeRecordings.sessions, tpv)
+	}
+}
+
+// PushAssets asks the proxy to push the recordings of the assets.json at
+// path to the assets repository, as `test-proxy push` does, after
+// re-recording. The proxy commits them under a new tag and writes the tag
+// to assets.json. Failures of git or of the authentication to the
+// repository are returned with the proxy's message. PushAssets refuses to
+// push, with ErrActiveRecordings, while record sessions are active.
+func (tpv *TestProxyVariables) PushAssets(ctx context.Context, path string) (PushResult, error) {
+	activeRecordings.mu.Lock()
+	var active []string
+	for session := range activeRecordings.sessions {
+		active = append(active, session.CurrentRecordingPath)
+	}
+	activeRecordings.mu.Unlock()
+	if len(active) > 0 {
+		sort.Strings(active)
+		return PushResult{}, fmt.Errorf("pushing %s: %w: %s", path, ErrActiveRecordings, strings.Join(active, ", "))
+	}
+
+	before, err := ReadAssetsFile(path)
+	if err != nil {
+		return PushResult{}, err
+	}
+	assetsFile := path
+	if tpv.PathMapping != nil {
+		if assetsFile, err = tpv.PathMapping.Map(assetsFile); err != nil {
+			return PushResult{}, err
+		}
+	}
+	marshalled, err := json.Marshal(map[string]string{"x-recording-assets-file": assetsFile})
+	if err != nil {
+		return PushResult{}, err
+	}
+	url := fmt.Sprintf("https://%v:%v/record/push", tpv.Host, tpv.Port)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(marshalled))
+	if err != nil {
+		return PushResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setClientId(req, tpv)
+
+	resp, err := tpv.HttpClient.Do(req)
+	if err != nil {
+		return PushResult{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return PushResult{}, fmt.Errorf("pushing %s: %s: %s", path, resp.Status, proxyErrorMessage(body))
+	}
+
+	after, err := ReadAssetsFile(path)
+	if err != nil {
+		return PushResult{}, err
+	}
+	if after.Tag == "" {
+		return PushResult{}, fmt.Errorf("pushing %s: the proxy did not write a tag", path)
+	}
+	return PushResult{AssetsRepo: after.AssetsRepo, PreviousTag: before.Tag, Tag: after.Tag}, nil
+}
+
+// proxyErrorMessage extracts the message of an error the proxy answered
+// with, which is JSON with a Message field, or plain text.
+func proxyErrorMessage(body []byte) string {
+	var proxyErr struct{ Message string }
+	if json.Unmarshal(body, &proxyErr) == nil && proxyErr.Message != "" {
+		return proxyErr.Message
+	}
+	return string(bytes.TrimSpace(body))
+}
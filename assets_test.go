@@ -0,0 +1,95 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPushAssets(t *testing.T) {
+	// Other tests may leave record sessions running.
+	activeRecordings.mu.Lock()
+	saved := activeRecordings.sessions
+	activeRecordings.sessions = map[*TestProxyVariables]bool{}
+	activeRecordings.mu.Unlock()
+	t.Cleanup(func() {
+		activeRecordings.mu.Lock()
+		activeRecordings.sessions = saved
+		activeRecordings.mu.Unlock()
+	})
+
+	path := filepath.Join(t.TempDir(), "assets.json")
+	if err := os.WriteFile(path, []byte(`{
+  "AssetsRepo": "Azure/azure-sdk-assets",
+  "AssetsRepoPrefixPath": "go",
+  "TagPrefix": "go/data/aztables",
+  "Tag": "go/data/aztables_1a2b3c4d5e"
+}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sp := newStubProxy(t)
+	failure := ""
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/record/push" {
+			return false
+		}
+		if failure != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, failure)
+			return true
+		}
+		// The stub has already read the body.
+		requests := sp.Requests()
+		var payload map[string]string
+		if err := json.Unmarshal(requests[len(requests)-1].Body, &payload); err != nil || payload["x-recording-assets-file"] != path {
+			t.Errorf("got payload %v, %v", payload, err)
+		}
+		assets, err := ReadAssetsFile(path)
+		if err != nil {
+			t.Error(err)
+		}
+		assets.Tag = "go/data/aztables_9f8e7d6c5b"
+		data, _ := json.MarshalIndent(assets, "", "  ")
+		os.WriteFile(path, data, 0o644)
+		return true
+	}
+	tpv := sp.variables(t, "record")
+	ctx := context.Background()
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpv.PushAssets(ctx, path); !errors.Is(err, ErrActiveRecordings) || !strings.Contains(err.Error(), tpv.CurrentRecordingPath) {
+		t.Errorf("got error %v with an active recording", err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	failure = `{"Message": "Unable to push: fatal: Authentication failed for 'https://github.com/Azure/azure-sdk-assets'", "Status": "InternalServerError"}`
+	if _, err := tpv.PushAssets(ctx, path); err == nil || !strings.HasSuffix(err.Error(), "500 Internal Server Error: Unable to push: fatal: Authentication failed for 'https://github.com/Azure/azure-sdk-assets'") {
+		t.Errorf("got error %v for a failed push", err)
+	}
+
+	failure = ""
+	result, err := tpv.PushAssets(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PushResult{AssetsRepo: "Azure/azure-sdk-assets", PreviousTag: "go/data/aztables_1a2b3c4d5e", Tag: "go/data/aztables_9f8e7d6c5b"}
+	if result != want || !result.Changed() {
+		t.Errorf("got %+v, want %+v", result, want)
+	}
+}
@@ -0,0 +1,50 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// send passes req to the inner transport under PerAttemptTimeout. uri is
+// the request's URL before it was rerouted to the proxy, for the error.
+func (tpt *TestProxyTransport) send(req *http.Request, uri string) (*http.Response, error) {
+	if tpt.PerAttemptTimeout <= 0 {
+		return tpt.transport.Do(req)
+	}
+
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, tpt.PerAttemptTimeout)
+	resp, err := tpt.transport.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+			return nil, fmt.Errorf("test proxy did not answer %s %s within %v (recording ID %q): %w",
+				req.Method, uri, tpt.PerAttemptTimeout, tpt.recordingId, err)
+		}
+		return nil, err
+	}
+	// The deadline also covers reading the body, so the context is only
+	// released once the caller is done with it.
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context when its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
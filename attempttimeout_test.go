@@ -0,0 +1,89 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPerAttemptTimeout(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+			io.WriteString(w, "slow")
+		}
+		return true
+	}
+	tpv := sp.variables(t, "playback")
+	tpv.RecordingId = "rec-timeout"
+
+	do := func(ctx context.Context, timeout time.Duration) (string, error) {
+		tpt := tpv.Transport(sp.Client())
+		tpt.PerAttemptTimeout = timeout
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://account.table.core.windows.net/Tables", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if tpv.Transport(sp.Client()).PerAttemptTimeout != DefaultPerAttemptTimeout {
+		t.Error("transports should default to DefaultPerAttemptTimeout")
+	}
+
+	t.Run("transport deadline earlier", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		_, err := do(ctx, 20*time.Millisecond)
+		if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline error, got %v", err)
+		}
+		for _, want := range []string{"rec-timeout", "https://account.table.core.windows.net/Tables", "20ms"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not mention %s", err, want)
+			}
+		}
+	})
+
+	t.Run("caller deadline earlier", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := do(ctx, time.Minute)
+		if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline error, got %v", err)
+		}
+		if strings.Contains(err.Error(), "test proxy did not answer") {
+			t.Errorf("caller's deadline reported as the transport's: %v", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		body, err := do(context.Background(), 0)
+		if err != nil || body != "slow" {
+			t.Fatalf("got %q, %v", body, err)
+		}
+	})
+
+	t.Run("body readable after Do", func(t *testing.T) {
+		body, err := do(context.Background(), time.Minute)
+		if err != nil || body != "slow" {
+			t.Fatalf("got %q, %v", body, err)
+		}
+	})
+}
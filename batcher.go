@@ -0,0 +1,188 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+)
+
+// DefaultBatchWorkers is the number of sessions a RecordingBatcher starts
+// at once when Workers is zero.
+const DefaultBatchWorkers = 8
+
+// registeredTests are the tests added by RegisterRecordedTest, in order.
+var registeredTests = struct {
+	mu    sync.Mutex
+	names []string
+}{}
+
+// RegisterRecordedTest adds tests, by name, to the registry a
+// RecordingBatcher pre-starts by default. Call it from an init function
+// next to the tests:
+//
+//	func init() { testproxy.RegisterRecordedTest("TestCreateTable", "TestListTables") }
+func RegisterRecordedTest(names ...string) {
+	registeredTests.mu.Lock()
+	defer registeredTests.mu.Unlock()
+	registeredTests.names = append(registeredTests.names, names...)
+}
+
+// RegisteredTests returns the names added by RegisterRecordedTest.
+func RegisteredTests() []string {
+	registeredTests.mu.Lock()
+	defer registeredTests.mu.Unlock()
+	return cloneStrings(registeredTests.names)
+}
+
+// RecordingBatcher starts the playback sessions of many tests concurrently
+// before they run, so a large suite does not pay for each start round
+// trip in turn, and hands each test its session when it claims it:
+//
+//	var batcher = &testproxy.RecordingBatcher{}
+//
+//	func TestMain(m *testing.M) {
+//		batcher.Prestart(nil)
+//		code := m.Run()
+//		batcher.Close()
+//		os.Exit(code)
+//	}
+//
+//	func TestCreateTable(t *testing.T) {
+//		tpv := batcher.Claim(t)
+//		...
+//	}
+//
+// Record sessions are never pre-started, since the order of recorded
+// requests matters; Claim starts them when the test asks.
+type RecordingBatcher struct {
+	// Variables returns the unstarted session of the named test. It
+	// defaults to NewTestProxyFromEnv with the recording at
+	// recordings/<name>.json.
+	Variables func(name string) (*TestProxyVariables, error)
+	// Workers is the number of sessions started at once; it defaults to
+	// DefaultBatchWorkers.
+	Workers int
+
+	mu       sync.Mutex
+	sessions map[string]*TestProxyVariables
+}
+
+// Prestart starts the playback sessions of the named tests, or of
+// RegisteredTests when names is nil. Tests whose session cannot be
+// started are left for Claim to start, and the first error is returned.
+func (b *RecordingBatcher) Prestart(names []string) error {
+	if names == nil {
+		names = RegisteredTests()
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				if err := b.prestart(name); err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+func (b *RecordingBatcher) prestart(name string) error {
+	tpv, err := b.variables(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if tpv.Mode != "playback" {
+		return nil
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sessions == nil {
+		b.sessions = map[string]*TestProxyVariables{}
+	}
+	if previous, ok := b.sessions[name]; ok {
+		stopTestProxy(previous, false)
+	}
+	b.sessions[name] = tpv
+	return nil
+}
+
+func (b *RecordingBatcher) variables(name string) (*TestProxyVariables, error) {
+	if b.Variables != nil {
+		return b.Variables(name)
+	}
+	return NewTestProxyFromEnv(func(tpv *TestProxyVariables) {
+		tpv.CurrentRecordingPath = path.Join(GetCurrentDirectory(), "recordings", name+".json")
+	})
+}
+
+// Claim returns t's pre-started session, or starts one if there is none,
+// and stops it when t completes, saving a recording unless t failed.
+func (b *RecordingBatcher) Claim(t testing.TB) *TestProxyVariables {
+	t.Helper()
+	b.mu.Lock()
+	tpv, ok := b.sessions[t.Name()]
+	delete(b.sessions, t.Name())
+	b.mu.Unlock()
+
+	if !ok {
+		var err error
+		if tpv, err = b.variables(t.Name()); err != nil {
+			t.Fatal(err)
+		}
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		if err := stopTestProxy(tpv, !t.Failed()); err != nil {
+			t.Errorf("stopping test proxy session %s: %v", tpv.RecordingId, err)
+		}
+	})
+	return tpv
+}
+
+// Close stops the pre-started sessions no test claimed and returns the
+// first error.
+func (b *RecordingBatcher) Close() error {
+	b.mu.Lock()
+	sessions := b.sessions
+	b.sessions = nil
+	b.mu.Unlock()
+
+	var firstErr error
+	for _, tpv := range sessions {
+		if err := stopTestProxy(tpv, false); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,133 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordingBatcher(t *testing.T) {
+	sp := newStubProxy(t)
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/playback/start" && r.URL.Path != "/record/start" {
+			return false
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		// Each session is named after its client ID.
+		name := strings.TrimPrefix(r.Header.Get("x-recording-client"), "TestRecordingBatcher/")
+		w.Header().Set("x-recording-id", name)
+		return true
+	}
+	count := func(suffix string) int {
+		n := 0
+		for _, r := range sp.Requests() {
+			if strings.HasSuffix(r.Path, suffix) {
+				n++
+			}
+		}
+		return n
+	}
+	stopped := func() []string {
+		var ids []string
+		for _, r := range sp.Requests() {
+			if strings.HasSuffix(r.Path, "/stop") {
+				ids = append(ids, r.Header.Get("x-recording-id"))
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	mode := "playback"
+	batcher := &RecordingBatcher{
+		Workers: 3,
+		Variables: func(name string) (*TestProxyVariables, error) {
+			tpv := sp.variables(t, mode)
+			tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), name+".json")
+			tpv.ClientId = name
+			return tpv, nil
+		},
+	}
+	RegisterRecordedTest("TestRecordingBatcher/claimed")
+	names := []string{"TestRecordingBatcher/claimed"}
+	for i := 0; i < 8; i++ {
+		names = append(names, "TestRecordingBatcher/unclaimed"+string(rune('a'+i)))
+	}
+	if !strings.Contains(strings.Join(RegisteredTests(), " "), "TestRecordingBatcher/claimed") {
+		t.Errorf("registered tests: %v", RegisteredTests())
+	}
+
+	start := time.Now()
+	if err := batcher.Prestart(names); err != nil {
+		t.Fatal(err)
+	}
+	if maxInFlight != 3 {
+		t.Errorf("started %d sessions at once, want 3", maxInFlight)
+	}
+	// Nine starts of 20ms each take three rounds with three workers.
+	if elapsed := time.Since(start); elapsed >= 9*20*time.Millisecond {
+		t.Errorf("pre-starting took %v", elapsed)
+	}
+
+	starts := count("/start")
+	t.Run("claimed", func(t *testing.T) {
+		tpv := batcher.Claim(t)
+		if tpv.RecordingId != "claimed" || tpv.Mode != "playback" {
+			t.Errorf("claimed session %s in %s mode", tpv.RecordingId, tpv.Mode)
+		}
+		if count("/start") != starts {
+			t.Error("claiming a pre-started session started another")
+		}
+	})
+	if got := stopped(); len(got) != 1 || got[0] != "claimed" {
+		t.Errorf("stopped %v after the claiming test", got)
+	}
+	t.Run("claimed", func(t *testing.T) {
+		// Claimed again, e.g. with -count=2, the session is started anew.
+		if tpv := batcher.Claim(t); tpv.RecordingId != "claimed#01" || count("/start") != starts+1 {
+			t.Errorf("got session %s", tpv.RecordingId)
+		}
+	})
+
+	if err := batcher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stopped(); len(got) != 10 || got[2] != "unclaimeda" || got[9] != "unclaimedh" {
+		t.Errorf("stopped %v", got)
+	}
+
+	// Record sessions are started by Claim, not beforehand.
+	mode = "record"
+	requests := len(sp.Requests())
+	if err := batcher.Prestart(names); err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.Requests()) != requests {
+		t.Error("record sessions were pre-started")
+	}
+	t.Run("claimed", func(t *testing.T) {
+		if tpv := batcher.Claim(t); tpv.Mode != "record" || tpv.RecordingId != "claimed#02" {
+			t.Errorf("got session %s in %s mode", tpv.RecordingId, tpv.Mode)
+		}
+	})
+}
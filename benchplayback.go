@@ -0,0 +1,92 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// BenchmarkPlayback plays the recording at recordingFile back through the
+// proxy of tpv b.N times, each time in a new playback session, and reports
+// the entries and response bytes per playback and the time per entry.
+// Starting and stopping the sessions is not timed. Call it from a
+// benchmark to track the cost of proxy or transport changes:
+//
+//	func BenchmarkCreateTablePlayback(b *testing.B) {
+//		tpv, _ := testproxy.NewTestProxyFromEnv()
+//		testproxy.BenchmarkPlayback(b, tpv, "recordings/TestCreateTable.json")
+//	}
+//
+// Requests are sent over a dedicated client that keeps connections alive
+// between playbacks. The recorded Accept-Encoding is not replayed, so
+// bytes/op counts response bodies as the caller reads them, decompressed.
+func BenchmarkPlayback(b *testing.B, tpv *TestProxyVariables, recordingFile string) {
+	b.Helper()
+	rec, err := ReadRecordingFile(recordingFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	playback := tpv.Clone()
+	playback.Mode = "playback"
+	playback.CurrentRecordingPath = recordingFile
+
+	var transport *http.Transport
+	if t, ok := tpv.HttpClient.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = newHttpTransport(&tls.Config{InsecureSkipVerify: true})
+	}
+	transport.DisableKeepAlives = false
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+	tpt := playback.Transport(client)
+
+	var bytes int64
+	var elapsed time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if err := StartTestProxy(playback); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		start := time.Now()
+		for j, e := range rec.Entries {
+			req, err := entryRequest(e)
+			if err != nil {
+				b.Fatalf("entry %d: %v", j, err)
+			}
+			resp, err := tpt.Do(req)
+			if err != nil {
+				b.Fatalf("entry %d: %v", j, err)
+			}
+			n, err := io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				b.Fatalf("entry %d: %v", j, err)
+			}
+			bytes += n
+		}
+		elapsed += time.Since(start)
+
+		b.StopTimer()
+		if err := StopTestProxy(playback); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+
+	entries := len(rec.Entries)
+	b.ReportMetric(float64(entries), "entries/op")
+	b.ReportMetric(float64(bytes)/float64(b.N), "bytes/op")
+	if entries > 0 {
+		b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N*entries), "ns/entry")
+	}
+}
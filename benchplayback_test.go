@@ -0,0 +1,95 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBenchmarkPlayback(t *testing.T) {
+	sp := newStubProxy(t)
+	path := filepath.Join(t.TempDir(), "TestBenchmarkPlayback.json")
+	rec := &RecordingFile{Entries: []Entry{
+		{RequestUri: "https://account.table.core.windows.net/Tables", RequestMethod: "GET"},
+		{RequestUri: "https://account.table.core.windows.net/Tables", RequestMethod: "POST", RequestHeaders: map[string][]string{"Content-Type": {"application/json"}}, RequestBody: []byte(`{"TableName":"products"}`)},
+	}}
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	tpv := sp.variables(t, "record")
+
+	result := testing.Benchmark(func(b *testing.B) {
+		BenchmarkPlayback(b, tpv, path)
+	})
+	if result.N == 0 {
+		t.Fatal("the benchmark failed")
+	}
+	if got := result.Extra["entries/op"]; got != 2 {
+		t.Errorf("entries/op = %v, want 2", got)
+	}
+	// The stub answers each entry with {"upstream":"https://account.table.core.windows.net"}.
+	if got := result.Extra["bytes/op"]; got != 2*float64(len(`{"upstream":"https://account.table.core.windows.net"}`)) {
+		t.Errorf("bytes/op = %v", got)
+	}
+	if result.Extra["ns/entry"] <= 0 {
+		t.Errorf("ns/entry = %v", result.Extra["ns/entry"])
+	}
+
+	starts := 0
+	for _, r := range sp.Requests() {
+		if r.Path == "/playback/start" {
+			starts++
+		}
+		if r.Path == "/record/start" {
+			t.Error("started a record session")
+		}
+	}
+	if starts == 0 {
+		t.Error("no playback session was started")
+	}
+	if tpv.Mode != "record" {
+		t.Errorf("tpv.Mode changed to %s", tpv.Mode)
+	}
+}
+
+func TestBenchmarkPlaybackDecodesResponses(t *testing.T) {
+	const body = `{"value":[{"TableName":"products"}]}`
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/Tables" || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			return false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, body)
+		zw.Close()
+		return true
+	}
+	path := filepath.Join(t.TempDir(), "TestBenchmarkPlaybackGzip.json")
+	rec := &RecordingFile{Entries: []Entry{
+		{RequestUri: "https://account.table.core.windows.net/Tables", RequestMethod: "GET", RequestHeaders: map[string][]string{"Accept-Encoding": {"gzip"}}},
+	}}
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	result := testing.Benchmark(func(b *testing.B) {
+		BenchmarkPlayback(b, sp.variables(t, "playback"), path)
+	})
+	if result.N == 0 {
+		t.Fatal("the benchmark failed")
+	}
+	// The recorded Accept-Encoding is not replayed, so net/http asks for
+	// gzip itself and the bytes counted are the decoded ones.
+	if got := result.Extra["bytes/op"]; got != float64(len(body)) {
+		t.Errorf("bytes/op = %v, want %d", got, len(body))
+	}
+}
@@ -0,0 +1,168 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+)
+
+// blobStorageVersion is the x-ms-version of the Blob Storage REST API used
+// by ExportToBlob and ImportFromBlob.
+const blobStorageVersion = "2021-08-06"
+
+// BlobStoreConfig locates a Blob Storage container holding recordings
+// outside the repository; see TestProxyVariables.RemoteStore.
+type BlobStoreConfig struct {
+	// ContainerURL is the container's URL, e.g.
+	// https://account.blob.core.windows.net/recordings.
+	ContainerURL string
+	Credential   azcore.TokenCredential
+	// ClientOptions configures the pipeline of the uploads and downloads.
+	ClientOptions *policy.ClientOptions
+}
+
+// ExportToBlob uploads the recording of tpv to the container as
+// <test name>.json, replacing the blob if it exists. Call it after
+// StopTestProxy, which does so when RemoteStore is set.
+func ExportToBlob(tpv *TestProxyVariables, containerURL string, credential azcore.TokenCredential) error {
+	return exportToBlob(context.Background(), tpv, BlobStoreConfig{ContainerURL: containerURL, Credential: credential})
+}
+
+// ImportFromBlob downloads the recording of tpv from the container,
+// overwriting the local file. Call it before StartTestProxy, which does so
+// when RemoteStore is set.
+func ImportFromBlob(tpv *TestProxyVariables, containerURL string, credential azcore.TokenCredential) error {
+	return importFromBlob(context.Background(), tpv, BlobStoreConfig{ContainerURL: containerURL, Credential: credential})
+}
+
+func exportToBlob(ctx context.Context, tpv *TestProxyVariables, store BlobStoreConfig) error {
+	data, err := os.ReadFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	if err := store.putBlob(ctx, store.blobURL(tpv), data); err != nil {
+		return fmt.Errorf("exporting %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	return nil
+}
+
+// putBlob uploads data as the block blob at blobURL.
+func (store BlobStoreConfig) putBlob(ctx context.Context, blobURL string, data []byte) error {
+	req, err := runtime.NewRequest(ctx, http.MethodPut, blobURL)
+	if err != nil {
+		return err
+	}
+	req.Raw().Header.Set("x-ms-blob-type", "BlockBlob")
+	if err := req.SetBody(streaming.NopCloser(bytes.NewReader(data)), "application/json"); err != nil {
+		return err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusCreated) {
+		return runtime.NewResponseError(resp)
+	}
+	return nil
+}
+
+func importFromBlob(ctx context.Context, tpv *TestProxyVariables, store BlobStoreConfig) error {
+	req, err := runtime.NewRequest(ctx, http.MethodGet, store.blobURL(tpv))
+	if err != nil {
+		return err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return fmt.Errorf("importing %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return fmt.Errorf("importing %s: %w", tpv.CurrentRecordingPath, runtime.NewResponseError(resp))
+	}
+	if err := os.MkdirAll(filepath.Dir(tpv.CurrentRecordingPath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("importing %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	return f.Close()
+}
+
+// blobURL returns the URL of the blob of tpv's recording.
+func (store BlobStoreConfig) blobURL(tpv *TestProxyVariables) string {
+	return strings.TrimSuffix(store.ContainerURL, "/") + "/" + recordingName(tpv)
+}
+
+func (store BlobStoreConfig) pipeline() runtime.Pipeline {
+	var perCall []policy.Policy
+	perCall = append(perCall, blobVersionPolicy{})
+	if store.Credential != nil {
+		perCall = append(perCall, runtime.NewBearerTokenPolicy(store.Credential, []string{"https://storage.azure.com/.default"}, nil))
+	}
+	return runtime.NewPipeline("testproxy", "v0.0.0", runtime.PipelineOptions{PerCall: perCall}, store.ClientOptions)
+}
+
+type blobVersionPolicy struct{}
+
+func (blobVersionPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set("x-ms-version", blobStorageVersion)
+	return req.Next()
+}
+
+// importRemoteRecording downloads the recording from Store or RemoteStore
+// when the session needs an existing one: in playback, and in record mode
+// with ResumeMode, where a missing recording means there is nothing to
+// resume. It is called by StartTestProxy.
+func (tpv *TestProxyVariables) importRemoteRecording() error {
+	if tpv.Mode != "playback" && !tpv.ResumeMode {
+		return nil
+	}
+	if tpv.Store != nil {
+		return tpv.loadStoredRecording()
+	}
+	if tpv.RemoteStore.ContainerURL == "" {
+		return nil
+	}
+	err := importFromBlob(context.Background(), tpv, tpv.RemoteStore)
+	var respErr *azcore.ResponseError
+	if tpv.Mode == "record" && errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// exportRemoteRecording uploads a saved recording to Store or
+// RemoteStore. It is called by StopTestProxy.
+func (tpv *TestProxyVariables) exportRemoteRecording() error {
+	if tpv.Mode != "record" {
+		return nil
+	}
+	if tpv.Store != nil {
+		return tpv.saveStoredRecording()
+	}
+	if tpv.RemoteStore.ContainerURL == "" {
+		return nil
+	}
+	return exportToBlob(context.Background(), tpv, tpv.RemoteStore)
+}
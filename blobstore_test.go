@@ -0,0 +1,126 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// stubBlobContainer serves the Put Blob, Get Blob and Get User Delegation
+// Key operations of a storage account, over HTTPS and, for SAS URLs, plain
+// HTTP.
+type stubBlobContainer struct {
+	*httptest.Server
+	Plain *httptest.Server
+	mu    sync.Mutex
+	blobs map[string]string
+}
+
+func newStubBlobContainer(t *testing.T) *stubBlobContainer {
+	c := &stubBlobContainer{blobs: map[string]string{}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") && r.Header.Get("x-ms-version") != ""
+		sas := r.Method == http.MethodGet && r.URL.Query().Get("sig") != ""
+		if !bearer && !sas {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			if r.URL.Path != "/" || r.URL.Query().Get("comp") != "userdelegationkey" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey>`+
+				`<SignedOid>oid</SignedOid><SignedTid>tid</SignedTid><SignedStart>2026-10-17T00:00:00Z</SignedStart>`+
+				`<SignedExpiry>2026-10-24T00:00:00Z</SignedExpiry><SignedService>b</SignedService>`+
+				`<SignedVersion>2021-08-06</SignedVersion><Value>c2VjcmV0</Value></UserDelegationKey>`)
+		case http.MethodPut:
+			if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			c.blobs[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			blob, ok := c.blobs[r.URL.Path]
+			if !ok {
+				w.Header().Set("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, blob)
+		}
+	})
+	c.Server = httptest.NewTLSServer(handler)
+	t.Cleanup(c.Close)
+	c.Plain = httptest.NewServer(handler)
+	t.Cleanup(c.Plain.Close)
+	return c
+}
+
+func TestRemoteStore(t *testing.T) {
+	sp := newStubProxy(t)
+	container := newStubBlobContainer(t)
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestRemoteStore.json")
+	tpv.RemoteStore = BlobStoreConfig{
+		ContainerURL:  container.URL + "/recordings/",
+		Credential:    FakeWorkloadIdentityCredential{},
+		ClientOptions: &policy.ClientOptions{Transport: container.Client()},
+	}
+
+	// Recording with ResumeMode starts over when the store has nothing.
+	tpv.ResumeMode = true
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	const recording = `{"Entries":[],"Variables":{}}`
+	// The stub proxy does not write recordings.
+	if err := os.WriteFile(tpv.CurrentRecordingPath, []byte(recording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if got := container.blobs["/recordings/TestRemoteStore.json"]; got != recording {
+		t.Fatalf("got blobs %v, want the recording uploaded", container.blobs)
+	}
+
+	playback, err := tpv.CloneWith(WithMode("playback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(playback.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(playback.CurrentRecordingPath); err != nil || string(data) != recording {
+		t.Errorf("got %q, %v, want the recording downloaded", data, err)
+	}
+
+	// Playing back a recording missing from the store fails.
+	missing, err := playback.CloneWith(WithRecordingPath(filepath.Join(t.TempDir(), "TestMissing.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(missing); err == nil || !strings.Contains(err.Error(), "BlobNotFound") {
+		t.Errorf("got %v, want the missing blob reported", err)
+	}
+}
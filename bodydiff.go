@@ -0,0 +1,181 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// BodyDiff is the semantic difference between the JSON response bodies of
+// the same entry in two recordings. Field paths use dots for object keys and
+// brackets for array indexes, e.g. "value[0].properties.sku".
+type BodyDiff struct {
+	Index         int
+	AddedFields   []string
+	RemovedFields []string
+	ChangedFields []FieldChange
+}
+
+// FieldChange is a field present in both bodies with different values.
+type FieldChange struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// Empty reports whether the bodies were semantically equal.
+func (bd BodyDiff) Empty() bool {
+	return len(bd.AddedFields) == 0 && len(bd.RemovedFields) == 0 && len(bd.ChangedFields) == 0
+}
+
+// DiffEntryBodies compares the response bodies of entry index in fileA and
+// fileB, for spotting schema changes when upgrading an SDK or API version.
+// Key order and whitespace are ignored. Fields only in fileB are reported as
+// added and fields only in fileA as removed.
+func DiffEntryBodies(fileA, fileB string, index int) (BodyDiff, error) {
+	a, err := ReadRecordingFile(fileA)
+	if err != nil {
+		return BodyDiff{}, err
+	}
+	b, err := ReadRecordingFile(fileB)
+	if err != nil {
+		return BodyDiff{}, err
+	}
+	if index < 0 || index >= len(a.Entries) || index >= len(b.Entries) {
+		return BodyDiff{}, fmt.Errorf("entry %d is out of range (%s has %d entries, %s has %d)",
+			index, fileA, len(a.Entries), fileB, len(b.Entries))
+	}
+	return diffEntryBodies(a.Entries[index], b.Entries[index], index)
+}
+
+// DiffAllEntries compares the response bodies of every entry the two
+// recordings have in common, in order.
+func DiffAllEntries(fileA, fileB string) ([]BodyDiff, error) {
+	a, err := ReadRecordingFile(fileA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ReadRecordingFile(fileB)
+	if err != nil {
+		return nil, err
+	}
+	n := len(a.Entries)
+	if len(b.Entries) < n {
+		n = len(b.Entries)
+	}
+	diffs := make([]BodyDiff, 0, n)
+	for i := 0; i < n; i++ {
+		diff, err := diffEntryBodies(a.Entries[i], b.Entries[i], i)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+func diffEntryBodies(a, b Entry, index int) (BodyDiff, error) {
+	va, err := decodeBody(a.ResponseBody)
+	if err != nil {
+		return BodyDiff{}, fmt.Errorf("entry %d: %w", index, err)
+	}
+	vb, err := decodeBody(b.ResponseBody)
+	if err != nil {
+		return BodyDiff{}, fmt.Errorf("entry %d: %w", index, err)
+	}
+	diff := BodyDiff{Index: index}
+	diffValues("", va, vb, &diff)
+	return diff, nil
+}
+
+// decodeBody parses a recorded body. Bodies the proxy stored as strings are
+// parsed as JSON when possible, so JSON saved as text compares semantically.
+func decodeBody(raw json.RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if s, ok := v.(string); ok {
+		var parsed interface{}
+		dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+		dec.UseNumber()
+		if dec.Decode(&parsed) == nil {
+			return parsed, nil
+		}
+	}
+	return v, nil
+}
+
+func diffValues(path string, a, b interface{}, diff *BodyDiff) {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(a)+len(b))
+			for k := range a {
+				keys = append(keys, k)
+			}
+			for k := range b {
+				if _, ok := a[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := k
+				if path != "" {
+					child = path + "." + k
+				}
+				va, inA := a[k]
+				vb, inB := b[k]
+				switch {
+				case !inA:
+					diff.AddedFields = append(diff.AddedFields, child)
+				case !inB:
+					diff.RemovedFields = append(diff.RemovedFields, child)
+				default:
+					diffValues(child, va, vb, diff)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok {
+			for i := 0; i < len(a) || i < len(b); i++ {
+				child := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(a):
+					diff.AddedFields = append(diff.AddedFields, child)
+				case i >= len(b):
+					diff.RemovedFields = append(diff.RemovedFields, child)
+				default:
+					diffValues(child, a[i], b[i], diff)
+				}
+			}
+			return
+		}
+	case json.Number:
+		// Compare numbers by value, so 1.0 and 1 are equal.
+		if b, ok := b.(json.Number); ok {
+			fa, errA := a.Float64()
+			fb, errB := b.Float64()
+			if errA == nil && errB == nil && fa == fb {
+				return
+			}
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		diff.ChangedFields = append(diff.ChangedFields, FieldChange{Path: path, Old: a, New: b})
+	}
+}
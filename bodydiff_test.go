@@ -0,0 +1,74 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffEntryBodies(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, bodies ...string) string {
+		rec := &RecordingFile{}
+		for _, body := range bodies {
+			rec.Entries = append(rec.Entries, Entry{
+				RequestUri:      "https://example.com/items",
+				RequestMethod:   "GET",
+				StatusCode:      200,
+				ResponseHeaders: Headers{"Content-Type": {"application/json"}},
+				ResponseBody:    json.RawMessage(body),
+			})
+		}
+		path := filepath.Join(dir, name)
+		if err := rec.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	old := write("v1.json",
+		`{"name": "a", "count": 1.0, "sku": {"tier": "Standard"}, "tags": ["x"], "legacy": true}`,
+		`{"value": [1, 2]}`,
+	)
+	// Same content as v1 for the first entry, with different key order and
+	// whitespace, plus the schema changes being looked for.
+	upgraded := write("v2.json",
+		`{"tags":["x","y"],"sku":{"tier":"Premium","capacity":2},"count":1,"name":"a"}`,
+		`"{\"value\": [1, 2]}"`,
+	)
+
+	diff, err := DiffEntryBodies(old, upgraded, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BodyDiff{
+		Index:         0,
+		AddedFields:   []string{"sku.capacity", "tags[1]"},
+		RemovedFields: []string{"legacy"},
+		ChangedFields: []FieldChange{{Path: "sku.tier", Old: "Standard", New: "Premium"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("got %+v\nwant %+v", diff, want)
+	}
+
+	diffs, err := DiffAllEntries(old, upgraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Empty() || !diffs[1].Empty() {
+		t.Fatalf("DiffAllEntries: %+v", diffs)
+	}
+
+	if _, err := DiffEntryBodies(old, upgraded, 2); err == nil {
+		t.Fatal("expected an out of range error")
+	}
+	if _, err := DiffEntryBodies(old, filepath.Join(dir, "missing.json"), 0); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error, got %v", err)
+	}
+}
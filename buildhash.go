@@ -0,0 +1,123 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// buildHash returns the first 8 hex characters of the SHA-256 hash of the
+// running binary's module sum. Test binaries built from a working tree have
+// no module sum, so the binary itself is hashed instead.
+var buildHash = sync.OnceValues(func() (string, error) {
+	h := sha256.New()
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Sum != "" {
+		io.WriteString(h, info.Main.Sum)
+	} else {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8], nil
+})
+
+// scopeRecordingPath points CurrentRecordingPath at the build-hash scoped
+// recording, <name>.<hash>.json. It is called by StartTestProxy in record
+// mode when ScopeByBuildHash is set.
+func (tpv *TestProxyVariables) scopeRecordingPath() error {
+	if tpv.unscopedRecordingPath != "" {
+		// Already scoped by a start that failed.
+		return nil
+	}
+	hash, err := buildHash()
+	if err != nil {
+		return fmt.Errorf("computing the build hash: %w", err)
+	}
+	tpv.unscopedRecordingPath = tpv.CurrentRecordingPath
+	tpv.CurrentRecordingPath = strings.TrimSuffix(tpv.CurrentRecordingPath, ".json") + "." + hash + ".json"
+	return nil
+}
+
+// unscopeRecordingPath restores the CurrentRecordingPath changed by
+// scopeRecordingPath once the session has stopped.
+func (tpv *TestProxyVariables) unscopeRecordingPath() {
+	if tpv.unscopedRecordingPath != "" {
+		tpv.CurrentRecordingPath = tpv.unscopedRecordingPath
+		tpv.unscopedRecordingPath = ""
+	}
+}
+
+var buildHashRecording = regexp.MustCompile(`^(.+)\.[0-9a-f]{8}\.json$`)
+
+// MergeBuildHashRecordings merges the recordings made with ScopeByBuildHash
+// under dir into their canonical files, replacing them, and removes the
+// scoped recordings. Run it once everyone sharing the directory has
+// stopped recording. Scoped recordings of the same test are merged oldest
+// first, with repeated requests removed.
+func MergeBuildHashRecordings(dir string) error {
+	scoped := map[string][]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if m := buildHashRecording.FindStringSubmatch(d.Name()); m != nil && !d.IsDir() {
+			canonical := filepath.Join(filepath.Dir(path), m[1]+".json")
+			scoped[canonical] = append(scoped[canonical], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	canonicals := make([]string, 0, len(scoped))
+	for canonical := range scoped {
+		canonicals = append(canonicals, canonical)
+	}
+	sort.Strings(canonicals)
+	for _, canonical := range canonicals {
+		inputs := scoped[canonical]
+		modTimes := map[string]int64{}
+		for _, input := range inputs {
+			info, err := os.Stat(input)
+			if err != nil {
+				return err
+			}
+			modTimes[input] = info.ModTime().UnixNano()
+		}
+		sort.SliceStable(inputs, func(i, j int) bool { return modTimes[inputs[i]] < modTimes[inputs[j]] })
+
+		if err := MergeRecordingsWithOptions(canonical, MergeOptions{Dedupe: true}, inputs...); err != nil {
+			return fmt.Errorf("%s: %w", canonical, err)
+		}
+		for _, input := range inputs {
+			if err := os.Remove(input); err != nil {
+				return err
+			}
+			recordingCache.Forget(input)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestScopeByBuildHash(t *testing.T) {
+	hash, err := buildHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(hash) {
+		t.Fatalf("unexpected build hash %q", hash)
+	}
+
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.ScopeByBuildHash = true
+	canonical := tpv.CurrentRecordingPath
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(sp.Requests()[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(canonical), "TestScopeByBuildHash."+hash+".json"); body["x-recording-file"] != want {
+		t.Errorf("recording to %s, want %s", body["x-recording-file"], want)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if tpv.CurrentRecordingPath != canonical {
+		t.Errorf("CurrentRecordingPath is %s after stopping, want %s", tpv.CurrentRecordingPath, canonical)
+	}
+
+	// Playback uses the canonical recording.
+	tpv = sp.variables(t, "playback")
+	tpv.ScopeByBuildHash = true
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if tpv.CurrentRecordingPath != canonical {
+		t.Errorf("playing back %s, want %s", tpv.CurrentRecordingPath, canonical)
+	}
+}
+
+func TestMergeBuildHashRecordings(t *testing.T) {
+	dir := t.TempDir()
+	entry := func(uri string) Entry {
+		return Entry{RequestUri: uri, RequestMethod: "GET", StatusCode: 200, RequestHeaders: Headers{}, ResponseHeaders: Headers{}}
+	}
+	write := func(name string, modTime time.Time, entries ...Entry) {
+		path := filepath.Join(dir, name)
+		if err := (&RecordingFile{Entries: entries}).WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("TestTables.json", now.Add(-time.Hour), entry("https://account.table.core.windows.net/old"))
+	write("TestTables.0badf00d.json", now, entry("https://account.table.core.windows.net/b"))
+	write("TestTables.12ab34cd.json", now.Add(-time.Minute), entry("https://account.table.core.windows.net/a"))
+	write("TestTables.1.json", now, entry("https://account.table.core.windows.net/rotated"))
+
+	if err := MergeBuildHashRecordings(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := ReadRecordingFile(filepath.Join(dir, "TestTables.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, e := range rec.Entries {
+		uris = append(uris, e.RequestUri)
+	}
+	if len(uris) != 2 || uris[0] != "https://account.table.core.windows.net/a" || uris[1] != "https://account.table.core.windows.net/b" {
+		t.Errorf("merged entries %v", uris)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(names) != 2 {
+		t.Errorf("files left after merging: %v", names)
+	}
+}
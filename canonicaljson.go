@@ -0,0 +1,109 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultCanonicalizeMaxBytes is the size of the largest body
+// CanonicalizeJSONBodies rewrites when CanonicalizeMaxBytes is zero.
+const DefaultCanonicalizeMaxBytes = 1 << 20
+
+// canonicalizeJSONBody rewrites a JSON request body with its object keys
+// sorted and without insignificant whitespace, when tpt is configured to.
+// Strings and numbers are kept byte for byte. Bodies that are not JSON, of
+// unknown length or larger than the cap are left untouched.
+func (tpt *TestProxyTransport) canonicalizeJSONBody(req *http.Request) error {
+	if !tpt.CanonicalizeJSONBodies || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	maxBytes := tpt.CanonicalizeMaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultCanonicalizeMaxBytes
+	}
+	if req.ContentLength < 0 || req.ContentLength > maxBytes {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	var canonical bytes.Buffer
+	if writeCanonicalJSON(&canonical, body) == nil {
+		body = canonical.Bytes()
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// writeCanonicalJSON writes the JSON value raw to buf with the keys of its
+// objects sorted.
+func writeCanonicalJSON(buf *bytes.Buffer, raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case len(raw) > 0 && raw[0] == '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := marshalNoEscape(k)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, obj[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case len(raw) > 0 && raw[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return err
+		}
+		buf.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	if !json.Valid(raw) {
+		return errors.New("invalid JSON value")
+	}
+	buf.Write(raw)
+	return nil
+}
@@ -0,0 +1,90 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeJSONBodies(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpt := tpv.Transport(sp.Client())
+	tpt.CanonicalizeJSONBodies = true
+	tpt.CanonicalizeMaxBytes = 200
+
+	send := func(contentType, body string) string {
+		t.Helper()
+		req, err := http.NewRequest("POST", "https://account.table.core.windows.net/Tables", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		// A Content-Length not matching the rewritten body fails Do.
+		requests := sp.Requests()
+		return string(requests[len(requests)-1].Body)
+	}
+
+	for _, tc := range []struct{ name, contentType, body, want string }{
+		{
+			"nested objects",
+			"application/json",
+			`{"b": {"z": 1, "a": [ {"y": true, "x": null} ]}, "a": "first"}`,
+			`{"a":"first","b":{"a":[{"x":null,"y":true}],"z":1}}`,
+		},
+		{
+			"arrays keep their order",
+			"application/json; charset=utf-8",
+			`[3, 1, {"b": 2, "a": 1}]`,
+			`[3,1,{"a":1,"b":2}]`,
+		},
+		{
+			"numbers",
+			"application/json",
+			`{"n": 1.10, "big": 12345678901234567890, "exp": 1E+400}`,
+			`{"big":12345678901234567890,"exp":1E+400,"n":1.10}`,
+		},
+		{
+			"unicode",
+			"application/merge-patch+json",
+			`{"é": "café & <b>", "a": "naïve 😀"}`,
+			`{"a":"naïve 😀","é":"café & <b>"}`,
+		},
+		{
+			"not JSON",
+			"text/plain",
+			`{"b": 1, "a": 2}`,
+			`{"b": 1, "a": 2}`,
+		},
+		{
+			"invalid JSON",
+			"application/json",
+			`{"b": 1, "a": }`,
+			`{"b": 1, "a": }`,
+		},
+		{
+			"over the size cap",
+			"application/json",
+			`{"b": "` + strings.Repeat("x", 200) + `", "a": 1}`,
+			`{"b": "` + strings.Repeat("x", 200) + `", "a": 1}`,
+		},
+	} {
+		if got := send(tc.contentType, tc.body); got != tc.want {
+			t.Errorf("%s: sent %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	tpt.CanonicalizeJSONBodies = false
+	if body := `{"b": 1, "a": 2}`; send("application/json", body) != body {
+		t.Error("canonicalized a body without CanonicalizeJSONBodies")
+	}
+}
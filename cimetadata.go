@@ -0,0 +1,62 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ciMetadataPrefix marks the recording metadata written by InjectCIMetadata.
+const ciMetadataPrefix = "ci."
+
+// ciEnvironment maps the recording metadata keys used for CI build
+// information to the environment variables GitHub Actions and Azure
+// Pipelines set them in.
+var ciEnvironment = map[string]string{
+	ciMetadataPrefix + "commit":  "GITHUB_SHA",
+	ciMetadataPrefix + "branch":  "GITHUB_REF_NAME",
+	ciMetadataPrefix + "buildId": "BUILD_BUILDID",
+}
+
+// InjectCIMetadata saves the branch, commit SHA and pipeline run ID of the
+// current CI build in the recording's metadata, which StopTestProxy writes
+// with RecordingMetadata. Values that are not set in the environment (e.g.
+// on a developer machine) are skipped, and any kept from the recording being
+// replaced are dropped so they are not mistaken for this build's.
+func InjectCIMetadata(tpv *TestProxyVariables) error {
+	if tpv.Mode != "record" {
+		return fmt.Errorf("CI metadata can only be injected while recording, mode is %q", tpv.Mode)
+	}
+	for name, env := range ciEnvironment {
+		value := os.Getenv(env)
+		if value == "" {
+			delete(tpv.RecordingMetadata, name)
+			continue
+		}
+		if tpv.RecordingMetadata == nil {
+			tpv.RecordingMetadata = map[string]string{}
+		}
+		tpv.RecordingMetadata[name] = value
+	}
+	return nil
+}
+
+// GetRecordingMetadata returns the CI build information saved with the
+// recording by InjectCIMetadata, keyed without the "ci." prefix. It is only
+// available once playback has been started.
+func GetRecordingMetadata(tpv *TestProxyVariables) (map[string]string, error) {
+	if tpv.Mode != "playback" || tpv.RecordingId == "" {
+		return nil, fmt.Errorf("recording metadata is only available after playback has started")
+	}
+	metadata := map[string]string{}
+	for name, value := range tpv.RecordingMetadata {
+		if strings.HasPrefix(name, ciMetadataPrefix) {
+			metadata[strings.TrimPrefix(name, ciMetadataPrefix)] = value
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,87 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInjectCIMetadata(t *testing.T) {
+	t.Setenv("GITHUB_SHA", "0123abcd")
+	t.Setenv("GITHUB_REF_NAME", "main")
+	t.Setenv("BUILD_BUILDID", "")
+
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestCI.json")
+	// Left over from the recording being replaced.
+	tpv.RecordingMetadata = map[string]string{"ci.buildId": "41"}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := InjectCIMetadata(tpv); err != nil {
+		t.Fatal(err)
+	}
+	// Stand in for the proxy saving the recording.
+	if err := (&RecordingFile{}).WriteFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	if stop := sp.Requests()[1]; len(stop.Body) > 0 {
+		var variables map[string]string
+		if err := json.Unmarshal(stop.Body, &variables); err != nil {
+			t.Fatal(err)
+		}
+		if len(variables) != 0 {
+			t.Errorf("CI metadata saved as variables %v", variables)
+		}
+	}
+	rf, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"ci.commit": "0123abcd", "ci.branch": "main"}
+	if got := rf.Metadata(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("saved metadata %v, want %v", got, want)
+	}
+}
+
+func TestGetRecordingMetadata(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestCI.json")
+	rf := &RecordingFile{}
+	if err := rf.SetMetadata(map[string]string{"ci.commit": "0123abcd", "ci.buildId": "42", "service": "Tables"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.WriteFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetRecordingMetadata(tpv); err == nil {
+		t.Fatal("expected an error before playback started")
+	}
+	if err := InjectCIMetadata(tpv); err == nil {
+		t.Fatal("expected an error injecting metadata in playback")
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := GetRecordingMetadata(tpv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"commit": "0123abcd", "buildId": "42"}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Fatalf("metadata %v, want %v", metadata, want)
+	}
+}
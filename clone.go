@@ -0,0 +1,134 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+// Clone returns an independent copy of tpv for reuse in another test or
+// sub-case. Maps, slices and the PathMapping are copied, so changing them
+// on the clone never affects tpv. HttpClient, Logger, the Observer
+// functions, the AccessTracker, the RemoteStore's credential, the Store and
+// the RecordingSpanExporter are shared by reference; replace them on the clone
+// to separate them. The clone starts without the internal state of tpv's
+// session: HTTP dumping is off, playback is not paused, and LastRequest,
+// LastResponse, LastN and RequestHashes are empty.
+func (tpv *TestProxyVariables) Clone() *TestProxyVariables {
+	clone := &TestProxyVariables{
+		Host:                 tpv.Host,
+		Port:                 tpv.Port,
+		Mode:                 tpv.Mode,
+		RecordingId:          tpv.RecordingId,
+		ClientId:             tpv.ClientId,
+		SkipVersionCheck:     tpv.SkipVersionCheck,
+		CurrentRecordingPath: tpv.CurrentRecordingPath,
+		CompressFormat:       tpv.CompressFormat,
+		ScopeByBuildHash:     tpv.ScopeByBuildHash,
+		LocalPlayback:        tpv.LocalPlayback,
+		ResumeMode:           tpv.ResumeMode,
+		IncrementalRecord:    tpv.IncrementalRecord,
+		RotateRecordings:     tpv.RotateRecordings,
+		MaxRotationCount:     tpv.MaxRotationCount,
+		RecordingVariant:     tpv.RecordingVariant,
+		IncludedHosts:        cloneStrings(tpv.IncludedHosts),
+		ExcludedHosts:        cloneStrings(tpv.ExcludedHosts),
+		ExcludeURIPatterns:   cloneStrings(tpv.ExcludeURIPatterns),
+		LiveFallbackURL:      tpv.LiveFallbackURL,
+		UpstreamTransport:    tpv.UpstreamTransport,
+		Matcher: Matcher{
+			IgnoreBodies:           tpv.Matcher.IgnoreBodies,
+			ExcludedHeaders:        cloneStrings(tpv.Matcher.ExcludedHeaders),
+			IgnoredHeaders:         cloneStrings(tpv.Matcher.IgnoredHeaders),
+			IgnoredQueryParameters: cloneStrings(tpv.Matcher.IgnoredQueryParameters),
+			IgnoreQueryOrdering:    tpv.Matcher.IgnoreQueryOrdering,
+		},
+		ProxyHeaders:      tpv.ProxyHeaders,
+		HttpClient:        tpv.HttpClient,
+		Variables:         cloneStringMap(tpv.Variables),
+		RecordingMetadata: cloneStringMap(tpv.RecordingMetadata),
+		FuzzyURISegments:  cloneStrings(tpv.FuzzyURISegments),
+		DumpSensitive:     tpv.DumpSensitive,
+		sanitizers:        append(tpv.sanitizers[:0:0], tpv.sanitizers...),
+		WebSocketMode:     tpv.WebSocketMode,
+		GoldenDir:         tpv.GoldenDir,
+		ArtifactDir:       tpv.ArtifactDir,
+		Logger:            tpv.Logger,
+		ExcludeRequestIDs: tpv.ExcludeRequestIDs,
+
+		MaxRecordingFileSizeBytes:      tpv.MaxRecordingFileSizeBytes,
+		MaxRecordingFileSizeErrorBytes: tpv.MaxRecordingFileSizeErrorBytes,
+		ResponseCodeOverrides:          cloneIntMap(tpv.ResponseCodeOverrides),
+		EntryHeaderOverrides:           cloneEntryHeaderOverrides(tpv.EntryHeaderOverrides),
+		ReplayLatency:                  tpv.ReplayLatency,
+		SessionTimeout:                 tpv.SessionTimeout,
+		RemoteStore:                    tpv.RemoteStore,
+		Store:                          tpv.Store,
+		RecordingSpanExporter:          tpv.RecordingSpanExporter,
+		Observer:                       tpv.Observer,
+		AccessTracker:                  tpv.AccessTracker,
+		arraySorts:                     append(tpv.arraySorts[:0:0], tpv.arraySorts...),
+		requestHooks:                   append(tpv.requestHooks[:0:0], tpv.requestHooks...),
+		excludedHeaders:                append(tpv.excludedHeaders[:0:0], tpv.excludedHeaders...),
+		createRecordingDir:             tpv.createRecordingDir,
+	}
+	if tpv.PathMapping != nil {
+		mapping := *tpv.PathMapping
+		clone.PathMapping = &mapping
+	}
+	return clone
+}
+
+// CloneWith returns a clone of tpv with opts applied, as NewTestProxy
+// applies them, so WithMode and WithRecordingPath behave the same on a
+// clone as on new TestProxyVariables:
+//
+//	playback, err := tpv.CloneWith(testproxy.WithMode("playback"))
+func (tpv *TestProxyVariables) CloneWith(opts ...TestProxyOption) (*TestProxyVariables, error) {
+	clone := tpv.Clone()
+	for _, opt := range opts {
+		opt(clone)
+	}
+	if clone.optionErr != nil {
+		return nil, clone.optionErr
+	}
+	return clone, nil
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneIntMap(m map[string]int) map[string]int {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]int, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneEntryHeaderOverrides(m map[int]map[string]string) map[int]map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[int]map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = cloneStringMap(v)
+	}
+	return clone
+}
@@ -0,0 +1,165 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	tpv := &TestProxyVariables{
+		Host:              "localhost",
+		Port:              5001,
+		Mode:              "record",
+		IncludedHosts:     []string{"*.table.core.windows.net"},
+		ExcludedHosts:     []string{"login.microsoftonline.com"},
+		Matcher:           Matcher{ExcludedHeaders: []string{"x-ms-date"}},
+		PathMapping:       &PathMapping{HostPrefix: "/src", ContainerPrefix: "/srv"},
+		HttpClient:        &http.Client{},
+		Variables:         map[string]string{"tableName": "products"},
+		RecordingMetadata: map[string]string{"owner": "storage-team"},
+		FuzzyURISegments:  []string{"operations"},
+	}
+	var dump bytes.Buffer
+	tpv.EnableHTTPDump(&dump)
+
+	clone := tpv.Clone()
+	clone.Variables["tableName"] = "orders"
+	clone.RecordingMetadata["owner"] = "someone-else"
+	clone.IncludedHosts[0] = "*.blob.core.windows.net"
+	clone.ExcludedHosts = append(clone.ExcludedHosts[:0], "management.azure.com")
+	clone.Matcher.ExcludedHeaders[0] = "Authorization"
+	clone.PathMapping.ContainerPrefix = "/other"
+	clone.FuzzyURISegments[0] = "jobs"
+	clone.DisableHTTPDump()
+
+	if tpv.Variables["tableName"] != "products" || tpv.RecordingMetadata["owner"] != "storage-team" {
+		t.Errorf("clone changed the original's maps: %v %v", tpv.Variables, tpv.RecordingMetadata)
+	}
+	if tpv.IncludedHosts[0] != "*.table.core.windows.net" || tpv.ExcludedHosts[0] != "login.microsoftonline.com" {
+		t.Errorf("clone changed the original's host lists: %v %v", tpv.IncludedHosts, tpv.ExcludedHosts)
+	}
+	if tpv.Matcher.ExcludedHeaders[0] != "x-ms-date" || tpv.PathMapping.ContainerPrefix != "/srv" || tpv.FuzzyURISegments[0] != "operations" {
+		t.Errorf("clone changed the original's matcher, path mapping or fuzzy segments")
+	}
+	if clone.HttpClient != tpv.HttpClient {
+		t.Error("clone does not share the HTTP client")
+	}
+	tpv.dump.mu.Lock()
+	enabled := tpv.dump.w != nil
+	tpv.dump.mu.Unlock()
+	if !enabled {
+		t.Error("disabling the clone's HTTP dump disabled the original's")
+	}
+}
+
+// TestCloneCopiesExportedFields guards against fields added to
+// TestProxyVariables but not to Clone.
+func TestCloneCopiesExportedFields(t *testing.T) {
+	tpv := &TestProxyVariables{}
+	v := reflect.ValueOf(tpv).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(field.Name)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(int64(i + 1))
+		case reflect.Float64:
+			f.SetFloat(float64(i + 1))
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Map:
+			m := reflect.MakeMap(f.Type())
+			key := reflect.ValueOf(field.Name)
+			if f.Type().Key().Kind() != reflect.String {
+				key = reflect.Zero(f.Type().Key())
+			}
+			m.SetMapIndex(key, reflect.Zero(f.Type().Elem()))
+			f.Set(m)
+		case reflect.Interface:
+			switch f.Type() {
+			case reflect.TypeOf((*RecordingStore)(nil)).Elem():
+				f.Set(reflect.ValueOf(memoryStore{}))
+			case reflect.TypeOf((*policy.Transporter)(nil)).Elem():
+				f.Set(reflect.ValueOf(http.DefaultClient))
+			default:
+				f.Set(reflect.ValueOf(tracetest.NewInMemoryExporter()))
+			}
+		case reflect.Ptr:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Struct:
+			// Matcher, ProxyHeaders and Observer: set their first field.
+			if first := f.Field(0); first.Kind() == reflect.Bool {
+				first.SetBool(true)
+			} else if first.Kind() == reflect.String {
+				first.SetString(field.Name)
+			} else if first.Kind() == reflect.Func {
+				first.Set(reflect.MakeFunc(first.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+			}
+		default:
+			t.Fatalf("field %s of kind %s is not covered by this test", field.Name, f.Kind())
+		}
+	}
+
+	clone := reflect.ValueOf(tpv.Clone()).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Name == "LastRequest" || field.Name == "LastResponse" || field.Name == "RequestHashes" {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			t.Fatalf("field %s was not set by this test", field.Name)
+		}
+		if clone.Field(i).IsZero() {
+			t.Errorf("Clone does not copy %s", field.Name)
+		}
+	}
+}
+
+func TestCloneWith(t *testing.T) {
+	dir := t.TempDir()
+	tpv := &TestProxyVariables{Mode: "record", CurrentRecordingPath: filepath.Join(dir, "TestA.json"), Variables: map[string]string{"k": "v"}}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "recordings", "TestB.json")
+	relative, err := filepath.Rel(wd, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The path is resolved like NewTestProxy resolves it.
+	playback, err := tpv.CloneWith(WithMode("playback"), WithRecordingPath(relative))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playback.Mode != "playback" || playback.CurrentRecordingPath != want || playback.Variables["k"] != "v" {
+		t.Errorf("unexpected clone %v", playback)
+	}
+	if tpv.Mode != "record" || tpv.CurrentRecordingPath != filepath.Join(dir, "TestA.json") {
+		t.Errorf("CloneWith changed the original %v", tpv)
+	}
+
+	// And validated like it.
+	if _, err := tpv.CloneWith(WithRecordingPath(dir)); err == nil || !strings.HasPrefix(err.Error(), "recording path: ") {
+		t.Errorf("got %v, want the directory rejected", err)
+	}
+}
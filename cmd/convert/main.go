@@ -0,0 +1,125 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command convert converts recordings between the proxy's JSON format,
+// YAML and HAR:
+//
+//	go run ./cmd/convert -from json -to yaml recordings/TestCreateTable.json
+//	go run ./cmd/convert -from har -to json -o recordings/TestImported.json < capture.har
+//	go run ./cmd/convert -from json -to yaml -dir recordings
+//
+// With -dir, every file with the -from format's extension under the
+// directory is converted to a file next to it with the -to format's
+// extension.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+func main() {
+	from := flag.String("from", "json", "format to read: json, yaml or har")
+	to := flag.String("to", "yaml", "format to write: json, yaml or har")
+	out := flag.String("o", "", "output file; defaults to stdout")
+	dir := flag.String("dir", "", "convert every recording under this directory")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: convert [flags] [file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	for _, format := range []string{*from, *to} {
+		if _, ok := testproxy.RecordingFormats[format]; !ok {
+			fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+			os.Exit(2)
+		}
+	}
+
+	if *dir != "" {
+		if err := convertDir(*dir, *from, *to); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var in io.Reader = os.Stdin
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var converted bytes.Buffer
+	if err := testproxy.ConvertRecording(in, *from, &converted, *to); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(converted.Bytes())
+		return
+	}
+	if err := os.WriteFile(*out, converted.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// convertDir converts every file under dir with the extension of the from
+// format, reporting failures and carrying on with the other files.
+func convertDir(dir, from, to string) error {
+	fromExt, toExt := testproxy.RecordingFormats[from], testproxy.RecordingFormats[to]
+	failed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != fromExt && !(from == "yaml" && ext == ".yml")) {
+			return nil
+		}
+		if err := convertFile(path, from, strings.TrimSuffix(path, filepath.Ext(path))+toExt, to); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files could not be converted", failed)
+	}
+	return nil
+}
+
+func convertFile(src, from, dst, to string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var converted bytes.Buffer
+	if err := testproxy.ConvertRecording(in, from, &converted, to); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, converted.Bytes(), 0o644)
+}
@@ -0,0 +1,69 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command gc lists the recordings under a directory that belong to no test
+// of the package, and deletes them with -delete:
+//
+//	go run ./cmd/gc -delete recordings
+//
+// The tests are listed with go test -list, or from a test binary built
+// with go test -c when -test is given. Recordings matching an -exclude
+// glob, such as -exclude 'shared/*', are kept, as are package recordings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+type globFlags []string
+
+func (g *globFlags) String() string { return strings.Join(*g, ",") }
+
+func (g *globFlags) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+func main() {
+	var exclude globFlags
+	flag.Var(&exclude, "exclude", "keep the recordings matching the `glob`; may be repeated")
+	del := flag.Bool("delete", false, "delete the recordings that belong to no test")
+	testBinary := flag.String("test", "", "list the tests of the test `binary` instead of running go test -list")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gc [flags] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	dir := "recordings"
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		dir = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	orphans, err := testproxy.GarbageCollectRecordings(*testBinary, dir, testproxy.ExcludeFromGarbageCollection(exclude...))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, path := range orphans {
+		if *del {
+			if err := os.Remove(path); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println("deleted", path)
+			continue
+		}
+		fmt.Println(path)
+	}
+}
@@ -0,0 +1,65 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command lint checks the recordings under a directory for structural
+// problems and, with -max-size, for recordings larger than a size budget.
+// Recordings over budget are reported as warnings unless -enforce-budget
+// is set:
+//
+//	go run ./cmd/lint -max-size 1048576 -enforce-budget recordings
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+func main() {
+	maxSize := flag.Int64("max-size", 0, "size budget of a recording in `bytes`; 0 disables the check")
+	enforce := flag.Bool("enforce-budget", false, "fail when a recording exceeds -max-size instead of warning")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: lint [flags] dir\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+
+	failed := false
+	issues, err := testproxy.ValidateRecordingsDir(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+		failed = true
+	}
+
+	if *maxSize > 0 {
+		report, err := testproxy.SizeReport(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		level := "warning"
+		if *enforce {
+			level = "error"
+		}
+		for _, rs := range report.OverBudget(*maxSize) {
+			fmt.Printf("%s: %s: %d bytes exceeds the budget of %d bytes\n", rs.Path, level, rs.Size, *maxSize)
+			failed = failed || *enforce
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
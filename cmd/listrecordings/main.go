@@ -0,0 +1,71 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command listrecordings lists the recordings under a directory, optionally
+// only those tagged with the given metadata:
+//
+//	go run ./cmd/listrecordings -tag service=CosmosDB -tag owner=alice@example.com recordings
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+type tagFlags map[string]string
+
+func (t tagFlags) String() string { return "" }
+
+func (t tagFlags) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("tag %q is not in the form key=value", value)
+	}
+	t[k] = v
+	return nil
+}
+
+func main() {
+	tags := tagFlags{}
+	flag.Var(tags, "tag", "only list recordings with metadata `key=value`; may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: listrecordings [flags] dir\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	infos, err := testproxy.ListRecordings(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, info := range infos {
+		if info.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", info.Path, info.Err)
+			continue
+		}
+		if !info.MatchesMetadata(tags) {
+			continue
+		}
+		keys := make([]string, 0, len(info.Metadata))
+		for k := range info.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + info.Metadata[k]
+		}
+		fmt.Printf("%s\t%d entries\t%s\n", info.TestName, info.Entries, strings.Join(pairs, " "))
+	}
+}
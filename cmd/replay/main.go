@@ -0,0 +1,83 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command replay sends the requests of a recording to the live service and
+// reports, as JSON patches, where the live responses differ from the
+// recorded ones. Requests go straight to the service; recordings are
+// sanitized, so pass credentials with -H:
+//
+//	go run ./cmd/replay -H "Authorization: Bearer $TOKEN" -tolerance 0.01 recordings/TestCreateTable.json
+//
+// The output is one JSON object per line for each drifted entry, whose
+// "patch" is an application/json-patch+json document turning the recorded
+// {"statusCode", "body"} into the live one. The exit code is 1 when any
+// entry drifted beyond the tolerance.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("header %q is not in the form 'Name: value'", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	return nil
+}
+
+func main() {
+	headers := headerFlags{}
+	flag.Var(headers, "H", "header `Name: value` to set on every request; may be repeated")
+	tolerance := flag.Float64("tolerance", 0, "accepted relative drift of numeric fields, e.g. 0.01 for 1%")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: replay [flags] recording.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rec, err := testproxy.ReadRecordingFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	results := testproxy.ReplayRecording(rec, testproxy.ReplayOptions{
+		Headers:   http.Header(headers),
+		Tolerance: *tolerance,
+	})
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	drifted := 0
+	for _, r := range results {
+		if !r.Drifted() {
+			continue
+		}
+		drifted++
+		if err := enc.Encode(r); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d entries drifted\n", drifted, len(results))
+	if drifted > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,69 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+// Command viewer renders a recording as a sequence diagram of the test's
+// calls to each service host:
+//
+//	go run ./cmd/viewer -o TestCreateTable.html recordings/TestCreateTable.json
+//	go run ./cmd/viewer -serve localhost:8080 recordings/TestCreateTable.json
+//
+// The output is an HTML page when -o ends in .html and Mermaid source
+// otherwise; without -o the Mermaid source is written to stdout. With
+// -serve, the page is served instead and the recording is re-read on
+// every request, so re-recording a test and reloading shows the new
+// diagram.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	testproxy "github.com/Alancere/test-proxy-for-golang"
+)
+
+func main() {
+	out := flag.String("o", "", "output file; .html for a page, otherwise Mermaid source")
+	serve := flag.String("serve", "", "serve the diagram as a web page on this `address`, e.g. localhost:8080")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: viewer [flags] recording.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	switch {
+	case *serve != "":
+		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			rec, err := testproxy.ReadRecordingFile(path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			testproxy.WriteSequenceDiagramHTML(w, filepath.Base(path), rec)
+		})
+		fmt.Fprintf(os.Stderr, "serving %s on http://%s/\n", path, *serve)
+		log.Fatal(http.ListenAndServe(*serve, nil))
+	case *out != "":
+		if err := testproxy.GenerateSequenceDiagram(path, *out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		rec, err := testproxy.ReadRecordingFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(testproxy.SequenceDiagram(rec))
+	}
+}
@@ -0,0 +1,207 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressionFormats are the values accepted for
+// TestProxyVariables.CompressFormat, keyed by name.
+var compressionFormats = map[string]struct {
+	ext        string
+	compress   func(src, dst string) error
+	decompress func(src, dst string) error
+	reader     func(io.Reader) (io.Reader, error)
+}{
+	"gzip":   {".gz", gzipCompress, gzipDecompress, gzipReader},
+	"brotli": {".br", brotliCompress, brotliDecompress, brotliReader},
+}
+
+// readRecordingData reads the recording at path, decompressing it when its
+// extension is that of one of the compressionFormats.
+func readRecordingData(path string) ([]byte, error) {
+	for _, format := range compressionFormats {
+		if !strings.EqualFold(filepath.Ext(path), format.ext) {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r, err := format.reader(f)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	return os.ReadFile(path)
+}
+
+// hasRecordingExt reports whether name has the extension of a recording,
+// ".json", or of a recording compressed with one of the compressionFormats.
+func hasRecordingExt(name string) bool {
+	ext := filepath.Ext(name)
+	for _, format := range compressionFormats {
+		if strings.EqualFold(ext, format.ext) {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	return strings.EqualFold(filepath.Ext(name), ".json")
+}
+
+// compressedRecordingPath returns the path of the compressed copy of the
+// session's recording, or "" when CompressFormat is empty.
+func (tpv *TestProxyVariables) compressedRecordingPath() (string, error) {
+	if tpv.CompressFormat == "" {
+		return "", nil
+	}
+	format, ok := compressionFormats[tpv.CompressFormat]
+	if !ok {
+		return "", fmt.Errorf("unknown CompressFormat %q, want \"gzip\", \"brotli\" or \"\"", tpv.CompressFormat)
+	}
+	return tpv.CurrentRecordingPath + format.ext, nil
+}
+
+// decompressRecording unpacks the compressed recording, if there is one, to
+// CurrentRecordingPath so the proxy can play it back. It is called before a
+// playback session is started.
+func (tpv *TestProxyVariables) decompressRecording() error {
+	archive, err := tpv.compressedRecordingPath()
+	if archive == "" || err != nil {
+		return err
+	}
+	if _, err := os.Stat(archive); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	// Unpacking over an uncompressed recording would lose it once the
+	// session ends and the unpacked copy is removed.
+	if _, err := os.Stat(tpv.CurrentRecordingPath); err == nil {
+		return fmt.Errorf("both %s and %s exist; remove one of them", tpv.CurrentRecordingPath, archive)
+	}
+	if err := compressionFormats[tpv.CompressFormat].decompress(archive, tpv.CurrentRecordingPath); err != nil {
+		return fmt.Errorf("decompressing %s: %w", archive, err)
+	}
+	tpv.decompressedRecording = tpv.CurrentRecordingPath
+	return nil
+}
+
+// removeDecompressedRecording removes the file unpacked by
+// decompressRecording, if any. It runs on every path that ends a playback
+// session, including a failed start.
+func (tpv *TestProxyVariables) removeDecompressedRecording() error {
+	if tpv.decompressedRecording == "" {
+		return nil
+	}
+	err := os.Remove(tpv.decompressedRecording)
+	tpv.decompressedRecording = ""
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// compressRecording replaces the recording the proxy saved at
+// CurrentRecordingPath with its compressed copy after a record session, and
+// removes the file unpacked by decompressRecording after a playback session.
+func (tpv *TestProxyVariables) compressRecording() error {
+	if tpv.decompressedRecording != "" {
+		return tpv.removeDecompressedRecording()
+	}
+	archive, err := tpv.compressedRecordingPath()
+	if archive == "" || err != nil || tpv.Mode != "record" {
+		return err
+	}
+	if err := compressionFormats[tpv.CompressFormat].compress(tpv.CurrentRecordingPath, archive); err != nil {
+		return fmt.Errorf("compressing %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	return os.Remove(tpv.CurrentRecordingPath)
+}
+
+func gzipCompress(src, dst string) error {
+	return transformFile(src, dst, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	}, nil)
+}
+
+func gzipDecompress(src, dst string) error {
+	return transformFile(src, dst, nil, gzipReader)
+}
+
+func gzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func brotliCompress(src, dst string) error {
+	return transformFile(src, dst, func(w io.Writer) (io.WriteCloser, error) {
+		return brotli.NewWriterLevel(w, brotli.BestCompression), nil
+	}, nil)
+}
+
+func brotliDecompress(src, dst string) error {
+	return transformFile(src, dst, nil, brotliReader)
+}
+
+func brotliReader(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
+
+// transformFile copies src to dst through an optional compressing writer or
+// decompressing reader. Like RecordingFile.WriteFile, it writes to a
+// temporary file and renames it into place.
+func transformFile(src, dst string, wrapWriter func(io.Writer) (io.WriteCloser, error), wrapReader func(io.Reader) (io.Reader, error)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if wrapReader != nil {
+		if r, err = wrapReader(in); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var w io.Writer = tmp
+	var zw io.WriteCloser
+	if wrapWriter != nil {
+		if zw, err = wrapWriter(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+		w = zw
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	recordingCache.Forget(dst)
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,173 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressFormatRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/listrecordings/TestValid.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"gzip", "brotli"} {
+		t.Run(format, func(t *testing.T) {
+			sp := newStubProxy(t)
+			recording := filepath.Join(t.TempDir(), "TestCompressed.json")
+
+			// The stub does not write recordings, so stand in for the proxy
+			// saving one during the record session.
+			tpv := sp.variables(t, "record")
+			tpv.CurrentRecordingPath = recording
+			tpv.CompressFormat = format
+			if err := StartTestProxy(tpv); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(recording, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := StopTestProxy(tpv); err != nil {
+				t.Fatal(err)
+			}
+			archive := recording + compressionFormats[format].ext
+			if _, err := os.Stat(archive); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(recording); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("uncompressed recording left behind: %v", err)
+			}
+
+			tpv.Mode = "playback"
+			if err := StartTestProxy(tpv); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(recording)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("decompressed recording differs:\n%s", got)
+			}
+			if err := StopTestProxy(tpv); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(recording); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("decompressed recording left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompressFormatUnknown(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.CompressFormat = "zip"
+	if err := StartTestProxy(tpv); err == nil {
+		t.Fatal("expected an error for an unknown CompressFormat")
+	}
+}
+
+// BenchmarkCompressFormats reports the compressed size of a sizeable
+// recording in each format.
+func BenchmarkCompressFormats(b *testing.B) {
+	dir := b.TempDir()
+	src := filepath.Join(dir, "recording.json")
+	rec := &RecordingFile{}
+	template, err := ReadRecordingFile("testdata/listrecordings/TestValid.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for len(rec.Entries) < 500 {
+		rec.Entries = append(rec.Entries, template.Entries...)
+	}
+	if err := rec.WriteFile(src); err != nil {
+		b.Fatal(err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for name, format := range compressionFormats {
+		b.Run(name, func(b *testing.B) {
+			dst := filepath.Join(dir, "recording.json"+format.ext)
+			for i := 0; i < b.N; i++ {
+				if err := format.compress(src, dst); err != nil {
+					b.Fatal(err)
+				}
+			}
+			compressed, err := os.Stat(dst)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(compressed.Size()), "bytes")
+			b.ReportMetric(float64(compressed.Size())/float64(info.Size()), "ratio")
+		})
+	}
+}
+
+func TestCompressFormatLeavesNoCopies(t *testing.T) {
+	dir := t.TempDir()
+	recording := filepath.Join(dir, "TestCompressed.json")
+	archive := recording + ".gz"
+	if err := gzipCompress("testdata/listrecordings/TestValid.json", archive); err != nil {
+		t.Fatal(err)
+	}
+	sp := newStubProxy(t)
+	var failMatcher bool
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if failMatcher && r.URL.Path == "/Admin/SetMatcher" {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = recording
+	tpv.CompressFormat = "gzip"
+
+	// A committed uncompressed recording is neither overwritten nor removed.
+	committed := []byte(`{"Entries": [], "Variables": {}}`)
+	if err := os.WriteFile(recording, committed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err == nil {
+		t.Fatal("started with both the compressed and the uncompressed recording")
+	}
+	if got, err := os.ReadFile(recording); err != nil || !bytes.Equal(got, committed) {
+		t.Fatalf("the uncompressed recording changed: %s, %v", got, err)
+	}
+	if err := os.Remove(recording); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unpacked copy is removed when the start fails and when the session
+	// is stopped without saving.
+	failMatcher = true
+	if err := StartTestProxy(tpv); err == nil {
+		t.Fatal("expected the start to fail")
+	}
+	if _, err := os.Stat(recording); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unpacked recording left behind by a failed start: %v", err)
+	}
+	failMatcher = false
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := stopTestProxy(tpv, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(recording); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unpacked recording left behind by a discarded session: %v", err)
+	}
+}
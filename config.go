@@ -0,0 +1,128 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// Config is what a session needs to know about its proxy: its address and
+// mode, and how to talk to it. It is usually read from the environment
+// with ConfigFromEnv, but can be built directly, so that configurations
+// for different proxies or modes can be used side by side in one test
+// binary without touching the environment.
+type Config struct {
+	Host string
+	Port int
+	// Mode is "record" or "playback".
+	Mode string
+	// CABundle is a PEM file with the CAs that signed the proxy's
+	// certificate. When set, the certificate is validated.
+	CABundle string
+	// ClientId is sent as 'x-recording-client'; see
+	// TestProxyVariables.ClientId.
+	ClientId string
+	// SkipVersionCheck turns off the MinProxyVersion check.
+	SkipVersionCheck bool
+	// ArtifactDir is where transcripts of the traffic are written; see
+	// TestProxyVariables.ArtifactDir.
+	ArtifactDir string
+}
+
+// DefaultConfig returns the Config of a proxy on localhost:5001 in record
+// mode.
+func DefaultConfig() Config {
+	return Config{Host: DefaultProxyHost, Port: DefaultProxyPort, Mode: DefaultProxyMode}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by the environment; see
+// NewTestProxyFromEnv for the variables.
+func ConfigFromEnv() (Config, error) {
+	return ConfigFromLookup(os.LookupEnv)
+}
+
+// ConfigFromLookup is ConfigFromEnv with the variables looked up by
+// lookup, e.g. the Lookup of an Environment read by LoadEnvironment.
+func ConfigFromLookup(lookup func(key string) (string, bool)) (Config, error) {
+	get := func(key string) string {
+		v, _ := lookup(key)
+		return v
+	}
+	cfg := DefaultConfig()
+	if v := get("PROXY_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil {
+			return cfg, fmt.Errorf("PROXY_URL: %w", err)
+		}
+		if u.Scheme != "https" || u.Hostname() == "" {
+			return cfg, fmt.Errorf("PROXY_URL: %q is not an https://host[:port] URL", v)
+		}
+		cfg.Host = u.Hostname()
+		if u.Port() != "" {
+			if cfg.Port, err = strconv.Atoi(u.Port()); err != nil {
+				return cfg, fmt.Errorf("PROXY_URL: %w", err)
+			}
+		}
+	}
+	if v := get("PROXY_HOST"); v != "" {
+		cfg.Host = v
+	}
+	if v := get("PROXY_PORT"); v != "" {
+		var err error
+		if cfg.Port, err = strconv.Atoi(v); err != nil {
+			return cfg, fmt.Errorf("PROXY_PORT: %q is not a port number", v)
+		}
+	}
+	if v := get("PROXY_MODE"); v != "" {
+		cfg.Mode = v
+	}
+	cfg.CABundle = get("TESTPROXY_CA_BUNDLE")
+	cfg.ClientId = get("TESTPROXY_CLIENT_ID")
+	cfg.SkipVersionCheck = get("TESTPROXY_SKIP_VERSION_CHECK") == "1"
+	cfg.ArtifactDir = get("TESTPROXY_ARTIFACTS")
+	return cfg, nil
+}
+
+// clientConfigFromEnv returns the parts of ConfigFromEnv that say how to
+// talk to the proxy, for the constructors that take the proxy's address
+// and mode from elsewhere.
+func clientConfigFromEnv() Config {
+	return Config{
+		CABundle:         os.Getenv("TESTPROXY_CA_BUNDLE"),
+		ClientId:         os.Getenv("TESTPROXY_CLIENT_ID"),
+		SkipVersionCheck: os.Getenv("TESTPROXY_SKIP_VERSION_CHECK") == "1",
+		ArtifactDir:      os.Getenv("TESTPROXY_ARTIFACTS"),
+	}
+}
+
+// httpClient returns the client for talking to the proxy, validating its
+// certificate against CABundle when that is set.
+func (cfg Config) httpClient() (*http.Client, error) {
+	if cfg.CABundle != "" {
+		return NewHttpClient(cfg.CABundle)
+	}
+	return &client, nil
+}
+
+// newVariables returns unstarted TestProxyVariables for cfg.
+func (cfg Config) newVariables() (*TestProxyVariables, error) {
+	httpClient, err := cfg.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return &TestProxyVariables{
+		Host:             cfg.Host,
+		Port:             cfg.Port,
+		Mode:             cfg.Mode,
+		HttpClient:       httpClient,
+		ClientId:         cfg.ClientId,
+		SkipVersionCheck: cfg.SkipVersionCheck,
+		ArtifactDir:      cfg.ArtifactDir,
+	}, nil
+}
@@ -0,0 +1,113 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigSideBySide(t *testing.T) {
+	environ := os.Environ()
+
+	stubs := map[string]*stubProxy{}
+	configs := map[string]Config{}
+	for _, mode := range []string{"record", "playback"} {
+		sp := newStubProxy(t)
+		host, port := sp.hostPort(t)
+		stubs[mode] = sp
+		configs[mode] = Config{Host: host, Port: port, Mode: mode, CABundle: sp.caBundle(t), ClientId: "client-" + mode}
+	}
+
+	t.Run("group", func(t *testing.T) {
+		for mode, cfg := range configs {
+			mode, cfg := mode, cfg
+			t.Run(mode, func(t *testing.T) {
+				t.Parallel()
+				tpv := StartWithConfig(t, cfg)
+				req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			})
+		}
+	})
+
+	for mode, sp := range stubs {
+		var paths []string
+		for _, r := range sp.Requests() {
+			paths = append(paths, r.Path)
+			if r.Path == "/Tables" && r.Header.Get("x-recording-mode") != mode {
+				t.Errorf("%s proxy got a %s request", mode, r.Header.Get("x-recording-mode"))
+			}
+			if strings.HasSuffix(r.Path, "/start") && r.Header.Get("x-recording-client") != "client-"+mode {
+				t.Errorf("%s proxy got client %q", mode, r.Header.Get("x-recording-client"))
+			}
+		}
+		if paths[0] != "/"+mode+"/start" || paths[len(paths)-1] != "/"+mode+"/stop" {
+			t.Errorf("%s proxy got %v", mode, paths)
+		}
+	}
+	if !reflect.DeepEqual(os.Environ(), environ) {
+		t.Error("the environment changed")
+	}
+}
+
+func TestConfigFromLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("PROXY_URL https://proxy.example.com:8443\r\nPROXY_MODE playback\nTESTPROXY_SKIP_VERSION_CHECK 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"PROXY_HOST", "PROXY_PORT", "TESTPROXY_CA_BUNDLE", "TESTPROXY_CLIENT_ID", "TESTPROXY_ARTIFACTS"} {
+		t.Setenv(name, "")
+	}
+	environ := os.Environ()
+	env, err := LoadEnvironment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(os.Environ(), environ) {
+		t.Error("LoadEnvironment changed the environment")
+	}
+	cfg, err := ConfigFromLookup(env.Lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Host: "proxy.example.com", Port: 8443, Mode: "playback", SkipVersionCheck: true}
+	if cfg != want {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+	if cfg, err := LoadConfig(path); err != nil || cfg != want {
+		t.Errorf("LoadConfig: got %+v, %v, want %+v", cfg, err, want)
+	}
+	if !reflect.DeepEqual(os.Environ(), environ) {
+		t.Error("LoadConfig changed the environment")
+	}
+
+	tpv, err := NewTestProxyFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpv.Host != "proxy.example.com" || tpv.Port != 8443 || tpv.Mode != "playback" || !tpv.SkipVersionCheck {
+		t.Errorf("got %+v", tpv)
+	}
+
+	cfg.Mode = "replay"
+	if _, err := NewTestProxyFromConfig(cfg); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := ConfigFromLookup(Environment{"PROXY_PORT": "port"}.Lookup); err == nil {
+		t.Error("expected an error for a bad PROXY_PORT")
+	}
+}
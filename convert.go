@@ -0,0 +1,68 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RecordingFormats are the formats ConvertRecording reads and writes, by
+// name, with the file extension used for each.
+var RecordingFormats = map[string]string{
+	"json": ".json",
+	"yaml": ".yaml",
+	"har":  ".har",
+}
+
+// ReadRecording reads a recording in the given format.
+func ReadRecording(r io.Reader, format string) (*RecordingFile, error) {
+	switch format {
+	case "json":
+		rec := &RecordingFile{}
+		if err := json.NewDecoder(r).Decode(rec); err != nil {
+			return nil, err
+		}
+		return rec, nil
+	case "yaml":
+		return ImportYAML(r)
+	case "har":
+		return ImportHAR(r)
+	}
+	return nil, fmt.Errorf("unknown recording format %q", format)
+}
+
+// WriteRecording writes rec in the given format. JSON is written the way
+// RecordingFile.WriteFile writes it.
+func WriteRecording(rec *RecordingFile, w io.Writer, format string) error {
+	switch format {
+	case "json":
+		indented, err := rec.marshalIndented()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(indented)
+		return err
+	case "yaml":
+		return ExportYAML(rec, w)
+	case "har":
+		return ExportHAR(rec, w)
+	}
+	return fmt.Errorf("unknown recording format %q", format)
+}
+
+// ConvertRecording reads a recording in one format and writes it in
+// another.
+func ConvertRecording(r io.Reader, from string, w io.Writer, to string) error {
+	if _, ok := RecordingFormats[to]; !ok {
+		return fmt.Errorf("unknown recording format %q", to)
+	}
+	rec, err := ReadRecording(r, from)
+	if err != nil {
+		return err
+	}
+	return WriteRecording(rec, w, to)
+}
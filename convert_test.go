@@ -0,0 +1,156 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// quickRecording generates recordings for the round-trip properties, with
+// JSON and text bodies, multi-valued headers and awkward strings.
+type quickRecording struct {
+	rec *RecordingFile
+}
+
+func (quickRecording) Generate(r *rand.Rand, size int) reflect.Value {
+	str := func() string {
+		pieces := []string{"a", "key: value", "- item", "#", "\"", "\\", "\n", "<&>", "é", "true", "null", "0x1F", " "}
+		var b strings.Builder
+		for i := r.Intn(6); i > 0; i-- {
+			b.WriteString(pieces[r.Intn(len(pieces))])
+		}
+		return b.String()
+	}
+	body := func(headers Headers) json.RawMessage {
+		switch r.Intn(4) {
+		case 0:
+			return json.RawMessage("null")
+		case 1:
+			headers["Content-Type"] = []string{"application/json"}
+			doc := map[string]interface{}{
+				"name":  str(),
+				"count": r.Intn(1 << 20),
+				"ratio": json.Number(fmt.Sprintf("%d.%02d", r.Intn(100), r.Intn(100))),
+				"tags":  []interface{}{str(), r.Intn(2) == 0, nil},
+			}
+			raw, _ := marshalNoEscape(doc)
+			return raw
+		default:
+			// HAR cannot tell an empty text body from no body, so text
+			// bodies are never empty.
+			headers["Content-Type"] = []string{"text/plain"}
+			raw, _ := marshalNoEscape("text" + str())
+			return raw
+		}
+	}
+
+	rec := &RecordingFile{Variables: map[string]string{}}
+	for i := r.Intn(size + 1); i > 0; i-- {
+		e := Entry{
+			RequestUri:      fmt.Sprintf("https://account.table.core.windows.net/Tables('t%d')?$top=%d", r.Intn(100), r.Intn(10)),
+			RequestMethod:   []string{"GET", "PUT", "POST", "DELETE"}[r.Intn(4)],
+			RequestHeaders:  Headers{"x-ms-client-request-id": {str()}},
+			StatusCode:      []int{200, 201, 204, 404, 409}[r.Intn(5)],
+			ResponseHeaders: Headers{"Vary": {str(), str()}},
+		}
+		e.RequestBody = body(e.RequestHeaders)
+		e.ResponseBody = body(e.ResponseHeaders)
+		rec.Entries = append(rec.Entries, e)
+	}
+	for i := r.Intn(3); i > 0; i-- {
+		rec.Variables[fmt.Sprintf("var%d", i)] = str()
+	}
+	return reflect.ValueOf(quickRecording{rec})
+}
+
+func convert(t *testing.T, rec *RecordingFile, via string) *RecordingFile {
+	var buf bytes.Buffer
+	if err := WriteRecording(rec, &buf, via); err != nil {
+		t.Fatal(err)
+	}
+	converted, err := ReadRecording(&buf, via)
+	if err != nil {
+		t.Fatalf("reading %s: %v\n%s", via, err, buf.String())
+	}
+	return converted
+}
+
+func TestConvertYAMLRoundTrip(t *testing.T) {
+	roundTrips := func(q quickRecording) bool {
+		want, err := q.rec.marshalIndented()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := convert(t, q.rec, "yaml").marshalIndented()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Logf("got:\n%s\nwant:\n%s", got, want)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrips, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertHARRoundTrip(t *testing.T) {
+	roundTrips := func(q quickRecording) bool {
+		got := convert(t, q.rec, "har")
+		if len(got.Entries) != len(q.rec.Entries) {
+			return false
+		}
+		for i, want := range q.rec.Entries {
+			e := got.Entries[i]
+			if e.RequestUri != want.RequestUri || e.RequestMethod != want.RequestMethod || e.StatusCode != want.StatusCode ||
+				!reflect.DeepEqual(e.RequestHeaders, want.RequestHeaders) || !reflect.DeepEqual(e.ResponseHeaders, want.ResponseHeaders) ||
+				compactJSON(t, e.RequestBody) != compactJSON(t, want.RequestBody) ||
+				compactJSON(t, e.ResponseBody) != compactJSON(t, want.ResponseBody) {
+				t.Logf("entry %d: got %+v, want %+v", i, e, want)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(roundTrips, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertRecordingKeepsMetadata(t *testing.T) {
+	var yamlDoc, jsonDoc bytes.Buffer
+	src, err := ReadRecordingFile("testdata/listrecordings/TestValid.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := src.marshalIndented()
+	if err := ConvertRecording(bytes.NewReader(want), "json", &yamlDoc, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(yamlDoc.String(), "owner: storage-team") {
+		t.Fatalf("metadata missing from YAML:\n%s", yamlDoc.String())
+	}
+	if err := ConvertRecording(&yamlDoc, "yaml", &jsonDoc, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if jsonDoc.String() != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", jsonDoc.String(), want)
+	}
+}
+
+func TestConvertRecordingUnknownFormat(t *testing.T) {
+	if err := ConvertRecording(strings.NewReader("{}"), "json", &bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"strconv"
 	"testing"
@@ -32,33 +31,36 @@ func TestCosmosDBTables(t *testing.T) {
 	//=====================================================================//
 	// Load environment variables from the local .env file
 	root := GetCurrentDirectory()
-	err := Load(filepath.Join(root, ".env"))
+	env, err := LoadEnvironment(filepath.Join(root, ".env"))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	tpv := NewTestProxyVariables(t)
-	userproxy, err := strconv.ParseBool(os.Getenv("USE_PROXY"))
+	userproxy, err := strconv.ParseBool(env.Get("USE_PROXY"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	tableOptions := &aztables.ClientOptions{}
 
 	if userproxy == true {
-		tpv.Host = os.Getenv("PROXY_HOST")
-		port, err := strconv.Atoi(os.Getenv("PROXY_PORT"))
+		cfg, err := ConfigFromLookup(env.Lookup)
 		if err != nil {
 			t.Fatal(err)
 		}
-		tpv.Port = port
-		tpv.Mode = os.Getenv("PROXY_MODE")
-		if err = StartTestProxy(tpv); err != nil {
+		tpv, err := NewTestProxyFromConfig(cfg, WithTest(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		session, err := StartSession(tpv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tableOptions.Transport, err = session.Transport(); err != nil {
 			t.Fatal(err)
 		}
-		tableOptions.Transport = NewTestProxyTransport(tpv.HttpClient, tpv.Host, tpv.Port, tpv.RecordingId, tpv.Mode)
 
 		defer func() {
-			err = StopTestProxy(tpv)
+			err = session.Stop(context.Background())
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -69,7 +71,7 @@ func TestCosmosDBTables(t *testing.T) {
 	// End of test proxy prologue. Original test code starts here. Everything after this point //
 	// represents an app interacting with the Azure Table Storage service.                     //
 	//=========================================================================================//
-	tableServiceClient, err := aztables.NewServiceClientFromConnectionString(os.Getenv("COSMOS_CONNECTION_STRING"), tableOptions)
+	tableServiceClient, err := aztables.NewServiceClientFromConnectionString(env.Get("COSMOS_CONNECTION_STRING"), tableOptions)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,116 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CurlOptions controls how RecordingEntryToCurl renders a command.
+type CurlOptions struct {
+	// IncludeSensitive keeps credential headers such as Authorization and
+	// Cookie, which are dropped by default.
+	IncludeSensitive bool
+	// BodyFile is the file referenced with --data-binary @file for binary
+	// request bodies, which cannot be passed on the command line. It
+	// defaults to "body.bin".
+	BodyFile string
+}
+
+// sensitiveHeaders are left out of generated commands unless
+// CurlOptions.IncludeSensitive is set.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"x-ms-authorization-auxiliary",
+}
+
+// RecordingEntryToCurl returns a copy-pasteable curl command that re-issues
+// the recorded request against the live service. Pseudo headers, the
+// headers curl computes itself and the test proxy's x-recording-* headers
+// are left out.
+func RecordingEntryToCurl(entry Entry, opts CurlOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "curl -X %s %s", entry.RequestMethod, shellQuote(entry.RequestUri))
+
+	names := make([]string, 0, len(entry.RequestHeaders))
+	for name := range entry.RequestHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if skipCurlHeader(name, opts) {
+			continue
+		}
+		for _, v := range entry.RequestHeaders[name] {
+			fmt.Fprintf(&b, " \\\n  -H %s", shellQuote(name+": "+v))
+		}
+	}
+
+	if text, base64, ok := bodyText(entry.RequestBody, entry.RequestHeaders); ok {
+		if base64 {
+			bodyFile := opts.BodyFile
+			if bodyFile == "" {
+				bodyFile = "body.bin"
+			}
+			fmt.Fprintf(&b, " \\\n  --data-binary %s", shellQuote("@"+bodyFile))
+		} else {
+			fmt.Fprintf(&b, " \\\n  --data-binary %s", shellQuote(text))
+		}
+	}
+
+	return b.String()
+}
+
+// ExportCurlScript writes a shell script to w with one curl command per
+// entry of rec, each preceded by a comment naming the entry and its
+// recorded status. Binary request bodies are written to entry-<N>.bin by
+// the script itself before the command that sends them.
+func ExportCurlScript(rec *RecordingFile, w io.Writer) error {
+	if _, err := io.WriteString(w, "#!/bin/sh\n"); err != nil {
+		return err
+	}
+	for i, e := range rec.Entries {
+		opts := CurlOptions{BodyFile: fmt.Sprintf("entry-%d.bin", i)}
+		var b strings.Builder
+		fmt.Fprintf(&b, "\n# Entry %d: %s %s (recorded status %d)\n", i, e.RequestMethod, e.RequestUri, e.StatusCode)
+		if text, base64, ok := bodyText(e.RequestBody, e.RequestHeaders); ok && base64 {
+			fmt.Fprintf(&b, "base64 -d > %s <<'EOF'\n%s\nEOF\n", opts.BodyFile, text)
+		}
+		b.WriteString(RecordingEntryToCurl(e, opts))
+		b.WriteString("\n")
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipCurlHeader(name string, opts CurlOptions) bool {
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, ":") || strings.HasPrefix(lower, "x-recording-") ||
+		lower == "content-length" || lower == "host" {
+		return true
+	}
+	if !opts.IncludeSensitive {
+		for _, s := range sensitiveHeaders {
+			if strings.EqualFold(s, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s for POSIX shells. Inside single quotes every
+// character is literal, including newlines, so only the single quote itself
+// needs escaping.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,110 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestRecordingEntryToCurl(t *testing.T) {
+	jsonEntry := Entry{
+		RequestUri:    "https://account.table.core.windows.net/Tables?$format=json&x=1",
+		RequestMethod: "POST",
+		RequestHeaders: Headers{
+			"Content-Type":   {"application/json"},
+			"Authorization":  {"SharedKey account:secret"},
+			"Content-Length": {"40"},
+			":authority":     {"account.table.core.windows.net"},
+			"x-recording-id": {"abc"},
+			"Accept":         {"application/json", "text/plain"},
+		},
+		RequestBody: json.RawMessage(`{"Name": "Bob's \"best\" board", "Note": "line1\nline2"}`),
+	}
+
+	got := RecordingEntryToCurl(jsonEntry, CurlOptions{})
+	want := `curl -X POST 'https://account.table.core.windows.net/Tables?$format=json&x=1' \
+  -H 'Accept: application/json' \
+  -H 'Accept: text/plain' \
+  -H 'Content-Type: application/json' \
+  --data-binary '{"Name":"Bob'\''s \"best\" board","Note":"line1\nline2"}'`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = RecordingEntryToCurl(jsonEntry, CurlOptions{IncludeSensitive: true})
+	want = `curl -X POST 'https://account.table.core.windows.net/Tables?$format=json&x=1' \
+  -H 'Accept: application/json' \
+  -H 'Accept: text/plain' \
+  -H 'Authorization: SharedKey account:secret' \
+  -H 'Content-Type: application/json' \
+  --data-binary '{"Name":"Bob'\''s \"best\" board","Note":"line1\nline2"}'`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	textEntry := Entry{
+		RequestUri:     "https://example.com/notes",
+		RequestMethod:  "PUT",
+		RequestHeaders: Headers{"Content-Type": {"text/plain"}},
+		RequestBody:    json.RawMessage(`"it's\nmultiline"`),
+	}
+	got = RecordingEntryToCurl(textEntry, CurlOptions{})
+	want = "curl -X PUT 'https://example.com/notes' \\\n  -H 'Content-Type: text/plain' \\\n  --data-binary 'it'\\''s\nmultiline'"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	binaryEntry := Entry{
+		RequestUri:     "https://account.blob.core.windows.net/c/b",
+		RequestMethod:  "PUT",
+		RequestHeaders: Headers{"Content-Type": {"application/octet-stream"}},
+		RequestBody:    json.RawMessage(`"AAECAw=="`),
+	}
+	got = RecordingEntryToCurl(binaryEntry, CurlOptions{})
+	want = "curl -X PUT 'https://account.blob.core.windows.net/c/b' \\\n  -H 'Content-Type: application/octet-stream' \\\n  --data-binary '@body.bin'"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportCurlScript(t *testing.T) {
+	rec := &RecordingFile{Entries: []Entry{
+		{
+			RequestUri:    "https://example.com/a",
+			RequestMethod: "GET",
+			StatusCode:    200,
+		},
+		{
+			RequestUri:     "https://example.com/b",
+			RequestMethod:  "PUT",
+			RequestHeaders: Headers{"Content-Type": {"application/octet-stream"}},
+			RequestBody:    json.RawMessage(`"AAECAw=="`),
+			StatusCode:     201,
+		},
+	}}
+
+	var buf bytes.Buffer
+	if err := ExportCurlScript(rec, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `#!/bin/sh
+
+# Entry 0: GET https://example.com/a (recorded status 200)
+curl -X GET 'https://example.com/a'
+
+# Entry 1: PUT https://example.com/b (recorded status 201)
+base64 -d > entry-1.bin <<'EOF'
+AAECAw==
+EOF
+curl -X PUT 'https://example.com/b' \
+  -H 'Content-Type: application/octet-stream' \
+  --data-binary '@entry-1.bin'
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
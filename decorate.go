@@ -0,0 +1,79 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// decorate applies ExtraHeaders and RequestDecorator to req, failing if
+// either touches a header reserved for the proxy.
+func (tpt *TestProxyTransport) decorate(req *http.Request) error {
+	for name, value := range tpt.ExtraHeaders {
+		if tpt.isReservedHeader(name) {
+			return fmt.Errorf("ExtraHeaders: %s is reserved for the test proxy", name)
+		}
+		req.Header.Set(name, value)
+	}
+	if tpt.RequestDecorator == nil {
+		return nil
+	}
+
+	reserved := http.Header{}
+	for name, values := range req.Header {
+		if tpt.isReservedHeader(name) {
+			reserved[name] = append([]string(nil), values...)
+		}
+	}
+	tpt.RequestDecorator(req)
+	for name, values := range req.Header {
+		if tpt.isReservedHeader(name) && !reflect.DeepEqual(values, reserved[name]) {
+			return fmt.Errorf("RequestDecorator changed %s, which is reserved for the test proxy", name)
+		}
+	}
+	for name := range reserved {
+		if _, ok := req.Header[name]; !ok {
+			return fmt.Errorf("RequestDecorator removed %s, which is reserved for the test proxy", name)
+		}
+	}
+	return nil
+}
+
+func (tpt *TestProxyTransport) isReservedHeader(name string) bool {
+	for _, reserved := range []string{tpt.headers.RecordingId, tpt.headers.RecordingMode, tpt.headers.UpstreamBaseUri} {
+		if strings.EqualFold(name, reserved) {
+			return true
+		}
+	}
+	return strings.HasPrefix(strings.ToLower(name), "x-recording-")
+}
+
+// keepGetBody gives req a GetBody matching its body when a request hook or
+// RequestDecorator replaced the body it arrived with, so that the transport
+// can still resend it, e.g. to follow a 307 redirect or when a reused
+// connection fails during the Expect: 100-continue handshake. A body that
+// was not replaced is left unread, so that the handshake still decides
+// whether it is sent.
+func keepGetBody(req *http.Request, original io.ReadCloser) error {
+	if req.Body == nil || req.Body == http.NoBody || req.Body == original {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(body))
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
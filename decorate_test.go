@@ -0,0 +1,71 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTransportExtraHeaders(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.RecordingId = "rec-1"
+
+	tpt := tpv.Transport(sp.Client())
+	tpt.ExtraHeaders = map[string]string{"x-correlation-id": "corr-1"}
+	tpt.RequestDecorator = func(req *http.Request) {
+		req.Header.Set("x-run-id", "run-"+req.Header.Get("x-correlation-id"))
+	}
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tpt.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got := sp.Requests()[0].Header
+	if got.Get("x-correlation-id") != "corr-1" || got.Get("x-run-id") != "run-corr-1" || got.Get("x-recording-id") != "rec-1" {
+		t.Errorf("unexpected headers %v", got)
+	}
+}
+
+func TestTransportReservedHeaders(t *testing.T) {
+	for name, configure := range map[string]func(tpt *TestProxyTransport){
+		"extra header": func(tpt *TestProxyTransport) {
+			tpt.ExtraHeaders = map[string]string{"X-Recording-Mode": "live"}
+		},
+		"custom proxy header": func(tpt *TestProxyTransport) {
+			tpt.headers.RecordingId = "x-gateway-id"
+			tpt.ExtraHeaders = map[string]string{"x-gateway-id": "other"}
+		},
+		"decorator change": func(tpt *TestProxyTransport) {
+			tpt.RequestDecorator = func(req *http.Request) { req.Header.Set("x-recording-id", "other") }
+		},
+		"decorator removal": func(tpt *TestProxyTransport) {
+			tpt.RequestDecorator = func(req *http.Request) { req.Header.Del("x-recording-upstream-base-uri") }
+		},
+	} {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, "record")
+		tpt := tpv.Transport(sp.Client())
+		configure(tpt)
+
+		req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpt.Do(req); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("%s: expected a reserved header error, got %v", name, err)
+		}
+		if len(sp.Requests()) != 0 {
+			t.Errorf("%s: request was sent", name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultProxyDialAttempts and DefaultProxyDialBackoff are used by
+// RetryProxyDial when ProxyDialAttempts and ProxyDialBackoff are zero.
+const (
+	DefaultProxyDialAttempts = 3
+	DefaultProxyDialBackoff  = 250 * time.Millisecond
+)
+
+// sendWithRetry sends req like sendWithFaults and, with RetryProxyDial,
+// resends it while the proxy cannot be dialed, e.g. because it is
+// restarting. Only dial errors are retried, so a request the proxy may
+// have seen is never sent twice, and only when the body can be rewound.
+// It returns the number of attempts made.
+func (tpt *TestProxyTransport) sendWithRetry(req *http.Request, uri string) (*http.Response, int, error) {
+	attempts := tpt.ProxyDialAttempts
+	if attempts <= 0 {
+		attempts = DefaultProxyDialAttempts
+	}
+	backoff := tpt.ProxyDialBackoff
+	if backoff <= 0 {
+		backoff = DefaultProxyDialBackoff
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := tpt.sendWithFaults(req, uri)
+		if err == nil || !tpt.RetryProxyDial || attempt == attempts || !isDialError(err) {
+			return resp, attempt, err
+		}
+		if !rewindBody(req) {
+			return nil, attempt, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isDialError reports whether err means no connection to the proxy could
+// be made, so the proxy cannot have received the request.
+func isDialError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// rewindBody replaces the request's body with a fresh copy from GetBody
+// and reports whether it could.
+func rewindBody(req *http.Request) bool {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	req.Body = body
+	return true
+}
@@ -0,0 +1,112 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryProxyDial(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}
+
+	// A port nothing listens on refuses connections, like a restarting
+	// proxy.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusing := l.Addr().String()
+	l.Close()
+
+	// newClient returns a client whose first refusals dials are refused.
+	newClient := func(refusals int32) (*http.Client, *int32) {
+		var dials int32
+		transport := sp.Client().Transport.(*http.Transport).Clone()
+		transport.DisableKeepAlives = true
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) <= refusals {
+				addr = refusing
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		return &http.Client{Transport: transport}, &dials
+	}
+
+	var exchanges []Exchange
+	tpv := sp.variables(t, "playback")
+	tpv.Observer.Exchange = func(e Exchange) { exchanges = append(exchanges, e) }
+	do := func(client *http.Client, retry bool, body io.Reader) (*http.Response, error) {
+		tpt := tpv.Transport(client)
+		tpt.RetryProxyDial = retry
+		tpt.ProxyDialBackoff = time.Millisecond
+		req, err := http.NewRequest("PUT", "https://account.table.core.windows.net/Tables", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tpt.Do(req)
+	}
+
+	t.Run("refuses twice then accepts", func(t *testing.T) {
+		exchanges = nil
+		client, dials := newClient(2)
+		resp, err := do(client, true, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		// An error status from the proxy is returned, not retried.
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("got status %d", resp.StatusCode)
+		}
+		requests := sp.Requests()
+		if *dials != 3 || len(requests) != 1 || string(requests[0].Body) != "payload" {
+			t.Errorf("dialed %d times and sent %+v", *dials, requests)
+		}
+		if len(exchanges) != 1 || exchanges[0].Attempts != 3 {
+			t.Errorf("observed %+v", exchanges)
+		}
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		client, dials := newClient(5)
+		if _, err := do(client, true, nil); !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Errorf("expected the refused connection, got %v", err)
+		}
+		if *dials != DefaultProxyDialAttempts {
+			t.Errorf("dialed %d times", *dials)
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		client, dials := newClient(1)
+		if _, err := do(client, false, nil); err == nil || *dials != 1 {
+			t.Errorf("got %v after %d dials", err, *dials)
+		}
+	})
+
+	t.Run("body cannot be rewound", func(t *testing.T) {
+		exchanges = nil
+		client, dials := newClient(1)
+		if _, err := do(client, true, io.MultiReader(strings.NewReader("payload"))); err == nil || *dials != 1 {
+			t.Errorf("got %v after %d dials", err, *dials)
+		}
+		if len(exchanges) != 1 || exchanges[0].Attempts != 1 {
+			t.Errorf("observed %+v", exchanges)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvVarSpec declares an environment variable the tests need. The same
+// list of specs drives RequireEnv and WriteEnvTemplate.
+type EnvVarSpec struct {
+	Name        string
+	Description string
+	// Example is a placeholder showing the expected shape of the value.
+	Example string
+	// Secret values are left blank in the template, so that filling it in
+	// never starts from a value that looks real.
+	Secret bool
+}
+
+// RequireEnv returns an error listing every variable of specs that is not
+// set.
+func RequireEnv(specs []EnvVarSpec) error {
+	var missing []string
+	for _, spec := range specs {
+		if _, ok := os.LookupEnv(spec.Name); !ok {
+			missing = append(missing, spec.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("missing environment variables: %s", strings.Join(missing, ", "))
+}
+
+// RequireEnvOrTemplate is RequireEnv for TestMain: when variables are
+// missing it also writes the template for specs to path, so a new
+// contributor gets a file to fill in:
+//
+//	func TestMain(m *testing.M) {
+//		if err := testproxy.RequireEnvOrTemplate(".env.template", envSpecs); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		os.Exit(m.Run())
+//	}
+func RequireEnvOrTemplate(path string, specs []EnvVarSpec) error {
+	err := RequireEnv(specs)
+	if err == nil {
+		return nil
+	}
+	if werr := WriteEnvTemplate(path, specs); werr != nil {
+		return fmt.Errorf("%w; writing %s: %v", err, path, werr)
+	}
+	return fmt.Errorf("%w; fill in %s", err, path)
+}
+
+// WriteEnvTemplate writes a KEY=VALUE file with an entry for each spec,
+// preceded by its description as a comment. Non-secret entries are set to
+// their example and secret ones are left blank.
+func WriteEnvTemplate(path string, specs []EnvVarSpec) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Environment variables for the recorded tests.\n")
+	for _, spec := range specs {
+		buf.WriteByte('\n')
+		for _, line := range strings.Split(spec.Description, "\n") {
+			if line != "" {
+				fmt.Fprintf(&buf, "# %s\n", line)
+			}
+		}
+		if spec.Secret {
+			if spec.Example != "" {
+				fmt.Fprintf(&buf, "# Secret, e.g. %s\n", spec.Example)
+			} else {
+				buf.WriteString("# Secret\n")
+			}
+			fmt.Fprintf(&buf, "%s=\n", spec.Name)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", spec.Name, spec.Example)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
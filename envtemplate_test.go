@@ -0,0 +1,67 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testEnvSpecs = []EnvVarSpec{
+	{Name: "TESTPROXY_ENV_ACCOUNT", Description: "Storage account for the table tests.", Example: "myaccount"},
+	{Name: "TESTPROXY_ENV_KEY", Description: "Key of the storage account.", Example: "base64 account key", Secret: true},
+	{Name: "TESTPROXY_ENV_REGION", Description: "Region to create resources in.\nDefaults are not used.", Example: "westus2"},
+}
+
+func TestWriteEnvTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env.template")
+	if err := WriteEnvTemplate(path, testEnvSpecs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# Environment variables for the recorded tests.
+
+# Storage account for the table tests.
+TESTPROXY_ENV_ACCOUNT=myaccount
+
+# Key of the storage account.
+# Secret, e.g. base64 account key
+TESTPROXY_ENV_KEY=
+
+# Region to create resources in.
+# Defaults are not used.
+TESTPROXY_ENV_REGION=westus2
+`
+	if string(got) != want {
+		t.Errorf("got template:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRequireEnvOrTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env.template")
+	t.Setenv("TESTPROXY_ENV_ACCOUNT", "myaccount")
+	err := RequireEnvOrTemplate(path, testEnvSpecs)
+	if err == nil || !strings.Contains(err.Error(), "TESTPROXY_ENV_KEY, TESTPROXY_ENV_REGION") {
+		t.Fatalf("got error %v, want the missing variables", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("template not written: %v", err)
+	}
+
+	t.Setenv("TESTPROXY_ENV_KEY", "")
+	t.Setenv("TESTPROXY_ENV_REGION", "westus2")
+	path = filepath.Join(t.TempDir(), ".env.template")
+	if err := RequireEnvOrTemplate(path, testEnvSpecs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("template written although every variable is set")
+	}
+}
@@ -0,0 +1,185 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EntryMatcher selects the requests a Fault applies to: those with Method,
+// compared case-insensitively, and a URL matching the regular expression
+// URIPattern. Empty fields match every request.
+type EntryMatcher struct {
+	Method     string
+	URIPattern string
+}
+
+// FaultKind is the failure a Fault simulates.
+type FaultKind int
+
+const (
+	// FaultStatus answers with StatusCode and an empty body, without
+	// sending the request to the proxy.
+	FaultStatus FaultKind = iota
+	// FaultConnectionReset fails the request with ECONNRESET, without
+	// sending it to the proxy.
+	FaultConnectionReset
+	// FaultTruncatedBody returns the played back response with its body
+	// cut after TruncateAt bytes, failing with io.ErrUnexpectedEOF.
+	FaultTruncatedBody
+)
+
+// Fault is a failure InjectFault makes playback return instead of the
+// recorded response.
+type Fault struct {
+	Kind FaultKind
+	// StatusCode and RetryAfter, which sets the Retry-After header in
+	// whole seconds when positive, are used by FaultStatus.
+	StatusCode int
+	RetryAfter time.Duration
+	// TruncateAt is the number of body bytes FaultTruncatedBody keeps.
+	TruncateAt int
+	// Times limits the fault to the first Times matching requests, e.g. 1
+	// for a 503 followed by the recorded success. Zero applies it to every
+	// matching request.
+	Times int
+}
+
+// injectedFault is a Fault registered with InjectFault.
+type injectedFault struct {
+	method  string
+	pattern *regexp.Regexp
+	fault   Fault
+	applied int
+}
+
+// faultInjector holds the faults of InjectFault.
+type faultInjector struct {
+	mu     sync.Mutex
+	faults []*injectedFault
+}
+
+// errFaultInRecordMode is returned by InjectFault in record mode.
+var errFaultInRecordMode = errors.New("faults can only be injected in playback")
+
+// InjectFault makes Transport fail the playback requests selected by
+// matcher with fault, to exercise a client's retry and error handling
+// against a recording of the happy path. When several faults match a
+// request, the first one registered that has not been used up applies.
+// Faults cannot be injected in record mode, where they would end up in the
+// recording.
+//
+// FaultStatus and FaultConnectionReset never reach the proxy, so the
+// recorded entry is still there for the retry. FaultTruncatedBody needs
+// the recorded body, so the proxy serves the entry; a retry then needs a
+// second matching entry.
+func (tpv *TestProxyVariables) InjectFault(matcher EntryMatcher, fault Fault) error {
+	if tpv.Mode == "record" {
+		return errFaultInRecordMode
+	}
+	pattern, err := regexp.Compile(matcher.URIPattern)
+	if err != nil {
+		return err
+	}
+	tpv.faults.mu.Lock()
+	defer tpv.faults.mu.Unlock()
+	tpv.faults.faults = append(tpv.faults.faults, &injectedFault{method: matcher.Method, pattern: pattern, fault: fault})
+	return nil
+}
+
+// ClearFaults removes the faults registered with InjectFault.
+func (tpv *TestProxyVariables) ClearFaults() {
+	tpv.faults.mu.Lock()
+	defer tpv.faults.mu.Unlock()
+	tpv.faults.faults = nil
+}
+
+// nextFault returns the fault to apply to a playback request, if any, and
+// counts it as applied.
+func (tpv *TestProxyVariables) nextFault(mode, method, uri string) *Fault {
+	if mode != "playback" {
+		return nil
+	}
+	tpv.faults.mu.Lock()
+	defer tpv.faults.mu.Unlock()
+	for _, f := range tpv.faults.faults {
+		if f.fault.Times > 0 && f.applied >= f.fault.Times {
+			continue
+		}
+		if f.method != "" && !strings.EqualFold(f.method, method) || !f.pattern.MatchString(uri) {
+			continue
+		}
+		f.applied++
+		fault := f.fault
+		return &fault
+	}
+	return nil
+}
+
+// sendWithFaults is send with the faults injected by InjectFault.
+func (tpt *TestProxyTransport) sendWithFaults(req *http.Request, uri string) (*http.Response, error) {
+	var fault *Fault
+	if tpt.variables != nil {
+		fault = tpt.variables.nextFault(tpt.mode, req.Method, uri)
+	}
+	if fault == nil {
+		return tpt.send(req, uri)
+	}
+
+	switch fault.Kind {
+	case FaultStatus:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		header := http.Header{}
+		if fault.RetryAfter > 0 {
+			header.Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", fault.StatusCode, http.StatusText(fault.StatusCode)),
+			StatusCode: fault.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     header,
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	case FaultConnectionReset:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+
+	resp, err := tpt.send(req, uri)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(fault.TruncateAt)))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{io.ErrUnexpectedEOF}))
+	return resp, nil
+}
+
+// errReader fails every read with err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
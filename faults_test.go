@@ -0,0 +1,105 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+func TestInjectFault(t *testing.T) {
+	sp := newStubProxy(t)
+	upstream := func() int {
+		n := 0
+		for _, r := range sp.Requests() {
+			if r.Path == "/Tables" {
+				n++
+			}
+		}
+		return n
+	}
+
+	if err := sp.variables(t, "record").InjectFault(EntryMatcher{}, Fault{Kind: FaultStatus, StatusCode: 503}); !errors.Is(err, errFaultInRecordMode) {
+		t.Errorf("got error %v in record mode", err)
+	}
+
+	// A 503 with Retry-After, then the recorded success, through azcore's
+	// retry policy.
+	tpv := sp.variables(t, "playback")
+	if err := tpv.InjectFault(EntryMatcher{Method: "GET", URIPattern: `/Tables$`}, Fault{Kind: FaultStatus, StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Second, Times: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var statuses []int
+	pipeline := runtime.NewPipeline("testproxy", "v0.0.0", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport: tpv.Transport(sp.Client()),
+		Retry:     policy.RetryOptions{RetryDelay: time.Millisecond, MaxRetryDelay: 2 * time.Second},
+		PerRetryPolicies: []policy.Policy{policyFunc(func(req *policy.Request) (*http.Response, error) {
+			resp, err := req.Next()
+			if err == nil {
+				statuses = append(statuses, resp.StatusCode)
+			}
+			return resp, err
+		})},
+	})
+	req, err := runtime.NewRequest(context.Background(), "GET", "https://account.table.core.windows.net/Tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(statuses) != 2 || statuses[0] != http.StatusServiceUnavailable {
+		t.Errorf("got status %d after attempts %v, want 200 after a 503", resp.StatusCode, statuses)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before Retry-After", elapsed)
+	}
+	if n := upstream(); n != 1 {
+		t.Errorf("proxy got %d requests, want only the retry", n)
+	}
+
+	// A connection reset and a truncated body.
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tpv.Transport(sp.Client()).Do(req)
+	}
+	tpv.ClearFaults()
+	tpv.InjectFault(EntryMatcher{URIPattern: "/Tables"}, Fault{Kind: FaultConnectionReset, Times: 1})
+	tpv.InjectFault(EntryMatcher{URIPattern: "/Tables"}, Fault{Kind: FaultTruncatedBody, TruncateAt: 5, Times: 1})
+	if _, err := do(); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("got error %v, want a connection reset", err)
+	}
+	resp, err = do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if string(body) != `{"ups` || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got body %q, %v, want it truncated", body, err)
+	}
+	if resp, err = do(); err != nil {
+		t.Fatal(err)
+	} else if body, err := io.ReadAll(resp.Body); err != nil || len(body) <= 5 {
+		t.Errorf("got body %q, %v once the faults are used up", body, err)
+	}
+}
+
+type policyFunc func(req *policy.Request) (*http.Response, error)
+
+func (f policyFunc) Do(req *policy.Request) (*http.Response, error) { return f(req) }
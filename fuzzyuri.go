@@ -0,0 +1,141 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// fuzzyURIState caches the recorded entries used to resolve
+// FuzzyURISegments during playback.
+type fuzzyURIState struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries []Entry
+	used    map[int]bool
+}
+
+// reset drops the cached entries so the next session reloads its recording.
+func (s *fuzzyURIState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = false
+	s.entries = nil
+	s.used = nil
+}
+
+// applyFuzzyURISegments rewrites the path of req during playback so that the
+// segments named by tpv.FuzzyURISegments carry the values from the matching
+// recorded entry. A recorded entry matches when it has the same method, host
+// and number of path segments, and every segment that is not fuzzy is equal.
+// Entries are consumed in order, so repeated calls against the same URI shape
+// pick up successive recorded IDs.
+func (tpv *TestProxyVariables) applyFuzzyURISegments(req *http.Request, mode string) error {
+	if mode != "playback" || len(tpv.FuzzyURISegments) == 0 {
+		return nil
+	}
+
+	state := &tpv.fuzzyURI
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if !state.loaded {
+		rf, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+		if err != nil {
+			return err
+		}
+		state.entries = rf.Entries
+		state.used = map[int]bool{}
+		state.loaded = true
+	}
+
+	segments := strings.Split(req.URL.EscapedPath(), "/")
+	for i, e := range state.entries {
+		if state.used[i] || !strings.EqualFold(e.RequestMethod, req.Method) {
+			continue
+		}
+		recorded, err := url.Parse(e.RequestUri)
+		if err != nil || !strings.EqualFold(recorded.Host, req.URL.Host) {
+			continue
+		}
+		recordedSegments := strings.Split(recorded.EscapedPath(), "/")
+		if !tpv.fuzzySegmentsMatch(segments, recordedSegments) {
+			continue
+		}
+
+		state.used[i] = true
+		rewritten, err := url.Parse(recorded.EscapedPath())
+		if err != nil {
+			return err
+		}
+		req.URL.Path = rewritten.Path
+		req.URL.RawPath = rewritten.RawPath
+		return nil
+	}
+
+	return nil
+}
+
+func (tpv *TestProxyVariables) fuzzySegmentsMatch(segments, recorded []string) bool {
+	if len(segments) != len(recorded) {
+		return false
+	}
+	fuzzy := tpv.fuzzyPositions(segments, recorded)
+	for i := range segments {
+		if segments[i] != recorded[i] && !fuzzy[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzyPositions reports which path segments hold a fuzzy value. A template
+// entry such as "operations/{operationId}" marks its placeholders wherever
+// its literal segments line up with both the live and the recorded path. A
+// plain name such as "operations" marks the segment that follows it.
+func (tpv *TestProxyVariables) fuzzyPositions(segments, recorded []string) map[int]bool {
+	fuzzy := map[int]bool{}
+	for _, rule := range tpv.FuzzyURISegments {
+		if !strings.Contains(rule, "{") {
+			for i := 1; i < len(segments); i++ {
+				if strings.EqualFold(segments[i-1], rule) {
+					fuzzy[i] = true
+				}
+			}
+			continue
+		}
+
+		template := strings.Split(strings.Trim(rule, "/"), "/")
+		for start := 0; start+len(template) <= len(segments); start++ {
+			if templateMatches(template, segments[start:], recorded[start:]) {
+				for j, part := range template {
+					if isPlaceholder(part) {
+						fuzzy[start+j] = true
+					}
+				}
+			}
+		}
+	}
+	return fuzzy
+}
+
+func templateMatches(template, segments, recorded []string) bool {
+	for j, part := range template {
+		if isPlaceholder(part) {
+			continue
+		}
+		if !strings.EqualFold(segments[j], part) || !strings.EqualFold(recorded[j], part) {
+			return false
+		}
+	}
+	return true
+}
+
+func isPlaceholder(part string) bool {
+	return len(part) > 2 && strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")
+}
@@ -0,0 +1,128 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const operationsRecording = `{
+  "Entries": [
+    {"RequestUri": "https://example.com/subscriptions/sub/operations/abc-111?api-version=1", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null},
+    {"RequestUri": "https://example.com/subscriptions/sub/operations/def-222?api-version=1", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null},
+    {"RequestUri": "https://example.com/subscriptions/sub/items/1", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null}
+  ],
+  "Variables": {}
+}`
+
+func writeFuzzyRecording(t *testing.T, data string) string {
+	t.Helper()
+	recording := filepath.Join(t.TempDir(), "recording.json")
+	if err := os.WriteFile(recording, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return recording
+}
+
+func sendFuzzyRequests(t *testing.T, tpv *TestProxyVariables, uris ...string) {
+	t.Helper()
+	transport := tpv.Transport(tpv.HttpClient)
+	for _, uri := range uris {
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func checkFuzzyPaths(t *testing.T, sp *stubProxy, want ...string) {
+	t.Helper()
+	requests := sp.Requests()
+	if len(requests) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(requests), len(want))
+	}
+	for i, r := range requests {
+		if r.Path != want[i] {
+			t.Errorf("request %d went to %s, want %s", i, r.Path, want[i])
+		}
+	}
+}
+
+func TestFuzzyURISegments(t *testing.T) {
+	recording := writeFuzzyRecording(t, operationsRecording)
+	uris := []string{
+		"https://example.com/subscriptions/sub/operations/new-1?api-version=1",
+		"https://example.com/subscriptions/sub/operations/new-2?api-version=1",
+		"https://example.com/subscriptions/sub/items/2",
+	}
+	recorded := []string{"/subscriptions/sub/operations/abc-111", "/subscriptions/sub/operations/def-222", "/subscriptions/sub/items/2"}
+	live := []string{"/subscriptions/sub/operations/new-1", "/subscriptions/sub/operations/new-2", "/subscriptions/sub/items/2"}
+
+	for _, tt := range []struct {
+		name  string
+		mode  string
+		rules []string
+		want  []string
+	}{
+		{"segment name", "playback", []string{"Operations"}, recorded},
+		{"template", "playback", []string{"/operations/{operationId}"}, recorded},
+		{"nested template", "playback", []string{"subscriptions/{subscriptionId}/operations/{operationId}"}, recorded},
+		// A bare placeholder name never appears in the URI, so nothing is fuzzy.
+		{"placeholder name", "playback", []string{"operationId"}, live},
+		{"record", "record", []string{"operations/{operationId}"}, live},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newStubProxy(t)
+			tpv := sp.variables(t, tt.mode)
+			tpv.CurrentRecordingPath = recording
+			tpv.FuzzyURISegments = tt.rules
+
+			sendFuzzyRequests(t, tpv, uris...)
+			checkFuzzyPaths(t, sp, tt.want...)
+		})
+	}
+}
+
+func TestFuzzyURISegmentsResetPerSession(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.FuzzyURISegments = []string{"operations/{operationId}"}
+
+	for _, id := range []string{"abc-111", "xyz-999"} {
+		tpv.CurrentRecordingPath = writeFuzzyRecording(t, `{
+  "Entries": [
+    {"RequestUri": "https://example.com/operations/`+id+`", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null}
+  ],
+  "Variables": {}
+}`)
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		sendFuzzyRequests(t, tpv, "https://example.com/operations/live")
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var paths []string
+	for _, r := range sp.Requests() {
+		if strings.HasPrefix(r.Path, "/operations/") {
+			paths = append(paths, r.Path)
+		}
+	}
+	if want := []string{"/operations/abc-111", "/operations/xyz-999"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,188 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// testIdentifier matches the name of a top-level test, benchmark, fuzz test
+// or example.
+var testIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GarbageCollectOption configures GarbageCollectRecordings.
+type GarbageCollectOption func(o *garbageCollectOptions)
+
+type garbageCollectOptions struct {
+	exclude []string
+}
+
+// ExcludeFromGarbageCollection keeps the recordings matching any of the
+// glob patterns, as understood by path.Match, whether matched against the
+// slash-separated path relative to the recording directory or against the
+// file name.
+func ExcludeFromGarbageCollection(patterns ...string) GarbageCollectOption {
+	return func(o *garbageCollectOptions) { o.exclude = append(o.exclude, patterns...) }
+}
+
+// GarbageCollectRecordings returns the recording files under recordingDir
+// that belong to no test, so that recordings of deleted or renamed tests
+// can be removed. The tests are listed by running the test binary at
+// testBinaryPath, as built by go test -c, with -test.list, or when it is
+// empty by running go test -list . ./... in the parent of recordingDir.
+//
+// A recording belongs to the test named by recordingTestName, so subtest
+// recordings, variants, WithRecordingSuffix suffixes, rotations and
+// compressed recordings belong to their test. Package recordings, tagged
+// with MetadataPackageRecording, belong to no test and are kept, as are
+// the recordings excluded with ExcludeFromGarbageCollection. The files
+// are not deleted.
+func GarbageCollectRecordings(testBinaryPath string, recordingDir string, opts ...GarbageCollectOption) ([]string, error) {
+	var o garbageCollectOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, pattern := range o.exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("exclude pattern %q: %w", pattern, err)
+		}
+	}
+	tests, err := listTests(testBinaryPath, recordingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+	err = filepath.WalkDir(recordingDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || !strings.Contains(d.Name(), ".json") {
+			return nil
+		}
+		rel, err := filepath.Rel(recordingDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if tests[recordingTestName(rel)] || excluded(o.exclude, rel) {
+			return nil
+		}
+		if isPackageRecording(file) {
+			return nil
+		}
+		orphans = append(orphans, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// recordingTestName returns the name of the top-level test the recording at
+// rel, relative to the recording directory, was made for. Subtests are
+// recorded in a directory named after their test. Otherwise the file name
+// is the test name followed by the suffixes this package adds, none of
+// which can occur in a Go identifier: ".<variant>", ".<hash>" build
+// hashes, ".merged" and ".verify" copies, "-<suffix>" from
+// WithRecordingSuffix, ".json", the compression extension and ".<N>"
+// rotations. So the test name is what comes before the first '.' or '-'.
+func recordingTestName(rel string) string {
+	if dir, _, ok := strings.Cut(rel, "/"); ok {
+		return dir
+	}
+	if i := strings.IndexAny(rel, ".-"); i >= 0 {
+		return rel[:i]
+	}
+	return rel
+}
+
+// excluded reports whether rel matches any of patterns.
+func excluded(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isPackageRecording reports whether the recording at file, or the
+// uncompressed recording next to a compressed one, is tagged with
+// MetadataPackageRecording.
+func isPackageRecording(file string) bool {
+	for _, format := range compressionFormats {
+		if base := strings.TrimSuffix(file, format.ext); base != file {
+			if _, err := os.Stat(base); err == nil {
+				file = base
+			} else {
+				return false
+			}
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	summary, err := scanRecording(f, nil)
+	return err == nil && summary.metadata[MetadataPackageRecording] == "true"
+}
+
+// listTests returns the names of the tests of the test binary at
+// testBinaryPath, or of the packages under the parent of recordingDir.
+func listTests(testBinaryPath, recordingDir string) (map[string]bool, error) {
+	var cmd *exec.Cmd
+	if testBinaryPath != "" {
+		cmd = exec.Command(testBinaryPath, "-test.list", ".")
+	} else {
+		abs, err := filepath.Abs(recordingDir)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command("go", "test", "-list", ".", "./...")
+		cmd.Dir = filepath.Dir(abs)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing tests with %s: %w: %s", strings.Join(cmd.Args, " "), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	// go test also prints a summary line per package, such as
+	// "ok  	example.com/pkg	0.01s", which is not an identifier.
+	tests := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if testIdentifier.MatchString(line) {
+			tests[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 {
+		// Collecting against an empty list would report every recording.
+		return nil, fmt.Errorf("listing tests with %s: no tests found", strings.Join(cmd.Args, " "))
+	}
+	return tests, nil
+}
@@ -0,0 +1,85 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGarbageCollectRecordings(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		"TestGarbageCollectRecordings.json",
+		"TestGarbageCollectRecordings/subtest.json",
+		"TestSessionLifecycle.dev.json",
+		"TestStartNamedSessions-setup.json",
+		"TestProxySuite.json.gz.2",
+		"TestDeletedTest.json",
+		"TestDeletedTest-verify.json",
+		"TestRenamedTest/subtest.json",
+		"TestGarbageCollectRecordings.dev-setup.json",
+		"TestSelectVariant-verify.prod.json.gz",
+		"shared/fixture.json",
+		".recording_index.json",
+		"README.md",
+	}
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(`{"Entries":[]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A package recording is kept although no test has its name.
+	var pkg RecordingFile
+	if err := pkg.SetMetadata(map[string]string{MetadataPackageRecording: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"smoke.json", "smoke.json.gz"} {
+		if err := pkg.WriteFile(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The running test binary lists the tests of this package.
+	orphans, err := GarbageCollectRecordings(os.Args[0], dir, ExcludeFromGarbageCollection("shared/*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "TestDeletedTest-verify.json"),
+		filepath.Join(dir, "TestDeletedTest.json"),
+		filepath.Join(dir, "TestRenamedTest", "subtest.json"),
+	}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("got orphans %v, want %v", orphans, want)
+	}
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("GarbageCollectRecordings removed %s", name)
+		}
+	}
+
+	orphans, err = GarbageCollectRecordings(os.Args[0], dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 4 || orphans[3] != filepath.Join(dir, "shared", "fixture.json") {
+		t.Errorf("got orphans %v without exclusions", orphans)
+	}
+
+	if _, err := GarbageCollectRecordings(os.Args[0], dir, ExcludeFromGarbageCollection("[")); err == nil {
+		t.Error("expected an error for a bad exclude pattern")
+	}
+	if _, err := GarbageCollectRecordings(filepath.Join(dir, "missing.test"), dir); err == nil {
+		t.Error("expected an error for a missing test binary")
+	}
+}
@@ -0,0 +1,148 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// goldenState holds the captures armed by CaptureNext.
+type goldenState struct {
+	mu      sync.Mutex
+	pending []goldenCapture
+}
+
+type goldenCapture struct {
+	t    testing.TB
+	name string
+}
+
+// CaptureNext has the next response that Transport returns captured as the
+// golden file name of t; see CaptureResponse. Captures armed together are
+// taken by consecutive responses, in order.
+func CaptureNext(t testing.TB, tpv *TestProxyVariables, name string) {
+	tpv.golden.mu.Lock()
+	defer tpv.golden.mu.Unlock()
+	tpv.golden.pending = append(tpv.golden.pending, goldenCapture{t, name})
+}
+
+// captureGolden hands resp to the oldest capture armed by CaptureNext. It
+// is called by Do.
+func (tpv *TestProxyVariables) captureGolden(resp *http.Response) {
+	tpv.golden.mu.Lock()
+	if len(tpv.golden.pending) == 0 {
+		tpv.golden.mu.Unlock()
+		return
+	}
+	c := tpv.golden.pending[0]
+	tpv.golden.pending = tpv.golden.pending[1:]
+	tpv.golden.mu.Unlock()
+	tpv.CaptureResponse(c.t, c.name, resp)
+}
+
+// CaptureResponse keeps the body of resp as a golden file, reviewed in
+// code review to catch changes of the service's contract, at
+// <GoldenDir>/<test name>/<name>.json for JSON bodies, pretty-printed, and
+// <name>.bin for others. In record mode the file is written; otherwise the
+// body is compared with it and differences are reported with t.Errorf, by
+// field for JSON and by size and SHA-256 for other bodies. Run the tests
+// with -update, a flag the test package declares, to rewrite the files in
+// playback instead. The body of resp is read and replaced, so
+// CaptureResponse can be called from Observer.Exchange.
+func (tpv *TestProxyVariables) CaptureResponse(t testing.TB, name string, resp *http.Response) {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("capturing golden response %s: %v", name, err)
+		return
+	}
+
+	ext, content := ".bin", body
+	if json.Valid(body) && (isTextContentType(resp.Header.Get("Content-Type")) || resp.Header.Get("Content-Type") == "") {
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, body, "", "  "); err == nil {
+			pretty.WriteByte('\n')
+			ext, content = ".json", pretty.Bytes()
+		}
+	}
+	path := filepath.Join(tpv.goldenDir(), filepath.FromSlash(t.Name()), name+ext)
+
+	if tpv.Mode == "record" || updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("writing golden response %s: %v", name, err)
+			return
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Errorf("writing golden response %s: %v", name, err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("reading golden response %s: %v", name, err)
+		return
+	}
+	if ext == ".bin" {
+		if !bytes.Equal(golden, content) {
+			t.Errorf("response %s differs from %s: got %d bytes with SHA-256 %x, want %d bytes with SHA-256 %x",
+				name, path, len(content), sha256.Sum256(content), len(golden), sha256.Sum256(golden))
+		}
+		return
+	}
+	var want, got interface{}
+	if err := json.Unmarshal(golden, &want); err != nil {
+		t.Errorf("reading golden response %s: %v", name, err)
+		return
+	}
+	json.Unmarshal(content, &got)
+	var diff BodyDiff
+	diffValues("", want, got, &diff)
+	if !diff.Empty() {
+		t.Errorf("response %s differs from %s:\n%s", name, path, formatBodyDiff(diff))
+	}
+}
+
+// goldenDir returns GoldenDir, or testdata/golden in the current directory.
+func (tpv *TestProxyVariables) goldenDir() string {
+	if tpv.GoldenDir != "" {
+		return tpv.GoldenDir
+	}
+	return filepath.Join(GetCurrentDirectory(), "testdata", "golden")
+}
+
+// updateGolden reports whether the test binary was run with -update.
+func updateGolden() bool {
+	f := flag.Lookup("update")
+	return f != nil && f.Value.String() == "true"
+}
+
+// formatBodyDiff lists the fields of diff, one per line.
+func formatBodyDiff(diff BodyDiff) string {
+	var lines []string
+	for _, path := range diff.AddedFields {
+		lines = append(lines, "  added "+path)
+	}
+	for _, path := range diff.RemovedFields {
+		lines = append(lines, "  removed "+path)
+	}
+	for _, change := range diff.ChangedFields {
+		lines = append(lines, fmt.Sprintf("  %s: got %v, want %v", change.Path, change.New, change.Old))
+	}
+	return strings.Join(lines, "\n")
+}
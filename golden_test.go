@@ -0,0 +1,101 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The package's tests declare -update as users of CaptureResponse would.
+var _ = flag.Bool("update", false, "rewrite the golden files of CaptureResponse")
+
+func TestCaptureResponse(t *testing.T) {
+	dir := t.TempDir()
+	body, contentType := `{"value":[{"TableName":"products"}]}`, "application/json"
+	send := func(mode string, r testing.TB, name string) string {
+		tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: mode, GoldenDir: dir}
+		tpt := tpv.Transport(transporterFunc(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{"Content-Type": {contentType}}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}))
+		CaptureNext(r, tpv, name)
+		req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		got, _ := io.ReadAll(resp.Body)
+		return string(got)
+	}
+
+	// Record mode writes the pretty-printed body, and the caller still
+	// reads it.
+	if got := send("record", t, "tables"); got != body {
+		t.Errorf("the caller read %q", got)
+	}
+	path := filepath.Join(dir, "TestCaptureResponse", "tables.json")
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"value\": [\n    {\n      \"TableName\": \"products\"\n    }\n  ]\n}\n"
+	if string(golden) != want {
+		t.Errorf("golden file:\n%s", golden)
+	}
+
+	// Playback compares; key order and whitespace do not matter.
+	body = `{ "value": [ { "TableName": "products" } ] }`
+	r := &errorRecorder{TB: t}
+	send("playback", r, "tables")
+	if len(r.errors) != 0 {
+		t.Errorf("got errors %q for a matching body", r.errors)
+	}
+
+	body = `{"value":[{"TableName":"orders"}],"odata.metadata":"x"}`
+	r = &errorRecorder{TB: t}
+	send("playback", r, "tables")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "added odata.metadata") || !strings.Contains(r.errors[0], "value[0].TableName: got orders, want products") {
+		t.Errorf("got errors %q for a changed body", r.errors)
+	}
+
+	// -update rewrites the golden file in playback.
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatal(err)
+	}
+	r = &errorRecorder{TB: t}
+	send("playback", r, "tables")
+	flag.Set("update", "false")
+	if golden, _ := os.ReadFile(path); len(r.errors) != 0 || !strings.Contains(string(golden), `"orders"`) {
+		t.Errorf("got errors %q, golden file:\n%s", r.errors, golden)
+	}
+	r = &errorRecorder{TB: t}
+	send("playback", r, "tables")
+	if len(r.errors) != 0 {
+		t.Errorf("got errors %q after -update", r.errors)
+	}
+
+	// Binary bodies are compared by size and hash.
+	body, contentType = "\x89PNG\r\n\x1a\n", "image/png"
+	send("record", t, "logo")
+	if _, err := os.Stat(filepath.Join(dir, "TestCaptureResponse", "logo.bin")); err != nil {
+		t.Fatal(err)
+	}
+	body = "\x89PNG\r\n\x1a\n\x00"
+	r = &errorRecorder{TB: t}
+	send("playback", r, "logo")
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "got 9 bytes") || !strings.Contains(r.errors[0], "want 8 bytes") {
+		t.Errorf("got errors %q for a changed binary body", r.errors)
+	}
+}
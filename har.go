@@ -0,0 +1,272 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The HAR 1.2 document model, limited to the fields needed to carry a
+// recording. See http://www.softwareishard.com/blog/har-12-spec/.
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harPostData has no encoding field in HAR 1.2, so base64 request bodies
+// are flagged with the custom "_encoding" field.
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ExportHAR writes the entries of rec to w as a HAR 1.2 document, so that
+// recordings can be inspected with browser devtools, Fiddler and other HAR
+// tooling. Timings are zero since the proxy does not record them.
+//
+// The proxy stores bodies already decoded, so the text of a body is never
+// compressed even when the entry has a Content-Encoding header; binary
+// bodies are carried base64 encoded and flagged as such.
+func ExportHAR(rec *RecordingFile, w io.Writer) error {
+	doc := harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "testproxy", Version: "1.0"},
+		Entries: []harEntry{},
+	}}
+
+	for _, e := range rec.Entries {
+		started := time.Time{}
+		if date, err := http.ParseTime(e.ResponseHeaders.Get("Date")); err == nil {
+			started = date
+		}
+
+		req := harRequest{
+			Method:      e.RequestMethod,
+			URL:         e.RequestUri,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     toHARHeaders(e.RequestHeaders),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    0,
+		}
+		if u, err := url.Parse(e.RequestUri); err == nil {
+			for name, values := range u.Query() {
+				for _, v := range values {
+					req.QueryString = append(req.QueryString, harNameValue{name, v})
+				}
+			}
+			sort.Slice(req.QueryString, func(i, j int) bool { return req.QueryString[i].Name < req.QueryString[j].Name })
+		}
+		if text, base64, ok := bodyText(e.RequestBody, e.RequestHeaders); ok {
+			req.PostData = &harPostData{MimeType: e.RequestHeaders.Get("Content-Type"), Text: text}
+			if base64 {
+				req.PostData.Encoding = "base64"
+			}
+			req.BodySize = len(text)
+		}
+
+		resp := harResponse{
+			Status:      e.StatusCode,
+			StatusText:  http.StatusText(e.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     toHARHeaders(e.ResponseHeaders),
+			Content:     harContent{MimeType: e.ResponseHeaders.Get("Content-Type")},
+			HeadersSize: -1,
+		}
+		if text, base64, ok := bodyText(e.ResponseBody, e.ResponseHeaders); ok {
+			resp.Content.Text = text
+			resp.Content.Size = len(text)
+			if base64 {
+				resp.Content.Encoding = "base64"
+			}
+			resp.BodySize = len(text)
+		}
+
+		doc.Log.Entries = append(doc.Log.Entries, harEntry{
+			StartedDateTime: started.UTC().Format(time.RFC3339Nano),
+			Request:         req,
+			Response:        resp,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// ImportHAR reads a HAR document and converts its entries into a recording
+// that can be saved with RecordingFile.WriteFile and played back.
+func ImportHAR(r io.Reader) (*RecordingFile, error) {
+	var doc harDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	rec := &RecordingFile{Entries: []Entry{}, Variables: map[string]string{}}
+	for _, he := range doc.Log.Entries {
+		e := Entry{
+			RequestUri:      he.Request.URL,
+			RequestMethod:   he.Request.Method,
+			RequestHeaders:  fromHARHeaders(he.Request.Headers),
+			RequestBody:     json.RawMessage("null"),
+			StatusCode:      he.Response.Status,
+			ResponseHeaders: fromHARHeaders(he.Response.Headers),
+			ResponseBody:    json.RawMessage("null"),
+		}
+		if pd := he.Request.PostData; pd != nil {
+			body, err := recordedBody(pd.Text, pd.Encoding == "base64", e.RequestHeaders)
+			if err != nil {
+				return nil, err
+			}
+			e.RequestBody = body
+		}
+		if c := he.Response.Content; c.Text != "" {
+			body, err := recordedBody(c.Text, c.Encoding == "base64", e.ResponseHeaders)
+			if err != nil {
+				return nil, err
+			}
+			e.ResponseBody = body
+		}
+		rec.Entries = append(rec.Entries, e)
+	}
+	return rec, nil
+}
+
+// bodyText converts a recorded body into its textual form. JSON bodies are
+// stored by the proxy as JSON values, text bodies as strings, and binary
+// bodies as base64 strings, distinguished by the entry's Content-Type.
+func bodyText(body json.RawMessage, headers Headers) (text string, base64 bool, ok bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return "", false, false
+	}
+	var s string
+	if err := json.Unmarshal(trimmed, &s); err != nil {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, trimmed); err != nil {
+			return string(trimmed), false, true
+		}
+		return compact.String(), false, true
+	}
+	return s, !isTextContentType(headers.Get("Content-Type")), true
+}
+
+// recordedBody is the inverse of bodyText.
+func recordedBody(text string, base64 bool, headers Headers) (json.RawMessage, error) {
+	if !base64 && isJSONContentType(headers.Get("Content-Type")) && json.Valid([]byte(text)) {
+		return json.RawMessage(text), nil
+	}
+	return marshalNoEscape(text)
+}
+
+// isTextContentType reports whether the proxy stores bodies of the given
+// content type as text rather than base64.
+func isTextContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		isJSONContentType(contentType) ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json")
+}
+
+func toHARHeaders(h Headers) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{name, v})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+func fromHARHeaders(headers []harNameValue) Headers {
+	h := Headers{}
+	for _, nv := range headers {
+		h[nv.Name] = append(h[nv.Name], nv.Value)
+	}
+	return h
+}
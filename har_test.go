@@ -0,0 +1,122 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHARRoundTrip(t *testing.T) {
+	for _, path := range []string{
+		"recordings/TestCosmosDBTables.json",
+		"testdata/har/binary.json",
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec, err := ReadRecordingFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var har bytes.Buffer
+			if err := ExportHAR(rec, &har); err != nil {
+				t.Fatal(err)
+			}
+			imported, err := ImportHAR(&har)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(imported.Entries) != len(rec.Entries) {
+				t.Fatalf("got %d entries, want %d", len(imported.Entries), len(rec.Entries))
+			}
+			for i := range rec.Entries {
+				want, got := rec.Entries[i], imported.Entries[i]
+				if got.RequestUri != want.RequestUri || got.RequestMethod != want.RequestMethod || got.StatusCode != want.StatusCode {
+					t.Errorf("entry %d: got %s %s %d", i, got.RequestMethod, got.RequestUri, got.StatusCode)
+				}
+				if !reflect.DeepEqual(got.RequestHeaders, want.RequestHeaders) || !reflect.DeepEqual(got.ResponseHeaders, want.ResponseHeaders) {
+					t.Errorf("entry %d: headers differ", i)
+				}
+				if compactJSON(t, got.RequestBody) != compactJSON(t, want.RequestBody) {
+					t.Errorf("entry %d: request body %s, want %s", i, got.RequestBody, want.RequestBody)
+				}
+				if compactJSON(t, got.ResponseBody) != compactJSON(t, want.ResponseBody) {
+					t.Errorf("entry %d: response body %s, want %s", i, got.ResponseBody, want.ResponseBody)
+				}
+			}
+		})
+	}
+}
+
+func TestExportHARMarksBinaryBodies(t *testing.T) {
+	rec, err := ReadRecordingFile("testdata/har/binary.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har bytes.Buffer
+	if err := ExportHAR(rec, &har); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc harDocument
+	if err := json.Unmarshal(har.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	upload := doc.Log.Entries[0]
+	if upload.Request.PostData == nil || upload.Request.PostData.Encoding != "base64" || upload.Request.PostData.Text != "AAECA/7/" {
+		t.Errorf("binary request body: %+v", upload.Request.PostData)
+	}
+	if upload.StartedDateTime != "2023-02-08T02:34:37Z" {
+		t.Errorf("startedDateTime %s", upload.StartedDateTime)
+	}
+	download := doc.Log.Entries[1]
+	if download.Response.Content.Encoding != "" || !strings.Contains(download.Response.Content.Text, `"quoted"`) {
+		t.Errorf("text response body: %+v", download.Response.Content)
+	}
+}
+
+func TestImportHAR(t *testing.T) {
+	f, err := os.Open("testdata/har/sample.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rec, err := ImportHAR(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Entries) != 2 {
+		t.Fatalf("got %d entries", len(rec.Entries))
+	}
+	create := rec.Entries[0]
+	if compactJSON(t, create.RequestBody) != `{"TableName":"products"}` || compactJSON(t, create.ResponseBody) != `{"TableName":"products"}` {
+		t.Errorf("JSON bodies: %s / %s", create.RequestBody, create.ResponseBody)
+	}
+	if create.RequestHeaders.Get("accept") != "application/json;odata=minimalmetadata" {
+		t.Errorf("request headers: %v", create.RequestHeaders)
+	}
+	logo := rec.Entries[1]
+	if string(logo.RequestBody) != "null" || string(logo.ResponseBody) != `"iVBORw=="` {
+		t.Errorf("binary bodies: %s / %s", logo.RequestBody, logo.ResponseBody)
+	}
+}
+
+func compactJSON(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return "null"
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
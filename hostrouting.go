@@ -0,0 +1,85 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// routesThroughProxy reports whether requests to host are sent to the
+// proxy, according to tpv.IncludedHosts and tpv.ExcludedHosts.
+func (tpv *TestProxyVariables) routesThroughProxy(host string) bool {
+	if matchesAnyHost(host, tpv.ExcludedHosts) {
+		return false
+	}
+	return len(tpv.IncludedHosts) == 0 || matchesAnyHost(host, tpv.IncludedHosts)
+}
+
+// validateHostRouting fails when a host pattern is both included and
+// excluded, which is almost certainly a configuration mistake.
+func (tpv *TestProxyVariables) validateHostRouting() error {
+	for _, included := range tpv.IncludedHosts {
+		for _, excluded := range tpv.ExcludedHosts {
+			if strings.EqualFold(included, excluded) {
+				return fmt.Errorf("host %q is in both IncludedHosts and ExcludedHosts", included)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAnyHost reports whether host matches one of patterns. A pattern
+// is a host name, compared case-insensitively, or "*." followed by a
+// domain, which matches every subdomain of it.
+func matchesAnyHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesURI reports whether uri matches one of ExcludeURIPatterns.
+func (tpv *TestProxyVariables) excludesURI(uri string) (bool, error) {
+	for _, pattern := range tpv.ExcludeURIPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("ExcludeURIPatterns: %w", err)
+		}
+		if re.MatchString(uri) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sendExcluded sends a request matching ExcludeURIPatterns through the
+// upstream transporter, to LiveFallbackURL in playback when it is set.
+func (tpt *TestProxyTransport) sendExcluded(req *http.Request) (*http.Response, error) {
+	if tpt.mode != "playback" || tpt.variables.LiveFallbackURL == "" {
+		return tpt.upstream().Do(req)
+	}
+	fallback, err := url.Parse(tpt.variables.LiveFallbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("LiveFallbackURL: %w", err)
+	}
+	if fallback.Scheme == "" || fallback.Host == "" {
+		return nil, fmt.Errorf("LiveFallbackURL: %q is not a scheme://host URL", tpt.variables.LiveFallbackURL)
+	}
+	req.URL.Scheme, req.URL.Host = fallback.Scheme, fallback.Host
+	req.Host = ""
+	return tpt.upstream().Do(req)
+}
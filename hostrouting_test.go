@@ -0,0 +1,142 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// transporterFunc adapts a function to policy.Transporter.
+type transporterFunc func(req *http.Request) (*http.Response, error)
+
+func (f transporterFunc) Do(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHostRouting(t *testing.T) {
+	tpv := &TestProxyVariables{
+		Host:          "localhost",
+		Port:          5001,
+		Mode:          "playback",
+		IncludedHosts: []string{"*.table.core.windows.net", "vault.azure.net"},
+		ExcludedHosts: []string{"telemetry.table.core.windows.net"},
+	}
+	var sentTo []string
+	sender := func(via string) transporterFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			sentTo = append(sentTo, via+" "+req.URL.Host+" "+req.Header.Get("x-recording-mode"))
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}
+	}
+	tpv.UpstreamTransport = sender("upstream")
+	tpt := tpv.Transport(sender("proxy"))
+
+	for _, url := range []string{
+		"https://account.table.core.windows.net/Tables",
+		"https://VAULT.azure.net/secrets/s",
+		"https://telemetry.table.core.windows.net/events",
+		"https://flags.example.com/features",
+	} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tpt.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"proxy localhost:5001 playback",
+		"proxy localhost:5001 playback",
+		"upstream telemetry.table.core.windows.net ",
+		"upstream flags.example.com ",
+	}
+	if strings.Join(sentTo, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got requests sent to:\n%s\nwant:\n%s", strings.Join(sentTo, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHostRoutingConflict(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.IncludedHosts = []string{"account.table.core.windows.net"}
+	tpv.ExcludedHosts = []string{"Account.Table.Core.Windows.Net"}
+	if err := StartTestProxy(tpv); err == nil || !strings.Contains(err.Error(), "both IncludedHosts and ExcludedHosts") {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if len(sp.Requests()) != 0 {
+		t.Error("session started despite the conflict")
+	}
+}
+
+func TestExcludeURIPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		mode, fallback string
+		want           []string
+	}{
+		{"record", "", []string{
+			"proxy localhost:5001 record /Tables",
+			"upstream login.microsoftonline.com  /tenant/oauth2/v2.0/token",
+			"upstream dc.services.visualstudio.com  /v2/track",
+		}},
+		{"playback", "http://localhost:8080", []string{
+			"proxy localhost:5001 playback /Tables",
+			"upstream localhost:8080  /tenant/oauth2/v2.0/token",
+			"upstream localhost:8080  /v2/track",
+		}},
+		{"playback", "", []string{
+			"proxy localhost:5001 playback /Tables",
+			"upstream login.microsoftonline.com  /tenant/oauth2/v2.0/token",
+			"upstream dc.services.visualstudio.com  /v2/track",
+		}},
+	} {
+		tpv := &TestProxyVariables{
+			Host:               "localhost",
+			Port:               5001,
+			Mode:               tc.mode,
+			ExcludeURIPatterns: []string{`/oauth2/v2\.0/token$`, `^https://dc\.services\.visualstudio\.com/`},
+			LiveFallbackURL:    tc.fallback,
+		}
+		var sentTo []string
+		sender := func(via string) transporterFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				sentTo = append(sentTo, via+" "+req.URL.Host+" "+req.Header.Get("x-recording-mode")+" "+req.URL.Path)
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+			}
+		}
+		tpv.UpstreamTransport = sender("upstream")
+		tpt := tpv.Transport(sender("proxy"))
+		for _, url := range []string{
+			"https://account.table.core.windows.net/Tables",
+			"https://login.microsoftonline.com/tenant/oauth2/v2.0/token",
+			"https://dc.services.visualstudio.com/v2/track",
+		} {
+			req, err := http.NewRequest("POST", url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tpt.Do(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if strings.Join(sentTo, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s with fallback %q: got requests sent to:\n%s\nwant:\n%s", tc.mode, tc.fallback, strings.Join(sentTo, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+
+	tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: "record", ExcludeURIPatterns: []string{`(`}}
+	tpt := tpv.Transport(transporterFunc(func(req *http.Request) (*http.Response, error) {
+		t.Error("sent a request despite an invalid pattern")
+		return nil, nil
+	}))
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpt.Do(req); err == nil || !strings.Contains(err.Error(), "ExcludeURIPatterns") {
+		t.Errorf("got %v for an invalid pattern", err)
+	}
+}
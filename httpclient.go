@@ -0,0 +1,76 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// The test proxy is usually a local process, but teams also share a single
+// deployment reached over a WAN (e.g. https://proxy.team.example.com:443).
+// The dial and TLS handshake timeouts below are generous enough for both.
+const (
+	dialTimeout         = 30 * time.Second
+	tlsHandshakeTimeout = 30 * time.Second
+	keepAlive           = 30 * time.Second
+	idleConnTimeout     = 90 * time.Second
+)
+
+// startAttempts is the number of times StartTestProxy POSTs to the proxy
+// when the connection is reset before a response is received.
+const startAttempts = 3
+
+var client = http.Client{
+	Transport: newHttpTransport(&tls.Config{InsecureSkipVerify: true}),
+}
+
+func newHttpTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   tlsHandshakeTimeout,
+		IdleConnTimeout:       idleConnTimeout,
+		MaxIdleConnsPerHost:   16,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// NewHttpClient returns an http client for talking to a test proxy whose
+// certificate is signed by one of the CAs in the PEM encoded caBundle file.
+// Unlike the default client, certificate validation is left switched on.
+func NewHttpClient(caBundle string) (*http.Client, error) {
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", caBundle)
+	}
+
+	return &http.Client{
+		Transport: newHttpTransport(&tls.Config{RootCAs: pool}),
+	}, nil
+}
+
+// isConnectionReset reports whether err means the connection was dropped
+// before the proxy answered, in which case the request can safely be resent.
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,95 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemoteProxyWithCABundle(t *testing.T) {
+	sp := newStubProxy(t)
+
+	// Drop the first start request on the floor to simulate a connection
+	// reset on the way to a remote proxy.
+	var starts int32
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/record/start" || atomic.AddInt32(&starts, 1) > 1 {
+			return false
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		return true
+	}
+
+	trustStubProxy(t, sp)
+	t.Setenv("TESTPROXY_CLIENT_ID", "team-storage")
+
+	tpv := NewTestProxyVariables(t)
+	tpv.Host, tpv.Port = sp.hostPort(t)
+	tpv.Mode = "record"
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if tpv.RecordingId != "stub-recording-id" {
+		t.Fatalf("unexpected recording id %q", tpv.RecordingId)
+	}
+
+	transport := NewTestProxyTransport(tpv.HttpClient, tpv.Host, tpv.Port, tpv.RecordingId, tpv.Mode)
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"upstream":"https://account.table.core.windows.net"}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, r := range sp.Requests() {
+		paths = append(paths, r.Path)
+		if r.Path == "/record/start" || r.Path == "/record/stop" {
+			if got := r.Header.Get("x-recording-client"); got != "team-storage" {
+				t.Errorf("%s: x-recording-client = %q", r.Path, got)
+			}
+		}
+	}
+	want := []string{"/record/start", "/record/start", "/Tables", "/record/stop"}
+	if len(paths) != len(want) {
+		t.Fatalf("got requests %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("got requests %v, want %v", paths, want)
+		}
+	}
+}
+
+func TestNewHttpClientEmptyBundle(t *testing.T) {
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caBundle, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHttpClient(caBundle); err == nil {
+		t.Fatal("expected an error for a bundle without certificates")
+	}
+}
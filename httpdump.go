@@ -0,0 +1,88 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+)
+
+// httpDump writes the traffic of transports created with Transport.
+type httpDump struct {
+	mu      sync.Mutex
+	w       io.Writer
+	entries int
+}
+
+// EnableHTTPDump writes every request sent to the proxy by transports
+// created with tpv.Transport, and the proxy's response, to w in HTTP/1.1
+// wire format, each pair preceded by a "---ENTRY <N>---" line. Requests
+// with an Authorization header are left out unless tpv.DumpSensitive is
+// set.
+func (tpv *TestProxyVariables) EnableHTTPDump(w io.Writer) {
+	tpv.dump.mu.Lock()
+	defer tpv.dump.mu.Unlock()
+	tpv.dump.w = w
+}
+
+// DisableHTTPDump stops the dump started by EnableHTTPDump.
+func (tpv *TestProxyVariables) DisableHTTPDump() {
+	tpv.dump.mu.Lock()
+	defer tpv.dump.mu.Unlock()
+	tpv.dump.w = nil
+}
+
+// dumpRequest captures req for writeEntry, or returns nil when dumping is
+// off. It must be called before req is sent, while its body is unread.
+func (tpv *TestProxyVariables) dumpRequest(req *http.Request) []byte {
+	tpv.dump.mu.Lock()
+	enabled := tpv.dump.w != nil
+	tpv.dump.mu.Unlock()
+	if !enabled {
+		return nil
+	}
+	if req.Header.Get("Authorization") != "" && !tpv.DumpSensitive {
+		return []byte("(request has an Authorization header and is not shown; set DumpSensitive to include it)\r\n\r\n")
+	}
+	dumped, err := httputil.DumpRequest(req, true)
+	if err != nil {
+		return []byte(fmt.Sprintf("(request could not be dumped: %v)\r\n\r\n", err))
+	}
+	return dumped
+}
+
+// writeEntry writes a captured request and the response, or error, that
+// answered it.
+func (tpv *TestProxyVariables) writeEntry(dumpedReq []byte, resp *http.Response, respErr error) {
+	if dumpedReq == nil {
+		return
+	}
+	var dumpedResp []byte
+	switch {
+	case respErr != nil:
+		dumpedResp = []byte(fmt.Sprintf("(no response: %v)\r\n", respErr))
+	case resp.Request != nil && resp.Request.Header.Get("Authorization") != "" && !tpv.DumpSensitive:
+		dumpedResp = []byte("(response to a request with an Authorization header is not shown)\r\n")
+	default:
+		var err error
+		if dumpedResp, err = httputil.DumpResponse(resp, true); err != nil {
+			dumpedResp = []byte(fmt.Sprintf("(response could not be dumped: %v)\r\n", err))
+		}
+	}
+
+	tpv.dump.mu.Lock()
+	defer tpv.dump.mu.Unlock()
+	if tpv.dump.w == nil {
+		return
+	}
+	fmt.Fprintf(tpv.dump.w, "---ENTRY %d---\n", tpv.dump.entries)
+	tpv.dump.entries++
+	tpv.dump.w.Write(dumpedReq)
+	tpv.dump.w.Write(dumpedResp)
+	io.WriteString(tpv.dump.w, "\n")
+}
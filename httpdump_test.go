@@ -0,0 +1,67 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDump(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.RecordingId = "rec-dump"
+
+	send := func(auth string) string {
+		req, err := http.NewRequest("POST", "https://account.table.core.windows.net/Tables", strings.NewReader(`{"TableName":"t"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := tpv.Transport(sp.Client()).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	var dump bytes.Buffer
+	tpv.EnableHTTPDump(&dump)
+	if body := send(""); !strings.Contains(body, "upstream") {
+		t.Errorf("response body consumed by the dump: %q", body)
+	}
+	send("SharedKey account:secret")
+	tpv.DumpSensitive = true
+	send("SharedKey account:secret")
+	tpv.DisableHTTPDump()
+	send("")
+
+	out := dump.String()
+	entries := strings.Split(out, "---ENTRY ")
+	if len(entries) != 4 || !strings.HasPrefix(entries[1], "0---") || !strings.HasPrefix(entries[3], "2---") {
+		t.Fatalf("expected three delimited entries, got:\n%s", out)
+	}
+	for _, want := range []string{"POST /Tables HTTP/1.1", "X-Recording-Id: rec-dump", `{"TableName":"t"}`, "HTTP/1.1 200 OK", `{"upstream":"https://account.table.core.windows.net"}`} {
+		if !strings.Contains(entries[1], want) {
+			t.Errorf("entry 0 does not contain %q:\n%s", want, entries[1])
+		}
+	}
+	if strings.Contains(entries[2], "secret") || !strings.Contains(entries[2], "DumpSensitive") {
+		t.Errorf("entry 1 should be suppressed:\n%s", entries[2])
+	}
+	if !strings.Contains(entries[3], "Authorization: SharedKey account:secret") {
+		t.Errorf("entry 2 should include the Authorization header with DumpSensitive:\n%s", entries[3])
+	}
+}
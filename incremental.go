@@ -0,0 +1,164 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// The test proxy records every request of a session, so IncrementalRecord
+// answers the requests that match an entry of the existing recording
+// without the proxy, and puts the entries back among the newly recorded
+// ones once the proxy has saved the recording.
+
+// incrementalState is the existing recording of an IncrementalRecord
+// session.
+type incrementalState struct {
+	mu   sync.Mutex
+	rec  *RecordingFile
+	used []bool
+	// slots holds, for each request of the session in order, the index of
+	// the existing entry that answered it, or -1 when the proxy recorded
+	// it.
+	slots []int
+}
+
+// errIncrementalResume is returned when both IncrementalRecord and
+// ResumeMode are set.
+var errIncrementalResume = errors.New("IncrementalRecord and ResumeMode cannot be combined")
+
+// loadIncrementalRecording remembers the existing recording of an
+// IncrementalRecord session. It is called by StartTestProxy.
+func (tpv *TestProxyVariables) loadIncrementalRecording() error {
+	tpv.incremental.mu.Lock()
+	defer tpv.incremental.mu.Unlock()
+	tpv.incremental.rec, tpv.incremental.used, tpv.incremental.slots = nil, nil, nil
+	if !tpv.IncrementalRecord || tpv.Mode != "record" {
+		return nil
+	}
+	if tpv.ResumeMode {
+		return errIncrementalResume
+	}
+	if _, err := os.Stat(tpv.CurrentRecordingPath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return fmt.Errorf("re-recording %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	tpv.incremental.rec = rec
+	tpv.incremental.used = make([]bool, len(rec.Entries))
+	return nil
+}
+
+// incrementalResponse answers req from the first unused entry of the
+// existing recording with the same RequestHash, and reports whether it
+// did. Requests whose body cannot be read again are always sent to the
+// proxy. It is called by TestProxyTransport.Do in record mode.
+func (tpv *TestProxyVariables) incrementalResponse(req *http.Request, uri string) (*http.Response, bool) {
+	tpv.incremental.mu.Lock()
+	defer tpv.incremental.mu.Unlock()
+	state := &tpv.incremental
+	if state.rec == nil {
+		return nil, false
+	}
+	body, ok := rereadBody(req)
+	if !ok {
+		state.slots = append(state.slots, -1)
+		return nil, false
+	}
+	hash := requestHash(req.Method, uri, body)
+	for i, e := range state.rec.Entries {
+		if !state.used[i] && e.Hash() == hash {
+			state.used[i] = true
+			state.slots = append(state.slots, i)
+			return localResponse(req, e), true
+		}
+	}
+	state.slots = append(state.slots, -1)
+	return nil, false
+}
+
+// rereadBody returns the body of req without consuming it, and reports
+// whether that was possible.
+func rereadBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	defer rc.Close()
+	body, err := io.ReadAll(rc)
+	return body, err == nil
+}
+
+// mergeIncrementalRecording puts the entries that answered requests of the
+// session back among those the proxy saved, in the order of the requests.
+// Entries no request matched are dropped, as the test no longer makes
+// them. Variables saved by the proxy win over existing ones. It is called
+// by StopTestProxy.
+func (tpv *TestProxyVariables) mergeIncrementalRecording() error {
+	tpv.incremental.mu.Lock()
+	existing, slots := tpv.incremental.rec, tpv.incremental.slots
+	tpv.incremental.rec, tpv.incremental.used, tpv.incremental.slots = nil, nil, nil
+	tpv.incremental.mu.Unlock()
+	if existing == nil {
+		return nil
+	}
+
+	rec := &RecordingFile{}
+	if _, err := os.Stat(tpv.CurrentRecordingPath); err == nil {
+		if rec, err = ReadRecordingFile(tpv.CurrentRecordingPath); err != nil {
+			return err
+		}
+	}
+	recorded := rec.Entries
+	rec.Entries = nil
+	for _, slot := range slots {
+		switch {
+		case slot >= 0:
+			rec.Entries = append(rec.Entries, existing.Entries[slot])
+		case len(recorded) > 0:
+			rec.Entries = append(rec.Entries, recorded[0])
+			recorded = recorded[1:]
+		}
+	}
+	rec.Entries = append(rec.Entries, recorded...)
+	mergeRecordingVariables(rec, existing)
+	return rec.WriteFile(tpv.CurrentRecordingPath)
+}
+
+// mergeRecordingVariables adds the variables and other top-level fields of
+// from that rec does not have.
+func mergeRecordingVariables(rec, from *RecordingFile) {
+	for k, v := range from.Variables {
+		if _, ok := rec.Variables[k]; !ok {
+			if rec.Variables == nil {
+				rec.Variables = map[string]string{}
+			}
+			rec.Variables[k] = v
+		}
+	}
+	for k, v := range from.extra {
+		if _, ok := rec.extra[k]; !ok {
+			if rec.extra == nil {
+				rec.extra = map[string]json.RawMessage{}
+			}
+			rec.extra[k] = v
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIncrementalRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestIncrementalRecord.json")
+	existing := &RecordingFile{
+		Entries: []Entry{
+			{RequestUri: "https://example.com/tables?b=2&a=1", RequestMethod: "GET", StatusCode: 200,
+				ResponseHeaders: Headers{"Content-Type": {"application/json"}}, ResponseBody: []byte(`{"from":"recording"}`)},
+			{RequestUri: "https://example.com/tables", RequestMethod: "POST", StatusCode: 201,
+				RequestHeaders: Headers{"Content-Type": {"application/json"}}, RequestBody: []byte(`{"TableName":"old"}`)},
+			{RequestUri: "https://example.com/removed", RequestMethod: "DELETE", StatusCode: 204},
+		},
+		Variables: map[string]string{"kept": "yes", "session": "old"},
+	}
+	if err := existing.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stub saves an entry for each request it records.
+	sp := newStubProxy(t)
+	var mu sync.Mutex
+	var recorded []Entry
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/record/start":
+			return false
+		case "/record/stop":
+			rec := &RecordingFile{Entries: recorded, Variables: map[string]string{"session": "new"}}
+			rec.WriteFile(path)
+			return true
+		}
+		uri := r.Header.Get("x-recording-upstream-base-uri") + r.URL.RequestURI()
+		recorded = append(recorded, Entry{RequestUri: uri, RequestMethod: r.Method, StatusCode: 200})
+		return false
+	}
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+	tpv.IncrementalRecord = true
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	tpt := tpv.Transport(sp.Client())
+	send := func(method, uri, body string) string {
+		req, err := http.NewRequest(method, uri, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		got, _ := io.ReadAll(resp.Body)
+		return string(got)
+	}
+	// The query order does not matter, but the changed body does.
+	if got := send("GET", "https://example.com/tables?a=1&b=2", ""); got != `{"from":"recording"}` {
+		t.Errorf("unchanged request got %s, want the recorded response", got)
+	}
+	send("POST", "https://example.com/tables", `{"TableName":"new"}`)
+	send("GET", "https://example.com/added", "")
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != 2 {
+		t.Errorf("the proxy recorded %d requests, want the 2 changed ones", len(recorded))
+	}
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range rec.Entries {
+		got = append(got, e.RequestMethod+" "+e.RequestUri)
+	}
+	want := []string{
+		"GET https://example.com/tables?b=2&a=1",
+		"POST https://example.com/tables",
+		"GET https://example.com/added",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+	if rec.Entries[1].StatusCode != 200 {
+		t.Error("the changed request kept its old entry")
+	}
+	if want := map[string]string{"kept": "yes", "session": "new"}; !reflect.DeepEqual(rec.Variables, want) {
+		t.Errorf("got variables %v, want %v", rec.Variables, want)
+	}
+
+	tpv.ResumeMode = true
+	if err := StartTestProxy(tpv); err != errIncrementalResume {
+		t.Errorf("got %v with ResumeMode, want errIncrementalResume", err)
+	}
+}
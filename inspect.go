@@ -0,0 +1,76 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// maxInspectedPairs is the number of exchanges LastN can return.
+const maxInspectedPairs = 100
+
+// RequestResponsePair is a request made through Transport and the response
+// that answered it. Response is nil when the request failed.
+type RequestResponsePair struct {
+	Request  *http.Request
+	Response *http.Response
+	Err      error
+}
+
+// inspect remembers an exchange for LastRequest, LastResponse and LastN.
+// The request is a shallow copy with its URL as the caller made it, before
+// it was rerouted to the proxy; the proxy headers are included. The
+// response is a shallow copy sharing its body with the one returned to the
+// caller.
+func (tpv *TestProxyVariables) inspect(req *http.Request, original *url.URL, resp *http.Response, err error) {
+	pair := RequestResponsePair{Err: err}
+	copiedReq := *req
+	copiedReq.URL = original
+	copiedReq.Header = req.Header.Clone()
+	pair.Request = &copiedReq
+	if resp != nil {
+		copiedResp := *resp
+		pair.Response = &copiedResp
+	}
+
+	tpv.inspectMu.Lock()
+	defer tpv.inspectMu.Unlock()
+	tpv.LastRequest, tpv.LastResponse = pair.Request, pair.Response
+	tpv.inspected = append(tpv.inspected, pair)
+	if len(tpv.inspected) > maxInspectedPairs {
+		tpv.inspected = tpv.inspected[len(tpv.inspected)-maxInspectedPairs:]
+	}
+}
+
+// InspectLastRequest returns LastRequest, and is safe to call while other
+// goroutines make requests.
+func (tpv *TestProxyVariables) InspectLastRequest() *http.Request {
+	tpv.inspectMu.RLock()
+	defer tpv.inspectMu.RUnlock()
+	return tpv.LastRequest
+}
+
+// InspectLastResponse returns LastResponse, and is safe to call while
+// other goroutines make requests.
+func (tpv *TestProxyVariables) InspectLastResponse() *http.Response {
+	tpv.inspectMu.RLock()
+	defer tpv.inspectMu.RUnlock()
+	return tpv.LastResponse
+}
+
+// LastN returns up to the last n exchanges made through Transport, oldest
+// first. At most the last 100 are kept.
+func (tpv *TestProxyVariables) LastN(n int) []RequestResponsePair {
+	tpv.inspectMu.RLock()
+	defer tpv.inspectMu.RUnlock()
+	if n > len(tpv.inspected) {
+		n = len(tpv.inspected)
+	}
+	if n <= 0 {
+		return nil
+	}
+	return append([]RequestResponsePair(nil), tpv.inspected[len(tpv.inspected)-n:]...)
+}
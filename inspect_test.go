@@ -0,0 +1,78 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectLastRequest(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.RecordingId = "rec-1"
+	tpt := tpv.Transport(sp.Client())
+
+	for _, table := range []string{"first", "second"} {
+		req, err := http.NewRequest("POST", "https://account.table.core.windows.net/Tables", strings.NewReader(`{"TableName":"`+table+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, "application/json", tpv.LastRequest.Header.Get("Content-Type"))
+	assert.Equal(t, "rec-1", tpv.LastRequest.Header.Get("x-recording-id"))
+	assert.Equal(t, "https://account.table.core.windows.net/Tables", tpv.InspectLastRequest().URL.String())
+	assert.Equal(t, http.StatusOK, tpv.InspectLastResponse().StatusCode)
+
+	pairs := tpv.LastN(5)
+	if assert.Len(t, pairs, 2) {
+		assert.Same(t, tpv.LastRequest, pairs[1].Request)
+		assert.Same(t, tpv.LastResponse, pairs[1].Response)
+		assert.NotSame(t, pairs[0].Request, pairs[1].Request)
+	}
+	assert.Len(t, tpv.LastN(1), 1)
+	assert.Empty(t, tpv.LastN(0))
+}
+
+func TestInspectParallelRequests(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpt := tpv.Transport(sp.Client())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 150; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if tpv.InspectLastRequest() == nil || tpv.InspectLastResponse() == nil {
+				t.Error("no last exchange after a request")
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, tpv.LastN(1000), maxInspectedPairs)
+}
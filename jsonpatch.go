@@ -0,0 +1,117 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPatchContentType is the media type of a JSON patch document.
+const JSONPatchContentType = "application/json-patch+json"
+
+// PatchOperation is one operation of a JSON patch (RFC 6902).
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return marshalNoEscape(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type plain PatchOperation
+	return marshalNoEscape(plain(op))
+}
+
+// DiffJSONPatch returns the JSON patch turning from into to, both values
+// as decoded by encoding/json. Numbers decoded as json.Number are compared
+// by value, and differences within tolerance, relative to the larger of
+// the two numbers, are ignored: 0.01 accepts a 1% drift.
+func DiffJSONPatch(from, to interface{}, tolerance float64) []PatchOperation {
+	var ops []PatchOperation
+	diffJSONPatch("", from, to, tolerance, &ops)
+	return ops
+}
+
+func diffJSONPatch(path string, from, to interface{}, tolerance float64, ops *[]PatchOperation) {
+	switch from := from.(type) {
+	case map[string]interface{}:
+		if to, ok := to.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(from)+len(to))
+			for k := range from {
+				keys = append(keys, k)
+			}
+			for k := range to {
+				if _, ok := from[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := path + "/" + jsonPointerEscape(k)
+				vf, inFrom := from[k]
+				vt, inTo := to[k]
+				switch {
+				case !inFrom:
+					*ops = append(*ops, PatchOperation{Op: "add", Path: child, Value: vt})
+				case !inTo:
+					*ops = append(*ops, PatchOperation{Op: "remove", Path: child})
+				default:
+					diffJSONPatch(child, vf, vt, tolerance, ops)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if to, ok := to.([]interface{}); ok {
+			n := len(from)
+			if len(to) < n {
+				n = len(to)
+			}
+			for i := 0; i < n; i++ {
+				diffJSONPatch(path+"/"+strconv.Itoa(i), from[i], to[i], tolerance, ops)
+			}
+			for i := n; i < len(to); i++ {
+				*ops = append(*ops, PatchOperation{Op: "add", Path: path + "/-", Value: to[i]})
+			}
+			// Remove from the end, so earlier indexes stay valid.
+			for i := len(from) - 1; i >= n; i-- {
+				*ops = append(*ops, PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+			}
+			return
+		}
+	case json.Number:
+		if to, ok := to.(json.Number); ok && numbersWithin(from, to, tolerance) {
+			return
+		}
+	}
+	if !reflect.DeepEqual(from, to) {
+		*ops = append(*ops, PatchOperation{Op: "replace", Path: path, Value: to})
+	}
+}
+
+func numbersWithin(a, b json.Number, tolerance float64) bool {
+	fa, errA := a.Float64()
+	fb, errB := b.Float64()
+	if errA != nil || errB != nil {
+		return false
+	}
+	return math.Abs(fa-fb) <= tolerance*math.Max(math.Abs(fa), math.Abs(fb))
+}
+
+// jsonPointerEscape escapes a key for use as a JSON pointer (RFC 6901)
+// reference token.
+func jsonPointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,106 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latenciesVariable is the recording variable holding the duration of each
+// request of a record session, in milliseconds, comma-separated in order.
+const latenciesVariable = "latencies"
+
+// latencyReplay is the state of ReplayLatency.
+type latencyReplay struct {
+	mu   sync.Mutex
+	next int
+	// sleep waits for d or until ctx is done; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// resetLatencies restarts the latencies for a new session, dropping those
+// of a previous record session. It is called by StartTestProxy.
+func (tpv *TestProxyVariables) resetLatencies() {
+	tpv.latency.mu.Lock()
+	defer tpv.latency.mu.Unlock()
+	tpv.latency.next = 0
+	if tpv.Mode == "record" {
+		delete(tpv.Variables, latenciesVariable)
+	}
+}
+
+// recordLatency saves the duration of a request made in record mode.
+func (tpv *TestProxyVariables) recordLatency(d time.Duration) {
+	tpv.latency.mu.Lock()
+	defer tpv.latency.mu.Unlock()
+	if tpv.Variables == nil {
+		tpv.Variables = map[string]string{}
+	}
+	ms := strconv.FormatInt(d.Milliseconds(), 10)
+	if list := tpv.Variables[latenciesVariable]; list != "" {
+		tpv.Variables[latenciesVariable] = list + "," + ms
+	} else {
+		tpv.Variables[latenciesVariable] = ms
+	}
+}
+
+// replayLatency waits for the recorded duration of the session's next
+// request, scaled by ReplayLatency, or until ctx is done. Requests beyond
+// the recorded ones do not wait.
+func (tpv *TestProxyVariables) replayLatency(ctx context.Context) error {
+	tpv.latency.mu.Lock()
+	index := tpv.latency.next
+	tpv.latency.next++
+	var recorded []string
+	if list := tpv.Variables[latenciesVariable]; list != "" {
+		recorded = strings.Split(list, ",")
+	}
+	sleep := tpv.latency.sleep
+	tpv.latency.mu.Unlock()
+
+	if index >= len(recorded) {
+		return nil
+	}
+	ms, err := strconv.ParseInt(recorded[index], 10, 64)
+	if err != nil {
+		return nil
+	}
+	d := time.Duration(float64(time.Duration(ms)*time.Millisecond) * tpv.ReplayLatency)
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	return sleep(ctx, d)
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// applyLatency records or replays the latency of a request that took
+// elapsed, according to mode. It is called by TestProxyTransport.Do.
+func (tpv *TestProxyVariables) applyLatency(ctx context.Context, mode string, elapsed time.Duration) error {
+	if tpv.ReplayLatency <= 0 {
+		return nil
+	}
+	switch mode {
+	case "record":
+		tpv.recordLatency(elapsed)
+	case "playback":
+		return tpv.replayLatency(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayLatency(t *testing.T) {
+	sp := newStubProxy(t)
+	do := func(tpv *TestProxyVariables, ctx context.Context) error {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://example.com/slow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(sp.Client()).Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Record sessions save how long each request took.
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/slow" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return false
+	}
+	record := sp.variables(t, "record")
+	record.ReplayLatency = 1
+	if err := StartTestProxy(record); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := do(record, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := StopTestProxy(record); err != nil {
+		t.Fatal(err)
+	}
+	requests := sp.Requests()
+	var saved map[string]string
+	if err := json.Unmarshal(requests[len(requests)-1].Body, &saved); err != nil {
+		t.Fatal(err)
+	}
+	latencies := strings.Split(saved[latenciesVariable], ",")
+	if len(latencies) != 2 {
+		t.Fatalf("got latencies %q, want 2", saved[latenciesVariable])
+	}
+	for _, l := range latencies {
+		if ms, err := strconv.Atoi(l); err != nil || ms < 30 {
+			t.Errorf("got latency %q, want at least 30ms", l)
+		}
+	}
+
+	// Playback waits for the scaled durations.
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/playback/start" {
+			return false
+		}
+		w.Header().Set("x-recording-id", "stub-recording-id")
+		json.NewEncoder(w).Encode(map[string]string{latenciesVariable: "100,2000"})
+		return true
+	}
+	playback := sp.variables(t, "playback")
+	playback.ReplayLatency = 0.1
+	var slept []time.Duration
+	playback.latency.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := do(playback, context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []time.Duration{10 * time.Millisecond, 200 * time.Millisecond}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("slept %v, want %v", slept, want)
+	}
+
+	// Cancelling the request ends the wait.
+	playback.ReplayLatency = 1000
+	playback.latency.sleep = nil
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := do(playback, ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled request returned after %v", elapsed)
+	}
+}
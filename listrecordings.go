@@ -0,0 +1,182 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errNotRecording is returned by scanRecording for well-formed JSON that
+// has no Entries array, e.g. an assets.json or a golden file.
+var errNotRecording = errors.New("not a recording")
+
+// RecordingInfo describes one recording file found by ListRecordings.
+type RecordingInfo struct {
+	Path string
+	// TestName is the path relative to the listed directory without the
+	// .json extension, which is the t.Name() the recording was made for.
+	TestName string
+	Entries  int
+	Size     int64
+	ModTime  time.Time
+
+	Metadata  map[string]string
+	Variables map[string]string
+
+	// Err is set when the file could not be parsed. Such files are still
+	// listed so they can be reported instead of silently skipped.
+	Err error
+}
+
+// ListRecordings walks dir and returns an inventory of the recording files
+// in it. Files are parsed as a stream, so large recordings are not loaded
+// into memory. Corrupt files are flagged through RecordingInfo.Err rather
+// than aborting the walk, and JSON files that are not recordings are skipped.
+func ListRecordings(dir string) ([]RecordingInfo, error) {
+	var infos []RecordingInfo
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info := RecordingInfo{
+			Path:     path,
+			TestName: strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel)),
+			Size:     fi.Size(),
+			ModTime:  fi.ModTime(),
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		summary, err := scanRecording(f, nil)
+		if errors.Is(err, errNotRecording) {
+			return nil
+		}
+		info.Entries = summary.entries
+		info.Metadata = summary.metadata
+		info.Variables = summary.variables
+		info.Err = err
+		infos = append(infos, info)
+		return nil
+	})
+	return infos, err
+}
+
+type recordingSummary struct {
+	entries   int
+	metadata  map[string]string
+	variables map[string]string
+}
+
+// scanRecordingFile runs scanRecording over the file at path.
+func scanRecordingFile(path string, onEntry func(index int, raw json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = scanRecording(f, onEntry)
+	return err
+}
+
+// scanRecording reads a recording document from r one top-level key at a
+// time, calling onEntry (when non-nil) with each raw entry of the Entries
+// array.
+func scanRecording(r io.Reader, onEntry func(index int, raw json.RawMessage) error) (recordingSummary, error) {
+	var summary recordingSummary
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return summary, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return summary, errNotRecording
+	}
+	sawEntries := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return summary, err
+		}
+		key, _ := tok.(string)
+		switch {
+		case key == "Entries":
+			sawEntries = true
+			if err := expectDelim(dec, '['); err != nil {
+				return summary, err
+			}
+			for dec.More() {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return summary, err
+				}
+				if onEntry != nil {
+					if err := onEntry(summary.entries, raw); err != nil {
+						return summary, err
+					}
+				}
+				summary.entries++
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return summary, err
+			}
+		case key == "Variables":
+			if err := dec.Decode(&summary.variables); err != nil {
+				return summary, fmt.Errorf("Variables: %w", err)
+			}
+		case strings.EqualFold(key, "metadata"):
+			if err := dec.Decode(&summary.metadata); err != nil {
+				return summary, fmt.Errorf("%s: %w", key, err)
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return summary, err
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return summary, err
+	}
+	if !sawEntries {
+		return summary, errNotRecording
+	}
+	return summary, nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %v at offset %d, found %v", want, dec.InputOffset(), tok)
+	}
+	return nil
+}
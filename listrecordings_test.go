@@ -0,0 +1,51 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"testing"
+)
+
+func TestListRecordings(t *testing.T) {
+	infos, err := ListRecordings("testdata/listrecordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]RecordingInfo{}
+	for _, info := range infos {
+		byName[info.TestName] = info
+	}
+	if len(byName) != 3 {
+		t.Fatalf("got %d recordings, want 3: %+v", len(byName), infos)
+	}
+
+	valid := byName["TestValid"]
+	if valid.Err != nil || valid.Entries != 2 || valid.Size == 0 {
+		t.Errorf("TestValid: %+v", valid)
+	}
+	if valid.Variables["tableName"] != "products" || valid.Metadata["owner"] != "storage-team" {
+		t.Errorf("TestValid: variables %v, metadata %v", valid.Variables, valid.Metadata)
+	}
+
+	sub := byName["TestParent/SubTest"]
+	if sub.Err != nil || sub.Entries != 1 {
+		t.Errorf("TestParent/SubTest: %+v", sub)
+	}
+
+	if corrupt := byName["TestCorrupt"]; corrupt.Err == nil {
+		t.Errorf("TestCorrupt was not flagged: %+v", corrupt)
+	}
+
+	if _, ok := byName["assets"]; ok {
+		t.Error("assets.json was listed as a recording")
+	}
+}
+
+func TestListRecordingsMissingDir(t *testing.T) {
+	if _, err := ListRecordings("testdata/does-not-exist"); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,39 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"net/http"
+)
+
+type liveKey struct{}
+
+// Live returns a context derived from ctx for requests that must always
+// reach the service, such as fetching a short-lived SAS that cannot be
+// played back. Transport sends a request made with it straight upstream,
+// through UpstreamTransport and without the proxy headers, so it is not
+// recorded; in playback it still
+// goes live, and the Logger logs it. Live takes precedence over
+// IncludedHosts.
+func Live(ctx context.Context) context.Context {
+	return context.WithValue(ctx, liveKey{}, true)
+}
+
+func isLive(ctx context.Context) bool {
+	live, _ := ctx.Value(liveKey{}).(bool)
+	return live
+}
+
+// logLiveRequest logs a request sent live by Live in playback, without its
+// query, which may hold a SAS.
+func (tpv *TestProxyVariables) logLiveRequest(req *http.Request, mode string) {
+	if tpv.Logger == nil || mode != "playback" {
+		return
+	}
+	u := *req.URL
+	u.RawQuery = ""
+	tpv.Logger.Info("test proxy request sent live in playback", "method", req.Method, "url", u.String())
+}
@@ -0,0 +1,109 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLive(t *testing.T) {
+	for _, mode := range []string{"record", "playback"} {
+		t.Run(mode, func(t *testing.T) {
+			var log bytes.Buffer
+			tpv := &TestProxyVariables{
+				Host:          "localhost",
+				Port:          5001,
+				Mode:          mode,
+				IncludedHosts: []string{"*.core.windows.net"},
+				ExcludedHosts: []string{"login.microsoftonline.com"},
+				Logger:        slog.New(slog.NewTextHandler(&log, nil)),
+			}
+			var sentTo []string
+			sender := func(via string) transporterFunc {
+				return func(req *http.Request) (*http.Response, error) {
+					sentTo = append(sentTo, via+" "+req.URL.Host+" "+req.Header.Get("x-recording-mode"))
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(""))}, nil
+				}
+			}
+			tpv.UpstreamTransport = sender("upstream")
+			tpt := tpv.Transport(sender("proxy"))
+
+			live := Live(context.Background())
+			for _, r := range []struct {
+				ctx context.Context
+				url string
+			}{
+				{context.Background(), "https://account.table.core.windows.net/Tables"},
+				{live, "https://account.blob.core.windows.net/c?restype=container&comp=sas&sig=secret"},
+				{context.Background(), "https://account.table.core.windows.net/Tables('t')"},
+				{live, "https://login.microsoftonline.com/token"},
+				{context.Background(), "https://login.microsoftonline.com/token"},
+			} {
+				req, err := http.NewRequestWithContext(r.ctx, "GET", r.url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := tpt.Do(req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := []string{
+				"proxy localhost:5001 " + mode,
+				"upstream account.blob.core.windows.net ",
+				"proxy localhost:5001 " + mode,
+				"upstream login.microsoftonline.com ",
+				"upstream login.microsoftonline.com ",
+			}
+			if strings.Join(sentTo, "\n") != strings.Join(want, "\n") {
+				t.Errorf("got requests sent to:\n%s\nwant:\n%s", strings.Join(sentTo, "\n"), strings.Join(want, "\n"))
+			}
+
+			logged := log.String()
+			if mode == "record" && logged != "" {
+				t.Errorf("logged %q in record mode", logged)
+			}
+			if mode == "playback" && (strings.Count(logged, "sent live") != 2 || strings.Contains(logged, "secret")) {
+				t.Errorf("got log %q, want both live requests without their query", logged)
+			}
+		})
+	}
+}
+
+func TestLiveVerifiesUpstream(t *testing.T) {
+	service := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer service.Close()
+
+	// The proxy's client skips certificate verification; live requests
+	// must not go through it.
+	tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: "record", HttpClient: &client}
+	req, err := http.NewRequestWithContext(Live(context.Background()), "GET", service.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certErr *tls.CertificateVerificationError
+	if _, err := tpv.Transport(tpv.HttpClient).Do(req); !errors.As(err, &certErr) {
+		t.Fatalf("got %v sending live to a service with an untrusted certificate", err)
+	}
+
+	tpv.UpstreamTransport = service.Client()
+	req, err = http.NewRequestWithContext(Live(context.Background()), "GET", service.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,322 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// localExcludedHeaders are never compared by LocalPlaybackTransport, in
+// addition to the hop-by-hop headers and Matcher.ExcludedHeaders. They
+// differ between runs, like the date, or are added by net/http below the
+// transport, like Accept-Encoding and Content-Length, and so are in the
+// recording but not in the requests the transport sees.
+var localExcludedHeaders = []string{
+	"Accept-Encoding",
+	"Content-Length",
+	"Date",
+	"Request-Id",
+	"Traceparent",
+	"User-Agent",
+	"X-Ms-Client-Request-Id",
+	"X-Ms-Date",
+}
+
+// localIgnoredHeaders must be present in both requests, but their values
+// are not compared, because sanitizers replace them in recordings.
+var localIgnoredHeaders = []string{"Authorization"}
+
+// LocalPlaybackTransport is a policy.Transporter that plays back a
+// recording in process, for environments where the test proxy cannot run.
+// It matches requests to entries as the proxy does with Matcher: on the
+// method, the URI, the headers and the body. Each entry answers one
+// request, in recording order, and a request no entry matches fails with a
+// *PlaybackMismatchError. Recording still needs the proxy.
+//
+// Requests may be sent to the transport directly or through a
+// TestProxyTransport, whose x-recording-upstream-base-uri header gives the
+// original host. TestProxyVariables.LocalPlayback sets this up for a
+// session.
+type LocalPlaybackTransport struct {
+	Matcher Matcher
+
+	headers ProxyHeaders
+
+	mu      sync.Mutex
+	entries []Entry
+	used    []bool
+}
+
+// NewLocalPlaybackTransport returns a LocalPlaybackTransport playing back
+// rec with matcher.
+func NewLocalPlaybackTransport(rec *RecordingFile, matcher Matcher) *LocalPlaybackTransport {
+	return &LocalPlaybackTransport{
+		Matcher: matcher,
+		headers: DefaultProxyHeaders(),
+		entries: rec.Entries,
+		used:    make([]bool, len(rec.Entries)),
+	}
+}
+
+// PlaybackMismatchError is returned by LocalPlaybackTransport when no
+// unused entry matches a request. Closest is the index of the unused entry
+// with the same method that differs the least, or -1 when there is none,
+// and Differences lists how it differs.
+type PlaybackMismatchError struct {
+	Method      string
+	URI         string
+	Closest     int
+	Differences []string
+}
+
+func (e *PlaybackMismatchError) Error() string {
+	if e.Closest < 0 {
+		return fmt.Sprintf("no recorded entry matches %s %s", e.Method, e.URI)
+	}
+	return fmt.Sprintf("no recorded entry matches %s %s; closest is entry %d:\n  %s",
+		e.Method, e.URI, e.Closest, strings.Join(e.Differences, "\n  "))
+}
+
+// NonRetriable stops azcore's retry policy from retrying a mismatch, which
+// would fail the same way.
+func (*PlaybackMismatchError) NonRetriable() {}
+
+func (lpt *LocalPlaybackTransport) Do(req *http.Request) (*http.Response, error) {
+	uri := *req.URL
+	if base := req.Header.Get(lpt.headers.UpstreamBaseUri); base != "" {
+		upstream, err := url.Parse(base)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", lpt.headers.UpstreamBaseUri, err)
+		}
+		uri.Scheme, uri.Host = upstream.Scheme, upstream.Host
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	lpt.mu.Lock()
+	defer lpt.mu.Unlock()
+	mismatch := &PlaybackMismatchError{Method: req.Method, URI: uri.String(), Closest: -1}
+	for i, e := range lpt.entries {
+		if lpt.used[i] || !strings.EqualFold(e.RequestMethod, req.Method) {
+			continue
+		}
+		differences := lpt.compare(e, &uri, req.Header, body)
+		if len(differences) == 0 {
+			lpt.used[i] = true
+			return localResponse(req, e), nil
+		}
+		if mismatch.Closest < 0 || len(differences) < len(mismatch.Differences) {
+			mismatch.Closest, mismatch.Differences = i, differences
+		}
+	}
+	return nil, mismatch
+}
+
+// compare lists the differences between the recorded request of e and a
+// request, empty when they match.
+func (lpt *LocalPlaybackTransport) compare(e Entry, uri *url.URL, header http.Header, body []byte) []string {
+	var differences []string
+	recorded, err := url.Parse(e.RequestUri)
+	if err != nil {
+		return []string{fmt.Sprintf("recorded URI %q: %v", e.RequestUri, err)}
+	}
+	if !strings.EqualFold(recorded.Scheme, uri.Scheme) || !strings.EqualFold(recorded.Host, uri.Host) || recorded.Path != uri.Path {
+		differences = append(differences, fmt.Sprintf("URI: recorded %s", e.RequestUri))
+	} else if a, b := lpt.query(recorded.RawQuery), lpt.query(uri.RawQuery); !reflect.DeepEqual(a, b) {
+		differences = append(differences, fmt.Sprintf("query: recorded %q, got %q", a, b))
+	}
+
+	excluded := map[string]bool{}
+	for _, list := range [][]string{hopByHopHeaders, localExcludedHeaders, lpt.Matcher.ExcludedHeaders} {
+		for _, name := range list {
+			excluded[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	ignored := map[string]bool{}
+	for _, list := range [][]string{localIgnoredHeaders, lpt.Matcher.IgnoredHeaders} {
+		for _, name := range list {
+			ignored[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	recordedHeaders := http.Header{}
+	for name, values := range e.RequestHeaders {
+		recordedHeaders[http.CanonicalHeaderKey(name)] = values
+	}
+	names := map[string]string{}
+	for name := range recordedHeaders {
+		names[name] = ""
+	}
+	for name := range header {
+		if !strings.HasPrefix(strings.ToLower(name), "x-recording-") {
+			names[name] = ""
+		}
+	}
+	for _, name := range sortedKeys(names) {
+		if excluded[name] {
+			continue
+		}
+		want, inRecording := recordedHeaders[name]
+		got, inRequest := header[name]
+		switch {
+		case !inRecording:
+			differences = append(differences, fmt.Sprintf("header %s: not recorded", name))
+		case !inRequest:
+			differences = append(differences, fmt.Sprintf("header %s: recorded %q, missing", name, strings.Join(want, ", ")))
+		case !ignored[name] && strings.Join(want, ", ") != strings.Join(got, ", "):
+			differences = append(differences, fmt.Sprintf("header %s: recorded %q, got %q", name, strings.Join(want, ", "), strings.Join(got, ", ")))
+		}
+	}
+
+	if !lpt.Matcher.IgnoreBodies && !sameBody(bodyBytes(e.RequestBody, e.RequestHeaders), body) {
+		differences = append(differences, fmt.Sprintf("body: recorded %s, got %s", compactBody(bodyBytes(e.RequestBody, e.RequestHeaders)), compactBody(body)))
+	}
+	return differences
+}
+
+// query returns the parameters of a raw query as "name=value" pairs, with
+// Matcher.IgnoredQueryParameters removed, sorted when
+// Matcher.IgnoreQueryOrdering is set.
+func (lpt *LocalPlaybackTransport) query(raw string) []string {
+	var pairs []string
+	for _, part := range strings.Split(raw, "&") {
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		ignored := false
+		for _, p := range lpt.Matcher.IgnoredQueryParameters {
+			ignored = ignored || p == name
+		}
+		if !ignored {
+			pairs = append(pairs, name+"="+value)
+		}
+	}
+	if lpt.Matcher.IgnoreQueryOrdering {
+		sort.Strings(pairs)
+	}
+	return pairs
+}
+
+// sameBody compares two bodies as JSON when both are JSON, and byte for
+// byte otherwise.
+func sameBody(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) == nil && json.Unmarshal(b, &y) == nil {
+		return reflect.DeepEqual(x, y)
+	}
+	return bytes.Equal(a, b)
+}
+
+func compactBody(body []byte) string {
+	const max = 200
+	if len(body) == 0 {
+		return "no body"
+	}
+	var compacted bytes.Buffer
+	if json.Compact(&compacted, body) == nil {
+		body = compacted.Bytes()
+	}
+	if len(body) > max {
+		return strconv.Quote(string(body[:max])) + "..."
+	}
+	return strconv.Quote(string(body))
+}
+
+// localResponse builds the recorded response of e to req.
+func localResponse(req *http.Request, e Entry) *http.Response {
+	body := bodyBytes(e.ResponseBody, e.ResponseHeaders)
+	header := http.Header{}
+	for name, values := range e.ResponseHeaders {
+		if strings.EqualFold(name, "Transfer-Encoding") || strings.EqualFold(name, "Content-Length") {
+			continue
+		}
+		header[http.CanonicalHeaderKey(name)] = values
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// errLocalRecord is returned when LocalPlayback is set in record mode.
+var errLocalRecord = errors.New("local playback cannot record; record mode requires the test proxy")
+
+// startLocalPlayback starts a playback session served by a
+// LocalPlaybackTransport instead of the proxy. It is called by
+// StartTestProxy when LocalPlayback is set.
+func (tpv *TestProxyVariables) startLocalPlayback() error {
+	if tpv.Mode != "playback" {
+		return errLocalRecord
+	}
+	if err := tpv.decompressRecording(); err != nil {
+		return err
+	}
+	if err := tpv.readRecordingMetadata(); err != nil {
+		return err
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	// The same headers are excluded as by the proxy's session matcher.
+	matcher := tpv.Matcher
+	matcher.ExcludedHeaders = tpv.sessionExcludedHeaders()
+	tpv.local = NewLocalPlaybackTransport(rec, matcher)
+	tpv.local.headers = tpv.ProxyHeaders.withDefaults()
+	tpv.Variables = rec.Variables
+	tpv.RecordingId = ""
+
+	if tpv.Logger != nil {
+		tpv.Logger.Info("test proxy session started", "session", tpv, "local", true)
+	}
+	return nil
+}
+
+// stopLocalPlayback stops a session started by startLocalPlayback.
+func (tpv *TestProxyVariables) stopLocalPlayback() error {
+	tpv.local = nil
+	if tpv.AccessTracker != nil {
+		if err := tpv.AccessTracker.finish(tpv.CurrentRecordingPath); err != nil {
+			return err
+		}
+	}
+	if err := tpv.compressRecording(); err != nil {
+		return err
+	}
+	if tpv.Logger != nil {
+		tpv.Logger.Info("test proxy session stopped", "session", tpv, "local", true)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+// cosmosFixtureConnectionString points at the account of the committed
+// TestCosmosDBTables recording.
+var cosmosFixtureConnectionString = "DefaultEndpointsProtocol=https;AccountName=zedy-table;AccountKey=" +
+	base64.StdEncoding.EncodeToString([]byte("fake-key")) + ";TableEndpoint=https://zedy-table.table.cosmos.azure.com/;"
+
+func TestLocalPlayback(t *testing.T) {
+	tpv, err := NewTestProxy(WithMode("playback"), WithLocalPlayback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpv.CurrentRecordingPath = filepath.Join("recordings", "TestCosmosDBTables.json")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	service, err := aztables.NewServiceClientFromConnectionString(cosmosFixtureConnectionString, &aztables.ClientOptions{
+		ClientOptions: tpv.ClientOptions(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	table := service.NewClient("gocosmosZ")
+	if _, err := table.CreateTable(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity, _ := json.Marshal(Product{RowKey: "68719518388", PartitionKey: "gear-surf-surfboards", Name: "Ocean Surfboard", Quantity: 8, Sale: true})
+	if _, err := table.AddEntity(ctx, entity, nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := table.GetEntity(ctx, "gear-surf-surfboards", "68719518388", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var product Product
+	if err := json.Unmarshal(resp.Value, &product); err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "Ocean Surfboard" {
+		t.Errorf("got product %+v", product)
+	}
+	entity, _ = json.Marshal(Product{RowKey: "68719518390", PartitionKey: "gear-surf-surfboards", Name: "Sand Surfboard", Quantity: 5})
+	if _, err := table.AddEntity(ctx, entity, nil); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	pager := table.NewListEntitiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entities {
+			var p Product
+			if err := json.Unmarshal(e, &p); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, p.Name)
+		}
+	}
+	if strings.Join(names, ",") != "Ocean Surfboard,Sand Surfboard" {
+		t.Errorf("listed %v", names)
+	}
+	if _, err := table.Delete(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every entry has been used once.
+	var mismatch *PlaybackMismatchError
+	if _, err := table.Delete(ctx, nil); !errors.As(err, &mismatch) || mismatch.Closest != -1 {
+		t.Errorf("got error %v for a request with no entry left", err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalPlaybackMismatch(t *testing.T) {
+	rec, err := ReadRecordingFile(filepath.Join("recordings", "TestCosmosDBTables.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("DELETE", "https://zedy-table.table.cosmos.azure.com/Tables('other')", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "SharedKey zedy-table:c2lnbmF0dXJl")
+	req.Header.Set("X-Ms-Version", "2019-02-02")
+
+	_, err = NewLocalPlaybackTransport(rec, Matcher{}).Do(req)
+	var mismatch *PlaybackMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("got error %v, want a PlaybackMismatchError", err)
+	}
+	if mismatch.Closest != 5 || len(mismatch.Differences) != 1 || !strings.HasPrefix(mismatch.Differences[0], "URI: ") {
+		t.Errorf("got mismatch %+v", mismatch)
+	}
+
+	tpv, err := NewTestProxy(WithMode("record"), WithLocalPlayback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); !errors.Is(err, errLocalRecord) {
+		t.Errorf("got error %v in record mode", err)
+	}
+}
+
+func TestLocalPlaybackBypass(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "TestLocalPlaybackBypass.json")
+	rec := &RecordingFile{Entries: []Entry{
+		{RequestUri: "https://account.table.core.windows.net/Tables", RequestMethod: "GET", StatusCode: http.StatusOK},
+	}}
+	if err := rec.WriteFile(recording); err != nil {
+		t.Fatal(err)
+	}
+	tpv, err := NewTestProxy(WithMode("playback"), WithLocalPlayback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpv.CurrentRecordingPath = recording
+	tpv.ExcludedHosts = []string{"login.microsoftonline.com"}
+	tpv.ExcludeURIPatterns = []string{`/telemetry$`}
+	var upstream []string
+	tpv.UpstreamTransport = transporterFunc(func(req *http.Request) (*http.Response, error) {
+		upstream = append(upstream, req.URL.String())
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	defer StopTestProxy(tpv)
+
+	tpt := tpv.Transport(tpv.HttpClient)
+	for _, r := range []struct {
+		ctx context.Context
+		url string
+	}{
+		{context.Background(), "https://account.table.core.windows.net/Tables"},
+		{Live(context.Background()), "https://account.blob.core.windows.net/c?comp=sas"},
+		{context.Background(), "https://login.microsoftonline.com/token"},
+		{context.Background(), "https://account.table.core.windows.net/telemetry"},
+	} {
+		req, err := http.NewRequestWithContext(r.ctx, "GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", r.url, err)
+		}
+		resp.Body.Close()
+	}
+	want := []string{
+		"https://account.blob.core.windows.net/c?comp=sas",
+		"https://login.microsoftonline.com/token",
+		"https://account.table.core.windows.net/telemetry",
+	}
+	if strings.Join(upstream, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent upstream:\n%s\nwant:\n%s", strings.Join(upstream, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLocalPlaybackExcludesTimestamp(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "TestLocalPlaybackTimestamp.json")
+	rec := &RecordingFile{Entries: []Entry{{
+		RequestUri:     "https://account.table.core.windows.net/Tables",
+		RequestMethod:  "GET",
+		RequestHeaders: Headers{TimestampHeader: {"1600000000000000000"}},
+		StatusCode:     http.StatusOK,
+	}}}
+	if err := rec.WriteFile(recording); err != nil {
+		t.Fatal(err)
+	}
+	tpv, err := NewTestProxy(WithMode("playback"), WithLocalPlayback())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpv.CurrentRecordingPath = recording
+	if err := AddTimestampAnnotation(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	defer StopTestProxy(tpv)
+
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(TimestampHeader, "1700000000000000000")
+	resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+	if err != nil {
+		t.Fatalf("the timestamp was compared: %v", err)
+	}
+	resp.Body.Close()
+}
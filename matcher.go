@@ -0,0 +1,123 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are the RFC 7230 connection-specific headers, plus the
+// non-standard Proxy-Connection. TestProxyTransport.Do never forwards them,
+// and the session matcher excludes them so recordings made before they were
+// stripped still play back.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Matcher configures how the proxy matches requests to recorded entries
+// during playback. The zero value is the proxy's default matcher, which
+// compares the method, URI, headers and body.
+type Matcher struct {
+	// IgnoreBodies stops request bodies from being compared.
+	IgnoreBodies bool
+	// ExcludedHeaders are not compared at all, not even for presence.
+	ExcludedHeaders []string
+	// IgnoredHeaders must be present in both requests, but their values
+	// are not compared.
+	IgnoredHeaders []string
+	// IgnoredQueryParameters are removed from URIs before comparing.
+	IgnoredQueryParameters []string
+	// IgnoreQueryOrdering compares query parameters regardless of order.
+	IgnoreQueryOrdering bool
+}
+
+// sessionExcludedHeaders are the headers the session's matcher does not
+// compare: the hop-by-hop headers, Matcher.ExcludedHeaders and the headers
+// the transport adds itself.
+func (tpv *TestProxyVariables) sessionExcludedHeaders() []string {
+	excluded := append(append([]string(nil), hopByHopHeaders...), tpv.Matcher.ExcludedHeaders...)
+	excluded = append(excluded, tpv.excludedHeaders...)
+	if tpv.ExcludeRequestIDs {
+		excluded = append(excluded, clientRequestIDHeader)
+	}
+	return excluded
+}
+
+// setSessionMatcher registers tpv.Matcher, with the hop-by-hop headers and
+// the headers added by request hooks excluded, as the matcher of the current
+// playback session.
+func (tpv *TestProxyVariables) setSessionMatcher() error {
+	m := tpv.Matcher
+	excluded := tpv.sessionExcludedHeaders()
+	marshalled, err := marshalNoEscape(map[string]interface{}{
+		"compareBodies":          !m.IgnoreBodies,
+		"excludedHeaders":        strings.Join(excluded, ","),
+		"ignoredHeaders":         strings.Join(m.IgnoredHeaders, ","),
+		"ignoredQueryParameters": strings.Join(m.IgnoredQueryParameters, ","),
+		"ignoreQueryOrdering":    m.IgnoreQueryOrdering,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://%v:%v/Admin/SetMatcher", tpv.Host, tpv.Port)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(marshalled))
+	if err != nil {
+		return err
+	}
+	headers := tpv.ProxyHeaders.withDefaults()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headers.AbstractionIdentifier, "CustomDefaultMatcher")
+	req.Header.Set(headers.RecordingId, tpv.RecordingId)
+	setClientId(req, tpv)
+
+	resp, err := tpv.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("setting the session matcher: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// removeHopByHopHeaders deletes the hop-by-hop headers from h, including
+// those listed in its Connection header.
+func removeHopByHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range splitHeaderList(value) {
+			h.Del(name)
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// splitHeaderList splits a comma-separated header value into its
+// non-empty elements.
+func splitHeaderList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
@@ -0,0 +1,75 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTransportStripsHopByHopHeaders(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "keep-alive, X-Hop")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Proxy-Connection", "keep-alive")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("x-ms-version", "2019-02-02")
+	resp, err := tpv.Transport(sp.Client()).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got := sp.Requests()[0].Header
+	for _, name := range []string{"Keep-Alive", "Proxy-Connection", "X-Hop"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%s was forwarded", name)
+		}
+	}
+	if got.Get("Accept") != "application/json" || got.Get("x-ms-version") != "2019-02-02" {
+		t.Errorf("end-to-end headers changed: %v", got)
+	}
+}
+
+func TestPlaybackSetsSessionMatcher(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.Matcher = Matcher{IgnoreBodies: true, ExcludedHeaders: []string{"x-ms-client-request-id"}}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := sp.Requests()
+	if len(requests) != 2 || requests[1].Path != "/Admin/SetMatcher" {
+		t.Fatalf("expected start then SetMatcher, got %+v", requests)
+	}
+	if requests[1].Header.Get("x-recording-id") != "stub-recording-id" {
+		t.Errorf("matcher not scoped to the session: %v", requests[1].Header)
+	}
+	var body struct {
+		CompareBodies   bool   `json:"compareBodies"`
+		ExcludedHeaders string `json:"excludedHeaders"`
+	}
+	if err := json.Unmarshal(requests[1].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.CompareBodies {
+		t.Error("compareBodies should be false")
+	}
+	for _, name := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "x-ms-client-request-id"} {
+		if !strings.Contains(","+body.ExcludedHeaders+",", ","+name+",") {
+			t.Errorf("%s not excluded: %s", name, body.ExcludedHeaders)
+		}
+	}
+}
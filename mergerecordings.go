@@ -0,0 +1,97 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// MergeOptions control how MergeRecordingsWithOptions combines recordings.
+type MergeOptions struct {
+	// Dedupe drops an entry when it repeats the method, URI and request
+	// body of the entry just before it, e.g. a shared setup call made at
+	// the end of one test and the start of the next.
+	Dedupe bool
+	// Warn receives a message for every variable defined with different
+	// values by several inputs. It defaults to log.Print.
+	Warn func(msg string)
+}
+
+// MergeRecordings concatenates the entries of the input recordings, in
+// order, into a single recording written to out. Variables are merged with
+// later inputs winning; conflicts are logged. The merged recording is
+// validated before MergeRecordings returns.
+func MergeRecordings(out string, inputs ...string) error {
+	return MergeRecordingsWithOptions(out, MergeOptions{}, inputs...)
+}
+
+// MergeRecordingsWithOptions is MergeRecordings with control over
+// deduplication and conflict warnings.
+func MergeRecordingsWithOptions(out string, opts MergeOptions, inputs ...string) error {
+	warn := opts.Warn
+	if warn == nil {
+		warn = func(msg string) { log.Print(msg) }
+	}
+
+	merged := &RecordingFile{}
+	setBy := map[string]string{}
+	for _, input := range inputs {
+		rec, err := ReadRecordingFile(input)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+
+		for _, e := range rec.Entries {
+			if opts.Dedupe && len(merged.Entries) > 0 && sameRequest(merged.Entries[len(merged.Entries)-1], e) {
+				continue
+			}
+			merged.Entries = append(merged.Entries, e)
+		}
+
+		for k, v := range rec.Variables {
+			if merged.Variables == nil {
+				merged.Variables = map[string]string{}
+			}
+			if old, ok := merged.Variables[k]; ok && old != v {
+				warn(fmt.Sprintf("merging recordings: variable %q is %q in %s and %q in %s; using %q",
+					k, old, setBy[k], v, input, v))
+			}
+			merged.Variables[k] = v
+			setBy[k] = input
+		}
+	}
+
+	// The merged recording is validated before it is written, so a bad
+	// merge never replaces out, which may be one of the inputs.
+	data, err := merged.marshalIndented()
+	if err != nil {
+		return err
+	}
+	if issues := validateRecordingData(out, data); len(issues) > 0 {
+		lines := make([]string, len(issues))
+		for i, issue := range issues {
+			lines[i] = "  " + issue.String()
+		}
+		return fmt.Errorf("merged recording is invalid:\n%s", strings.Join(lines, "\n"))
+	}
+	return merged.WriteFile(out)
+}
+
+// sameRequest reports whether two entries send the same method, URI and
+// request body.
+func sameRequest(a, b Entry) bool {
+	if a.RequestMethod != b.RequestMethod || a.RequestUri != b.RequestUri {
+		return false
+	}
+	var bodyA, bodyB bytes.Buffer
+	if json.Compact(&bodyA, a.RequestBody) != nil || json.Compact(&bodyB, b.RequestBody) != nil {
+		return bytes.Equal(a.RequestBody, b.RequestBody)
+	}
+	return bytes.Equal(bodyA.Bytes(), bodyB.Bytes())
+}
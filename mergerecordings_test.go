@@ -0,0 +1,77 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeRecordings(t *testing.T) {
+	inputs := []string{"testdata/merge/TestCreateTable.json", "testdata/merge/TestListTables.json"}
+
+	for _, tc := range []struct {
+		dedupe bool
+		want   []string
+	}{
+		{false, []string{"POST /Tables", "GET /Tables", "GET /Tables", "DELETE /Tables('merge')"}},
+		{true, []string{"POST /Tables", "GET /Tables", "DELETE /Tables('merge')"}},
+	} {
+		out := filepath.Join(t.TempDir(), "TestMerged.json")
+		var warnings []string
+		opts := MergeOptions{Dedupe: tc.dedupe, Warn: func(msg string) { warnings = append(warnings, msg) }}
+		if err := MergeRecordingsWithOptions(out, opts, inputs...); err != nil {
+			t.Fatal(err)
+		}
+
+		rec, err := ReadRecordingFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range rec.Entries {
+			got = append(got, e.RequestMethod+" "+strings.TrimPrefix(e.RequestUri, "https://account.table.core.windows.net"))
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("dedupe=%v: got entries %q, want %q", tc.dedupe, got, tc.want)
+		}
+
+		wantVars := map[string]string{"tableName": "merge", "seed": "2"}
+		if !reflect.DeepEqual(rec.Variables, wantVars) {
+			t.Errorf("got variables %v, want %v", rec.Variables, wantVars)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], `"seed"`) {
+			t.Errorf("got warnings %q, want one about seed", warnings)
+		}
+	}
+}
+
+func TestMergeRecordingsMissingInput(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "TestMerged.json")
+	if err := MergeRecordings(out, "testdata/merge/TestCreateTable.json", "testdata/merge/TestMissing.json"); err == nil {
+		t.Fatal("expected an error for a missing input")
+	}
+}
+
+func TestMergeRecordingsInvalidKeepsOut(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "TestMerged.json")
+	invalid := `{"Entries":[{"RequestUri":"Tables","RequestMethod":"GET","StatusCode":200}]}`
+	if err := os.WriteFile(out, []byte(invalid), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// out is also an input, and the merge fails validation.
+	err := MergeRecordings(out, "testdata/merge/TestCreateTable.json", out)
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != invalid {
+		t.Errorf("a failed merge changed out: %q, %v", data, err)
+	}
+}
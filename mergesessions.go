@@ -0,0 +1,78 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MergeSessionIDs makes the next playback session serve the entries of
+// several recordings as one virtual session, for tests that call a shared
+// helper which was recorded separately. The proxy only assigns recording
+// IDs once a session starts, so the sub-sessions are named by the paths of
+// their recording files. The test proxy has no notion of merged sessions,
+// so the recordings are interleaved round-robin, one entry from each in
+// turn, into a file next to CurrentRecordingPath that the session plays
+// back instead. The file is removed, and CurrentRecordingPath restored,
+// when the session stops, with or without saving, or fails to start.
+// Variables are merged with later recordings winning. Call MergeSessionIDs
+// before StartTestProxy.
+func MergeSessionIDs(tpv *TestProxyVariables, recordingPaths ...string) error {
+	if tpv.Mode != "playback" {
+		return fmt.Errorf("sessions can only be merged for playback, mode is %q", tpv.Mode)
+	}
+
+	recordings := make([]*RecordingFile, len(recordingPaths))
+	for i, path := range recordingPaths {
+		rec, err := ReadRecordingFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		recordings[i] = rec
+	}
+
+	merged := &RecordingFile{Variables: map[string]string{}}
+	for round := 0; ; round++ {
+		added := false
+		for _, rec := range recordings {
+			if round < len(rec.Entries) {
+				merged.Entries = append(merged.Entries, rec.Entries[round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	for _, rec := range recordings {
+		for k, v := range rec.Variables {
+			merged.Variables[k] = v
+		}
+	}
+
+	path := strings.TrimSuffix(tpv.CurrentRecordingPath, ".json") + ".merged.json"
+	if err := merged.WriteFile(path); err != nil {
+		return err
+	}
+	tpv.mergedRecording = path
+	tpv.unmergedRecordingPath = tpv.CurrentRecordingPath
+	tpv.CurrentRecordingPath = path
+	return nil
+}
+
+// removeMergedRecording removes the file written by MergeSessionIDs once
+// its session has ended, and restores CurrentRecordingPath.
+func (tpv *TestProxyVariables) removeMergedRecording() error {
+	if tpv.mergedRecording == "" {
+		return nil
+	}
+	err := os.Remove(tpv.mergedRecording)
+	recordingCache.Forget(tpv.mergedRecording)
+	tpv.CurrentRecordingPath = tpv.unmergedRecordingPath
+	tpv.mergedRecording, tpv.unmergedRecordingPath = "", ""
+	return err
+}
@@ -0,0 +1,102 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeSessionIDs(t *testing.T) {
+	dir := t.TempDir()
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = filepath.Join(dir, "TestCombined.json")
+
+	if err := MergeSessionIDs(tpv, "testdata/merge/TestCreateTable.json", "testdata/stats/TestTables/TestCreate.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	var started struct {
+		File string `json:"x-recording-file"`
+	}
+	if err := json.Unmarshal(sp.Requests()[0].Body, &started); err != nil {
+		t.Fatal(err)
+	}
+	if started.File != filepath.Join(dir, "TestCombined.merged.json") {
+		t.Fatalf("session started with %s", started.File)
+	}
+
+	rec, err := ReadRecordingFile(started.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range rec.Entries {
+		got = append(got, e.RequestMethod+" "+strings.TrimSuffix(e.RequestUri, ".table.core.windows.net/Tables"))
+	}
+	want := []string{"POST https://account", "POST https://sanitized", "GET https://account", "GET https://sanitized"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+	if rec.Variables["seed"] != "1" || rec.Variables["tableName"] != "merge" {
+		t.Errorf("unexpected variables %v", rec.Variables)
+	}
+
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(started.File); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("merged recording left behind: %v", err)
+	}
+	if tpv.CurrentRecordingPath != filepath.Join(dir, "TestCombined.json") {
+		t.Errorf("recording path not restored: %s", tpv.CurrentRecordingPath)
+	}
+
+	// The merged recording also goes when the session is discarded or
+	// fails to start.
+	var failMatcher bool
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if failMatcher && r.URL.Path == "/Admin/SetMatcher" {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return true
+		}
+		return false
+	}
+	for _, failStart := range []bool{false, true} {
+		if err := MergeSessionIDs(tpv, "testdata/merge/TestCreateTable.json"); err != nil {
+			t.Fatal(err)
+		}
+		failMatcher = failStart
+		if err := StartTestProxy(tpv); (err != nil) != failStart {
+			t.Fatalf("starting with failStart %v: %v", failStart, err)
+		}
+		if !failStart {
+			if err := stopTestProxy(tpv, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := os.Stat(started.File); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("failStart %v: merged recording left behind: %v", failStart, err)
+		}
+		if tpv.CurrentRecordingPath != filepath.Join(dir, "TestCombined.json") {
+			t.Errorf("failStart %v: recording path not restored: %s", failStart, tpv.CurrentRecordingPath)
+		}
+	}
+
+	tpv.Mode = "record"
+	if err := MergeSessionIDs(tpv, "testdata/merge/TestCreateTable.json"); err == nil {
+		t.Error("expected merging to be refused in record mode")
+	}
+}
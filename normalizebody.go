@@ -0,0 +1,59 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// NormalizedTimestamp replaces the timestamps rewritten by
+// NormalizeTimestamps.
+const NormalizedTimestamp = "2001-01-01T00:00:00Z"
+
+// rfc3339Regex matches RFC 3339 timestamps, with optional fractional
+// seconds.
+var rfc3339Regex = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[Tt]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})`)
+
+// NormalizeTimestamps returns a TestProxyTransport.NormalizeBody that
+// replaces RFC 3339 timestamps within window of the current time, which
+// the code under test derived from "now", with NormalizedTimestamp.
+// Timestamps further away, such as fixed dates in test data, are kept.
+func NormalizeTimestamps(window time.Duration) func(contentType string, body []byte) []byte {
+	return func(contentType string, body []byte) []byte {
+		now := time.Now()
+		return rfc3339Regex.ReplaceAllFunc(body, func(match []byte) []byte {
+			ts, err := time.Parse(time.RFC3339Nano, string(match))
+			if err != nil {
+				return match
+			}
+			if d := now.Sub(ts); d > window || d < -window {
+				return match
+			}
+			return []byte(NormalizedTimestamp)
+		})
+	}
+}
+
+// normalizeBody applies tpt.NormalizeBody to a text request body.
+func (tpt *TestProxyTransport) normalizeBody(req *http.Request) error {
+	if tpt.NormalizeBody == nil || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	contentType := req.Header.Get("Content-Type")
+	if !isTextContentType(contentType) {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(tpt.NormalizeBody(contentType, body)))
+	return nil
+}
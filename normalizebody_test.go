@@ -0,0 +1,65 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTimestamps(t *testing.T) {
+	now := time.Now()
+	utc := now.UTC().Format(time.RFC3339Nano)
+	local := now.Add(-30 * time.Second).In(time.FixedZone("", -8*3600)).Format(time.RFC3339)
+	fixed := "2020-02-29T12:00:00Z"
+
+	for _, mode := range []string{"record", "playback"} {
+		sp := newStubProxy(t)
+		tpt := sp.variables(t, mode).Transport(sp.Client())
+		tpt.NormalizeBody = NormalizeTimestamps(time.Minute)
+		send := func(contentType, body string) string {
+			t.Helper()
+			req, err := http.NewRequest("PUT", "https://account.table.core.windows.net/Tables('t')", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			requests := sp.Requests()
+			return string(requests[len(requests)-1].Body)
+		}
+
+		for _, tc := range []struct{ name, contentType, body, want string }{
+			{
+				"JSON",
+				"application/json",
+				`{"created":"` + utc + `","updated":"` + local + `","birthday":"` + fixed + `"}`,
+				`{"created":"2001-01-01T00:00:00Z","updated":"2001-01-01T00:00:00Z","birthday":"2020-02-29T12:00:00Z"}`,
+			},
+			{
+				"XML",
+				"application/xml; charset=utf-8",
+				`<KeyInfo><Start>` + local + `</Start><Expiry>` + fixed + `</Expiry><Stamp>` + utc + `</Stamp></KeyInfo>`,
+				`<KeyInfo><Start>2001-01-01T00:00:00Z</Start><Expiry>2020-02-29T12:00:00Z</Expiry><Stamp>2001-01-01T00:00:00Z</Stamp></KeyInfo>`,
+			},
+			{
+				"binary",
+				"application/octet-stream",
+				"\x00\x01" + utc,
+				"\x00\x01" + utc,
+			},
+		} {
+			if got := send(tc.contentType, tc.body); got != tc.want {
+				t.Errorf("%s in %s: sent %q, want %q", tc.name, mode, got, tc.want)
+			}
+		}
+	}
+}
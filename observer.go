@@ -0,0 +1,76 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Observer is notified of the requests a session's Transport sends to the
+// proxy. Either function may be nil. They are called from the goroutine
+// making the request and must be safe for concurrent use when the session
+// is shared by parallel requests.
+type Observer struct {
+	// Exchange is called once the proxy has answered a request, or the
+	// request has failed. The response body has not been read yet.
+	Exchange func(e Exchange)
+	// Warning is called with typed warnings, such as *TrailerWarning, for
+	// proxy behavior that does not fail a request but may make playback
+	// differ from the live service.
+	Warning func(err error)
+}
+
+// Exchange is a request sent through the proxy and its outcome.
+type Exchange struct {
+	Mode string
+	// URI is the request's URL before it was rerouted to the proxy.
+	URI      string
+	Request  *http.Request
+	Response *http.Response
+	Err      error
+	Duration time.Duration
+	// Attempts is the number of times the request was sent; more than one
+	// when RetryProxyDial resent it after the proxy refused a connection.
+	Attempts int
+}
+
+// TrailerWarning reports response trailers that playback will not
+// reproduce. The proxy's recordings have no place for trailers, so
+// trailers received in record mode are lost; Dropped lists the trailers a
+// response announced but arrived without, which happens when the proxy
+// re-frames the upstream response.
+type TrailerWarning struct {
+	Mode     string
+	Method   string
+	URI      string
+	Trailers []string
+	Dropped  []string
+}
+
+func (w *TrailerWarning) Error() string {
+	if len(w.Dropped) > 0 {
+		return fmt.Sprintf("test proxy dropped the response trailers %s of %s %s", strings.Join(w.Dropped, ", "), w.Method, w.URI)
+	}
+	return fmt.Sprintf("response trailers %s of %s %s are not stored in the recording and will be missing in playback",
+		strings.Join(w.Trailers, ", "), w.Method, w.URI)
+}
+
+func (tpv *TestProxyVariables) observeExchange(e Exchange) {
+	if e.Err == nil {
+		tpv.served.serve(e.Request.Method, e.URI)
+	}
+	if tpv.Observer.Exchange != nil {
+		tpv.Observer.Exchange(e)
+	}
+}
+
+func (tpv *TestProxyVariables) warn(err error) {
+	if tpv.Observer.Warning != nil {
+		tpv.Observer.Warning(err)
+	}
+}
@@ -0,0 +1,180 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Defaults of NewTestProxyFromEnv and DefaultConfig.
+const (
+	DefaultProxyHost = "localhost"
+	DefaultProxyPort = 5001
+	DefaultProxyMode = "record"
+)
+
+// TestProxyOption configures the TestProxyVariables returned by
+// NewTestProxy.
+type TestProxyOption func(tpv *TestProxyVariables)
+
+// NewTestProxy returns TestProxyVariables configured declaratively:
+//
+//	tpv, err := testproxy.NewTestProxy(
+//		testproxy.WithTest(t),
+//		testproxy.WithMode("playback"),
+//		testproxy.WithSanitizers(testproxy.BodyRegexSanitizer{...}, testproxy.HeaderRegexSanitizer{...}),
+//	)
+//
+// Like NewTestProxyVariables, it honours TESTPROXY_CA_BUNDLE and
+// TESTPROXY_CLIENT_ID.
+func NewTestProxy(opts ...TestProxyOption) (*TestProxyVariables, error) {
+	return newTestProxy(clientConfigFromEnv(), opts)
+}
+
+func newTestProxy(cfg Config, opts []TestProxyOption) (*TestProxyVariables, error) {
+	tpv, err := cfg.newVariables()
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(tpv)
+	}
+	if tpv.optionErr != nil {
+		return nil, tpv.optionErr
+	}
+	return tpv, nil
+}
+
+// NewTestProxyFromEnv returns TestProxyVariables for a proxy on
+// localhost:5001 in record mode, unless the environment says otherwise:
+//
+//   - PROXY_URL, e.g. https://proxy.example.com:5001, sets the host and port
+//   - PROXY_HOST and PROXY_PORT override the host and port
+//   - PROXY_MODE sets the mode, "record" or "playback"
+//   - TESTPROXY_CA_BUNDLE and TESTPROXY_CLIENT_ID apply as for
+//     NewTestProxyVariables
+//   - TESTPROXY_SKIP_VERSION_CHECK=1 sets SkipVersionCheck
+//   - TESTPROXY_ARTIFACTS sets ArtifactDir
+//
+// opts are applied after the environment. Pass WithTest(t) to store the
+// recording under recordings/<test name>.json. The result is validated, so
+// a typo in the environment fails here rather than at StartTestProxy.
+func NewTestProxyFromEnv(opts ...TestProxyOption) (*TestProxyVariables, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewTestProxyFromConfig(cfg, opts...)
+}
+
+// NewTestProxyFromConfig returns TestProxyVariables for the proxy cfg
+// describes, without reading the environment. opts are applied after cfg,
+// and the result is validated like that of NewTestProxyFromEnv.
+func NewTestProxyFromConfig(cfg Config, opts ...TestProxyOption) (*TestProxyVariables, error) {
+	tpv, err := newTestProxy(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if tpv.Port < 1 || tpv.Port > 65535 {
+		return nil, fmt.Errorf("proxy port %d is out of range", tpv.Port)
+	}
+	if tpv.Mode != "record" && tpv.Mode != "playback" {
+		return nil, fmt.Errorf("proxy mode %q is neither record nor playback", tpv.Mode)
+	}
+	return tpv, nil
+}
+
+// WithAddress sets the host and port the test proxy listens on.
+func WithAddress(host string, port int) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.Host = host
+		tpv.Port = port
+	}
+}
+
+// WithMode sets the mode, "record" or "playback".
+func WithMode(mode string) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.Mode = mode
+	}
+}
+
+// WithTest stores the session's recording under recordings/<test name>.json
+// in the current directory, like NewTestProxyVariables.
+func WithTest(t *testing.T) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.CurrentRecordingPath = getRecordingFilePath(t, GetCurrentDirectory(), tpv.RecordingVariant)
+	}
+}
+
+// WithRecordingPath stores the session's recording at path, made absolute.
+// NewTestProxy fails if path is a directory or lies under a file, rather
+// than the proxy failing at StartTestProxy. The directory of the recording
+// is created when a record session starts, so building options never
+// changes the file system.
+func WithRecordingPath(path string) TestProxyOption {
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		err = checkRecordingPath(abs)
+	}
+	if err != nil {
+		err = fmt.Errorf("recording path: %w", err)
+	}
+	return func(tpv *TestProxyVariables) {
+		if err != nil {
+			tpv.setOptionErr(err)
+			return
+		}
+		tpv.CurrentRecordingPath = abs
+		tpv.createRecordingDir = abs
+	}
+}
+
+// checkRecordingPath returns an error if a recording cannot be stored at
+// the absolute path abs: if abs is a directory, or its closest existing
+// ancestor is not one.
+func checkRecordingPath(abs string) error {
+	if info, err := os.Stat(abs); err == nil && info.IsDir() {
+		return fmt.Errorf("%s is a directory", abs)
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			return nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil
+		}
+	}
+}
+
+// setOptionErr records the first error of an option for NewTestProxy.
+func (tpv *TestProxyVariables) setOptionErr(err error) {
+	if tpv.optionErr == nil {
+		tpv.optionErr = err
+	}
+}
+
+// WithSanitizers adds sanitizers that StartTestProxy registers for the
+// session once it has started.
+func WithSanitizers(sanitizers ...Sanitizer) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.sanitizers = append(tpv.sanitizers, sanitizers...)
+	}
+}
+
+// WithLocalPlayback plays recordings back in process instead of through
+// the proxy; see TestProxyVariables.LocalPlayback.
+func WithLocalPlayback() TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.LocalPlayback = true
+	}
+}
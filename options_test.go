@@ -0,0 +1,170 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTestProxyWithSanitizers(t *testing.T) {
+	sp := newStubProxy(t)
+	trustStubProxy(t, sp)
+	host, port := sp.hostPort(t)
+
+	tpv, err := NewTestProxy(
+		WithAddress(host, port),
+		WithMode("playback"),
+		WithTest(t),
+		WithSanitizers(
+			BodyRegexSanitizer{Value: "fake", Regex: "AccountKey=[^;]+"},
+			HeaderRegexSanitizer{Key: "Authorization", Value: "Sanitized"},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(tpv.CurrentRecordingPath, "recordings/TestNewTestProxyWithSanitizers.json") {
+		t.Errorf("unexpected recording path %s", tpv.CurrentRecordingPath)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range sp.Requests() {
+		if r.Path == "/Admin/SetMatcher" {
+			continue
+		}
+		got = append(got, strings.Join([]string{r.Path, r.Header.Get("x-recording-id"), r.Header.Get("x-abstraction-identifier"), string(r.Body)}, " "))
+	}
+	want := []string{
+		`/playback/start   {"x-recording-file":"` + tpv.CurrentRecordingPath + `"}`,
+		`/Admin/AddSanitizer stub-recording-id BodyRegexSanitizer {"value":"fake","regex":"AccountKey=[^;]+"}`,
+		`/Admin/AddSanitizer stub-recording-id HeaderRegexSanitizer {"key":"Authorization","value":"Sanitized"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got requests:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAddSanitizerError(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/Admin/AddSanitizer" {
+			http.Error(w, "unknown sanitizer", http.StatusBadRequest)
+			return true
+		}
+		return false
+	}
+	tpv := sp.variables(t, "record")
+	err := tpv.AddSanitizer(UriRegexSanitizer{Value: "fake", Regex: "sig=.*"})
+	if err == nil || !strings.Contains(err.Error(), "unknown sanitizer") {
+		t.Fatalf("expected the proxy's error, got %v", err)
+	}
+}
+
+func TestNewTestProxyFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		host    string
+		port    int
+		mode    string
+		wantErr string
+	}{
+		{name: "defaults", host: "localhost", port: 5001, mode: "record"},
+		{
+			name: "url",
+			env:  map[string]string{"PROXY_URL": "https://proxy.example.com:7001"},
+			host: "proxy.example.com", port: 7001, mode: "record",
+		},
+		{
+			name: "url without port",
+			env:  map[string]string{"PROXY_URL": "https://proxy.example.com"},
+			host: "proxy.example.com", port: 5001, mode: "record",
+		},
+		{
+			name: "partial overrides",
+			env:  map[string]string{"PROXY_URL": "https://proxy.example.com:7001", "PROXY_PORT": "7002", "PROXY_MODE": "playback"},
+			host: "proxy.example.com", port: 7002, mode: "playback",
+		},
+		{name: "invalid port", env: map[string]string{"PROXY_PORT": "five"}, wantErr: "PROXY_PORT"},
+		{name: "port out of range", env: map[string]string{"PROXY_PORT": "70000"}, wantErr: "out of range"},
+		{name: "invalid mode", env: map[string]string{"PROXY_MODE": "replay"}, wantErr: "neither record nor playback"},
+		{name: "http url", env: map[string]string{"PROXY_URL": "http://localhost:5000"}, wantErr: "PROXY_URL"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, name := range []string{"PROXY_URL", "PROXY_HOST", "PROXY_PORT", "PROXY_MODE", "TESTPROXY_CA_BUNDLE", "TESTPROXY_CLIENT_ID"} {
+				t.Setenv(name, tc.env[name])
+			}
+			tpv, err := NewTestProxyFromEnv(WithTest(t))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one mentioning %s", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tpv.Host != tc.host || tpv.Port != tc.port || tpv.Mode != tc.mode || tpv.HttpClient == nil {
+				t.Errorf("got %s:%d in %s mode", tpv.Host, tpv.Port, tpv.Mode)
+			}
+			if !strings.HasSuffix(tpv.CurrentRecordingPath, "recordings/TestNewTestProxyFromEnv/"+strings.ReplaceAll(tc.name, " ", "_")+".json") {
+				t.Errorf("unexpected recording path %s", tpv.CurrentRecordingPath)
+			}
+		})
+	}
+}
+
+func TestWithRecordingPath(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "recordings", "nested", "TestA.json")
+	relative, err := filepath.Rel(wd, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sp := newStubProxy(t)
+	host, port := sp.hostPort(t)
+	tpv, err := NewTestProxy(WithAddress(host, port), WithMode("record"), WithRecordingPath(relative))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpv.CurrentRecordingPath != want {
+		t.Errorf("got recording path %s, want %s", tpv.CurrentRecordingPath, want)
+	}
+	// The directory is created by the session, not by the option.
+	if _, err := os.Stat(filepath.Dir(want)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("building the options created the recording directory: %v", err)
+	}
+	tpv.HttpClient = sp.Client()
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Dir(want)); err != nil || !info.IsDir() {
+		t.Errorf("recording directory not created: %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(file, "TestA.json"), filepath.Join(dir, "recordings")} {
+		if _, err := NewTestProxy(WithMode("record"), WithRecordingPath(path)); err == nil || !strings.HasPrefix(err.Error(), "recording path: ") {
+			t.Errorf("%s: got error %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// MetadataPackageRecording is the recording metadata key set to "true" on
+// the recordings of StartPackageRecording, which GarbageCollectRecordings
+// keeps although no test has their name.
+const MetadataPackageRecording = "packageRecording"
+
+// Recording is a session shared by the tests of a package; see
+// StartPackageRecording.
+type Recording struct {
+	Name string
+
+	tpv *TestProxyVariables
+
+	mu    sync.Mutex
+	tests []string
+}
+
+// packageRecording is the Recording started by StartPackageRecording and
+// not yet stopped.
+var packageRecording struct {
+	mu  sync.Mutex
+	rec *Recording
+}
+
+// StartPackageRecording starts a session that tests opt into with
+// UseSharedRecording instead of starting their own, for cheap tests that
+// do not warrant a recording each. Its recording is stored under
+// recordings/<name>.json. Start it in TestMain and stop it after the tests
+// have run:
+//
+//	func TestMain(m *testing.M) {
+//		rec, err := testproxy.StartPackageRecording("smoke", tpv)
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		code := m.Run()
+//		if err := rec.Stop(); err != nil {
+//			log.Fatal(err)
+//		}
+//		fmt.Print(rec.Report())
+//		os.Exit(code)
+//	}
+//
+// The tests sharing the recording share its entries, variables and
+// matcher, so they must not run in parallel with each other, and none of
+// them may change the session's matcher or sanitizers for the others.
+// Only one package recording can be active at a time.
+func StartPackageRecording(name string, tpv *TestProxyVariables) (*Recording, error) {
+	packageRecording.mu.Lock()
+	defer packageRecording.mu.Unlock()
+	if packageRecording.rec != nil {
+		return nil, fmt.Errorf("package recording %s is already active", packageRecording.rec.Name)
+	}
+	tpv.CurrentRecordingPath = path.Join(GetCurrentDirectory(), "recordings", name+".json")
+	if tpv.RecordingMetadata == nil {
+		tpv.RecordingMetadata = map[string]string{}
+	}
+	tpv.RecordingMetadata[MetadataPackageRecording] = "true"
+	if err := StartTestProxy(tpv); err != nil {
+		return nil, err
+	}
+	rec := &Recording{Name: name, tpv: tpv}
+	packageRecording.rec = rec
+	return rec, nil
+}
+
+// UseSharedRecording returns the session of the package recording for t,
+// and records t among the tests sharing it. It fails t when no package
+// recording is active.
+func UseSharedRecording(t testing.TB) *TestProxyVariables {
+	t.Helper()
+	packageRecording.mu.Lock()
+	rec := packageRecording.rec
+	packageRecording.mu.Unlock()
+	if rec == nil {
+		t.Fatal("no package recording is active; start one in TestMain with StartPackageRecording")
+	}
+	rec.mu.Lock()
+	rec.tests = append(rec.tests, t.Name())
+	rec.mu.Unlock()
+	return rec.tpv
+}
+
+// Variables returns the session of the recording.
+func (r *Recording) Variables() *TestProxyVariables {
+	return r.tpv
+}
+
+// Tests returns the names of the tests that used the recording, in the
+// order they opted in.
+func (r *Recording) Tests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.tests...)
+}
+
+// Stop stops the session of the recording, saving it, and lets another
+// package recording start.
+func (r *Recording) Stop() error {
+	packageRecording.mu.Lock()
+	defer packageRecording.mu.Unlock()
+	if packageRecording.rec != r {
+		return errors.New("package recording " + r.Name + " is not active")
+	}
+	if err := StopTestProxy(r.tpv); err != nil {
+		return err
+	}
+	packageRecording.rec = nil
+	return nil
+}
+
+// Report lists the tests that used the recording, each marked as shared:
+//
+//	TestListTables [shared recording smoke: recordings/smoke.json]
+func (r *Recording) Report() string {
+	var b strings.Builder
+	for _, test := range r.Tests() {
+		fmt.Fprintf(&b, "%s [shared recording %s: %s]\n", test, r.Name, r.tpv.CurrentRecordingPath)
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackageRecording(t *testing.T) {
+	sp := newStubProxy(t)
+	path := filepath.Join(GetCurrentDirectory(), "recordings", "smoke.json")
+	t.Cleanup(func() { os.Remove(path) })
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/record/stop" {
+			// The stub stands in for the proxy saving the recording.
+			if err := (&RecordingFile{}).WriteFile(path); err != nil {
+				t.Error(err)
+			}
+		}
+		return false
+	}
+	rec, err := StartPackageRecording("smoke", sp.variables(t, "record"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StartPackageRecording("other", sp.variables(t, "record")); err == nil {
+		t.Error("a second package recording started")
+	}
+	if filepath.Base(rec.Variables().CurrentRecordingPath) != "smoke.json" {
+		t.Errorf("got recording %s", rec.Variables().CurrentRecordingPath)
+	}
+
+	for _, name := range []string{"ListTables", "GetEntity"} {
+		t.Run(name, func(t *testing.T) {
+			if tpv := UseSharedRecording(t); tpv != rec.Variables() {
+				t.Error("the test did not get the shared session")
+			}
+		})
+	}
+
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Stop(); err == nil {
+		t.Error("stopped the recording twice")
+	}
+	saved, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Metadata()[MetadataPackageRecording] != "true" {
+		t.Errorf("the recording is not tagged as a package recording: %v", saved.Metadata())
+	}
+	starts, stops := 0, 0
+	for _, r := range sp.Requests() {
+		switch r.Path {
+		case "/record/start":
+			starts++
+		case "/record/stop":
+			stops++
+		}
+	}
+	if starts != 1 || stops != 1 {
+		t.Errorf("got %d sessions started and %d stopped, want one shared session", starts, stops)
+	}
+
+	report := rec.Report()
+	lines := strings.Split(strings.TrimSuffix(report, "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "TestPackageRecording/ListTables [shared recording smoke: ") ||
+		!strings.HasPrefix(lines[1], "TestPackageRecording/GetEntity [shared recording smoke: ") {
+		t.Errorf("got report:\n%s", report)
+	}
+
+	// Tests cannot opt in once the recording has stopped.
+	r := &errorRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		UseSharedRecording(fatalRecorder{r})
+	}()
+	<-done
+	if len(r.errors) != 1 {
+		t.Errorf("got errors %v, want the missing package recording reported", r.errors)
+	}
+}
@@ -0,0 +1,58 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PackageSummary is the recording footprint of a package's tests.
+type PackageSummary struct {
+	// TotalTests counts the recordings, one per recorded test.
+	TotalTests         int   `json:"totalTests"`
+	TotalEntries       int   `json:"totalEntries"`
+	TotalFileSizeBytes int64 `json:"totalFileSizeBytes"`
+	// UniqueHosts lists the upstream hosts of the entries, as recorded,
+	// i.e. after sanitization, in sorted order.
+	UniqueHosts            []string    `json:"uniqueHosts"`
+	StatusCodeDistribution map[int]int `json:"statusCodeDistribution"`
+	// OldestRecording and NewestRecording are the times the least and
+	// most recently recorded recordings were made, as computed by Stats,
+	// or nil when there are none.
+	OldestRecording *time.Time `json:"oldestRecording,omitempty"`
+	NewestRecording *time.Time `json:"newestRecording,omitempty"`
+}
+
+// AggregatePackageRecordings summarizes the recordings of the package in
+// packageDir, which its tests keep under packageDir/recordings; see
+// WithTest. It builds on Stats, but unlike Stats it fails on a recording it
+// cannot parse.
+func AggregatePackageRecordings(packageDir string) (PackageSummary, error) {
+	summary := PackageSummary{UniqueHosts: []string{}, StatusCodeDistribution: map[int]int{}}
+
+	dir := filepath.Join(packageDir, "recordings")
+	stats, err := Stats(dir)
+	if err != nil {
+		return summary, err
+	}
+	if stats.CorruptRecordings > 0 {
+		return summary, fmt.Errorf("%s: %d recordings could not be parsed", dir, stats.CorruptRecordings)
+	}
+
+	summary.TotalTests = stats.Recordings
+	summary.TotalEntries = stats.Entries
+	summary.TotalFileSizeBytes = stats.Size
+	summary.StatusCodeDistribution = stats.StatusCodes
+	summary.OldestRecording = stats.OldestRecordedAt
+	summary.NewestRecording = stats.NewestRecordedAt
+	for host := range stats.Hosts {
+		summary.UniqueHosts = append(summary.UniqueHosts, host)
+	}
+	sort.Strings(summary.UniqueHosts)
+	return summary, nil
+}
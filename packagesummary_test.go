@@ -0,0 +1,97 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAggregatePackageRecordings(t *testing.T) {
+	dir := t.TempDir()
+	oldest := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	var size int64
+	for name, rec := range map[string]struct {
+		entries []Entry
+		mtime   time.Time
+	}{
+		"TestTables.json": {[]Entry{
+			{RequestUri: "https://Sanitized.table.core.windows.net/Tables", RequestMethod: "POST", StatusCode: 201},
+			{RequestUri: "https://sanitized.table.core.windows.net/Tables('t')", RequestMethod: "DELETE", StatusCode: 204},
+		}, oldest.Add(48 * time.Hour)},
+		"TestBlobs/TestUpload.json": {[]Entry{
+			{RequestUri: "https://sanitized.blob.core.windows.net/c/b", RequestMethod: "PUT", StatusCode: 201},
+			{RequestUri: "https://sanitized.blob.core.windows.net/c/missing", RequestMethod: "GET", StatusCode: 404},
+			{RequestUri: "/relative", RequestMethod: "GET", StatusCode: 201},
+		}, oldest},
+	} {
+		path := filepath.Join(dir, "recordings", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&RecordingFile{Entries: rec.entries}).WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, rec.mtime, rec.mtime); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+
+	summary, err := AggregatePackageRecordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PackageSummary{
+		TotalTests:             2,
+		TotalEntries:           5,
+		TotalFileSizeBytes:     size,
+		UniqueHosts:            []string{"sanitized.blob.core.windows.net", "sanitized.table.core.windows.net"},
+		StatusCodeDistribution: map[int]int{201: 3, 204: 1, 404: 1},
+	}
+	if summary.OldestRecording == nil || summary.NewestRecording == nil ||
+		!summary.OldestRecording.Equal(oldest) || !summary.NewestRecording.Equal(oldest.Add(48*time.Hour)) {
+		t.Errorf("got recordings from %v to %v", summary.OldestRecording, summary.NewestRecording)
+	}
+	summary.OldestRecording, summary.NewestRecording = nil, nil
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("got %+v, want %+v", summary, want)
+	}
+
+	// A corrupt recording fails the summary.
+	if err := os.WriteFile(filepath.Join(dir, "recordings", "TestCorrupt.json"), []byte(`{"Entries": [{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AggregatePackageRecordings(dir); err == nil {
+		t.Error("expected an error for the corrupt recording")
+	}
+}
+
+func TestAggregatePackageRecordingsEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "recordings"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := AggregatePackageRecordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Recording\"") {
+		t.Errorf("got %s, want no recording times without recordings", data)
+	}
+}
@@ -0,0 +1,59 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pager is the paging pattern of the Azure SDK, implemented by the
+// runtime.Pager returned by methods such as NewListEntitiesPager.
+type Pager[T any] interface {
+	More() bool
+	NextPage(ctx context.Context) (T, error)
+}
+
+// PagerRecordingSummary describes the pages read by RecordPager.
+type PagerRecordingSummary struct {
+	Pages int
+	// The pages were recorded or played back by the session's entries
+	// FirstEntry up to, not including, EndEntry.
+	FirstEntry int
+	EndEntry   int
+}
+
+// Entries returns the number of entries the pages took.
+func (s PagerRecordingSummary) Entries() int {
+	return s.EndEntry - s.FirstEntry
+}
+
+// RecordPager reads every page of pager in the session of tpv, calling
+// assert with each. The pager's client must send its requests through
+// tpv's Transport for its entries to be counted. When a page fails,
+// RecordPager returns the summary of the pages read before it with the
+// error.
+func RecordPager[T any](ctx context.Context, tpv *TestProxyVariables, pager Pager[T], assert func(T)) (PagerRecordingSummary, error) {
+	summary := PagerRecordingSummary{FirstEntry: tpv.entryCount()}
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			summary.EndEntry = tpv.entryCount()
+			return summary, fmt.Errorf("page %d: %w", summary.Pages+1, err)
+		}
+		summary.Pages++
+		assert(page)
+	}
+	summary.EndEntry = tpv.entryCount()
+	return summary, nil
+}
+
+// entryCount returns the number of entries the session has recorded or
+// played back through Transport.
+func (tpv *TestProxyVariables) entryCount() int {
+	tpv.hashes.mu.Lock()
+	defer tpv.hashes.mu.Unlock()
+	return tpv.hashes.next
+}
@@ -0,0 +1,76 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// itemPager pages through https://example.com/items with one GET per page.
+type itemPager struct {
+	tpt       policy.Transporter
+	page, end int
+	failAt    int
+}
+
+func (p *itemPager) More() bool { return p.page < p.end }
+
+func (p *itemPager) NextPage(ctx context.Context) (int, error) {
+	p.page++
+	if p.page == p.failAt {
+		return 0, errors.New("service unavailable")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://example.com/items?page=%d", p.page), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.tpt.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return p.page, nil
+}
+
+func TestRecordPager(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	tpt := tpv.Transport(sp.Client())
+
+	// An entry before the pager shifts its range.
+	req, _ := http.NewRequest("GET", "https://example.com/tables", nil)
+	resp, err := tpt.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	var pages []int
+	summary, err := RecordPager[int](context.Background(), tpv, &itemPager{tpt: tpt, end: 3}, func(page int) {
+		pages = append(pages, page)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PagerRecordingSummary{Pages: 3, FirstEntry: 1, EndEntry: 4}
+	if summary != want || summary.Entries() != 3 || fmt.Sprint(pages) != "[1 2 3]" {
+		t.Errorf("got %+v with pages %v, want %+v", summary, pages, want)
+	}
+
+	summary, err = RecordPager[int](context.Background(), tpv, &itemPager{tpt: tpt, end: 3, failAt: 2}, func(int) {})
+	want = PagerRecordingSummary{Pages: 1, FirstEntry: 4, EndEntry: 5}
+	if err == nil || err.Error() != "page 2: service unavailable" || summary != want {
+		t.Errorf("got %+v, %v, want %+v and the failure of page 2", summary, err, want)
+	}
+}
@@ -5,23 +5,130 @@
 package testproxy
 
 import (
+	"fmt"
 	"os"
 	"strings"
 )
 
-func Load(root string) error {
-	envFile, err := os.ReadFile(root)
+// DefaultEncryptedPrefix marks the encrypted values of a .env file, as
+// written by SOPS: ENC[AES256_GCM,data:...].
+const DefaultEncryptedPrefix = "ENC["
+
+// Environment holds the variables of a .env file read by LoadEnvironment.
+type Environment map[string]string
+
+// ValueDecoder decrypts the raw value of the variable key, e.g. by calling
+// sops or age.
+type ValueDecoder func(key, raw string) (string, error)
+
+// LoadOption configures Load, LoadEnvironment and LoadConfig.
+type LoadOption func(o *loadOptions)
+
+type loadOptions struct {
+	prefix string
+	decode ValueDecoder
+}
+
+// WithValueDecoder has the .env file loaders pass the values starting with prefix, or with
+// DefaultEncryptedPrefix when prefix is empty, through decode. Other values
+// are loaded as they are.
+func WithValueDecoder(prefix string, decode ValueDecoder) LoadOption {
+	return func(o *loadOptions) {
+		if prefix == "" {
+			prefix = DefaultEncryptedPrefix
+		}
+		o.prefix = prefix
+		o.decode = decode
+	}
+}
+
+// DecodeError reports a .env value that the ValueDecoder failed to decode.
+// Its message names the variable only, so that neither the encrypted nor
+// the decrypted value ends up in test logs; the decoder's error is
+// available through errors.Unwrap.
+type DecodeError struct {
+	Path string
+	Key  string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: decoding the value of %s failed", e.Path, e.Key)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Load reads the variables of the .env file at path, one "NAME value" pair
+// per line, and sets them in the process environment. To leave the
+// environment untouched, use LoadEnvironment or LoadConfig instead.
+func Load(path string, opts ...LoadOption) error {
+	env, err := LoadEnvironment(path, opts...)
 	if err != nil {
 		return err
 	}
+	for key, value := range env {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadEnvironment reads the variables of the .env file at path, as Load
+// does, without setting them in the process environment. Pass the result's
+// Lookup to ConfigFromLookup to configure the proxy from it.
+func LoadEnvironment(path string, opts ...LoadOption) (Environment, error) {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	envFile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	env := Environment{}
 	for _, line := range strings.Split(string(envFile), "\n") {
 		splits := strings.Split(line, " ")
 		if len(splits) != 2 {
 			continue
 		}
 
-		os.Setenv(splits[0], strings.TrimSuffix(splits[1], "\r"))
+		key, value := splits[0], strings.TrimSuffix(splits[1], "\r")
+		if o.decode != nil && strings.HasPrefix(value, o.prefix) {
+			if value, err = o.decode(key, value); err != nil {
+				return nil, &DecodeError{Path: path, Key: key, Err: err}
+			}
+		}
+		env[key] = value
 	}
 
-	return nil
+	return env, nil
+}
+
+// LoadConfig returns the Config described by the .env file at path, with
+// the variables it does not set taken from the process environment, which
+// is left untouched.
+func LoadConfig(path string, opts ...LoadOption) (Config, error) {
+	env, err := LoadEnvironment(path, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+	return ConfigFromLookup(env.Lookup)
+}
+
+// Lookup returns the variable from the file or, when the file does not
+// set it, from the process environment.
+func (env Environment) Lookup(key string) (string, bool) {
+	if v, ok := env[key]; ok {
+		return v, true
+	}
+	return os.LookupEnv(key)
+}
+
+// Get is Lookup without the second result.
+func (env Environment) Get(key string) string {
+	v, _ := env.Lookup(key)
+	return v
 }
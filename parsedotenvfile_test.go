@@ -0,0 +1,101 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("USE_PROXY true\r\nPROXY_MODE playback\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Restore the variables when the test ends.
+	t.Setenv("USE_PROXY", "")
+	t.Setenv("PROXY_MODE", "")
+
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv("USE_PROXY") != "true" || os.Getenv("PROXY_MODE") != "playback" {
+		t.Errorf("USE_PROXY = %q, PROXY_MODE = %q", os.Getenv("USE_PROXY"), os.Getenv("PROXY_MODE"))
+	}
+	if err := Load(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestLoadWithValueDecoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "COSMOS_CONNECTION_STRING ENC[fake,data:c2VjcmV0]\nUSE_PROXY true\nPROXY_MODE ENC[fake,data:cGxheWJhY2s=]\r\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The fake decoder "decrypts" by mapping the ciphertexts it knows.
+	plaintexts := map[string]string{
+		"ENC[fake,data:c2VjcmV0]":     "AccountKey=secret",
+		"ENC[fake,data:cGxheWJhY2s=]": "playback",
+	}
+	var decoded []string
+	decode := func(key, raw string) (string, error) {
+		decoded = append(decoded, key)
+		if v, ok := plaintexts[raw]; ok {
+			return v, nil
+		}
+		return "", errors.New("cannot decrypt " + raw)
+	}
+
+	env, err := LoadEnvironment(path, WithValueDecoder("", decode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["COSMOS_CONNECTION_STRING"] != "AccountKey=secret" || env["PROXY_MODE"] != "playback" {
+		t.Errorf("got %v", env)
+	}
+	// Values without the prefix are not passed to the decoder.
+	if env["USE_PROXY"] != "true" || strings.Join(decoded, ",") != "COSMOS_CONNECTION_STRING,PROXY_MODE" {
+		t.Errorf("USE_PROXY = %q, decoded %v", env["USE_PROXY"], decoded)
+	}
+
+	// Without a decoder, the values are loaded as they are.
+	env, err = LoadEnvironment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["PROXY_MODE"] != "ENC[fake,data:cGxheWJhY2s=]" {
+		t.Errorf("PROXY_MODE = %q", env["PROXY_MODE"])
+	}
+
+	// A failure names the key but neither the ciphertext nor a plaintext.
+	delete(plaintexts, "ENC[fake,data:c2VjcmV0]")
+	_, err = LoadEnvironment(path, WithValueDecoder(DefaultEncryptedPrefix, decode))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Key != "COSMOS_CONNECTION_STRING" {
+		t.Fatalf("got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "COSMOS_CONNECTION_STRING") || strings.Contains(msg, "c2VjcmV0") || strings.Contains(msg, "secret") {
+		t.Errorf("message %q", msg)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Error("the decoder's error is not wrapped")
+	}
+
+	// A custom prefix selects other values.
+	decoded = nil
+	if _, err := LoadEnvironment(path, WithValueDecoder("tr", func(key, raw string) (string, error) {
+		decoded = append(decoded, key)
+		return raw, nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(decoded, ",") != "USE_PROXY" {
+		t.Errorf("decoded %v", decoded)
+	}
+}
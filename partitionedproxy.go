@@ -0,0 +1,285 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ProxyLauncher starts a test proxy instance for a partition and returns
+// its address and a function that shuts it down.
+type ProxyLauncher func(partition int) (host string, port int, shutdown func() error, err error)
+
+// ProxyPartitioner gives each group of tests its own test proxy instance,
+// so that session-scoped state such as sanitizers never leaks between
+// tests running in parallel. A test is assigned to a partition by the hash
+// of its top-level name, so subtests share their parent's instance.
+// Instances are started on first use and, when IdleTimeout is positive,
+// shut down once no test has used them for that long.
+type ProxyPartitioner struct {
+	// Launch starts an instance. It defaults to TestProxyLauncher for the
+	// current directory.
+	Launch ProxyLauncher
+	// Partitions is the number of instances that may run at once. It
+	// defaults to the value of -test.parallel, or GOMAXPROCS.
+	Partitions  int
+	IdleTimeout time.Duration
+	// Config, when set, supplies the mode of the sessions and how to talk
+	// to the instances, instead of the environment. Its Host and Port are
+	// ignored.
+	Config *Config
+
+	mu         sync.Mutex
+	partitions map[int]*partition
+	instances  []*ProxyInstance
+}
+
+// ProxyInstance is an instance started by a ProxyPartitioner and the tests
+// it served.
+type ProxyInstance struct {
+	Partition int
+	Host      string
+	Port      int
+	Tests     []string
+	Started   time.Time
+	// Stopped is zero while the instance runs.
+	Stopped time.Time
+
+	shutdown func() error
+}
+
+type partition struct {
+	mu       sync.Mutex
+	instance *ProxyInstance
+	leases   int
+	// releases counts the releases, so that an idle timer can tell
+	// whether the partition has been used since it was set.
+	releases int
+}
+
+// DefaultProxyPartitioner is the partitioner used by PartitionedProxy.
+var DefaultProxyPartitioner = &ProxyPartitioner{IdleTimeout: time.Minute}
+
+// PartitionedProxy returns TestProxyVariables for an instance of
+// DefaultProxyPartitioner dedicated to t's partition. The mode is read from
+// PROXY_MODE unless the partitioner has a Config. Start a session on it
+// with StartTestProxy as usual; the instance is released when t completes.
+func PartitionedProxy(t *testing.T) *TestProxyVariables {
+	return DefaultProxyPartitioner.Proxy(t)
+}
+
+// Proxy returns TestProxyVariables for the instance of t's partition,
+// starting the instance if it is not running.
+func (p *ProxyPartitioner) Proxy(t *testing.T) *TestProxyVariables {
+	t.Helper()
+	instance, release, err := p.lease(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(release)
+
+	if p.Config != nil {
+		tpv, err := NewTestProxyFromConfig(*p.Config, WithAddress(instance.Host, instance.Port), WithTest(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tpv
+	}
+	tpv := NewTestProxyVariables(t)
+	tpv.Host, tpv.Port = instance.Host, instance.Port
+	tpv.Mode = os.Getenv("PROXY_MODE")
+	return tpv
+}
+
+// partitionOf returns the partition of the test with the given name.
+func (p *ProxyPartitioner) partitionOf(name string) int {
+	n := p.Partitions
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+		if f := flag.Lookup("test.parallel"); f != nil {
+			if parallel, err := strconv.Atoi(f.Value.String()); err == nil && parallel > 0 {
+				n = parallel
+			}
+		}
+	}
+	topLevel := strings.SplitN(name, "/", 2)[0]
+	h := fnv.New32a()
+	h.Write([]byte(topLevel))
+	return int(h.Sum32() % uint32(n))
+}
+
+// lease returns the running instance of the named test's partition,
+// starting one if needed, and a function that releases it.
+func (p *ProxyPartitioner) lease(name string) (*ProxyInstance, func(), error) {
+	key := p.partitionOf(name)
+	p.mu.Lock()
+	if p.partitions == nil {
+		p.partitions = map[int]*partition{}
+	}
+	part := p.partitions[key]
+	if part == nil {
+		part = &partition{}
+		p.partitions[key] = part
+	}
+	p.mu.Unlock()
+
+	part.mu.Lock()
+	defer part.mu.Unlock()
+	if part.instance == nil {
+		launch := p.Launch
+		if launch == nil {
+			launch = TestProxyLauncher(GetCurrentDirectory())
+		}
+		host, port, shutdown, err := launch(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("starting the test proxy for partition %d: %w", key, err)
+		}
+		part.instance = &ProxyInstance{Partition: key, Host: host, Port: port, Started: time.Now(), shutdown: shutdown}
+		p.mu.Lock()
+		p.instances = append(p.instances, part.instance)
+		p.mu.Unlock()
+	}
+	part.leases++
+	instance := part.instance
+	p.mu.Lock()
+	instance.Tests = append(instance.Tests, name)
+	p.mu.Unlock()
+
+	var once sync.Once
+	return instance, func() { once.Do(func() { p.release(part) }) }, nil
+}
+
+func (p *ProxyPartitioner) release(part *partition) {
+	part.mu.Lock()
+	defer part.mu.Unlock()
+	part.leases--
+	part.releases++
+	if part.leases > 0 || p.IdleTimeout <= 0 {
+		return
+	}
+	releases := part.releases
+	time.AfterFunc(p.IdleTimeout, func() {
+		part.mu.Lock()
+		defer part.mu.Unlock()
+		if part.leases == 0 && part.releases == releases && part.instance != nil {
+			p.stop(part.instance)
+			part.instance = nil
+		}
+	})
+}
+
+// stop shuts instance down and records when it stopped.
+func (p *ProxyPartitioner) stop(instance *ProxyInstance) error {
+	err := instance.shutdown()
+	p.mu.Lock()
+	instance.Stopped = time.Now()
+	p.mu.Unlock()
+	return err
+}
+
+// Shutdown stops every running instance, whether or not tests still use
+// it. Call it from TestMain after the tests have run.
+func (p *ProxyPartitioner) Shutdown() error {
+	p.mu.Lock()
+	parts := make([]*partition, 0, len(p.partitions))
+	for _, part := range p.partitions {
+		parts = append(parts, part)
+	}
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, part := range parts {
+		part.mu.Lock()
+		if part.instance != nil {
+			if err := p.stop(part.instance); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			part.instance = nil
+		}
+		part.mu.Unlock()
+	}
+	return firstErr
+}
+
+// PartitionReport lists the instances a ProxyPartitioner started, in the
+// order they were started.
+type PartitionReport struct {
+	Instances []ProxyInstance
+}
+
+// Report returns the instances started so far and the tests each served.
+func (p *ProxyPartitioner) Report() PartitionReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var report PartitionReport
+	for _, instance := range p.instances {
+		copied := *instance
+		copied.Tests = append([]string(nil), instance.Tests...)
+		report.Instances = append(report.Instances, copied)
+	}
+	return report
+}
+
+func (r PartitionReport) String() string {
+	var b strings.Builder
+	for _, instance := range r.Instances {
+		state := "running"
+		if !instance.Stopped.IsZero() {
+			state = fmt.Sprintf("stopped after %v", instance.Stopped.Sub(instance.Started).Round(time.Millisecond))
+		}
+		fmt.Fprintf(&b, "partition %d, %s (%s): %s\n", instance.Partition,
+			net.JoinHostPort(instance.Host, strconv.Itoa(instance.Port)), state, strings.Join(instance.Tests, ", "))
+	}
+	return b.String()
+}
+
+// TestProxyLauncher starts the test-proxy tool on a free local port, with
+// recordings stored under storageLocation, and waits for it to accept
+// connections. The process is monitored with StartProxyProcess.
+func TestProxyLauncher(storageLocation string) ProxyLauncher {
+	return func(int) (string, int, func() error, error) {
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			return "", 0, nil, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		cmd := exec.Command("test-proxy", "start", "--storage-location", storageLocation)
+		cmd.Env = append(os.Environ(), fmt.Sprintf("ASPNETCORE_URLS=https://localhost:%d", port))
+		address := net.JoinHostPort("localhost", strconv.Itoa(port))
+		process, err := StartProxyProcess(cmd, address)
+		if err != nil {
+			return "", 0, nil, err
+		}
+		shutdown := process.Stop
+
+		for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+			if conn, err := net.Dial("tcp", address); err == nil {
+				conn.Close()
+				return "localhost", port, shutdown, nil
+			}
+			if err := process.Health(); err != nil {
+				shutdown()
+				return "", 0, nil, err
+			}
+			if time.Now().After(deadline) {
+				shutdown()
+				return "", 0, nil, fmt.Errorf("test-proxy did not listen on %s within 30s", address)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubLauncher starts stub listeners in place of proxy instances.
+type stubLauncher struct {
+	mu      sync.Mutex
+	running map[int]*httptest.Server
+	started int
+}
+
+func (sl *stubLauncher) launch(partition int) (string, int, func() error, error) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.Listener.Addr().(*net.TCPAddr)
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if sl.running == nil {
+		sl.running = map[int]*httptest.Server{}
+	}
+	sl.running[addr.Port] = srv
+	sl.started++
+	return addr.IP.String(), addr.Port, func() error {
+		sl.mu.Lock()
+		delete(sl.running, addr.Port)
+		sl.mu.Unlock()
+		srv.Close()
+		return nil
+	}, nil
+}
+
+func (sl *stubLauncher) counts() (started, running int) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.started, len(sl.running)
+}
+
+// testsInPartitions returns top-level test names that fall in distinct
+// partitions of p.
+func testsInPartitions(p *ProxyPartitioner, n int) []string {
+	var names []string
+	seen := map[int]bool{}
+	for i := 0; len(names) < n; i++ {
+		name := fmt.Sprintf("TestWorker%d", i)
+		if partition := p.partitionOf(name); !seen[partition] {
+			seen[partition] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestProxyPartitionerKeying(t *testing.T) {
+	sl := &stubLauncher{}
+	p := &ProxyPartitioner{Launch: sl.launch, Partitions: 3}
+	defer p.Shutdown()
+	workers := testsInPartitions(p, 3)
+
+	// Several workers, each running subtests in parallel.
+	var wg sync.WaitGroup
+	ports := make([]map[int]bool, len(workers))
+	var mu sync.Mutex
+	for w, worker := range workers {
+		ports[w] = map[int]bool{}
+		for sub := 0; sub < 4; sub++ {
+			wg.Add(1)
+			go func(w int, name string) {
+				defer wg.Done()
+				instance, release, err := p.lease(name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer release()
+				mu.Lock()
+				ports[w][instance.Port] = true
+				mu.Unlock()
+			}(w, fmt.Sprintf("%s/case%d", worker, sub))
+		}
+	}
+	wg.Wait()
+
+	all := map[int]bool{}
+	for w, used := range ports {
+		if len(used) != 1 {
+			t.Errorf("%s was served by %d instances", workers[w], len(used))
+		}
+		for port := range used {
+			all[port] = true
+		}
+	}
+	if started, _ := sl.counts(); started != 3 || len(all) != 3 {
+		t.Errorf("started %d instances for %d distinct ports, want 3", started, len(all))
+	}
+
+	report := p.Report()
+	if len(report.Instances) != 3 {
+		t.Fatalf("report has %d instances", len(report.Instances))
+	}
+	for _, instance := range report.Instances {
+		if len(instance.Tests) != 4 {
+			t.Errorf("partition %d served %v", instance.Partition, instance.Tests)
+		}
+		for _, name := range instance.Tests {
+			if p.partitionOf(name) != instance.Partition {
+				t.Errorf("%s served by partition %d", name, instance.Partition)
+			}
+		}
+	}
+}
+
+func TestProxyPartitionerIdleShutdown(t *testing.T) {
+	sl := &stubLauncher{}
+	p := &ProxyPartitioner{Launch: sl.launch, Partitions: 1, IdleTimeout: 50 * time.Millisecond}
+	defer p.Shutdown()
+
+	_, releaseA, err := p.lease("TestA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, releaseB, err := p.lease("TestB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseA()
+	time.Sleep(150 * time.Millisecond)
+	if _, running := sl.counts(); running != 1 {
+		t.Fatal("instance shut down while still leased")
+	}
+
+	releaseB()
+	releaseB()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, running := sl.counts(); running != 0; _, running = sl.counts() {
+		if time.Now().After(deadline) {
+			t.Fatal("idle instance was not shut down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	second, releaseC, err := p.lease("TestC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseC()
+	if started, _ := sl.counts(); started != 2 || second.Port == first.Port {
+		t.Fatalf("expected a new instance after the idle shutdown, started %d", started)
+	}
+
+	report := p.Report()
+	if len(report.Instances) != 2 || report.Instances[0].Stopped.IsZero() || !report.Instances[1].Stopped.IsZero() {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+	if got := strings.Join(report.Instances[0].Tests, ","); got != "TestA,TestB" {
+		t.Errorf("first instance served %s", got)
+	}
+	if !strings.Contains(report.String(), "(running): TestC") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestPartitionedProxy(t *testing.T) {
+	sl := &stubLauncher{}
+	p := &ProxyPartitioner{Launch: sl.launch, Partitions: 2}
+	defer p.Shutdown()
+	t.Setenv("PROXY_MODE", "playback")
+
+	var ports []int
+	for _, name := range []string{"one", "two"} {
+		t.Run(name, func(t *testing.T) {
+			tpv := p.Proxy(t)
+			if tpv.Mode != "playback" {
+				t.Errorf("got mode %q", tpv.Mode)
+			}
+			ports = append(ports, tpv.Port)
+		})
+	}
+	if len(ports) != 2 || ports[0] != ports[1] {
+		t.Errorf("subtests of one test used ports %v", ports)
+	}
+}
@@ -0,0 +1,61 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathMapping translates recording paths computed on the host into paths
+// the test proxy can open when it runs inside a container, e.g. a host
+// checkout at /home/me/repo mounted into the container at /srv/testproxy.
+//
+// HostPrefix may be a Windows path (C:\src\repo); it is matched
+// case-insensitively and its separators are converted, since the container
+// side is always a Linux path.
+type PathMapping struct {
+	HostPrefix      string
+	ContainerPrefix string
+}
+
+// Map returns the container path for hostPath. It fails if hostPath does
+// not fall under HostPrefix, since the proxy could never open such a file.
+func (pm PathMapping) Map(hostPath string) (string, error) {
+	prefix := normalizeHostPath(pm.HostPrefix)
+	path := normalizeHostPath(hostPath)
+
+	hasPrefix := strings.HasPrefix
+	if isWindowsPath(prefix) {
+		hasPrefix = func(s, prefix string) bool {
+			return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+		}
+	}
+
+	var rest string
+	switch {
+	case pm.HostPrefix == "":
+		return "", fmt.Errorf("path mapping has an empty host prefix")
+	case len(path) == len(prefix) && hasPrefix(path, prefix):
+		rest = ""
+	case hasPrefix(path, prefix+"/"):
+		rest = path[len(prefix):]
+	default:
+		return "", fmt.Errorf("recording path %s is not under the mapped host prefix %s", hostPath, pm.HostPrefix)
+	}
+
+	return strings.TrimSuffix(pm.ContainerPrefix, "/") + rest, nil
+}
+
+// normalizeHostPath converts separators to '/' and drops a trailing one.
+func normalizeHostPath(p string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(p, `\`, "/"), "/")
+}
+
+// isWindowsPath reports whether p starts with a drive letter such as C:.
+func isWindowsPath(p string) bool {
+	return len(p) >= 2 && p[1] == ':' &&
+		(('a' <= p[0] && p[0] <= 'z') || ('A' <= p[0] && p[0] <= 'Z'))
+}
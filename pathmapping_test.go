@@ -0,0 +1,123 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPathMappingMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping PathMapping
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "linux",
+			mapping: PathMapping{"/home/me/repo", "/srv/testproxy"},
+			host:    "/home/me/repo/recordings/Test.json",
+			want:    "/srv/testproxy/recordings/Test.json",
+		},
+		{
+			name:    "linux trailing separators",
+			mapping: PathMapping{"/home/me/repo/", "/srv/testproxy/"},
+			host:    "/home/me/repo/recordings/Test.json",
+			want:    "/srv/testproxy/recordings/Test.json",
+		},
+		{
+			name:    "linux sibling directory",
+			mapping: PathMapping{"/home/me/repo", "/srv/testproxy"},
+			host:    "/home/me/repo2/recordings/Test.json",
+			wantErr: true,
+		},
+		{
+			name:    "linux is case sensitive",
+			mapping: PathMapping{"/home/me/repo", "/srv/testproxy"},
+			host:    "/home/me/Repo/recordings/Test.json",
+			wantErr: true,
+		},
+		{
+			name:    "windows",
+			mapping: PathMapping{`C:\src\repo`, "/srv/testproxy"},
+			host:    `C:\src\repo\recordings\Test.json`,
+			want:    "/srv/testproxy/recordings/Test.json",
+		},
+		{
+			name:    "windows drive letter and case",
+			mapping: PathMapping{`c:\Src\Repo\`, "/srv/testproxy"},
+			host:    `C:\src\repo\recordings\TestA\sub.json`,
+			want:    "/srv/testproxy/recordings/TestA/sub.json",
+		},
+		{
+			name:    "windows forward slashes",
+			mapping: PathMapping{`C:\src\repo`, "/srv/testproxy"},
+			host:    "C:/src/repo/recordings/Test.json",
+			want:    "/srv/testproxy/recordings/Test.json",
+		},
+		{
+			name:    "windows drive root",
+			mapping: PathMapping{`D:\`, "/mnt/d"},
+			host:    `D:\repo\recordings\Test.json`,
+			want:    "/mnt/d/repo/recordings/Test.json",
+		},
+		{
+			name:    "windows other drive",
+			mapping: PathMapping{`C:\src\repo`, "/srv/testproxy"},
+			host:    `D:\src\repo\recordings\Test.json`,
+			wantErr: true,
+		},
+		{
+			name:    "empty prefix",
+			mapping: PathMapping{"", "/srv/testproxy"},
+			host:    "/home/me/repo/recordings/Test.json",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapping.Map(tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartTestProxyAppliesPathMapping(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = "/home/me/repo/recordings/Test.json"
+	tpv.PathMapping = &PathMapping{HostPrefix: "/home/me/repo", ContainerPrefix: "/srv/testproxy"}
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(sp.Requests()[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if got := body["x-recording-file"]; got != "/srv/testproxy/recordings/Test.json" {
+		t.Fatalf("x-recording-file = %q", got)
+	}
+
+	tpv.CurrentRecordingPath = "/elsewhere/Test.json"
+	if err := StartTestProxy(tpv); err == nil {
+		t.Fatal("expected an error for a path outside the mapping")
+	}
+}
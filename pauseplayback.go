@@ -0,0 +1,62 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// playbackGate holds requests in TestProxyTransport.Do while playback is
+// paused. A nil channel means playback is running.
+type playbackGate struct {
+	mu     sync.Mutex
+	paused chan struct{}
+}
+
+// PausePlayback makes transports created with tpv.Transport hold every
+// request until ResumePlayback is called, so a test can step through a
+// recorded session and inspect its state (e.g. with t.Logf) between
+// entries. Requests whose context ends while waiting fail with the
+// context's error.
+func (tpv *TestProxyVariables) PausePlayback() error {
+	if tpv.Mode != "playback" {
+		return fmt.Errorf("playback can only be paused in playback mode, mode is %q", tpv.Mode)
+	}
+	tpv.gate.mu.Lock()
+	defer tpv.gate.mu.Unlock()
+	if tpv.gate.paused == nil {
+		tpv.gate.paused = make(chan struct{})
+	}
+	return nil
+}
+
+// ResumePlayback releases the requests held since PausePlayback.
+func (tpv *TestProxyVariables) ResumePlayback() error {
+	tpv.gate.mu.Lock()
+	defer tpv.gate.mu.Unlock()
+	if tpv.gate.paused != nil {
+		close(tpv.gate.paused)
+		tpv.gate.paused = nil
+	}
+	return nil
+}
+
+// waitWhilePaused blocks until playback is resumed or ctx is done.
+func (g *playbackGate) waitWhilePaused(ctx context.Context) error {
+	g.mu.Lock()
+	paused := g.paused
+	g.mu.Unlock()
+	if paused == nil {
+		return nil
+	}
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
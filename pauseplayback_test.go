@@ -0,0 +1,84 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPauseAndResumePlayback(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	transport := tpv.Transport(tpv.HttpClient)
+
+	if err := tpv.PausePlayback(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		req, err := http.NewRequest("GET", "https://example.com/held", nil)
+		if err != nil {
+			done <- err
+			return
+		}
+		resp, err := transport.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("request completed while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := len(sp.Requests()); n != 0 {
+		t.Fatalf("proxy received %d requests while paused", n)
+	}
+
+	if err := tpv.ResumePlayback(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still held after resume")
+	}
+}
+
+func TestPausedRequestHonoursContext(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	if err := tpv.PausePlayback(); err != nil {
+		t.Fatal(err)
+	}
+	defer tpv.ResumePlayback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://example.com/held", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpv.Transport(tpv.HttpClient).Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
+
+func TestPausePlaybackRequiresPlayback(t *testing.T) {
+	sp := newStubProxy(t)
+	if err := sp.variables(t, "record").PausePlayback(); err == nil {
+		t.Fatal("expected an error pausing a recording session")
+	}
+}
@@ -0,0 +1,50 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+// ProxyHeaders names the headers used to talk to the test proxy. They only
+// need changing when something between the tests and the proxy renames
+// headers, e.g. a gateway that requires a prefix. Empty fields use the
+// names from DefaultProxyHeaders.
+type ProxyHeaders struct {
+	RecordingId           string
+	RecordingMode         string
+	UpstreamBaseUri       string
+	RecordingSave         string
+	RecordingClient       string
+	AbstractionIdentifier string
+}
+
+// DefaultProxyHeaders returns the header names the test proxy uses. It
+// returns a new value on every call, so customizing the names for one
+// TestProxyVariables never affects another.
+func DefaultProxyHeaders() ProxyHeaders {
+	return ProxyHeaders{
+		RecordingId:           "x-recording-id",
+		RecordingMode:         "x-recording-mode",
+		UpstreamBaseUri:       "x-recording-upstream-base-uri",
+		RecordingSave:         "x-recording-save",
+		RecordingClient:       "x-recording-client",
+		AbstractionIdentifier: "x-abstraction-identifier",
+	}
+}
+
+// withDefaults fills the empty fields of h from DefaultProxyHeaders.
+func (h ProxyHeaders) withDefaults() ProxyHeaders {
+	d := DefaultProxyHeaders()
+	for _, f := range []struct{ field, def *string }{
+		{&h.RecordingId, &d.RecordingId},
+		{&h.RecordingMode, &d.RecordingMode},
+		{&h.UpstreamBaseUri, &d.UpstreamBaseUri},
+		{&h.RecordingSave, &d.RecordingSave},
+		{&h.RecordingClient, &d.RecordingClient},
+		{&h.AbstractionIdentifier, &d.AbstractionIdentifier},
+	} {
+		if *f.field == "" {
+			*f.field = *f.def
+		}
+	}
+	return h
+}
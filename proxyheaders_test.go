@@ -0,0 +1,89 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyHeadersPerInstance(t *testing.T) {
+	for _, prefix := range []string{"", "x-gateway-"} {
+		prefix := prefix
+		t.Run("prefix="+prefix, func(t *testing.T) {
+			t.Parallel()
+
+			sp := newStubProxy(t)
+			sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+				if r.URL.Path == "/record/start" {
+					w.Header().Set(prefix+"x-recording-id", "id-for-"+prefix)
+					return true
+				}
+				return false
+			}
+			tpv := sp.variables(t, "record")
+			if prefix != "" {
+				tpv.ProxyHeaders = ProxyHeaders{
+					RecordingId:           prefix + "x-recording-id",
+					RecordingMode:         prefix + "x-recording-mode",
+					UpstreamBaseUri:       prefix + "x-recording-upstream-base-uri",
+					RecordingSave:         prefix + "x-recording-save",
+					AbstractionIdentifier: prefix + "x-abstraction-identifier",
+				}
+			}
+			tpv.ClientId = "team"
+
+			for i := 0; i < 20; i++ {
+				if err := StartTestProxy(tpv); err != nil {
+					t.Fatal(err)
+				}
+				if tpv.RecordingId != "id-for-"+prefix {
+					t.Fatalf("got recording ID %q", tpv.RecordingId)
+				}
+				req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := tpv.Transport(sp.Client()).Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if err := tpv.AddSanitizer(UriRegexSanitizer{Value: "fake"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := StopTestProxy(tpv); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, r := range sp.Requests() {
+				var want []string
+				switch r.Path {
+				case "/record/start":
+					want = []string{"x-recording-client"}
+				case "/Tables":
+					want = []string{prefix + "x-recording-id", prefix + "x-recording-mode", prefix + "x-recording-upstream-base-uri"}
+				case "/Admin/AddSanitizer":
+					want = []string{prefix + "x-recording-id", prefix + "x-abstraction-identifier", "x-recording-client"}
+				case "/record/stop":
+					want = []string{prefix + "x-recording-id", prefix + "x-recording-save", "x-recording-client"}
+				}
+				for _, name := range want {
+					if r.Header.Get(name) == "" {
+						t.Errorf("%s: missing %s in %v", r.Path, name, r.Header)
+					}
+				}
+				for name := range r.Header {
+					lower := strings.ToLower(name)
+					if prefix != "" && strings.HasPrefix(lower, "x-recording-") && lower != "x-recording-client" {
+						t.Errorf("%s: default header %s sent", r.Path, name)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// proxyOutputTail is the number of bytes of a proxy process's stderr kept
+// for ProxyExitError.
+const proxyOutputTail = 2048
+
+// proxyExitGrace is how long a connection error waits for a dying proxy
+// process to be reaped before its health is checked.
+const proxyExitGrace = 200 * time.Millisecond
+
+// ProxyProcess is a test proxy child process whose exit is monitored, so
+// that requests failing because it died report how it died rather than a
+// bare connection error. Sessions whose Host and Port are its Address find
+// it through ProxyHealth.
+type ProxyProcess struct {
+	Address string
+
+	cmd  *exec.Cmd
+	done chan struct{}
+
+	mu     sync.Mutex
+	output []byte
+	err    *ProxyExitError
+}
+
+// ProxyExitError reports that a proxy process exited. Code follows the
+// shell's convention of 128 plus the signal number for a process killed
+// by a signal, e.g. 139 for a segmentation fault.
+type ProxyExitError struct {
+	Address string
+	Code    int
+	// Output is the end of the process's stderr.
+	Output string
+}
+
+func (e *ProxyExitError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("test-proxy exited with code %d", e.Code)
+	}
+	return fmt.Sprintf("test-proxy exited with code %d; last output: %s", e.Code, e.Output)
+}
+
+var proxyProcesses = struct {
+	sync.Mutex
+	byAddress map[string]*ProxyProcess
+}{byAddress: map[string]*ProxyProcess{}}
+
+// StartProxyProcess starts cmd, the proxy listening on address, and
+// monitors it until it exits. Its stderr is still written to cmd.Stderr,
+// if set.
+func StartProxyProcess(cmd *exec.Cmd, address string) (*ProxyProcess, error) {
+	p := &ProxyProcess{Address: strings.ToLower(address), cmd: cmd, done: make(chan struct{})}
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, p)
+	} else {
+		cmd.Stderr = p
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proxyProcesses.Lock()
+	proxyProcesses.byAddress[p.Address] = p
+	proxyProcesses.Unlock()
+
+	go func() {
+		cmd.Wait()
+		code := cmd.ProcessState.ExitCode()
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			code = 128 + int(status.Signal())
+		}
+		p.mu.Lock()
+		p.err = &ProxyExitError{Address: p.Address, Code: code, Output: strings.TrimSpace(strings.ToValidUTF8(string(p.output), ""))}
+		p.mu.Unlock()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Write keeps the end of the process's stderr.
+func (p *ProxyProcess) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.output = append(p.output, b...)
+	if len(p.output) > proxyOutputTail {
+		p.output = p.output[len(p.output)-proxyOutputTail:]
+	}
+	return len(b), nil
+}
+
+// Health returns nil while the process runs and a *ProxyExitError once it
+// has exited.
+func (p *ProxyProcess) Health() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		return nil
+	}
+	return p.err
+}
+
+// Done is closed once the process has exited.
+func (p *ProxyProcess) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stop kills the process, waits for it to exit and stops monitoring it.
+func (p *ProxyProcess) Stop() error {
+	proxyProcesses.Lock()
+	if proxyProcesses.byAddress[p.Address] == p {
+		delete(proxyProcesses.byAddress, p.Address)
+	}
+	proxyProcesses.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-p.done
+	return nil
+}
+
+// ProxyHealth returns nil unless the session's proxy was started with
+// StartProxyProcess, e.g. by TestProxyLauncher, and has exited, in which
+// case it returns the *ProxyExitError.
+func (tpv *TestProxyVariables) ProxyHealth() error {
+	if p := tpv.proxyProcess(); p != nil {
+		return p.Health()
+	}
+	return nil
+}
+
+func (tpv *TestProxyVariables) proxyProcess() *ProxyProcess {
+	address := strings.ToLower(net.JoinHostPort(tpv.Host, strconv.Itoa(tpv.Port)))
+	proxyProcesses.Lock()
+	defer proxyProcesses.Unlock()
+	return proxyProcesses.byAddress[address]
+}
+
+// explainConnectionError replaces an error connecting to the proxy with
+// the proxy process's exit, when it has exited, and returns other errors
+// as they are.
+func (tpv *TestProxyVariables) explainConnectionError(err error) error {
+	if err == nil || !(isDialError(err) || isConnectionReset(err)) {
+		return err
+	}
+	p := tpv.proxyProcess()
+	if p == nil {
+		return err
+	}
+	select {
+	case <-p.done:
+	case <-time.After(proxyExitGrace):
+	}
+	if health := p.Health(); health != nil {
+		return health
+	}
+	return err
+}
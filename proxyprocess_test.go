@@ -0,0 +1,106 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestFakeProxyProcess is not a test: it is the child process started by
+// TestProxyHealth, which exits with the code written to its stdin.
+func TestFakeProxyProcess(t *testing.T) {
+	if os.Getenv("TESTPROXY_FAKE_PROCESS") != "1" {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "info: listening")
+	fmt.Fprintln(os.Stderr, "Fatal error. System.AccessViolationException")
+	var code int
+	fmt.Fscan(os.Stdin, &code)
+	os.Exit(code)
+}
+
+func startFakeProxyProcess(t *testing.T, address string) (*ProxyProcess, func(code int)) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFakeProxyProcess$")
+	cmd.Env = append(os.Environ(), "TESTPROXY_FAKE_PROCESS=1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := StartProxyProcess(cmd, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p, func(code int) {
+		fmt.Fprintln(stdin, code)
+		<-p.Done()
+	}
+}
+
+func TestProxyHealth(t *testing.T) {
+	// Nothing listens on the proxy's port, as after it crashed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	tpv := &TestProxyVariables{Host: "127.0.0.1", Port: port, Mode: "playback", HttpClient: &http.Client{}}
+	do := func() error {
+		req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tpv.Transport(&http.Client{}).Do(req)
+		return err
+	}
+
+	p, exit := startFakeProxyProcess(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err := tpv.ProxyHealth(); err != nil {
+		t.Errorf("running process: %v", err)
+	}
+	if err := do(); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected the connection error while the process runs, got %v", err)
+	}
+
+	exit(139)
+	want := "test-proxy exited with code 139; last output: info: listening\nFatal error. System.AccessViolationException"
+	if err := tpv.ProxyHealth(); err == nil || err.Error() != want {
+		t.Errorf("got health %v", err)
+	}
+	var exitErr *ProxyExitError
+	if err := do(); !errors.As(err, &exitErr) || exitErr.Code != 139 {
+		t.Errorf("Do: got %v", err)
+	}
+	if err := StopTestProxy(tpv); err == nil || err.Error() != want {
+		t.Errorf("StopTestProxy: got %v", err)
+	}
+
+	// A stopped process is no longer monitored.
+	p.Stop()
+	if err := tpv.ProxyHealth(); err != nil {
+		t.Errorf("stopped process: %v", err)
+	}
+}
+
+func TestProxyProcessStop(t *testing.T) {
+	p, _ := startFakeProxyProcess(t, "localhost:1")
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	<-p.Done()
+	if err := p.Health(); err == nil || !strings.Contains(err.Error(), "code 137") {
+		t.Errorf("killed process: got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ProxySuite is a testify suite that manages test proxy sessions for the
+// suite as a whole and for each test in it. Embed it in your own suite:
+//
+//	type TablesSuite struct {
+//		testproxy.ProxySuite
+//	}
+//
+// SetupSuite configures the proxy from Config, or the environment as
+// NewTestProxyFromEnv does when Config is nil, and starts a session
+// recorded under the suite's test name, for traffic made while
+// setting up shared resources. Each test then runs on its own Clone of the
+// suite's TestProxyVariables, with its own session and recording under its
+// own name; the embedded TestProxyVariables points at that clone until
+// TearDownTest. Suites that override SetupSuite, SetupTest, TearDownTest or
+// TearDownSuite must call the ProxySuite versions.
+type ProxySuite struct {
+	suite.Suite
+	*TestProxyVariables
+	Config *Config
+
+	// suiteVariables holds the suite's session while a test runs on its
+	// clone.
+	suiteVariables *TestProxyVariables
+}
+
+func (s *ProxySuite) SetupSuite() {
+	var cfg Config
+	if s.Config != nil {
+		cfg = *s.Config
+	} else {
+		var err error
+		cfg, err = ConfigFromEnv()
+		s.Require().NoError(err)
+	}
+	tpv, err := NewTestProxyFromConfig(cfg, func(tpv *TestProxyVariables) {
+		tpv.CurrentRecordingPath = getRecordingFilePath(s.T(), GetCurrentDirectory(), tpv.RecordingVariant)
+	})
+	s.Require().NoError(err)
+	s.TestProxyVariables = tpv
+	s.suiteVariables = tpv
+
+	s.Require().NoError(StartTestProxy(s.TestProxyVariables))
+}
+
+func (s *ProxySuite) TearDownSuite() {
+	s.TestProxyVariables = s.suiteVariables
+	s.Require().NoError(StopTestProxy(s.suiteVariables))
+}
+
+// SetupTest starts a session for the current test on a clone of the
+// suite's TestProxyVariables, leaving the suite's session untouched.
+func (s *ProxySuite) SetupTest() {
+	tpv := s.suiteVariables.Clone()
+	tpv.CurrentRecordingPath = getRecordingFilePath(s.T(), GetCurrentDirectory(), tpv.RecordingVariant)
+	s.TestProxyVariables = tpv
+	s.Require().NoError(StartTestProxy(tpv))
+}
+
+// TearDownTest stops the current test's session and switches back to the
+// suite's.
+func (s *ProxySuite) TearDownTest() {
+	tpv := s.TestProxyVariables
+	s.TestProxyVariables = s.suiteVariables
+	s.Require().NoError(StopTestProxy(tpv))
+}
+
+// Do sends req through the test proxy in the current session.
+func (s *ProxySuite) Do(req *http.Request) (*http.Response, error) {
+	return s.Transport(s.HttpClient).Do(req)
+}
@@ -0,0 +1,66 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type exampleSuite struct {
+	ProxySuite
+}
+
+func (s *exampleSuite) TestGetTables() {
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	s.Require().NoError(err)
+	resp, err := s.Do(req)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Equal("recording-2", s.RecordingId)
+	// The test runs on a clone; the suite's session is left alone.
+	s.NotSame(s.suiteVariables, s.TestProxyVariables)
+	s.Equal("recording-1", s.suiteVariables.RecordingId)
+}
+
+func TestProxySuite(t *testing.T) {
+	sp := newStubProxy(t)
+	var ids int32
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/record/start" {
+			w.Header().Set("x-recording-id", fmt.Sprintf("recording-%d", atomic.AddInt32(&ids, 1)))
+			return true
+		}
+		return false
+	}
+	host, port := sp.hostPort(t)
+	t.Setenv("PROXY_HOST", host)
+	t.Setenv("PROXY_PORT", strconv.Itoa(port))
+	t.Setenv("PROXY_MODE", "record")
+	trustStubProxy(t, sp)
+
+	suite.Run(t, &exampleSuite{})
+
+	var got []string
+	for _, r := range sp.Requests() {
+		got = append(got, r.Path+" "+r.Header.Get("x-recording-id"))
+	}
+	want := []string{
+		"/record/start ",
+		"/record/start ",
+		"/Tables recording-2",
+		"/record/stop recording-2",
+		"/record/stop recording-1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got requests:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,95 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+)
+
+// MinProxyVersion is the oldest test proxy release whose sanitizer and
+// matcher payloads this package sends. StartTestProxy fails against an
+// older proxy unless SkipVersionCheck is set, e.g. by
+// TESTPROXY_SKIP_VERSION_CHECK=1.
+const MinProxyVersion = "1.0.0-dev.20240410.1"
+
+// proxyUpdateCommands tells how to get a current proxy.
+const proxyUpdateCommands = "update it with `dotnet tool update azure.sdk.tools.testproxy --global --prerelease " +
+	"--add-source https://pkgs.dev.azure.com/azure-sdk/public/_packaging/azure-sdk-for-net/nuget/v3/index.json` " +
+	"or `docker pull azsdkengsys.azurecr.io/engsys/test-proxy:latest`"
+
+// serverVersionRegex finds the proxy's version in a Server header such as
+// "Azure.Sdk.Tools.TestProxy/1.0.0-dev.20240410.1".
+var serverVersionRegex = regexp.MustCompile(`(?i)(?:Azure\.Sdk\.Tools\.TestProxy|test-proxy)/(\S+)`)
+
+// proxyVersionRegex parses a proxy version: a release, or a dev build with
+// its build date and number.
+var proxyVersionRegex = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)(?:-dev\.(\d{8})\.(\d+))?$`)
+
+// ProxyVersionError reports that the proxy is older than MinProxyVersion,
+// or that its version could not be parsed.
+type ProxyVersionError struct {
+	Found      string
+	Required   string
+	Unparsable bool
+}
+
+func (e *ProxyVersionError) Error() string {
+	problem := fmt.Sprintf("test proxy version %s is older than the required %s", e.Found, e.Required)
+	if e.Unparsable {
+		problem = fmt.Sprintf("cannot parse test proxy version %q; the required version is %s", e.Found, e.Required)
+	}
+	return problem + "; " + proxyUpdateCommands + ", or set TESTPROXY_SKIP_VERSION_CHECK=1 to skip this check"
+}
+
+// checkProxyVersion compares the version in the Server header of the
+// proxy's response with MinProxyVersion. Proxies that do not announce a
+// version pass.
+func (tpv *TestProxyVariables) checkProxyVersion(header http.Header) error {
+	if tpv.SkipVersionCheck {
+		return nil
+	}
+	m := serverVersionRegex.FindStringSubmatch(header.Get("Server"))
+	if m == nil {
+		return nil
+	}
+	found, ok := parseProxyVersion(m[1])
+	if !ok {
+		return &ProxyVersionError{Found: m[1], Required: MinProxyVersion, Unparsable: true}
+	}
+	required, _ := parseProxyVersion(MinProxyVersion)
+	for i := range found {
+		if found[i] != required[i] {
+			if found[i] < required[i] {
+				return &ProxyVersionError{Found: m[1], Required: MinProxyVersion}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// parseProxyVersion returns the parts of a version in comparison order. A
+// release sorts after every dev build of the same version.
+func parseProxyVersion(v string) ([5]int, bool) {
+	var parts [5]int
+	m := proxyVersionRegex.FindStringSubmatch(v)
+	if m == nil {
+		return parts, false
+	}
+	if m[4] == "" {
+		m[4], m[5] = "99999999", "0"
+	}
+	for i := range parts {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,58 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyVersionCheck(t *testing.T) {
+	for _, tc := range []struct {
+		server, err string
+	}{
+		{"", ""},
+		{"Kestrel", ""},
+		{"Azure.Sdk.Tools.TestProxy/" + MinProxyVersion, ""},
+		{"Azure.Sdk.Tools.TestProxy/1.0.0-dev.20250102.3", ""},
+		{"Azure.Sdk.Tools.TestProxy/1.0.0", ""},
+		{"test-proxy/1.0.0-dev.20230427.1 Kestrel", "test proxy version 1.0.0-dev.20230427.1 is older than the required " + MinProxyVersion},
+		{"Azure.Sdk.Tools.TestProxy/0.9.9", "is older than the required"},
+		{"Azure.Sdk.Tools.TestProxy/latest", `cannot parse test proxy version "latest"`},
+	} {
+		sp := newStubProxy(t)
+		sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+			if tc.server != "" {
+				w.Header().Set("Server", tc.server)
+			}
+			return false
+		}
+		tpv := sp.variables(t, "record")
+		err := StartTestProxy(tpv)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tc.server, err)
+			}
+			continue
+		}
+		var versionErr *ProxyVersionError
+		if !errors.As(err, &versionErr) || !strings.Contains(err.Error(), tc.err) ||
+			!strings.Contains(err.Error(), "docker pull") || !strings.Contains(err.Error(), "TESTPROXY_SKIP_VERSION_CHECK=1") {
+			t.Errorf("%q: got %v", tc.server, err)
+		}
+		// The session the old proxy started is discarded.
+		requests := sp.Requests()
+		if last := requests[len(requests)-1]; last.Path != "/record/stop" || last.Header.Get("x-recording-save") != "false" {
+			t.Errorf("%q: last request was %s", tc.server, last.Path)
+		}
+
+		tpv.SkipVersionCheck = true
+		if err := StartTestProxy(tpv); err != nil {
+			t.Errorf("%q with the check skipped: %v", tc.server, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordingCache is shared by every TestProxyVariables in the process, so
+// tight loops (-count 10, benchmarks) read each recording from disk once.
+var recordingCache = NewLRURecordingCache(16)
+
+// LRURecordingCache keeps the contents of the most recently read recording
+// files in memory. Entries are keyed by path, modification time and size,
+// so a recording rewritten on disk is read again.
+//
+// Reads made by this package go through the cache, so sessions started
+// with LocalPlayback are served from memory once their recording has been
+// read. The test proxy cannot be handed a recording's contents, only its
+// path, so proxy sessions still have the proxy read the file from disk.
+type LRURecordingCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type recordingCacheItem struct {
+	path    string
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// NewLRURecordingCache returns a cache holding at most capacity recordings.
+func NewLRURecordingCache(capacity int) *LRURecordingCache {
+	return &LRURecordingCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// ReadFile returns the contents of the recording at path, from memory when
+// the file has not changed since it was last read.
+func (c *LRURecordingCache) ReadFile(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[path]; ok {
+		item := el.Value.(*recordingCacheItem)
+		if item.modTime.Equal(fi.ModTime()) && item.size == fi.Size() {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return item.data, nil
+		}
+		c.order.Remove(el)
+		delete(c.items, path)
+	}
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[path]; ok {
+		c.order.Remove(el)
+	}
+	c.items[path] = c.order.PushFront(&recordingCacheItem{path, fi.ModTime(), fi.Size(), data})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*recordingCacheItem).path)
+	}
+	return data, nil
+}
+
+// Forget drops the cached contents of path, if any.
+func (c *LRURecordingCache) Forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[path]; ok {
+		c.order.Remove(el)
+		delete(c.items, path)
+	}
+}
+
+// Len returns the number of recordings currently cached.
+func (c *LRURecordingCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,128 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLRURecordingCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modTime time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	read := func(c *LRURecordingCache, path string) string {
+		data, err := c.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	c := NewLRURecordingCache(2)
+	base := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	a := write("a.json", "aaaa", base)
+	b := write("b.json", "bbbb", base)
+
+	if got := read(c, a); got != "aaaa" {
+		t.Fatalf("first read %q", got)
+	}
+
+	// Rewriting the file with the same size and modification time is served
+	// from the cache; a new modification time is not.
+	write("a.json", "AAAA", base)
+	if got := read(c, a); got != "aaaa" {
+		t.Fatalf("expected cached contents, got %q", got)
+	}
+	write("a.json", "AAAA", base.Add(time.Second))
+	if got := read(c, a); got != "AAAA" {
+		t.Fatalf("expected fresh contents, got %q", got)
+	}
+
+	// Reading a third file evicts the least recently used one.
+	read(c, b)
+	read(c, a)
+	cc := write("c.json", "cccc", base)
+	read(c, cc)
+	if c.Len() != 2 {
+		t.Fatalf("cache holds %d recordings", c.Len())
+	}
+	write("b.json", "BBBB", base)
+	if got := read(c, b); got != "BBBB" {
+		t.Fatalf("evicted recording served from cache: %q", got)
+	}
+
+	if _, err := c.ReadFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestLocalPlaybackServedFromRecordingCache(t *testing.T) {
+	recording := filepath.Join(t.TempDir(), "TestCached.json")
+	modTime := time.Date(2023, 2, 8, 0, 0, 0, 0, time.UTC)
+	write := func(body string) {
+		data := `{"Entries": [{"RequestUri": "https://example.com/", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null,` +
+			` "StatusCode": 200, "ResponseHeaders": {"Content-Type": "application/json"}, "ResponseBody": "` + body + `"}], "Variables": {}}`
+		if err := os.WriteFile(recording, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(recording, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	play := func() string {
+		tpv, err := NewTestProxy(WithMode("playback"), WithLocalPlayback())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tpv.CurrentRecordingPath = recording
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		defer StopTestProxy(tpv)
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Trim(string(body), `"`)
+	}
+
+	write("first")
+	if got := play(); got != "first" {
+		t.Fatalf("first session got %q", got)
+	}
+	// Rewrite the file behind the cache's back, keeping its size and
+	// modification time. A session that reads the disk would see the change.
+	write("other")
+	if got := play(); got != "first" {
+		t.Errorf("second session got %q, want the cached %q", got, "first")
+	}
+	recordingCache.Forget(recording)
+	if got := play(); got != "other" {
+		t.Errorf("after Forget got %q", got)
+	}
+}
@@ -0,0 +1,248 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecordingFile mirrors the JSON document the test proxy writes when a
+// recording is stopped: the list of request/response entries plus the
+// variables saved with the session. Top-level keys this package does not
+// know about are kept so that rewriting a file never drops data.
+type RecordingFile struct {
+	Entries   []Entry
+	Variables map[string]string
+
+	extra map[string]json.RawMessage
+}
+
+// Entry is a single recorded request/response pair. Bodies are kept as raw
+// JSON because the proxy stores them either as a JSON value (for JSON
+// content) or as a string (for text and base64 encoded binary content).
+type Entry struct {
+	RequestUri      string
+	RequestMethod   string
+	RequestHeaders  Headers
+	RequestBody     json.RawMessage
+	StatusCode      int
+	ResponseHeaders Headers
+	ResponseBody    json.RawMessage
+}
+
+// Headers holds recorded header values. The proxy writes a header with a
+// single value as a string and one with several values as an array, and
+// both forms are accepted when reading.
+type Headers map[string][]string
+
+// Get returns the first value of the header with the given name, compared
+// case-insensitively.
+func (h Headers) Get(name string) string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+func (h Headers) MarshalJSON() ([]byte, error) {
+	if h == nil {
+		return []byte("null"), nil
+	}
+	m := make(map[string]interface{}, len(h))
+	for k, v := range h {
+		if len(v) == 1 {
+			m[k] = v[0]
+		} else {
+			m[k] = v
+		}
+	}
+	return marshalNoEscape(m)
+}
+
+func (h *Headers) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*h = nil
+		return nil
+	}
+	headers := make(Headers, len(raw))
+	for k, v := range raw {
+		var single string
+		if err := json.Unmarshal(v, &single); err == nil {
+			headers[k] = []string{single}
+			continue
+		}
+		var multi []string
+		if err := json.Unmarshal(v, &multi); err != nil {
+			return err
+		}
+		headers[k] = multi
+	}
+	*h = headers
+	return nil
+}
+
+func (rf RecordingFile) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(rf.extra)+2)
+	for k, v := range rf.extra {
+		m[k] = v
+	}
+	entries := rf.Entries
+	if entries == nil {
+		entries = []Entry{}
+	}
+	m["Entries"] = entries
+	variables := rf.Variables
+	if variables == nil {
+		variables = map[string]string{}
+	}
+	m["Variables"] = variables
+	return marshalNoEscape(m)
+}
+
+func (rf *RecordingFile) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*rf = RecordingFile{}
+	if v, ok := raw["Entries"]; ok {
+		if err := json.Unmarshal(v, &rf.Entries); err != nil {
+			return err
+		}
+		delete(raw, "Entries")
+	}
+	if v, ok := raw["Variables"]; ok {
+		if err := json.Unmarshal(v, &rf.Variables); err != nil {
+			return err
+		}
+		delete(raw, "Variables")
+	}
+	if len(raw) > 0 {
+		rf.extra = raw
+	}
+	return nil
+}
+
+// Metadata returns the annotations stored under the recording's top-level
+// "metadata" key, or nil when there are none.
+func (rf *RecordingFile) Metadata() map[string]string {
+	var metadata map[string]string
+	rf.getExtra("metadata", &metadata)
+	return metadata
+}
+
+// SetMetadata replaces the annotations stored under the "metadata" key.
+func (rf *RecordingFile) SetMetadata(metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return rf.setExtra("metadata", nil)
+	}
+	return rf.setExtra("metadata", metadata)
+}
+
+// getExtra decodes the top-level key, compared case-insensitively, into v.
+// v is left unchanged when the key is missing or cannot be decoded.
+func (rf *RecordingFile) getExtra(key string, v interface{}) {
+	for k, raw := range rf.extra {
+		if strings.EqualFold(k, key) {
+			json.Unmarshal(raw, v)
+		}
+	}
+}
+
+// setExtra replaces the top-level key with v, or removes it when v is nil.
+func (rf *RecordingFile) setExtra(key string, v interface{}) error {
+	for k := range rf.extra {
+		if strings.EqualFold(k, key) {
+			delete(rf.extra, k)
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	raw, err := marshalNoEscape(v)
+	if err != nil {
+		return err
+	}
+	if rf.extra == nil {
+		rf.extra = map[string]json.RawMessage{}
+	}
+	rf.extra[key] = raw
+	return nil
+}
+
+// ReadRecordingFile loads the recording at path. The contents are served from
+// the process-wide LRURecordingCache when the file has not changed.
+func ReadRecordingFile(path string) (*RecordingFile, error) {
+	data, err := recordingCache.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rf := &RecordingFile{}
+	if err := json.Unmarshal(data, rf); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// WriteFile writes the recording to path in the proxy's indented format.
+// The file is written to a temporary file first and renamed into place, so
+// an interrupted write never leaves a truncated recording behind.
+func (rf *RecordingFile) WriteFile(path string) error {
+	indented, err := rf.marshalIndented()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(indented); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	recordingCache.Forget(path)
+	return os.Rename(tmp.Name(), path)
+}
+
+// marshalIndented encodes the recording in the proxy's indented format.
+func (rf *RecordingFile) marshalIndented() ([]byte, error) {
+	data, err := marshalNoEscape(rf)
+	if err != nil {
+		return nil, err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// marshalNoEscape is json.Marshal without HTML escaping, so URIs containing
+// '&' stay readable in the written recording.
+func marshalNoEscape(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
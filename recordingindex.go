@@ -0,0 +1,183 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RecordingIndexFile is the name of the file BuildRecordingIndex persists
+// the index to, in the indexed directory.
+const RecordingIndexFile = ".recording_index.json"
+
+// ErrRecordingNotFound is returned by FindRecording for a test without a
+// recording.
+var ErrRecordingNotFound = errors.New("no recording found")
+
+// RecordingIndex maps test names to the recordings under a directory tree,
+// such as a monorepo with a recordings directory per package.
+type RecordingIndex struct {
+	// Root is the indexed directory.
+	Root string `json:"-"`
+	// Recordings maps each test name, the path of its recording relative
+	// to the recordings directory holding it without the .json extension,
+	// to the recording's path relative to Root.
+	Recordings map[string]string `json:"recordings"`
+	// ModTimes are the modification times of the indexed files when they
+	// were read, by path relative to Root.
+	ModTimes map[string]time.Time `json:"modTimes"`
+	// Duplicates lists the test names with a recording in several
+	// packages, with their paths. Recordings holds the first in path
+	// order.
+	Duplicates map[string][]string `json:"duplicates,omitempty"`
+}
+
+// BuildRecordingIndex indexes the recordings in the recordings directories
+// under rootDir and persists the index to rootDir/.recording_index.json.
+// When that file exists, the files it lists whose modification time has
+// not changed are not read again. Hidden directories are skipped.
+func BuildRecordingIndex(rootDir string) (*RecordingIndex, error) {
+	previous := &RecordingIndex{}
+	if data, err := os.ReadFile(filepath.Join(rootDir, RecordingIndexFile)); err == nil {
+		// A corrupt index is rebuilt from scratch.
+		json.Unmarshal(data, previous)
+	}
+	known := map[string]string{}
+	for name, path := range previous.Recordings {
+		known[path] = name
+	}
+	for name, paths := range previous.Duplicates {
+		for _, path := range paths {
+			known[path] = name
+		}
+	}
+
+	index := &RecordingIndex{Root: rootDir, Recordings: map[string]string{}, ModTimes: map[string]time.Time{}}
+	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != rootDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name, ok := indexedTestName(rel)
+		if !ok {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if _, seen := known[rel]; !seen || !previous.ModTimes[rel].Equal(fi.ModTime()) {
+			if !isRecordingFile(path) {
+				return nil
+			}
+		}
+		index.add(name, rel, fi.ModTime())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := index.write(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// FindRecording returns the path of the recording of testName. A recording
+// changed since it was indexed is checked again, and one removed since is
+// reported as not found; rebuild the index to pick up new recordings.
+func (idx *RecordingIndex) FindRecording(testName string) (string, error) {
+	rel, ok := idx.Recordings[testName]
+	if !ok {
+		return "", fmt.Errorf("%s: %w in the index of %s", testName, ErrRecordingNotFound, idx.Root)
+	}
+	path := filepath.Join(idx.Root, filepath.FromSlash(rel))
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w, %s was removed", testName, ErrRecordingNotFound, path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !fi.ModTime().Equal(idx.ModTimes[rel]) {
+		if !isRecordingFile(path) {
+			return "", fmt.Errorf("%s: %w, %s is no longer a recording", testName, ErrRecordingNotFound, path)
+		}
+		idx.ModTimes[rel] = fi.ModTime()
+	}
+	return path, nil
+}
+
+// indexedTestName returns the test name of the file at the slash-separated
+// path rel, when it is a .json file in a recordings directory.
+func indexedTestName(rel string) (string, bool) {
+	if !strings.EqualFold(filepath.Ext(rel), ".json") {
+		return "", false
+	}
+	i := strings.LastIndex("/"+rel, "/recordings/")
+	if i < 0 {
+		return "", false
+	}
+	name := rel[i+len("recordings/"):]
+	return strings.TrimSuffix(name, filepath.Ext(name)), true
+}
+
+// isRecordingFile reports whether the file at path is a recording, possibly
+// a corrupt one, rather than other JSON.
+func isRecordingFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = scanRecording(f, nil)
+	return !errors.Is(err, errNotRecording)
+}
+
+func (idx *RecordingIndex) add(name, rel string, modTime time.Time) {
+	idx.ModTimes[rel] = modTime
+	first, dup := idx.Recordings[name]
+	if !dup {
+		idx.Recordings[name] = rel
+		return
+	}
+	if idx.Duplicates == nil {
+		idx.Duplicates = map[string][]string{}
+	}
+	paths := idx.Duplicates[name]
+	if len(paths) == 0 {
+		paths = []string{first}
+	}
+	paths = append(paths, rel)
+	sort.Strings(paths)
+	idx.Duplicates[name] = paths
+	idx.Recordings[name] = paths[0]
+}
+
+func (idx *RecordingIndex) write() error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(idx.Root, RecordingIndexFile), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,101 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordingIndex(t *testing.T) {
+	root := t.TempDir()
+	const recording = `{"Entries":[],"Variables":{}}`
+	for path, content := range map[string]string{
+		"sdk/tables/recordings/TestTables.json":        recording,
+		"sdk/tables/recordings/TestTables/create.json": recording,
+		"sdk/tables/recordings/TestShared.json":        recording,
+		"sdk/blobs/recordings/TestShared.json":         recording,
+		"sdk/blobs/recordings/assets.json":             `{"AssetsRepo":"Azure/azure-sdk-assets"}`,
+		"sdk/blobs/testdata/golden.json":               recording,
+		"sdk/blobs/.cache/recordings/TestCached.json":  recording,
+		"sdk/keys/recordings/TestKeys.json":            recording,
+		"sdk/keys/recordings/notes.txt":                "not JSON",
+	} {
+		writeConfig(t, filepath.Join(root, filepath.FromSlash(path)), content)
+	}
+
+	idx, err := BuildRecordingIndex(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"TestTables":        "sdk/tables/recordings/TestTables.json",
+		"TestTables/create": "sdk/tables/recordings/TestTables/create.json",
+		"TestShared":        "sdk/blobs/recordings/TestShared.json",
+		"TestKeys":          "sdk/keys/recordings/TestKeys.json",
+	}
+	if !reflect.DeepEqual(idx.Recordings, want) {
+		t.Errorf("got index %v, want %v", idx.Recordings, want)
+	}
+	if dups := idx.Duplicates["TestShared"]; len(dups) != 2 || len(idx.Duplicates) != 1 {
+		t.Errorf("got duplicates %v", idx.Duplicates)
+	}
+	path, err := idx.FindRecording("TestTables/create")
+	if err != nil || path != filepath.Join(root, "sdk", "tables", "recordings", "TestTables", "create.json") {
+		t.Errorf("got %s, %v", path, err)
+	}
+	if _, err := idx.FindRecording("TestMissing"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Errorf("got %v for a test without a recording", err)
+	}
+
+	// A file replaced with the same modification time is not read again.
+	keys := filepath.Join(root, "sdk", "keys", "recordings", "TestKeys.json")
+	fi, err := os.Stat(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, keys, `{"not":"a recording"}`)
+	if err := os.Chtimes(keys, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = BuildRecordingIndex(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Recordings["TestKeys"]; !ok {
+		t.Error("an unchanged file was indexed again")
+	}
+
+	// Stale entries are checked at lookup.
+	later := fi.ModTime().Add(time.Second)
+	if err := os.Chtimes(keys, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.FindRecording("TestKeys"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Errorf("got %v for a file that is no longer a recording", err)
+	}
+	if err := os.Remove(filepath.Join(root, "sdk", "tables", "recordings", "TestTables.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.FindRecording("TestTables"); !errors.Is(err, ErrRecordingNotFound) {
+		t.Errorf("got %v for a removed recording", err)
+	}
+
+	// The index is persisted in the root.
+	if _, err := os.Stat(filepath.Join(root, RecordingIndexFile)); err != nil {
+		t.Error(err)
+	}
+	idx, err = BuildRecordingIndex(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Recordings["TestKeys"]; ok {
+		t.Error("a changed file that is no longer a recording is still indexed")
+	}
+}
@@ -0,0 +1,98 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// readRecordingMetadata loads the metadata of the existing recording into
+// tpv.RecordingMetadata, keeping values the test has already set. It is
+// called by StartTestProxy, so a test sees the tags of the recording it
+// plays back, and re-recording keeps them.
+func (tpv *TestProxyVariables) readRecordingMetadata() error {
+	if _, err := os.Stat(tpv.CurrentRecordingPath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		// A recording that is about to be replaced may well be broken.
+		if tpv.Mode == "record" {
+			return nil
+		}
+		return err
+	}
+	for k, v := range rec.Metadata() {
+		if tpv.RecordingMetadata == nil {
+			tpv.RecordingMetadata = map[string]string{}
+		}
+		if _, ok := tpv.RecordingMetadata[k]; !ok {
+			tpv.RecordingMetadata[k] = v
+		}
+	}
+	return nil
+}
+
+// writeRecordingMetadata merges tpv.RecordingMetadata into the "metadata"
+// of the recording the proxy saved. Recordings made for a matcher that
+// ignores bodies are tagged with MetadataCompareBodies, so TrimBodies can
+// tell it is safe to trim them, and those saved by SessionTimeout with
+// MetadataTimedOut. It is called by StopTestProxy in record mode. A
+// recording that is not on this machine, as when the proxy is remote, is
+// left alone, and one that already carries the metadata is not rewritten.
+func (tpv *TestProxyVariables) writeRecordingMetadata() error {
+	metadata := map[string]string{}
+	for k, v := range tpv.RecordingMetadata {
+		metadata[k] = v
+	}
+	if tpv.Matcher.IgnoreBodies {
+		metadata[MetadataCompareBodies] = "false"
+	}
+	if tpv.sessionTimedOut() {
+		metadata[MetadataTimedOut] = "true"
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	merged := rec.Metadata()
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	changed := false
+	for k, v := range metadata {
+		if got, ok := merged[k]; !ok || got != v {
+			merged[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := rec.SetMetadata(merged); err != nil {
+		return err
+	}
+	return rec.WriteFile(tpv.CurrentRecordingPath)
+}
+
+// MatchesMetadata reports whether the recording is tagged with every key
+// and value in tags.
+func (info RecordingInfo) MatchesMetadata(tags map[string]string) bool {
+	for k, v := range tags {
+		if got, ok := info.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
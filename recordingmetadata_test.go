@@ -0,0 +1,95 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRecordingMetadata(t *testing.T) {
+	dir := t.TempDir()
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(dir, "TestTagged.json")
+	tpv.RecordingMetadata = map[string]string{"service": "CosmosDB", "apiVersion": "2023-11"}
+	tpv.Matcher.IgnoreBodies = true
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	// Stand in for the proxy saving the recording.
+	saved := &RecordingFile{Entries: []Entry{{RequestUri: "https://example.com", RequestMethod: "GET", StatusCode: 200}}}
+	if err := saved.WriteFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"service": "CosmosDB", "apiVersion": "2023-11", MetadataCompareBodies: "false"}
+	infos, err := ListRecordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || !reflect.DeepEqual(infos[0].Metadata, want) {
+		t.Fatalf("got %+v, want metadata %v", infos, want)
+	}
+	if !infos[0].MatchesMetadata(map[string]string{"service": "CosmosDB"}) || infos[0].MatchesMetadata(map[string]string{"service": "Tables"}) {
+		t.Error("MatchesMetadata does not filter by tags")
+	}
+
+	playback := sp.variables(t, "playback")
+	playback.CurrentRecordingPath = tpv.CurrentRecordingPath
+	playback.RecordingMetadata = map[string]string{"owner": "alice@example.com"}
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	want["owner"] = "alice@example.com"
+	if !reflect.DeepEqual(playback.RecordingMetadata, want) {
+		t.Errorf("got metadata %v after start, want %v", playback.RecordingMetadata, want)
+	}
+}
+
+func TestRecordingMetadataLeavesRecordingAlone(t *testing.T) {
+	dir := t.TempDir()
+	sp := newStubProxy(t)
+
+	// A remote proxy saved the recording where it cannot be seen.
+	remote := sp.variables(t, "record")
+	remote.CurrentRecordingPath = filepath.Join(dir, "TestRemote.json")
+	remote.RecordingMetadata = map[string]string{"service": "CosmosDB"}
+	if err := StartTestProxy(remote); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(remote); err != nil {
+		t.Fatalf("stopping with no local recording: %v", err)
+	}
+
+	// The proxy's own formatting differs from WriteFile's; a recording that
+	// already carries the metadata must keep it.
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(dir, "TestTagged.json")
+	tpv.RecordingMetadata = map[string]string{"service": "CosmosDB"}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	saved := []byte(`{"Entries": [], "Variables": {}, "metadata": {"service": "CosmosDB"}}`)
+	if err := os.WriteFile(tpv.CurrentRecordingPath, saved, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(saved) {
+		t.Errorf("unchanged metadata rewrote the recording:\n%s", got)
+	}
+}
@@ -0,0 +1,80 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpans traces the requests of a record session to
+// RecordingSpanExporter.
+type recordingSpans struct {
+	mu       sync.Mutex
+	exporter sdktrace.SpanExporter
+	provider *sdktrace.TracerProvider
+	entries  int
+}
+
+// startRecordingSpan starts the span of a request made in record mode and
+// returns the function that ends it with the outcome and the number of
+// attempts made, or nil when no exporter is set. uri is the request's URL
+// before it was rerouted to the proxy.
+func (tpv *TestProxyVariables) startRecordingSpan(req *http.Request, uri string) func(resp *http.Response, attempts int, err error) {
+	if tpv.RecordingSpanExporter == nil || tpv.Mode != "record" {
+		return nil
+	}
+
+	tpv.spans.mu.Lock()
+	if tpv.spans.provider == nil || tpv.spans.exporter != tpv.RecordingSpanExporter {
+		tpv.spans.exporter = tpv.RecordingSpanExporter
+		tpv.spans.provider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(tpv.RecordingSpanExporter))
+	}
+	provider := tpv.spans.provider
+	index := tpv.spans.entries
+	tpv.spans.entries++
+	tpv.spans.mu.Unlock()
+
+	_, span := provider.Tracer("github.com/Alancere/test-proxy-for-golang").Start(req.Context(),
+		"testproxy.record."+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.url", uri),
+			attribute.String("http.method", req.Method),
+			attribute.Int("recording.entry_index", index),
+		))
+	return func(resp *http.Response, attempts int, err error) {
+		span.SetAttributes(attribute.Int("testproxy.attempts", attempts))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+			if resp.StatusCode >= 500 {
+				span.SetStatus(codes.Error, resp.Status)
+			}
+		}
+		span.End()
+	}
+}
+
+// flushRecordingSpans exports the spans of the session and restarts the
+// entry index. It is called by StopTestProxy.
+func (tpv *TestProxyVariables) flushRecordingSpans() error {
+	tpv.spans.mu.Lock()
+	provider := tpv.spans.provider
+	tpv.spans.entries = 0
+	tpv.spans.mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+	return provider.ForceFlush(context.Background())
+}
@@ -0,0 +1,68 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecordingSpans(t *testing.T) {
+	sp := newStubProxy(t)
+	exporter := tracetest.NewInMemoryExporter()
+
+	for _, mode := range []string{"record", "playback"} {
+		tpv := sp.variables(t, mode)
+		tpv.RecordingSpanExporter = exporter
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		tpt := tpv.Transport(sp.Client())
+		for _, r := range []struct{ method, uri string }{
+			{"POST", "https://account.table.core.windows.net/Tables"},
+			{"DELETE", "https://account.table.core.windows.net/Tables('products')"},
+		} {
+			req, err := http.NewRequest(r.method, r.uri, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2 for the record session only", len(spans))
+	}
+	for i, want := range []struct {
+		name, method, uri string
+	}{
+		{"testproxy.record.POST", "POST", "https://account.table.core.windows.net/Tables"},
+		{"testproxy.record.DELETE", "DELETE", "https://account.table.core.windows.net/Tables('products')"},
+	} {
+		span := spans[i]
+		if span.Name != want.name {
+			t.Errorf("span %d is named %s, want %s", i, span.Name, want.name)
+		}
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+		if attrs["http.url"].AsString() != want.uri || attrs["http.method"].AsString() != want.method ||
+			attrs["http.status_code"].AsInt64() != http.StatusOK || attrs["recording.entry_index"].AsInt64() != int64(i) {
+			t.Errorf("span %d has attributes %v", i, span.Attributes)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecordingStore keeps recordings outside the local file system, by name,
+// e.g. TestCreateTable.json; see TestProxyVariables.Store.
+type RecordingStore interface {
+	// Save stores the recording, replacing any stored under name.
+	Save(ctx context.Context, name string, data []byte) error
+	// Load returns the stored recording, or an error wrapping
+	// ErrRecordingNotFound when there is none.
+	Load(ctx context.Context, name string) ([]byte, error)
+}
+
+// recordingName is the name of tpv's recording in a remote store: the base
+// name of the recording path, without a compression extension.
+func recordingName(tpv *TestProxyVariables) string {
+	name := filepath.Base(tpv.CurrentRecordingPath)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".json"
+}
+
+// loadStoredRecording downloads the recording from Store the way
+// importRemoteRecording does from RemoteStore.
+func (tpv *TestProxyVariables) loadStoredRecording() error {
+	data, err := tpv.Store.Load(context.Background(), recordingName(tpv))
+	if errors.Is(err, ErrRecordingNotFound) && tpv.Mode == "record" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(tpv.CurrentRecordingPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(tpv.CurrentRecordingPath, data, 0o644)
+}
+
+// saveStoredRecording uploads a saved recording to Store.
+func (tpv *TestProxyVariables) saveStoredRecording() error {
+	data, err := os.ReadFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	if err := tpv.Store.Save(context.Background(), recordingName(tpv), data); err != nil {
+		return fmt.Errorf("saving %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	return nil
+}
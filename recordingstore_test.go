@@ -0,0 +1,73 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memoryStore is a RecordingStore in a map.
+type memoryStore map[string][]byte
+
+func (m memoryStore) Save(ctx context.Context, name string, data []byte) error {
+	m[name] = data
+	return nil
+}
+
+func (m memoryStore) Load(ctx context.Context, name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, ErrRecordingNotFound
+	}
+	return data, nil
+}
+
+func TestRecordingStore(t *testing.T) {
+	sp := newStubProxy(t)
+	store := memoryStore{}
+	path := filepath.Join(t.TempDir(), "recordings", "TestStored.json")
+	recorded := `{"Entries": [], "Variables": {}}`
+
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+	tpv.Store = store
+	// A new recording has nothing to resume.
+	tpv.ResumeMode = true
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	tpv.ResumeMode = false
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	os.WriteFile(path, []byte(recorded), 0o644)
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if string(store["TestStored.json"]) != recorded {
+		t.Fatalf("stored %v", store)
+	}
+
+	os.Remove(path)
+	playback, err := tpv.CloneWith(WithMode("playback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != recorded {
+		t.Errorf("loaded %s, %v", data, err)
+	}
+
+	delete(store, "TestStored.json")
+	if err := StartTestProxy(playback); err == nil {
+		t.Error("expected an error playing back a recording missing from the store")
+	}
+}
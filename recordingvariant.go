@@ -0,0 +1,43 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SelectVariant returns the recording variant named by PROXY_VARIANT, or
+// the first of availableVariants when it is unset, for RecordingVariant:
+//
+//	tpv := testproxy.Start(t, testproxy.WithRecordingVariant(testproxy.SelectVariant([]string{"dev", "prod"})))
+//
+// so that PROXY_VARIANT=dev go test ./... uses the dev recordings. A
+// PROXY_VARIANT that is not available is returned as is, so that a new
+// variant can be recorded. It returns "" when neither is given.
+func SelectVariant(availableVariants []string) string {
+	if v := os.Getenv("PROXY_VARIANT"); v != "" {
+		return v
+	}
+	if len(availableVariants) > 0 {
+		return availableVariants[0]
+	}
+	return ""
+}
+
+// WithRecordingVariant sets RecordingVariant, storing the recording as
+// recordings/<test name>.<variant>.json. It applies to the recording path
+// set by the options before it, or by Start, and to the one set by WithTest
+// after it.
+func WithRecordingVariant(variant string) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.RecordingVariant = variant
+		if tpv.CurrentRecordingPath != "" && variant != "" {
+			ext := filepath.Ext(tpv.CurrentRecordingPath)
+			tpv.CurrentRecordingPath = strings.TrimSuffix(tpv.CurrentRecordingPath, ext) + "." + variant + ext
+		}
+	}
+}
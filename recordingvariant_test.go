@@ -0,0 +1,51 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectVariant(t *testing.T) {
+	t.Setenv("PROXY_VARIANT", "")
+	if got := SelectVariant([]string{"dev", "prod"}); got != "dev" {
+		t.Errorf("got %q without PROXY_VARIANT, want the first variant", got)
+	}
+	if got := SelectVariant(nil); got != "" {
+		t.Errorf("got %q without variants", got)
+	}
+	t.Setenv("PROXY_VARIANT", "prod")
+	if got := SelectVariant([]string{"dev", "prod"}); got != "prod" {
+		t.Errorf("got %q with PROXY_VARIANT=prod", got)
+	}
+	t.Setenv("PROXY_VARIANT", "canary")
+	if got := SelectVariant([]string{"dev", "prod"}); got != "canary" {
+		t.Errorf("got %q for a new variant", got)
+	}
+}
+
+func TestWithRecordingVariant(t *testing.T) {
+	for name, opts := range map[string][]TestProxyOption{
+		"before WithTest": {WithRecordingVariant("dev"), WithTest(t)},
+		"after WithTest":  {WithTest(t), WithRecordingVariant("dev")},
+	} {
+		tpv, err := NewTestProxy(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filepath.Base(tpv.CurrentRecordingPath); got != "TestWithRecordingVariant.dev.json" || tpv.RecordingVariant != "dev" {
+			t.Errorf("%s: got recording %s and variant %q", name, got, tpv.RecordingVariant)
+		}
+	}
+
+	tpv, err := NewTestProxy(WithTest(t), WithRecordingVariant(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(tpv.CurrentRecordingPath); got != "TestWithRecordingVariant.json" {
+		t.Errorf("got recording %s without a variant", got)
+	}
+}
@@ -0,0 +1,61 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// String describes the session for logs: the proxy address, mode,
+// recording ID and file, and the variables with their values redacted.
+// It is also what %v and %+v print.
+func (tpv *TestProxyVariables) String() string {
+	var vars []string
+	for _, name := range sortedKeys(tpv.Variables) {
+		vars = append(vars, name+":"+redactValue(tpv.Variables[name]))
+	}
+	return fmt.Sprintf("TestProxyVariables{https://%s:%d mode=%s recording=%s file=%s variables={%s}}",
+		tpv.Host, tpv.Port, tpv.Mode, tpv.RecordingId, tpv.CurrentRecordingPath, strings.Join(vars, " "))
+}
+
+// LogValue logs the fields String prints as a group.
+func (tpv *TestProxyVariables) LogValue() slog.Value {
+	var vars []slog.Attr
+	for _, name := range sortedKeys(tpv.Variables) {
+		vars = append(vars, slog.String(name, redactValue(tpv.Variables[name])))
+	}
+	return slog.GroupValue(
+		slog.String("scheme", "https"),
+		slog.String("host", tpv.Host),
+		slog.Int("port", tpv.Port),
+		slog.String("mode", tpv.Mode),
+		slog.String("recordingId", tpv.RecordingId),
+		slog.String("recordingFile", tpv.CurrentRecordingPath),
+		slog.Attr{Key: "variables", Value: slog.GroupValue(vars...)},
+	)
+}
+
+// redactValue keeps the first and last characters of a value, enough to
+// tell values apart in a log, and masks the rest. The mask has a fixed
+// length so the value's length is not revealed either.
+func redactValue(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 4 {
+		return "***"
+	}
+	return string(runes[0]) + "***" + string(runes[len(runes)-1])
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
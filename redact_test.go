@@ -0,0 +1,70 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const redactTestSecret = "AccountKey=c2VjcmV0LWtleQ=="
+
+func TestTestProxyVariablesRedaction(t *testing.T) {
+	tpv := &TestProxyVariables{
+		Host:                 "localhost",
+		Port:                 5001,
+		Mode:                 "record",
+		RecordingId:          "rec-1",
+		CurrentRecordingPath: "recordings/TestTables.json",
+		Variables:            map[string]string{"connectionString": redactTestSecret, "pin": "1234"},
+	}
+
+	var logged bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logged, nil)).Info("session", "session", tpv)
+	for name, out := range map[string]string{
+		"String": tpv.String(),
+		"%v":     fmt.Sprintf("%v", tpv),
+		"%+v":    fmt.Sprintf("%+v", tpv),
+		"slog":   logged.String(),
+	} {
+		for _, secret := range []string{redactTestSecret, "c2VjcmV0", "1234"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s output contains %q: %s", name, secret, out)
+			}
+		}
+		for _, want := range []string{"localhost", "5001", "record", "rec-1", "recordings/TestTables.json", "A***="} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s output is missing %q: %s", name, want, out)
+			}
+		}
+	}
+}
+
+func TestSessionLifecycleLogging(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	tpv.Variables = map[string]string{"connectionString": redactTestSecret}
+	var logged bytes.Buffer
+	tpv.Logger = slog.New(slog.NewTextHandler(&logged, nil))
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	out := logged.String()
+	if !strings.Contains(out, "test proxy session started") || !strings.Contains(out, "test proxy session stopped") ||
+		!strings.Contains(out, "session.recordingId=stub-recording-id") {
+		t.Errorf("unexpected log:\n%s", out)
+	}
+	if strings.Contains(out, "c2VjcmV0") {
+		t.Errorf("log contains the secret:\n%s", out)
+	}
+}
@@ -0,0 +1,66 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+)
+
+// RedactedHeaderValue replaces the values of redacted request headers.
+const RedactedHeaderValue = "Sanitized"
+
+// DefaultRedactedRequestHeaders are the RedactRequestHeaders of transports
+// that do not set them.
+var DefaultRedactedRequestHeaders = []string{"Authorization", "Cookie", "x-ms-authorization-auxiliary"}
+
+// HeaderRedaction is where TestProxyTransport.RedactRequestHeaders are
+// redacted.
+type HeaderRedaction int
+
+const (
+	// RedactObserved redacts the headers in what the Observer, the HTTP
+	// dump and LastRequest see, and sends the real values to the proxy,
+	// since most upstreams need them to answer while recording.
+	RedactObserved HeaderRedaction = iota
+	// RedactWire also redacts the headers of the request sent to the
+	// proxy, so credentials never reach it or its logs. Use it when the
+	// upstream does not need them, or in playback.
+	RedactWire
+	// RedactNone leaves the headers as they are.
+	RedactNone
+)
+
+// redactRequestHeaders redacts the headers of req according to tpt's
+// Redaction and returns the request the session's observers see: req
+// itself, or a copy with redacted headers when only they are redacted.
+func (tpt *TestProxyTransport) redactRequestHeaders(req *http.Request) *http.Request {
+	names := tpt.RedactRequestHeaders
+	if names == nil {
+		names = DefaultRedactedRequestHeaders
+	}
+	present := false
+	for _, name := range names {
+		if _, ok := req.Header[http.CanonicalHeaderKey(name)]; ok {
+			present = true
+			break
+		}
+	}
+	if !present || tpt.Redaction == RedactNone {
+		return req
+	}
+
+	view := req
+	if tpt.Redaction == RedactObserved {
+		copied := *req
+		copied.Header = req.Header.Clone()
+		view = &copied
+	}
+	for _, name := range names {
+		if _, ok := view.Header[http.CanonicalHeaderKey(name)]; ok {
+			view.Header.Set(name, RedactedHeaderValue)
+		}
+	}
+	return view
+}
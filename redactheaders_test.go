@@ -0,0 +1,65 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedactRequestHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		redaction HeaderRedaction
+		headers   []string
+		// wire and observed are the Authorization and Cookie values the
+		// proxy and the Observer get.
+		wire, observed [2]string
+	}{
+		{"observed", RedactObserved, nil, [2]string{"Bearer token", "session=1"}, [2]string{"Sanitized", "Sanitized"}},
+		{"wire", RedactWire, nil, [2]string{"Sanitized", "Sanitized"}, [2]string{"Sanitized", "Sanitized"}},
+		{"none", RedactNone, nil, [2]string{"Bearer token", "session=1"}, [2]string{"Bearer token", "session=1"}},
+		{"custom headers", RedactWire, []string{"cookie"}, [2]string{"Bearer token", "Sanitized"}, [2]string{"Bearer token", "Sanitized"}},
+		{"no headers", RedactWire, []string{}, [2]string{"Bearer token", "session=1"}, [2]string{"Bearer token", "session=1"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sp := newStubProxy(t)
+			tpv := sp.variables(t, "record")
+			var observed http.Header
+			tpv.Observer.Exchange = func(e Exchange) { observed = e.Request.Header }
+			if err := StartTestProxy(tpv); err != nil {
+				t.Fatal(err)
+			}
+			tpt := tpv.Transport(sp.Client())
+			tpt.Redaction = tc.redaction
+			tpt.RedactRequestHeaders = tc.headers
+
+			req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("Cookie", "session=1")
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			requests := sp.Requests()
+			wire := requests[len(requests)-1].Header
+			if got := [2]string{wire.Get("Authorization"), wire.Get("Cookie")}; got != tc.wire {
+				t.Errorf("the proxy got %v, want %v", got, tc.wire)
+			}
+			if got := [2]string{observed.Get("Authorization"), observed.Get("Cookie")}; got != tc.observed {
+				t.Errorf("the observer got %v, want %v", got, tc.observed)
+			}
+			last := tpv.InspectLastRequest().Header
+			if got := [2]string{last.Get("Authorization"), last.Get("Cookie")}; got != tc.observed {
+				t.Errorf("LastRequest has %v, want %v", got, tc.observed)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RenameRecording moves the recordings of a renamed test so they are not
+// orphaned. Test names map to paths the way NewTestProxyVariables does it:
+// the recording of "TestA/case_1" is dir/TestA/case_1.json. The recording,
+// its variant, build hash and suffixed siblings such as TestA.linux.json,
+// their compressed copies (see CompressFormat), the archives of all of them
+// made by RotateRecordings, such as TestA.json.1, and the recordings of the test's subtests are moved, and
+// variables holding the old test name are updated in uncompressed
+// recordings. Nothing is moved if any target already exists.
+func RenameRecording(dir, oldTestName, newTestName string) error {
+	return RenameRecordings(dir, map[string]string{oldTestName: newTestName})
+}
+
+// RenameRecordings applies several renames, as RenameRecording does. All
+// targets are checked before anything is moved, so either every rename is
+// applied or, on a collision, none is.
+func RenameRecordings(dir string, renames map[string]string) error {
+	olds := make([]string, 0, len(renames))
+	for old := range renames {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+
+	type move struct{ from, to string }
+	var moves []move
+	targets := map[string]string{}
+	for _, old := range olds {
+		sources := recordingPaths(dir, old)
+		if len(sources) == 0 {
+			return fmt.Errorf("no recording for %s in %s", old, dir)
+		}
+		for _, from := range sources {
+			to := filepath.Join(dir, filepath.FromSlash(renames[old])) + strings.TrimPrefix(from, filepath.Join(dir, filepath.FromSlash(old)))
+			if _, err := os.Lstat(to); err == nil {
+				return fmt.Errorf("renaming %s to %s: %s already exists", old, renames[old], to)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if other, ok := targets[to]; ok {
+				return fmt.Errorf("renaming %s and %s: both would move to %s", other, old, to)
+			}
+			targets[to] = old
+			moves = append(moves, move{from, to})
+		}
+	}
+
+	for _, m := range moves {
+		if err := os.MkdirAll(filepath.Dir(m.to), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(m.from, m.to); err != nil {
+			return err
+		}
+		recordingCache.Forget(m.from)
+		removeEmptyParents(filepath.Dir(m.from), dir)
+	}
+
+	for _, old := range olds {
+		for _, path := range recordingPaths(dir, renames[old]) {
+			if err := renameTestInVariables(path, old, renames[old]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordingPaths returns the existing files and directories holding the
+// recordings of testName: its recording, the recordings made for it with a
+// RecordingVariant, ScopeByBuildHash or WithRecordingSuffix, compressed
+// copies and RotateRecordings archives of all of them, and the directory of
+// its subtests' recordings. As for GarbageCollectRecordings, a file
+// belongs to the test when its name continues the test's with '.' or '-',
+// which cannot occur in a Go identifier.
+func recordingPaths(dir, testName string) []string {
+	base := filepath.Join(dir, filepath.FromSlash(testName))
+	parent, leaf := filepath.Dir(base), filepath.Base(base)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			if name == leaf {
+				paths = append(paths, base)
+			}
+			continue
+		}
+		rest := strings.TrimPrefix(name, leaf)
+		if _, rotated := rotationNumber(name); rest == name || !hasRecordingExt(name) && !rotated {
+			continue
+		}
+		if strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "-") {
+			paths = append(paths, filepath.Join(parent, name))
+		}
+	}
+	return paths
+}
+
+// renameTestInVariables rewrites the variables of the recordings at or
+// under path that hold oldTestName, or the name of one of its subtests.
+func renameTestInVariables(path, oldTestName, newTestName string) error {
+	return filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(file), ".json") {
+			return nil
+		}
+		rec, err := ReadRecordingFile(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		changed := false
+		for k, v := range rec.Variables {
+			if v == oldTestName || strings.HasPrefix(v, oldTestName+"/") {
+				rec.Variables[k] = newTestName + strings.TrimPrefix(v, oldTestName)
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return rec.WriteFile(file)
+	})
+}
+
+// removeEmptyParents removes dir and its parents up to, but not including,
+// root while they are empty.
+func removeEmptyParents(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
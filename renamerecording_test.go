@@ -0,0 +1,136 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRenameFixture(t *testing.T, dir, testName string, variables map[string]string) {
+	path := filepath.Join(dir, filepath.FromSlash(testName)+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rec := &RecordingFile{
+		Entries:   []Entry{{RequestUri: "https://example.com", RequestMethod: "GET", StatusCode: 200}},
+		Variables: variables,
+	}
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertExists(t *testing.T, path string, want bool) {
+	t.Helper()
+	_, err := os.Stat(path)
+	if exists := err == nil; exists != want {
+		t.Errorf("%s: exists = %v, want %v (%v)", path, exists, want, err)
+	}
+}
+
+func TestRenameRecording(t *testing.T) {
+	dir := t.TempDir()
+	writeRenameFixture(t, dir, "TestOld", map[string]string{"testName": "TestOld", "other": "TestOldish"})
+	if err := os.WriteFile(filepath.Join(dir, "TestOld.json.br"), []byte("compressed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RenameRecording(dir, "TestOld", "TestNew"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "TestOld.json"), false)
+	assertExists(t, filepath.Join(dir, "TestOld.json.br"), false)
+	assertExists(t, filepath.Join(dir, "TestNew.json.br"), true)
+
+	rec, err := ReadRecordingFile(filepath.Join(dir, "TestNew.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Variables["testName"] != "TestNew" || rec.Variables["other"] != "TestOldish" {
+		t.Errorf("unexpected variables %v", rec.Variables)
+	}
+}
+
+func TestRenameRecordingSiblings(t *testing.T) {
+	dir := t.TempDir()
+	writeRenameFixture(t, dir, "TestOld", nil)
+	writeRenameFixture(t, dir, "TestOldish", nil)
+	siblings := []string{
+		"TestOld.linux.json",        // RecordingVariant
+		"TestOld.0123abcd.json",     // ScopeByBuildHash
+		"TestOld.json.1",            // RotateRecordings
+		"TestOld-westus.json",       // WithRecordingSuffix
+		"TestOld.linux.json.gz",     // CompressFormat
+		"TestOld.json.br.2",         // CompressFormat and RotateRecordings
+		"TestOld.json.tmp123456789", // not a recording
+	}
+	for _, name := range siblings {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenameRecording(dir, "TestOld", "TestNew"); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "TestNew.json"), true)
+	for _, name := range siblings[:len(siblings)-1] {
+		assertExists(t, filepath.Join(dir, name), false)
+		assertExists(t, filepath.Join(dir, "TestNew"+name[len("TestOld"):]), true)
+	}
+	assertExists(t, filepath.Join(dir, "TestOld.json.tmp123456789"), true)
+	assertExists(t, filepath.Join(dir, "TestOldish.json"), true)
+}
+
+func TestRenameRecordingSubtests(t *testing.T) {
+	dir := t.TempDir()
+	writeRenameFixture(t, dir, "TestTables", nil)
+	writeRenameFixture(t, dir, "TestTables/create", map[string]string{"testName": "TestTables/create"})
+	writeRenameFixture(t, dir, "TestQueues/send", nil)
+
+	if err := RenameRecordings(dir, map[string]string{
+		"TestTables":      "TestTableClient",
+		"TestQueues/send": "TestQueues/Send/small",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertExists(t, filepath.Join(dir, "TestTableClient.json"), true)
+	assertExists(t, filepath.Join(dir, "TestTableClient", "create.json"), true)
+	assertExists(t, filepath.Join(dir, "TestTables"), false)
+	assertExists(t, filepath.Join(dir, "TestQueues", "Send", "small.json"), true)
+	assertExists(t, filepath.Join(dir, "TestQueues", "send.json"), false)
+
+	rec, err := ReadRecordingFile(filepath.Join(dir, "TestTableClient", "create.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Variables["testName"] != "TestTableClient/create" {
+		t.Errorf("subtest name not updated: %v", rec.Variables)
+	}
+}
+
+func TestRenameRecordingRefusesOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	writeRenameFixture(t, dir, "TestA", nil)
+	writeRenameFixture(t, dir, "TestB", nil)
+	writeRenameFixture(t, dir, "TestC/sub", nil)
+	writeRenameFixture(t, dir, "TestD/sub", nil)
+
+	if err := RenameRecordings(dir, map[string]string{"TestA": "TestX", "TestC": "TestD"}); err == nil {
+		t.Fatal("expected a collision on the TestD directory")
+	}
+	// Nothing moves when any rename collides.
+	assertExists(t, filepath.Join(dir, "TestA.json"), true)
+	assertExists(t, filepath.Join(dir, "TestX.json"), false)
+
+	if err := RenameRecording(dir, "TestA", "TestB"); err == nil {
+		t.Fatal("expected a collision on TestB.json")
+	}
+	if err := RenameRecording(dir, "TestMissing", "TestY"); err == nil {
+		t.Fatal("expected an error for a test without recordings")
+	}
+}
@@ -0,0 +1,125 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReplayOptions control ReplayRecording.
+type ReplayOptions struct {
+	// Client sends the replayed requests. It defaults to http.DefaultClient.
+	Client *http.Client
+	// Headers are set on every replayed request, replacing recorded values.
+	// Recordings are sanitized, so credentials have to be supplied here,
+	// e.g. a fresh Authorization header.
+	Headers http.Header
+	// Tolerance is the accepted relative drift of numeric fields, e.g. 0.01
+	// for 1%.
+	Tolerance float64
+}
+
+// ReplayResult is the outcome of replaying one recorded entry. Patch turns
+// the recorded response, as the document {"statusCode": ..., "body": ...},
+// into the live one; it is empty when the service has not drifted.
+type ReplayResult struct {
+	Entry  int              `json:"entry"`
+	Method string           `json:"method"`
+	URI    string           `json:"uri"`
+	Patch  []PatchOperation `json:"patch,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// Drifted reports whether the live response differed from the recording.
+func (r ReplayResult) Drifted() bool {
+	return len(r.Patch) > 0 || r.Error != ""
+}
+
+// ReplayRecording sends each request of rec to the live service, in order,
+// and compares each response with the recorded one, to detect services
+// that have drifted from a recording.
+func ReplayRecording(rec *RecordingFile, opts ReplayOptions) []ReplayResult {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	results := make([]ReplayResult, len(rec.Entries))
+	for i, e := range rec.Entries {
+		results[i] = ReplayResult{Entry: i, Method: e.RequestMethod, URI: e.RequestUri}
+		live, err := replayEntry(client, e, opts.Headers)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		recorded := replayDocument(e.StatusCode, bodyBytes(e.ResponseBody, e.ResponseHeaders))
+		results[i].Patch = DiffJSONPatch(recorded, live, opts.Tolerance)
+	}
+	return results
+}
+
+// replayEntry sends the recorded request and returns the response as the
+// document compared by ReplayRecording.
+func replayEntry(client *http.Client, e Entry, headers http.Header) (map[string]interface{}, error) {
+	req, err := entryRequest(e)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return replayDocument(resp.StatusCode, body), nil
+}
+
+// entryRequest rebuilds the request recorded in e, without the proxy's
+// headers and the headers net/http sets for the connection. Accept-Encoding
+// is left to net/http too, which then decompresses the response.
+func entryRequest(e Entry) (*http.Request, error) {
+	req, err := http.NewRequest(e.RequestMethod, e.RequestUri, bytes.NewReader(bodyBytes(e.RequestBody, e.RequestHeaders)))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range e.RequestHeaders {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, ":") || strings.HasPrefix(lower, "x-recording-") ||
+			lower == "accept-encoding" || lower == "content-length" || lower == "host" {
+			continue
+		}
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	removeHopByHopHeaders(req.Header)
+	return req, nil
+}
+
+// replayDocument is the document compared by ReplayRecording. Bodies that
+// are JSON are compared structurally, other bodies as text.
+func replayDocument(statusCode int, body []byte) map[string]interface{} {
+	var decoded interface{}
+	if len(body) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if dec.Decode(&decoded) != nil || dec.More() {
+			decoded = string(body)
+		}
+	}
+	return map[string]interface{}{"statusCode": json.Number(strconv.Itoa(statusCode)), "body": decoded}
+}
@@ -0,0 +1,146 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDiffJSONPatch(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	from := decode(`{"count": 100, "a/b": 1, "gone": true, "items": [1, 2, 3], "name": "x"}`)
+	to := decode(`{"count": 100.5, "a/b": 2, "new": null, "items": [1, 5], "name": "x"}`)
+
+	patch, err := json.Marshal(DiffJSONPatch(from, to, 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op":"replace","path":"/a~1b","value":2},` +
+		`{"op":"remove","path":"/gone"},` +
+		`{"op":"replace","path":"/items/1","value":5},` +
+		`{"op":"remove","path":"/items/2"},` +
+		`{"op":"add","path":"/new","value":null}]`
+	if string(patch) != want {
+		t.Errorf("got patch %s\nwant %s", patch, want)
+	}
+
+	if ops := DiffJSONPatch(from, to, 0); len(ops) != 6 || ops[1].Path != "/count" {
+		t.Errorf("without tolerance, expected /count to drift: %v", ops)
+	}
+}
+
+func TestReplayRecording(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer live" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/tables":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"name":"`+string(body)+`","size":1010}`)
+		case "/blob":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0, 1, 2, 3})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	rec := &RecordingFile{Entries: []Entry{
+		{
+			RequestUri:      server.URL + "/tables",
+			RequestMethod:   "POST",
+			RequestHeaders:  Headers{"Authorization": {"Sanitized"}, "Content-Type": {"text/plain"}},
+			RequestBody:     json.RawMessage(`"t1"`),
+			StatusCode:      200,
+			ResponseHeaders: Headers{"Content-Type": {"application/json"}},
+			ResponseBody:    json.RawMessage(`{"name": "t1", "size": 1000}`),
+		},
+		{
+			RequestUri:      server.URL + "/blob",
+			RequestMethod:   "GET",
+			StatusCode:      200,
+			ResponseHeaders: Headers{"Content-Type": {"application/octet-stream"}},
+			ResponseBody:    json.RawMessage(`"AAECAw=="`),
+		},
+		{
+			RequestUri:    server.URL + "/removed",
+			RequestMethod: "GET",
+			StatusCode:    200,
+		},
+	}}
+
+	results := ReplayRecording(rec, ReplayOptions{
+		Headers:   http.Header{"Authorization": {"Bearer live"}},
+		Tolerance: 0.02,
+	})
+	if results[0].Drifted() || results[1].Drifted() {
+		t.Errorf("unexpected drift: %+v %+v", results[0], results[1])
+	}
+	if len(results[2].Patch) == 0 || results[2].Patch[0].Path != "/body" {
+		t.Errorf("expected the removed endpoint to drift: %+v", results[2])
+	}
+
+	results = ReplayRecording(rec, ReplayOptions{Headers: http.Header{"Authorization": {"Bearer live"}}})
+	if len(results[0].Patch) != 1 || results[0].Patch[0].Path != "/body/size" {
+		t.Errorf("expected /body/size to drift without tolerance: %+v", results[0])
+	}
+}
+
+func TestReplayRecordingGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Stale") != "" {
+			http.Error(w, "hop-by-hop headers were replayed", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			io.WriteString(w, `{"name":"t1"}`)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, `{"name":"t1"}`)
+		zw.Close()
+	}))
+	defer server.Close()
+
+	rec := &RecordingFile{Entries: []Entry{{
+		RequestUri:    server.URL + "/tables",
+		RequestMethod: "GET",
+		RequestHeaders: Headers{
+			"Accept-Encoding": {"gzip, deflate"},
+			"Connection":      {"keep-alive, X-Stale"},
+			"X-Stale":         {"1"},
+			"Host":            {"recorded.example.com"},
+			"Content-Length":  {"42"},
+		},
+		StatusCode:      200,
+		ResponseHeaders: Headers{"Content-Type": {"application/json"}},
+		ResponseBody:    json.RawMessage(`{"name": "t1"}`),
+	}}}
+
+	results := ReplayRecording(rec, ReplayOptions{})
+	if results[0].Error != "" || results[0].Drifted() {
+		t.Errorf("a gzipped live response drifted: %+v", results[0])
+	}
+}
@@ -0,0 +1,138 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// LoopReport aggregates the iterations run by ReplayLoop.
+type LoopReport struct {
+	Workers int
+	// Iterations counts the iterations that ran, and Errors those whose
+	// function returned an error.
+	Iterations int
+	Errors     int
+	// FirstError is the error of the first failed iteration.
+	FirstError error
+	// Elapsed is the wall time of the loop, and Throughput the iterations
+	// per second over it.
+	Elapsed    time.Duration
+	Throughput float64
+	// Latency statistics of the iterations' functions.
+	Min, Max, Mean, P50, P95 time.Duration
+}
+
+func (r LoopReport) String() string {
+	return fmt.Sprintf("%d iterations on %d workers in %v (%.1f/s), %d errors; latency min %v, mean %v, p50 %v, p95 %v, max %v",
+		r.Iterations, r.Workers, r.Elapsed, r.Throughput, r.Errors, r.Min, r.Mean, r.P50, r.P95, r.Max)
+}
+
+// ReplayLoop plays back the recording of rec repeatedly to measure a
+// client's throughput without touching Azure: workers goroutines each run
+// fn iterations times. Every iteration runs in a playback session of its
+// own, started on a clone of rec, since the proxy serves each recorded
+// entry once per session; fn gets client options routed through it. The
+// session start and stop are not part of the measured latency.
+//
+// When a session fails to start or stop, ReplayLoop stops the other
+// workers and returns the report of the iterations that ran with the
+// error. Errors returned by fn are counted in the report instead.
+func ReplayLoop(ctx context.Context, rec *TestProxyVariables, workers, iterations int, fn func(opts *arm.ClientOptions) error) (LoopReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		report    = LoopReport{Workers: workers}
+		loopErr   error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if loopErr == nil {
+			loopErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			session := rec.Clone()
+			session.Mode = "playback"
+			for i := 0; i < iterations && ctx.Err() == nil; i++ {
+				if err := StartTestProxy(session); err != nil {
+					fail(fmt.Errorf("worker %d, iteration %d: starting playback: %w", worker, i, err))
+					return
+				}
+				opts := &arm.ClientOptions{ClientOptions: session.ClientOptions()}
+				began := time.Now()
+				err := fn(opts)
+				latency := time.Since(began)
+
+				mu.Lock()
+				latencies = append(latencies, latency)
+				if err != nil {
+					report.Errors++
+					if report.FirstError == nil {
+						report.FirstError = err
+					}
+				}
+				mu.Unlock()
+
+				if err := StopTestProxy(session); err != nil {
+					fail(fmt.Errorf("worker %d, iteration %d: stopping playback: %w", worker, i, err))
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	report.Elapsed = time.Since(start)
+	report.summarize(latencies)
+	if loopErr == nil && ctx.Err() != nil {
+		// The caller's context ended the loop.
+		loopErr = ctx.Err()
+	}
+	return report, loopErr
+}
+
+// summarize sets the iteration count, throughput and latency statistics
+// of r from latencies.
+func (r *LoopReport) summarize(latencies []time.Duration) {
+	r.Iterations = len(latencies)
+	if r.Elapsed > 0 {
+		r.Throughput = float64(r.Iterations) / r.Elapsed.Seconds()
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	// Percentiles use the nearest rank.
+	percentile := func(p int) time.Duration {
+		rank := (p*len(sorted) + 99) / 100
+		return sorted[rank-1]
+	}
+	r.Min, r.Max = sorted[0], sorted[len(sorted)-1]
+	r.Mean = total / time.Duration(len(sorted))
+	r.P50, r.P95 = percentile(50), percentile(95)
+}
@@ -0,0 +1,125 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+func TestReplayLoop(t *testing.T) {
+	sp := newStubProxy(t)
+	var mu sync.Mutex
+	starts, maxStarts := 0, -1
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/playback/start" {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if maxStarts >= 0 && starts >= maxStarts {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return true
+		}
+		starts++
+		w.Header().Set("x-recording-id", "session-"+strconv.Itoa(starts))
+		return true
+	}
+
+	active, maxActive := 0, 0
+	recordingIDs := map[string]bool{}
+	fn := func(opts *arm.ClientOptions) error {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		req, err := http.NewRequest("GET", "https://example.com/items", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := opts.Transport.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		recordingIDs[req.Header.Get("x-recording-id")] = true
+		n := len(recordingIDs)
+		mu.Unlock()
+		if n%5 == 0 {
+			return errors.New("every fifth iteration fails")
+		}
+		return nil
+	}
+
+	report, err := ReplayLoop(context.Background(), sp.variables(t, "record"), 4, 5, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Workers != 4 || report.Iterations != 20 || report.Errors != 4 || report.FirstError == nil {
+		t.Errorf("got report %+v", report)
+	}
+	if len(recordingIDs) != 20 {
+		t.Errorf("got %d recording IDs, want one per iteration", len(recordingIDs))
+	}
+	if maxActive != 4 {
+		t.Errorf("ran %d iterations at once, want 4", maxActive)
+	}
+	if report.Min < 20*time.Millisecond || report.Min > report.P50 || report.P50 > report.P95 || report.P95 > report.Max || report.Throughput <= 0 {
+		t.Errorf("inconsistent statistics %v", report)
+	}
+
+	// A session that fails to start stops the loop with partial results.
+	mu.Lock()
+	starts, maxStarts = 0, 3
+	mu.Unlock()
+	report, err = ReplayLoop(context.Background(), sp.variables(t, "playback"), 2, 10, fn)
+	if err == nil || !strings.Contains(err.Error(), "starting playback") {
+		t.Errorf("got error %v, want the startup failure", err)
+	}
+	if report.Iterations != 3 {
+		t.Errorf("got %d iterations, want the 3 whose sessions started", report.Iterations)
+	}
+}
+
+func TestLoopReportStatistics(t *testing.T) {
+	var latencies []time.Duration
+	for i := 20; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	r := LoopReport{Elapsed: 2 * time.Second}
+	r.summarize(latencies)
+	want := LoopReport{
+		Elapsed:    2 * time.Second,
+		Iterations: 20,
+		Throughput: 10,
+		Min:        time.Millisecond,
+		Max:        20 * time.Millisecond,
+		Mean:       10500 * time.Microsecond,
+		P50:        10 * time.Millisecond,
+		P95:        19 * time.Millisecond,
+	}
+	if r != want {
+		t.Errorf("got %+v, want %+v", r, want)
+	}
+}
@@ -0,0 +1,145 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// requestHashes tracks the entry index of the requests of a session.
+type requestHashes struct {
+	mu   sync.Mutex
+	next int
+}
+
+// RequestHash returns a hash identifying req by its method, URL, query
+// parameters in sorted order and body, as SHA-256 in hex. Requests that
+// differ only in the order of their query parameters or the formatting of
+// a JSON body hash the same. The body is read with GetBody when set, and
+// is otherwise read and replaced.
+func (tpv *TestProxyVariables) RequestHash(req *http.Request) string {
+	var body []byte
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		if rc, err := req.GetBody(); err == nil {
+			body, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	default:
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return requestHash(req.Method, req.URL.String(), body)
+}
+
+// Hash returns the RequestHash of the entry's request.
+func (e Entry) Hash() string {
+	return requestHash(e.RequestMethod, e.RequestUri, bodyBytes(e.RequestBody, e.RequestHeaders))
+}
+
+// FindRecordedEntry returns the index of the entry recorded or played back
+// for a request made earlier in the session with the same RequestHash as
+// req. When several requests hash the same, the first one's entry is
+// returned.
+func (tpv *TestProxyVariables) FindRecordedEntry(req *http.Request) (int, bool) {
+	hash := tpv.RequestHash(req)
+	tpv.hashes.mu.Lock()
+	defer tpv.hashes.mu.Unlock()
+	index, ok := tpv.RequestHashes[hash]
+	return index, ok
+}
+
+func requestHash(method, uri string, body []byte) string {
+	var canonical strings.Builder
+	canonical.WriteString(strings.ToUpper(method))
+	canonical.WriteByte('\n')
+	if u, err := url.Parse(uri); err == nil {
+		query := u.Query()
+		u.RawQuery, u.ForceQuery, u.Fragment = "", false, ""
+		u.Host = strings.ToLower(u.Host)
+		canonical.WriteString(u.String())
+		canonical.WriteByte('\n')
+		// Encode sorts by name.
+		canonical.WriteString(query.Encode())
+	} else {
+		canonical.WriteString(uri)
+		canonical.WriteByte('\n')
+	}
+	canonical.WriteByte('\n')
+	var compacted bytes.Buffer
+	if json.Compact(&compacted, body) == nil {
+		body = compacted.Bytes()
+	}
+
+	h := sha256.New()
+	io.WriteString(h, canonical.String())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resetRequestHashes clears RequestHashes for a new session. It is called
+// by StartTestProxy.
+func (tpv *TestProxyVariables) resetRequestHashes() {
+	tpv.hashes.mu.Lock()
+	defer tpv.hashes.mu.Unlock()
+	tpv.RequestHashes = map[string]int{}
+	tpv.hashes.next = 0
+}
+
+// captureBody returns a function giving the body req sends, for hashing
+// once it has been sent. Bodies without GetBody are copied as the
+// transport reads them.
+func captureBody(req *http.Request) func() []byte {
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+		return func() []byte { return nil }
+	case req.GetBody != nil:
+		getBody := req.GetBody
+		return func() []byte {
+			rc, err := getBody()
+			if err != nil {
+				return nil
+			}
+			defer rc.Close()
+			body, _ := io.ReadAll(rc)
+			return body
+		}
+	}
+	var sent bytes.Buffer
+	req.Body = &teeReadCloser{Reader: io.TeeReader(req.Body, &sent), Closer: req.Body}
+	return sent.Bytes
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// recordRequestHash maps the hash of a request sent through Transport to
+// the index of its entry, and returns the index. It is called by
+// TestProxyTransport.Do.
+func (tpv *TestProxyVariables) recordRequestHash(method, uri string, body []byte) int {
+	hash := requestHash(method, uri, body)
+	tpv.hashes.mu.Lock()
+	defer tpv.hashes.mu.Unlock()
+	if tpv.RequestHashes == nil {
+		tpv.RequestHashes = map[string]int{}
+	}
+	if _, ok := tpv.RequestHashes[hash]; !ok {
+		tpv.RequestHashes[hash] = tpv.hashes.next
+	}
+	tpv.hashes.next++
+	return tpv.hashes.next - 1
+}
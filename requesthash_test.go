@@ -0,0 +1,89 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	tpt := tpv.Transport(sp.Client())
+	for _, r := range []struct {
+		method, uri string
+		body        io.Reader
+	}{
+		{"GET", "https://example.com/items?b=2&a=1", nil},
+		// strings.Reader gets a GetBody; the wrapped one does not.
+		{"POST", "https://example.com/items", strings.NewReader(`{"name": "a"}`)},
+		{"POST", "https://example.com/items", io.MultiReader(strings.NewReader(`{"name": "b"}`))},
+		{"GET", "https://example.com/items?b=2&a=1", nil},
+	} {
+		req, err := http.NewRequest(r.method, r.uri, r.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, tc := range []struct {
+		method, uri, body string
+		index             int
+		found             bool
+	}{
+		{"GET", "https://EXAMPLE.com/items?a=1&b=2", "", 0, true},
+		{"POST", "https://example.com/items", `{"name":"a"}`, 1, true},
+		{"POST", "https://example.com/items", "{\n  \"name\": \"b\"\n}", 2, true},
+		{"POST", "https://example.com/items", `{"name":"c"}`, 0, false},
+		{"GET", "https://example.com/items?a=1", "", 0, false},
+	} {
+		var body io.Reader
+		if tc.body != "" {
+			body = strings.NewReader(tc.body)
+		}
+		req, err := http.NewRequest(tc.method, tc.uri, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, found := tpv.FindRecordedEntry(req)
+		if index != tc.index || found != tc.found {
+			t.Errorf("%s %s %s: got entry %d, %v, want %d, %v", tc.method, tc.uri, tc.body, index, found, tc.index, tc.found)
+		}
+	}
+	if len(tpv.RequestHashes) != 3 {
+		t.Errorf("got %d hashes, want 3 for the unique requests", len(tpv.RequestHashes))
+	}
+
+	// Entries hash like the requests they recorded.
+	e := Entry{
+		RequestUri:     "https://example.com/items",
+		RequestMethod:  "POST",
+		RequestHeaders: Headers{"Content-Type": {"application/json"}},
+		RequestBody:    json.RawMessage(`{"name": "a"}`),
+	}
+	if index, ok := tpv.RequestHashes[e.Hash()]; !ok || index != 1 {
+		t.Errorf("got entry %d, %v for the recorded entry's hash", index, ok)
+	}
+
+	// A new session starts over.
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if len(tpv.RequestHashes) != 0 {
+		t.Errorf("got %d hashes in a new session", len(tpv.RequestHashes))
+	}
+}
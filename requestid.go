@@ -0,0 +1,99 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// clientRequestIDHeader is the header azcore sets to a random ID on every
+// request.
+const clientRequestIDHeader = "x-ms-client-request-id"
+
+// requestIDSequence generates the IDs of DeterministicRequestIDPolicy.
+type requestIDSequence struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// resetRequestIDs restarts the request ID sequence. It is called by
+// StartTestProxy.
+func (tpv *TestProxyVariables) resetRequestIDs() {
+	tpv.requestIDs.mu.Lock()
+	defer tpv.requestIDs.mu.Unlock()
+	tpv.requestIDs.rng = nil
+}
+
+// nextRequestID returns the next ID of a sequence seeded from the
+// recording's name, so that a test sends the same IDs every time it is
+// recorded or played back. IDs are formatted as version 4 UUIDs, like the
+// IDs azcore generates.
+func (tpv *TestProxyVariables) nextRequestID() string {
+	tpv.requestIDs.mu.Lock()
+	defer tpv.requestIDs.mu.Unlock()
+	if tpv.requestIDs.rng == nil {
+		path := tpv.CurrentRecordingPath
+		for _, original := range []string{tpv.unscopedRecordingPath, tpv.unmergedRecordingPath} {
+			if original != "" {
+				path = original
+			}
+		}
+		h := fnv.New64a()
+		h.Write([]byte(strings.TrimSuffix(filepath.Base(path), ".json")))
+		tpv.requestIDs.rng = rand.New(rand.NewSource(int64(h.Sum64())))
+	}
+
+	var b [16]byte
+	tpv.requestIDs.rng.Read(b[:])
+	return formatUUID(b)
+}
+
+// formatUUID formats 16 random bytes as a version 4 UUID.
+func formatUUID(b [16]byte) string {
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// DeterministicRequestIDPolicy returns a per-retry policy that sets
+// x-ms-client-request-id on every attempt to the next ID of a sequence
+// seeded from the name of tpv's recording. The IDs are the same each time
+// the test runs, in record and in playback, so recordings stay byte-stable
+// and the header can take part in matching; retries still get IDs of their
+// own. ClientOptions includes it unless ExcludeRequestIDs is set.
+func DeterministicRequestIDPolicy(tpv *TestProxyVariables) policy.Policy {
+	return requestIDPolicy{tpv}
+}
+
+type requestIDPolicy struct {
+	tpv *TestProxyVariables
+}
+
+func (p requestIDPolicy) Do(req *policy.Request) (*http.Response, error) {
+	req.Raw().Header.Set(clientRequestIDHeader, p.tpv.nextRequestID())
+	return req.Next()
+}
+
+// ClientOptions returns azcore client options that send requests through
+// the session's Transport, for use as the embedded ClientOptions of a
+// service client's options:
+//
+//	client, err := aztables.NewServiceClientFromConnectionString(connStr,
+//		&aztables.ClientOptions{ClientOptions: tpv.ClientOptions()})
+func (tpv *TestProxyVariables) ClientOptions() policy.ClientOptions {
+	opts := policy.ClientOptions{Transport: tpv.Transport(tpv.HttpClient)}
+	if !tpv.ExcludeRequestIDs {
+		opts.PerRetryPolicies = append(opts.PerRetryPolicies, DeterministicRequestIDPolicy(tpv))
+	}
+	return opts
+}
@@ -0,0 +1,136 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+// sendThroughPipeline sends GET requests to uris with a pipeline built like
+// a service client's from tpv.ClientOptions, and returns the request IDs
+// the stub proxy saw.
+func sendThroughPipeline(t *testing.T, sp *stubProxy, tpv *TestProxyVariables, uris ...string) []string {
+	opts := tpv.ClientOptions()
+	opts.Retry.RetryDelay = time.Millisecond
+	pl := runtime.NewPipeline("testproxy", "v0.0.0", runtime.PipelineOptions{
+		PerCall: []policy.Policy{runtime.NewRequestIDPolicy()},
+	}, &opts)
+	before := len(sp.Requests())
+	for _, uri := range uris {
+		req, err := runtime.NewRequest(context.Background(), http.MethodGet, uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := pl.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	var ids []string
+	for _, r := range sp.Requests()[before:] {
+		ids = append(ids, r.Header.Get(clientRequestIDHeader))
+	}
+	return ids
+}
+
+func TestDeterministicRequestIDs(t *testing.T) {
+	sp := newStubProxy(t)
+	uris := []string{
+		"https://account.table.core.windows.net/Tables",
+		"https://account.table.core.windows.net/Tables('products')",
+		"https://account.table.core.windows.net/products()",
+	}
+
+	var sequences [][]string
+	for _, mode := range []string{"record", "playback", "record"} {
+		tpv := sp.variables(t, mode)
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		sequences = append(sequences, sendThroughPipeline(t, sp, tpv, uris...))
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first := sequences[0]
+	if len(first) != len(uris) || first[0] == first[1] || first[1] == first[2] {
+		t.Fatalf("unexpected IDs %v", first)
+	}
+	for _, id := range first {
+		if !uuid.MatchString(id) {
+			t.Errorf("%s is not a version 4 UUID", id)
+		}
+	}
+	for i, ids := range sequences[1:] {
+		if strings.Join(ids, ",") != strings.Join(first, ",") {
+			t.Errorf("session %d sent %v, want %v", i+1, ids, first)
+		}
+	}
+
+	// Another recording gets another sequence.
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = strings.Replace(tpv.CurrentRecordingPath, "TestDeterministicRequestIDs", "TestOther", 1)
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if ids := sendThroughPipeline(t, sp, tpv, uris[0]); ids[0] == first[0] {
+		t.Errorf("two recordings share the request ID %s", ids[0])
+	}
+}
+
+func TestDeterministicRequestIDsOnRetry(t *testing.T) {
+	sp := newStubProxy(t)
+	var attempts int32
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasPrefix(r.URL.Path, "/Tables") && atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	tpv := sp.variables(t, "record")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := sendThroughPipeline(t, sp, tpv, "https://account.table.core.windows.net/Tables")
+	if len(ids) != 2 || ids[0] == ids[1] || ids[0] == "" {
+		t.Fatalf("the attempts sent the IDs %v, want two distinct IDs", ids)
+	}
+}
+
+func TestExcludeRequestIDs(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.ExcludeRequestIDs = true
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if opts := tpv.ClientOptions(); len(opts.PerRetryPolicies) != 0 {
+		t.Errorf("ClientOptions added %d policies", len(opts.PerRetryPolicies))
+	}
+
+	var matcher map[string]interface{}
+	for _, r := range sp.Requests() {
+		if r.Path == "/Admin/SetMatcher" {
+			if err := json.Unmarshal(r.Body, &matcher); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if excluded, _ := matcher["excludedHeaders"].(string); !strings.Contains(excluded, clientRequestIDHeader) {
+		t.Errorf("request IDs are not excluded from matching: %v", matcher)
+	}
+}
@@ -0,0 +1,50 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// overrideStatusCode applies ResponseCodeOverrides to a playback response.
+// uri is the request's URL before it was rerouted to the proxy. When
+// several patterns match, the first in sorted order wins.
+func (tpv *TestProxyVariables) overrideStatusCode(resp *http.Response, uri string) error {
+	if len(tpv.ResponseCodeOverrides) == 0 || tpv.Mode != "playback" {
+		return nil
+	}
+	patterns := make([]string, 0, len(tpv.ResponseCodeOverrides))
+	for pattern := range tpv.ResponseCodeOverrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("ResponseCodeOverrides: %w", err)
+		}
+		if re.MatchString(uri) {
+			code := tpv.ResponseCodeOverrides[pattern]
+			resp.StatusCode = code
+			resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+			return nil
+		}
+	}
+	return nil
+}
+
+// overrideEntryHeaders applies the EntryHeaderOverrides of entry index to
+// a playback response.
+func (tpv *TestProxyVariables) overrideEntryHeaders(resp *http.Response, index int) {
+	if tpv.Mode != "playback" {
+		return
+	}
+	for name, value := range tpv.EntryHeaderOverrides[index] {
+		resp.Header.Set(name, value)
+	}
+}
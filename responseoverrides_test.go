@@ -0,0 +1,98 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestResponseCodeOverrides(t *testing.T) {
+	sp := newStubProxy(t)
+	do := func(tpv *TestProxyVariables, uri string) (*http.Response, error) {
+		t.Helper()
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(sp.Client()).Do(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	for _, tc := range []struct {
+		mode, uri string
+		want      int
+	}{
+		{"playback", "https://account.table.core.windows.net/Tables", http.StatusTooManyRequests},
+		{"playback", "https://account.table.core.windows.net/Tables('products')", http.StatusOK},
+		{"record", "https://account.table.core.windows.net/Tables", http.StatusOK},
+	} {
+		tpv := sp.variables(t, tc.mode)
+		tpv.ResponseCodeOverrides = map[string]int{`/Tables$`: http.StatusTooManyRequests}
+		resp, err := do(tpv, tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want || resp.Status != fmt.Sprintf("%d %s", tc.want, http.StatusText(tc.want)) {
+			t.Errorf("%s %s: got %s, want %d", tc.mode, tc.uri, resp.Status, tc.want)
+		}
+		if tpv.InspectLastResponse().StatusCode != tc.want {
+			t.Errorf("%s %s: LastResponse has status %d", tc.mode, tc.uri, tpv.InspectLastResponse().StatusCode)
+		}
+	}
+
+	tpv := sp.variables(t, "playback")
+	tpv.ResponseCodeOverrides = map[string]int{`(`: http.StatusTooManyRequests}
+	if _, err := do(tpv, "https://account.table.core.windows.net/Tables"); err == nil {
+		t.Error("no error for an invalid pattern")
+	}
+}
+
+func TestEntryHeaderOverrides(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/Tables" {
+			w.Header().Set("Retry-After", "60")
+		}
+		return false
+	}
+	for mode, want := range map[string][]string{
+		"playback": {"0", "60", "60"},
+		"record":   {"60", "60", "60"},
+	} {
+		tpv := sp.variables(t, mode)
+		tpv.EntryHeaderOverrides = map[int]map[string]string{
+			0: {"retry-after": "0", "x-ms-error-code": "ServerBusy"},
+			5: {"Retry-After": "1"},
+		}
+		tpt := tpv.Transport(sp.Client())
+		var exchanges []Exchange
+		tpv.Observer.Exchange = func(e Exchange) { exchanges = append(exchanges, e) }
+		for i := range want {
+			req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Retry-After"); got != want[i] {
+				t.Errorf("%s: entry %d has Retry-After %q, want %q", mode, i, got, want[i])
+			}
+			if got := exchanges[i].Response.Header.Get("Retry-After"); got != want[i] {
+				t.Errorf("%s: the observer saw Retry-After %q for entry %d", mode, got, i)
+			}
+		}
+		if code := exchanges[0].Response.Header.Get("x-ms-error-code"); (mode == "playback") != (code == "ServerBusy") {
+			t.Errorf("%s: entry 0 has x-ms-error-code %q", mode, code)
+		}
+	}
+}
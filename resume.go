@@ -0,0 +1,60 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// The test proxy always starts a recording from scratch, so ResumeMode
+// keeps the entries of the existing recording when the session starts and
+// puts them back in front of the new ones once the proxy has saved the
+// recording.
+
+// loadResumedRecording remembers the existing recording of a resumed
+// record session, and starts the entry cursor after its entries. It is
+// called by StartTestProxy.
+func (tpv *TestProxyVariables) loadResumedRecording() error {
+	tpv.resumed = nil
+	if !tpv.ResumeMode || tpv.Mode != "record" {
+		return nil
+	}
+	if _, err := os.Stat(tpv.CurrentRecordingPath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return fmt.Errorf("resuming %s: %w", tpv.CurrentRecordingPath, err)
+	}
+	tpv.resumed = rec
+	tpv.spans.mu.Lock()
+	tpv.spans.entries = len(rec.Entries)
+	tpv.spans.mu.Unlock()
+	tpv.hashes.mu.Lock()
+	tpv.hashes.next = len(rec.Entries)
+	tpv.hashes.mu.Unlock()
+	return nil
+}
+
+// appendResumedRecording puts the entries of the resumed recording in front
+// of those the proxy saved. Variables saved by the proxy win over resumed
+// ones. It is called by StopTestProxy.
+func (tpv *TestProxyVariables) appendResumedRecording() error {
+	resumed := tpv.resumed
+	tpv.resumed = nil
+	if resumed == nil {
+		return nil
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	rec.Entries = append(append([]Entry(nil), resumed.Entries...), rec.Entries...)
+	mergeRecordingVariables(rec, resumed)
+	return rec.WriteFile(tpv.CurrentRecordingPath)
+}
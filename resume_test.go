@@ -0,0 +1,96 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestResumeMode(t *testing.T) {
+	sp := newStubProxy(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestResumed.json")
+	tpv.ResumeMode = true
+	tpv.RecordingSpanExporter = exporter
+
+	// Each session stands in for the proxy by writing only its own entries.
+	for session, uri := range []string{"https://example.com/first", "https://example.com/second"} {
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(sp.Client()).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		rec := &RecordingFile{
+			Entries:   []Entry{{RequestUri: uri, RequestMethod: "GET", StatusCode: 200}},
+			Variables: map[string]string{"session": string(rune('1' + session))},
+		}
+		if session == 0 {
+			rec.Variables["first"] = "kept"
+		}
+		if err := rec.WriteFile(tpv.CurrentRecordingPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, e := range rec.Entries {
+		uris = append(uris, e.RequestUri)
+	}
+	if want := []string{"https://example.com/first", "https://example.com/second"}; !reflect.DeepEqual(uris, want) {
+		t.Errorf("got entries %v, want %v", uris, want)
+	}
+	if want := map[string]string{"session": "2", "first": "kept"}; !reflect.DeepEqual(rec.Variables, want) {
+		t.Errorf("got variables %v, want %v", rec.Variables, want)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	for i, span := range spans {
+		for _, kv := range span.Attributes {
+			if kv.Key == "recording.entry_index" && kv.Value.AsInt64() != int64(i) {
+				t.Errorf("span %d has entry index %d", i, kv.Value.AsInt64())
+			}
+		}
+	}
+
+	// Without ResumeMode the recording is replaced.
+	tpv.ResumeMode = false
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&RecordingFile{}).WriteFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if rec, err = ReadRecordingFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	} else if len(rec.Entries) != 0 {
+		t.Errorf("got %d entries without ResumeMode, want 0", len(rec.Entries))
+	}
+}
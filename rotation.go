@@ -0,0 +1,101 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotateRecording archives the existing recording before a record session
+// overwrites it, as <name>.json.<N> with N one more than the newest
+// archive, and deletes the oldest archives beyond MaxRotationCount. When
+// CompressFormat is set, the compressed recording is the one rotated, to
+// <name>.json.gz.<N> or <name>.json.br.<N>. The archives do not end in a
+// recording extension, so ListRecordings, Stats and ScanRecordings skip
+// them.
+func (tpv *TestProxyVariables) rotateRecording() error {
+	current, err := tpv.compressedRecordingPath()
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		current = tpv.CurrentRecordingPath
+	}
+	if _, err := os.Stat(current); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	archives, err := rotatedRecordings(current)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(archives) > 0 {
+		next = archives[len(archives)-1] + 1
+	}
+	if err := os.Rename(current, rotatedRecordingPath(current, next)); err != nil {
+		return err
+	}
+	recordingCache.Forget(current)
+	archives = append(archives, next)
+
+	if tpv.MaxRotationCount > 0 {
+		for len(archives) > tpv.MaxRotationCount {
+			if err := os.Remove(rotatedRecordingPath(current, archives[0])); err != nil {
+				return err
+			}
+			archives = archives[1:]
+		}
+	}
+	return nil
+}
+
+func rotatedRecordingPath(file string, n int) string {
+	return file + "." + strconv.Itoa(n)
+}
+
+// rotatedRecordings returns the numbers of the archives of the recording
+// file, oldest first.
+func rotatedRecordings(file string) ([]int, error) {
+	dirEntries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(file) + "."
+	var numbers []int
+	for _, d := range dirEntries {
+		name := d.Name()
+		if d.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if n, ok := rotationNumber(name); ok && name == prefix+strconv.Itoa(n) {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+// rotationNumber returns N for the name of an archive, <recording>.<N>,
+// made by rotateRecording.
+func rotationNumber(name string) (int, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n <= 0 || !hasRecordingExt(name[:i]) {
+		return 0, false
+	}
+	return n, true
+}
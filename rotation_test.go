@@ -0,0 +1,86 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRotateRecordings(t *testing.T) {
+	sp := newStubProxy(t)
+	dir := t.TempDir()
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(dir, "TestRotated.json")
+	tpv.RotateRecordings = true
+	tpv.MaxRotationCount = 2
+
+	// Each session stands in for the proxy by writing the recording itself.
+	for session := 1; session <= 4; session++ {
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		rec := &RecordingFile{Variables: map[string]string{"session": strconv.Itoa(session)}}
+		if err := rec.WriteFile(tpv.CurrentRecordingPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		rec, err := ReadRecordingFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[e.Name()] = rec.Variables["session"]
+	}
+	want := map[string]string{
+		"TestRotated.json":   "4",
+		"TestRotated.json.2": "2",
+		"TestRotated.json.3": "3",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want %v", files, want)
+	}
+
+	// Playback never rotates.
+	tpv.Mode = "playback"
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	got, err := rotatedRecordings(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("got archives %v after playback, want [2 3]", got)
+	}
+
+	// The archives are not counted as recordings.
+	infos, err := ListRecordings(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || filepath.Base(infos[0].Path) != "TestRotated.json" {
+		t.Errorf("listed %+v, want only TestRotated.json", infos)
+	}
+	stats, err := Stats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Recordings != 1 {
+		t.Errorf("Stats counted %d recordings, want 1", stats.Recordings)
+	}
+}
@@ -0,0 +1,170 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sanitizer is a test proxy sanitizer, which replaces sensitive values in
+// requests and responses before they are recorded or matched. Name returns
+// the sanitizer's name in the proxy, and the sanitizer is sent to the proxy
+// as its JSON encoding.
+type Sanitizer interface {
+	Name() string
+}
+
+// BodyRegexSanitizer replaces the matches of Regex in request and response
+// bodies with Value. When GroupForReplace is set, only that capture group
+// is replaced.
+type BodyRegexSanitizer struct {
+	Value           string `json:"value,omitempty"`
+	Regex           string `json:"regex,omitempty"`
+	GroupForReplace string `json:"groupForReplace,omitempty"`
+}
+
+func (BodyRegexSanitizer) Name() string { return "BodyRegexSanitizer" }
+
+// BodyKeySanitizer replaces the value at JSONPath in JSON bodies with Value.
+type BodyKeySanitizer struct {
+	JSONPath        string `json:"jsonPath"`
+	Value           string `json:"value,omitempty"`
+	Regex           string `json:"regex,omitempty"`
+	GroupForReplace string `json:"groupForReplace,omitempty"`
+}
+
+func (BodyKeySanitizer) Name() string { return "BodyKeySanitizer" }
+
+// HeaderRegexSanitizer replaces the value of the header Key with Value,
+// or only the matches of Regex in it when Regex is set.
+type HeaderRegexSanitizer struct {
+	Key             string `json:"key"`
+	Value           string `json:"value,omitempty"`
+	Regex           string `json:"regex,omitempty"`
+	GroupForReplace string `json:"groupForReplace,omitempty"`
+}
+
+func (HeaderRegexSanitizer) Name() string { return "HeaderRegexSanitizer" }
+
+// UriRegexSanitizer replaces the matches of Regex in request URIs with
+// Value.
+type UriRegexSanitizer struct {
+	Value           string `json:"value,omitempty"`
+	Regex           string `json:"regex,omitempty"`
+	GroupForReplace string `json:"groupForReplace,omitempty"`
+}
+
+func (UriRegexSanitizer) Name() string { return "UriRegexSanitizer" }
+
+// RecordOnlySanitizer applies Sanitizer only in record mode, e.g. to scrub
+// real secrets that a recording, and hence playback, never contains.
+type RecordOnlySanitizer struct {
+	Sanitizer Sanitizer
+}
+
+func (s RecordOnlySanitizer) Name() string { return s.Sanitizer.Name() }
+
+func (s RecordOnlySanitizer) MarshalJSON() ([]byte, error) { return marshalNoEscape(s.Sanitizer) }
+
+func (s RecordOnlySanitizer) appliesIn(mode string) bool {
+	return mode == "record" && sanitizerApplies(s.Sanitizer, mode)
+}
+
+// PlaybackOnlySanitizer applies Sanitizer only in playback mode.
+type PlaybackOnlySanitizer struct {
+	Sanitizer Sanitizer
+}
+
+func (s PlaybackOnlySanitizer) Name() string { return s.Sanitizer.Name() }
+
+func (s PlaybackOnlySanitizer) MarshalJSON() ([]byte, error) { return marshalNoEscape(s.Sanitizer) }
+
+func (s PlaybackOnlySanitizer) appliesIn(mode string) bool {
+	return mode == "playback" && sanitizerApplies(s.Sanitizer, mode)
+}
+
+// sanitizerApplies reports whether s should be registered in mode. Only
+// the mode-aware wrappers restrict this.
+func sanitizerApplies(s Sanitizer, mode string) bool {
+	if ms, ok := s.(interface{ appliesIn(mode string) bool }); ok {
+		return ms.appliesIn(mode)
+	}
+	return true
+}
+
+// AddSanitizer registers s with the proxy. Once a session is started, the
+// sanitizer only applies to that session's recording; before, it applies
+// to every session the proxy runs. Sanitizers wrapped in
+// RecordOnlySanitizer or PlaybackOnlySanitizer are skipped in the other mode.
+func (tpv *TestProxyVariables) AddSanitizer(s Sanitizer) error {
+	if !sanitizerApplies(s, tpv.Mode) {
+		return nil
+	}
+	marshalled, err := marshalNoEscape(s)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("https://%v:%v/Admin/AddSanitizer", tpv.Host, tpv.Port)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(marshalled))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	headers := tpv.ProxyHeaders.withDefaults()
+	req.Header.Set(headers.AbstractionIdentifier, s.Name())
+	if tpv.RecordingId != "" {
+		req.Header.Set(headers.RecordingId, tpv.RecordingId)
+	}
+	setClientId(req, tpv)
+
+	resp, err := tpv.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("adding %s: %s: %s", s.Name(), resp.Status, bytes.TrimSpace(body))
+	}
+	tpv.registered = append(tpv.registered, s)
+	return nil
+}
+
+// ResetSanitizers removes the sanitizers registered for the session, so
+// later requests are recorded and matched as they are, e.g. in a
+// t.Cleanup undoing sanitizers a test registered conditionally. The test
+// proxy has no call that removes sanitizers alone: its Admin/Reset
+// endpoint clears every customization of the session, so in playback the
+// session's matcher is set again afterwards. Without a started session,
+// the proxy's global customizations are reset.
+func (tpv *TestProxyVariables) ResetSanitizers() error {
+	url := fmt.Sprintf("https://%v:%v/Admin/Reset", tpv.Host, tpv.Port)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return err
+	}
+	if tpv.RecordingId != "" {
+		req.Header.Set(tpv.ProxyHeaders.withDefaults().RecordingId, tpv.RecordingId)
+	}
+	setClientId(req, tpv)
+
+	resp, err := tpv.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("resetting sanitizers: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	tpv.registered = nil
+	if tpv.RecordingId != "" && tpv.Mode == "playback" {
+		return tpv.setSessionMatcher()
+	}
+	return nil
+}
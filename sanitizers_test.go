@@ -0,0 +1,138 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestModeSanitizers(t *testing.T) {
+	sanitizers := []Sanitizer{
+		RecordOnlySanitizer{BodyRegexSanitizer{Value: "fake", Regex: "AccountKey=[^;]+"}},
+		PlaybackOnlySanitizer{HeaderRegexSanitizer{Key: "x-ms-date", Value: "Sanitized"}},
+		PlaybackOnlySanitizer{RecordOnlySanitizer{UriRegexSanitizer{Value: "never"}}},
+		UriRegexSanitizer{Value: "fake", Regex: "sig=[^&]+"},
+	}
+
+	for mode, want := range map[string][]string{
+		"record": {
+			`BodyRegexSanitizer {"value":"fake","regex":"AccountKey=[^;]+"}`,
+			`UriRegexSanitizer {"value":"fake","regex":"sig=[^&]+"}`,
+		},
+		"playback": {
+			`HeaderRegexSanitizer {"key":"x-ms-date","value":"Sanitized"}`,
+			`UriRegexSanitizer {"value":"fake","regex":"sig=[^&]+"}`,
+		},
+	} {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, mode)
+		for _, s := range sanitizers {
+			if err := tpv.AddSanitizer(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []string
+		for _, r := range sp.Requests() {
+			got = append(got, r.Header.Get("x-abstraction-identifier")+" "+string(r.Body))
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: got sanitizers:\n%s\nwant:\n%s", mode, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestResetSanitizers(t *testing.T) {
+	// The stub sanitizes recorded request bodies with the session's
+	// BodyRegexSanitizers and saves the entries when the session stops.
+	sp := newStubProxy(t)
+	path := filepath.Join(t.TempDir(), "TestResetSanitizers.json")
+	var mu sync.Mutex
+	var sanitizers []BodyRegexSanitizer
+	var entries []Entry
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		requests := sp.Requests()
+		body := requests[len(requests)-1].Body
+		switch r.URL.Path {
+		case "/Admin/AddSanitizer":
+			var s BodyRegexSanitizer
+			json.Unmarshal(body, &s)
+			sanitizers = append(sanitizers, s)
+		case "/Admin/Reset":
+			if r.Header.Get("x-recording-id") != "stub-recording-id" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			sanitizers = nil
+		case "/record/stop":
+			(&RecordingFile{Entries: entries}).WriteFile(path)
+		case "/record/start", "/playback/start", "/playback/stop", "/Admin/SetMatcher":
+			return false
+		default:
+			for _, s := range sanitizers {
+				body = regexp.MustCompile(s.Regex).ReplaceAll(body, []byte(s.Value))
+			}
+			entries = append(entries, Entry{RequestUri: r.URL.String(), RequestMethod: r.Method, RequestBody: body})
+		}
+		return true
+	}
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := tpv.AddSanitizer(BodyRegexSanitizer{Value: `"Sanitized"`, Regex: `"secret-[a-z]+"`}); err != nil {
+		t.Fatal(err)
+	}
+	tpt := tpv.Transport(sp.Client())
+	send := func() {
+		req, err := http.NewRequest("PUT", "https://account.table.core.windows.net/Tables", strings.NewReader(`{"key":"secret-abc"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	send()
+	if err := tpv.ResetSanitizers(); err != nil {
+		t.Fatal(err)
+	}
+	send()
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Entries) != 2 || compactJSON(t, rec.Entries[0].RequestBody) != `{"key":"Sanitized"}` || compactJSON(t, rec.Entries[1].RequestBody) != `{"key":"secret-abc"}` {
+		t.Errorf("recorded %+v", rec.Entries)
+	}
+
+	// In playback, the session's matcher is set again.
+	playback := sp.variables(t, "playback")
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	if err := playback.ResetSanitizers(); err != nil {
+		t.Fatal(err)
+	}
+	requests := sp.Requests()
+	if last := requests[len(requests)-1]; last.Path != "/Admin/SetMatcher" || last.Header.Get("x-recording-id") != "stub-recording-id" {
+		t.Errorf("last request was %s", last.Path)
+	}
+}
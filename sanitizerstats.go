@@ -0,0 +1,128 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// defaultSanitizedValue is what the proxy writes for a sanitizer without a
+// Value.
+const defaultSanitizedValue = "Sanitized"
+
+// SanitizerStat is the number of recording entries a sanitizer rewrote.
+type SanitizerStat struct {
+	Sanitizer Sanitizer
+	Matches   int
+}
+
+// SanitizerStats returns the sanitizers registered with AddSanitizer,
+// including those given with WithSanitizers, and how many entries of the
+// recording each rewrote. The test proxy keeps no such statistics, so they
+// are read from the recording once StopTestProxy has saved it: an entry
+// counts as a match when the sanitizer's replacement value is found in the
+// part of the entry it rewrites, the headers named by a header sanitizer,
+// the bodies for a body sanitizer or the URI for a URI sanitizer. A value
+// that also occurs in the service's traffic is therefore counted too.
+// Sanitizers of types this package does not define are not counted and
+// report -1.
+func (tpv *TestProxyVariables) SanitizerStats() ([]SanitizerStat, error) {
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]SanitizerStat, 0, len(tpv.registered))
+	for _, s := range tpv.registered {
+		stats = append(stats, SanitizerStat{Sanitizer: s, Matches: sanitizerMatches(s, rec)})
+	}
+	return stats, nil
+}
+
+// AssertSanitizersApplied fails t for each registered sanitizer that did
+// not rewrite any entry of the recording, which usually means it no longer
+// matches the traffic, e.g. because a header was renamed. Call it after
+// StopTestProxy in record mode.
+func (tpv *TestProxyVariables) AssertSanitizersApplied(t testing.TB) {
+	t.Helper()
+	stats, err := tpv.SanitizerStats()
+	if err != nil {
+		t.Errorf("reading sanitizer statistics: %v", err)
+		return
+	}
+	for _, stat := range stats {
+		if stat.Matches == 0 {
+			marshalled, _ := marshalNoEscape(stat.Sanitizer)
+			t.Errorf("%s %s did not match any entry of %s", stat.Sanitizer.Name(), marshalled, tpv.CurrentRecordingPath)
+		}
+	}
+}
+
+// sanitizerMatches counts the entries of rec that s rewrote, or returns -1
+// when s is of an unknown type.
+func sanitizerMatches(s Sanitizer, rec *RecordingFile) int {
+	switch v := s.(type) {
+	case RecordOnlySanitizer:
+		return sanitizerMatches(v.Sanitizer, rec)
+	case PlaybackOnlySanitizer:
+		return sanitizerMatches(v.Sanitizer, rec)
+	case DateSanitizer:
+		var header HeaderRegexSanitizer
+		marshalled, _ := v.MarshalJSON()
+		if err := json.Unmarshal(marshalled, &header); err != nil {
+			return -1
+		}
+		return sanitizerMatches(header, rec)
+	}
+
+	var in func(e Entry, value string) bool
+	var value string
+	switch v := s.(type) {
+	case HeaderRegexSanitizer:
+		value = v.Value
+		in = func(e Entry, value string) bool {
+			return headerContains(e.RequestHeaders, v.Key, value) || headerContains(e.ResponseHeaders, v.Key, value)
+		}
+	case BodyRegexSanitizer:
+		value, in = v.Value, bodiesContain
+	case BodyKeySanitizer:
+		value, in = v.Value, bodiesContain
+	case UriRegexSanitizer:
+		value = v.Value
+		in = func(e Entry, value string) bool { return strings.Contains(e.RequestUri, value) }
+	default:
+		return -1
+	}
+	if value == "" {
+		value = defaultSanitizedValue
+	}
+	matches := 0
+	for _, e := range rec.Entries {
+		if in(e, value) {
+			matches++
+		}
+	}
+	return matches
+}
+
+func headerContains(h Headers, name, value string) bool {
+	for k, values := range h {
+		if !strings.EqualFold(k, name) {
+			continue
+		}
+		for _, v := range values {
+			if strings.Contains(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func bodiesContain(e Entry, value string) bool {
+	return strings.Contains(string(bodyBytes(e.RequestBody, e.RequestHeaders)), value) ||
+		strings.Contains(string(bodyBytes(e.ResponseBody, e.ResponseHeaders)), value)
+}
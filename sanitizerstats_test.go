@@ -0,0 +1,83 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSanitizerStats(t *testing.T) {
+	sp := newStubProxy(t)
+	path := filepath.Join(t.TempDir(), "TestSanitizerStats.json")
+	rec := &RecordingFile{Entries: []Entry{
+		{
+			RequestUri:      "https://account.table.core.windows.net/Tables?sig=REDACTED",
+			RequestMethod:   "POST",
+			RequestHeaders:  Headers{"Authorization": {"Sanitized"}, "x-ms-date": {SanitizedDate}, "Content-Type": {"application/json"}},
+			RequestBody:     []byte(`{"TableName":"products","key":"Sanitized"}`),
+			StatusCode:      201,
+			ResponseHeaders: Headers{"Content-Type": {"application/json"}},
+			ResponseBody:    []byte(`{"TableName":"products"}`),
+		},
+		{
+			RequestUri:     "https://account.table.core.windows.net/Tables",
+			RequestMethod:  "GET",
+			RequestHeaders: Headers{"Authorization": {"Bearer Sanitized"}},
+			StatusCode:     200,
+		},
+	}}
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+	sanitizers := []Sanitizer{
+		HeaderRegexSanitizer{Key: "authorization"},
+		DateSanitizer{},
+		RecordOnlySanitizer{UriRegexSanitizer{Value: "REDACTED", Regex: "sig=[^&]+"}},
+		BodyKeySanitizer{JSONPath: "$.key"},
+		HeaderRegexSanitizer{Key: "x-ms-client-request-id"},
+		BodyRegexSanitizer{Value: "fake-account-key", Regex: "AccountKey=[^;]+"},
+		PlaybackOnlySanitizer{UriRegexSanitizer{Value: "never"}},
+	}
+	for _, s := range sanitizers {
+		if err := tpv.AddSanitizer(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := tpv.SanitizerStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, stat := range stats {
+		got = append(got, stat.Matches)
+	}
+	// The playback-only sanitizer was not registered in record mode.
+	if want := []int{2, 1, 1, 1, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got matches %v, want %v", got, want)
+	}
+
+	r := &errorRecorder{TB: t}
+	tpv.AssertSanitizersApplied(r)
+	if len(r.errors) != 2 || !strings.Contains(r.errors[0], `HeaderRegexSanitizer {"key":"x-ms-client-request-id"}`) || !strings.Contains(r.errors[1], "BodyRegexSanitizer") {
+		t.Errorf("got errors %q", r.errors)
+	}
+
+	// Reset sanitizers are no longer asserted.
+	if err := tpv.ResetSanitizers(); err != nil {
+		t.Fatal(err)
+	}
+	r = &errorRecorder{TB: t}
+	tpv.AssertSanitizersApplied(r)
+	if len(r.errors) != 0 {
+		t.Errorf("got errors %q after ResetSanitizers", r.errors)
+	}
+}
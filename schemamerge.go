@@ -0,0 +1,226 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// MergeStrategy says how MergeWithSchemaEvolution combines a top-level
+// field found in several recordings.
+type MergeStrategy string
+
+const (
+	// MergeTakeFirst keeps the field of the first recording that has it.
+	MergeTakeFirst MergeStrategy = "take-first"
+	// MergeTakeLast keeps the field of the last recording that has it.
+	MergeTakeLast MergeStrategy = "take-last"
+	// MergeUnion concatenates arrays and merges the keys of objects, later
+	// recordings winning. Other values are combined as with MergeTakeLast.
+	MergeUnion MergeStrategy = "union"
+)
+
+// entryFieldOrder is the order in which the proxy writes the fields of an
+// entry.
+var entryFieldOrder = []string{"RequestUri", "RequestMethod", "RequestHeaders", "RequestBody", "StatusCode", "ResponseHeaders", "ResponseBody"}
+
+// MergeWithSchemaEvolution merges recordings written by different versions
+// of the test proxy into dst. Unlike MergeRecordings it does not decode the
+// recordings into RecordingFile, so fields this package does not know,
+// whether top-level or in entries, are kept. strategies picks how each
+// top-level field is merged and defaults to MergeUnion, which concatenates
+// the Entries. An entry missing a field that other entries have, because
+// an older proxy wrote it, gets the zero value of that field's JSON type.
+func MergeWithSchemaEvolution(dst string, srcs []string, strategies map[string]MergeStrategy) error {
+	for field, strategy := range strategies {
+		switch strategy {
+		case MergeTakeFirst, MergeTakeLast, MergeUnion:
+		default:
+			return fmt.Errorf("unknown merge strategy %q for field %s", strategy, field)
+		}
+	}
+
+	merged := map[string]json.RawMessage{}
+	for _, src := range srcs {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		for name, value := range fields {
+			old, ok := merged[name]
+			if !ok {
+				merged[name] = value
+				continue
+			}
+			strategy, ok := strategies[name]
+			if !ok {
+				strategy = MergeUnion
+			}
+			switch strategy {
+			case MergeTakeLast:
+				merged[name] = value
+			case MergeUnion:
+				if merged[name], err = unionJSON(old, value); err != nil {
+					return fmt.Errorf("%s: field %s: %w", src, name, err)
+				}
+			}
+		}
+	}
+
+	if raw, ok := merged["Entries"]; ok {
+		entries, err := fillEntryFields(raw)
+		if err != nil {
+			return err
+		}
+		merged["Entries"] = entries
+	}
+
+	data, err := marshalOrdered(merged, []string{"Entries", "Variables"})
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	recordingCache.Forget(dst)
+	return os.WriteFile(dst, indented.Bytes(), 0o644)
+}
+
+// unionJSON combines two values with MergeUnion.
+func unionJSON(a, b json.RawMessage) (json.RawMessage, error) {
+	switch {
+	case jsonKind(a) == '[' && jsonKind(b) == '[':
+		var x, y []json.RawMessage
+		if err := json.Unmarshal(a, &x); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &y); err != nil {
+			return nil, err
+		}
+		return marshalNoEscape(append(x, y...))
+	case jsonKind(a) == '{' && jsonKind(b) == '{':
+		var x, y map[string]json.RawMessage
+		if err := json.Unmarshal(a, &x); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &y); err != nil {
+			return nil, err
+		}
+		for k, v := range y {
+			x[k] = v
+		}
+		return marshalOrdered(x, nil)
+	}
+	return b, nil
+}
+
+// fillEntryFields gives every entry the fields any entry has, using the
+// zero value of the field's type where it is missing.
+func fillEntryFields(raw json.RawMessage) (json.RawMessage, error) {
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("Entries: %w", err)
+	}
+	zeros := map[string]json.RawMessage{}
+	for _, e := range entries {
+		for name, value := range e {
+			if zero := jsonZero(value); zero != nil {
+				if _, ok := zeros[name]; !ok || string(zeros[name]) == "null" {
+					zeros[name] = zero
+				}
+			}
+		}
+	}
+	filled := make([]json.RawMessage, len(entries))
+	for i, e := range entries {
+		for name, zero := range zeros {
+			if _, ok := e[name]; !ok {
+				e[name] = zero
+			}
+		}
+		data, err := marshalOrdered(e, entryFieldOrder)
+		if err != nil {
+			return nil, err
+		}
+		filled[i] = data
+	}
+	return marshalNoEscape(filled)
+}
+
+// jsonKind returns the first non-space byte of a JSON value.
+func jsonKind(v json.RawMessage) byte {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return 0
+	}
+	return v[0]
+}
+
+// jsonZero returns the zero value of v's JSON type.
+func jsonZero(v json.RawMessage) json.RawMessage {
+	switch jsonKind(v) {
+	case '{':
+		return json.RawMessage("{}")
+	case '[':
+		return json.RawMessage("[]")
+	case '"':
+		return json.RawMessage(`""`)
+	case 't', 'f':
+		return json.RawMessage("false")
+	case 'n':
+		return json.RawMessage("null")
+	case 0:
+		return nil
+	}
+	return json.RawMessage("0")
+}
+
+// marshalOrdered encodes m as a JSON object with the keys in first, when
+// present, followed by the others in sorted order.
+func marshalOrdered(m map[string]json.RawMessage, first []string) (json.RawMessage, error) {
+	seen := map[string]bool{}
+	keys := make([]string, 0, len(m))
+	for _, k := range first {
+		if _, ok := m[k]; ok {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	var rest []string
+	for k := range m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshalNoEscape(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(m[k])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
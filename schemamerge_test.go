@@ -0,0 +1,92 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Recordings of an older proxy without ResponseTime in entries, and of a
+// newer one that adds it and a top-level Schema field.
+const (
+	schemaV1Recording = `{
+  "Entries": [
+    {"RequestUri": "https://example.com/a", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": "a"}
+  ],
+  "Variables": {"name": "v1", "only-v1": "x"}
+}`
+	schemaV2Recording = `{
+  "Schema": 2,
+  "Entries": [
+    {"RequestUri": "https://example.com/b", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": "b", "ResponseTime": 12.5, "Tags": ["slow"]}
+  ],
+  "Variables": {"name": "v2"}
+}`
+)
+
+func TestMergeWithSchemaEvolution(t *testing.T) {
+	dir := t.TempDir()
+	v1 := filepath.Join(dir, "v1.json")
+	v2 := filepath.Join(dir, "v2.json")
+	if err := os.WriteFile(v1, []byte(schemaV1Recording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v2, []byte(schemaV2Recording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		strategies map[string]MergeStrategy
+		want       string
+	}{
+		{
+			name: "union",
+			want: `{"Entries":[` +
+				`{"RequestUri":"https://example.com/a","RequestMethod":"GET","RequestHeaders":{},"RequestBody":null,"StatusCode":200,"ResponseHeaders":{},"ResponseBody":"a","ResponseTime":0,"Tags":[]},` +
+				`{"RequestUri":"https://example.com/b","RequestMethod":"GET","RequestHeaders":{},"RequestBody":null,"StatusCode":200,"ResponseHeaders":{},"ResponseBody":"b","ResponseTime":12.5,"Tags":["slow"]}],` +
+				`"Variables":{"name":"v2","only-v1":"x"},"Schema":2}`,
+		},
+		{
+			name:       "take-first",
+			strategies: map[string]MergeStrategy{"Entries": MergeTakeFirst, "Variables": MergeTakeFirst},
+			want: `{"Entries":[` +
+				`{"RequestUri":"https://example.com/a","RequestMethod":"GET","RequestHeaders":{},"RequestBody":null,"StatusCode":200,"ResponseHeaders":{},"ResponseBody":"a"}],` +
+				`"Variables":{"name":"v1","only-v1":"x"},"Schema":2}`,
+		},
+		{
+			name:       "take-last",
+			strategies: map[string]MergeStrategy{"Variables": MergeTakeLast},
+			want: `{"Entries":[` +
+				`{"RequestUri":"https://example.com/a","RequestMethod":"GET","RequestHeaders":{},"RequestBody":null,"StatusCode":200,"ResponseHeaders":{},"ResponseBody":"a","ResponseTime":0,"Tags":[]},` +
+				`{"RequestUri":"https://example.com/b","RequestMethod":"GET","RequestHeaders":{},"RequestBody":null,"StatusCode":200,"ResponseHeaders":{},"ResponseBody":"b","ResponseTime":12.5,"Tags":["slow"]}],` +
+				`"Variables":{"name":"v2"},"Schema":2}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := filepath.Join(dir, tc.name+".json")
+			if err := MergeWithSchemaEvolution(out, []string{v1, v2}, tc.strategies); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := compactJSON(t, data); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+			// The known fields still read as a recording.
+			if _, err := ReadRecordingFile(out); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	if err := MergeWithSchemaEvolution(filepath.Join(dir, "out.json"), []string{v1, v2}, map[string]MergeStrategy{"Entries": "newest"}); err == nil {
+		t.Error("no error for an unknown strategy")
+	}
+}
@@ -0,0 +1,192 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SecretRule is a pattern for a secret that should never appear in a
+// committed recording.
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultSecretRules flag the secrets most likely to escape sanitization in
+// Azure recordings. Append your own rules to extend them.
+var DefaultSecretRules = []SecretRule{
+	{"jwt", regexp.MustCompile(`eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"storage-account-key", regexp.MustCompile(`AccountKey=[A-Za-z0-9+/]{20,}={0,2}`)},
+	{"sas-signature", regexp.MustCompile(`[?&]sig=[A-Za-z0-9%+/]{16,}={0,2}`)},
+	{"pem-block", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----`)},
+}
+
+// Finding is a likely secret found by ScanRecordings.
+type Finding struct {
+	File  string
+	Entry int
+	// Location is the part of the entry the secret was found in, e.g.
+	// "RequestUri", "RequestHeaders.Authorization" or "ResponseBody".
+	Location string
+	Rule     string
+	// Snippet is the matched text with all but its first characters masked.
+	Snippet string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: Entries[%d].%s: %s (%s)", f.File, f.Entry, f.Location, f.Snippet, f.Rule)
+}
+
+// ScanRecordings looks for secrets that escaped sanitization in every
+// recording under dir, including those compressed with CompressFormat.
+// Other JSON files, such as assets.json, are skipped. Strings are scanned
+// as decoded, so a URL the proxy saved with "&" escaped as "\u0026" still
+// matches. When rules is nil, DefaultSecretRules are used.
+func ScanRecordings(dir string, rules []SecretRule) ([]Finding, error) {
+	if rules == nil {
+		rules = DefaultSecretRules
+	}
+
+	var findings []Finding
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !hasRecordingExt(path) {
+			return nil
+		}
+		data, err := readRecordingData(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			if json.Valid(data) {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := doc["Entries"]; !ok {
+			return nil
+		}
+		rec := &RecordingFile{}
+		if err := json.Unmarshal(data, rec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		for i, e := range rec.Entries {
+			scan := func(location, text string) {
+				for _, rule := range rules {
+					for _, match := range rule.Pattern.FindAllString(text, -1) {
+						findings = append(findings, Finding{
+							File:     path,
+							Entry:    i,
+							Location: location,
+							Rule:     rule.Name,
+							Snippet:  redactSnippet(match),
+						})
+					}
+				}
+			}
+			scan("RequestUri", e.RequestUri)
+			scanHeaders("RequestHeaders", e.RequestHeaders, scan)
+			scanBody("RequestBody", e.RequestBody, scan)
+			scanHeaders("ResponseHeaders", e.ResponseHeaders, scan)
+			scanBody("ResponseBody", e.ResponseBody, scan)
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// RequireNoSecrets scans dir with ScanRecordings and returns an error
+// listing every finding, for use as a gate in TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		if err := testproxy.RequireNoSecrets("recordings", nil); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//		os.Exit(m.Run())
+//	}
+func RequireNoSecrets(dir string, rules []SecretRule) error {
+	findings, err := ScanRecordings(dir, rules)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = "  " + f.String()
+	}
+	return fmt.Errorf("found %d likely secrets in recordings:\n%s", len(findings), strings.Join(lines, "\n"))
+}
+
+func scanHeaders(prefix string, headers Headers, scan func(location, text string)) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range headers[name] {
+			scan(prefix+"."+name, v)
+		}
+	}
+}
+
+// scanBody scans every string in a recorded body, and the names of its
+// fields, as decoded. A body that is not JSON is scanned as it is.
+func scanBody(location string, body json.RawMessage, scan func(location, text string)) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		scan(location, string(body))
+		return
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			scan(location, v)
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				scan(location, k)
+				walk(v[k])
+			}
+		}
+	}
+	walk(v)
+}
+
+// redactSnippet keeps enough of a match to identify it and masks the rest.
+func redactSnippet(match string) string {
+	const keep = 6
+	if len(match) <= keep {
+		return strings.Repeat("*", len(match))
+	}
+	return match[:keep] + strings.Repeat("*", len(match)-keep)
+}
@@ -0,0 +1,103 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScanRecordings(t *testing.T) {
+	rules := append([]SecretRule{
+		{"ticket", regexp.MustCompile(`CONTOSO-\d+`)},
+	}, DefaultSecretRules...)
+
+	findings, err := ScanRecordings("testdata/secrets", rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range findings {
+		if filepath.Base(f.File) != "TestLeaky.json" {
+			t.Errorf("finding in clean recording: %v", f)
+		}
+		if strings.Contains(f.Snippet, "FAKEfake") || strings.Contains(f.Snippet, "eyJzdWIi") {
+			t.Errorf("snippet not redacted: %s", f.Snippet)
+		}
+		got = append(got, f.Rule+" "+f.Location+" "+strconv.Itoa(f.Entry))
+	}
+	sort.Strings(got)
+	want := []string{
+		"jwt RequestHeaders.Authorization 0",
+		"pem-block ResponseBody 1",
+		"sas-signature RequestUri 0",
+		"storage-account-key ResponseBody 0",
+		"ticket ResponseBody 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestScanRecordingsDecodesAndDecompresses(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The proxy escapes "&" in the URLs it saves in bodies.
+	leaky := `{"Entries": [{"RequestUri": "https://example.com/", "RequestMethod": "GET", "StatusCode": 200,
+		"ResponseBody": {"url": "https://account.blob.core.windows.net/c/b?sv=2021-08-06\u0026sig=FAKEfakeFAKEfake0123"}}]}`
+	write("TestEscaped.json", leaky)
+	for name, format := range compressionFormats {
+		write("TestCompressed"+name+".json", leaky)
+		src := filepath.Join(dir, "TestCompressed"+name+".json")
+		if err := format.compress(src, src+format.ext); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("assets.json", `{"AssetsRepo": "Azure/azure-sdk-assets", "Tag": "go/sig=FAKEfakeFAKEfake0123"}`)
+	write("matrix.json", `["?sig=FAKEfakeFAKEfake0123"]`)
+
+	findings, err := ScanRecordings(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, filepath.Base(f.File)+" "+f.Rule+" "+f.Location)
+	}
+	sort.Strings(got)
+	want := []string{
+		"TestCompressedbrotli.json.br sas-signature ResponseBody",
+		"TestCompressedgzip.json.gz sas-signature ResponseBody",
+		"TestEscaped.json sas-signature ResponseBody",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRequireNoSecrets(t *testing.T) {
+	if err := RequireNoSecrets("testdata/secrets", nil); err == nil {
+		t.Fatal("expected findings to fail the gate")
+	} else if !strings.Contains(err.Error(), "TestLeaky.json") {
+		t.Fatalf("error does not name the file: %v", err)
+	}
+	if err := RequireNoSecrets("recordings", nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxDiagramLabel is the number of characters of a request's path and
+// query shown on its arrow.
+const maxDiagramLabel = 60
+
+// SequenceDiagram renders the recording as a Mermaid sequence diagram: the
+// test on the left, one participant per service host in the order they
+// were first called, and an arrow for each request and its response.
+// Responses with an error status are drawn with a cross.
+func SequenceDiagram(rec *RecordingFile) string {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n    participant Test\n")
+
+	participants := map[string]string{}
+	var calls strings.Builder
+	for _, e := range rec.Entries {
+		host, label := "(unknown host)", e.RequestUri
+		if u, err := url.Parse(e.RequestUri); err == nil && u.Host != "" {
+			host = strings.ToLower(u.Host)
+			label = u.Path
+			if query, err := url.QueryUnescape(u.RawQuery); err == nil && query != "" {
+				label += "?" + query
+			}
+		}
+		id, ok := participants[host]
+		if !ok {
+			id = fmt.Sprintf("S%d", len(participants)+1)
+			participants[host] = id
+			fmt.Fprintf(&b, "    participant %s as %s\n", id, mermaidText(host))
+		}
+
+		fmt.Fprintf(&calls, "    Test->>%s: %s %s\n", id, e.RequestMethod, mermaidText(abbreviate(label, maxDiagramLabel)))
+		arrow := "-->>"
+		if e.StatusCode >= 400 {
+			arrow = "--x"
+		}
+		fmt.Fprintf(&calls, "    %s%sTest: %d\n", id, arrow, e.StatusCode)
+	}
+	b.WriteString(calls.String())
+	return b.String()
+}
+
+// abbreviate shortens s to at most n characters, marking the cut with an
+// ellipsis.
+func abbreviate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// mermaidText escapes the characters that end a Mermaid statement or start
+// an entity code.
+func mermaidText(s string) string {
+	return strings.NewReplacer("#", "#35;", ";", "#59;", "\n", " ").Replace(s)
+}
+
+var sequenceDiagramPage = template.Must(template.New("diagram").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<script src="https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.min.js"></script>
+<script>mermaid.initialize({startOnLoad: true});</script>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<pre class="mermaid">
+{{.Diagram}}</pre>
+</body>
+</html>
+`))
+
+// WriteSequenceDiagramHTML writes an HTML page that renders the
+// recording's SequenceDiagram in the browser with Mermaid.js.
+func WriteSequenceDiagramHTML(w io.Writer, title string, rec *RecordingFile) error {
+	return sequenceDiagramPage.Execute(w, struct{ Title, Diagram string }{title, SequenceDiagram(rec)})
+}
+
+// GenerateSequenceDiagram reads the recording at filePath and writes its
+// sequence diagram to outputPath: an HTML page when outputPath ends in
+// .html or .htm, and the Mermaid source otherwise.
+func GenerateSequenceDiagram(filePath string, outputPath string) error {
+	rec, err := ReadRecordingFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".html", ".htm":
+		if err := WriteSequenceDiagramHTML(&out, filepath.Base(filePath), rec); err != nil {
+			return err
+		}
+	default:
+		out.WriteString(SequenceDiagram(rec))
+	}
+	return os.WriteFile(outputPath, out.Bytes(), 0644)
+}
@@ -0,0 +1,59 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSequenceDiagram(t *testing.T) {
+	rec := &RecordingFile{Entries: []Entry{
+		{RequestMethod: "POST", RequestUri: "https://account.table.core.windows.net/Tables", StatusCode: 201},
+		{RequestMethod: "GET", RequestUri: "https://vault.azure.net/secrets/s?api-version=7.4", StatusCode: 200},
+		{RequestMethod: "GET", RequestUri: "https://Account.Table.Core.Windows.Net/products()?$filter=Name%20eq%20'a;b'%23&$top=2&$select=Name,Quantity,Sale", StatusCode: 404},
+	}}
+	want := `sequenceDiagram
+    participant Test
+    participant S1 as account.table.core.windows.net
+    participant S2 as vault.azure.net
+    Test->>S1: POST /Tables
+    S1-->>Test: 201
+    Test->>S2: GET /secrets/s?api-version=7.4
+    S2-->>Test: 200
+    Test->>S1: GET /products()?$filter=Name eq 'a#59;b'#35;&$top=2&$select=Name,Quan…
+    S1--xTest: 404
+`
+	if got := SequenceDiagram(rec); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "TestTables.json")
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ output, contains string }{
+		{"diagram.mmd", want},
+		{"diagram.html", "<pre class=\"mermaid\">\nsequenceDiagram\n    participant Test\n"},
+	} {
+		output := filepath.Join(dir, tc.output)
+		if err := GenerateSequenceDiagram(path, output); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), tc.contains) {
+			t.Errorf("%s:\n%s", tc.output, data)
+		}
+	}
+	if err := GenerateSequenceDiagram(filepath.Join(dir, "missing.json"), filepath.Join(dir, "out.html")); err == nil {
+		t.Error("expected an error for a missing recording")
+	}
+}
@@ -0,0 +1,116 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// startedSessions holds the sessions started by Start and not yet stopped,
+// by recording path.
+var startedSessions = struct {
+	mu       sync.Mutex
+	sessions map[string]*TestProxyVariables
+}{sessions: map[string]*TestProxyVariables{}}
+
+// Start starts a test proxy session for t, configured like
+// NewTestProxyFromEnv with its recording under recordings/<test name>.json,
+// and stops it when t and its subtests complete, saving the recording
+// unless t failed. Sessions may also be stopped earlier with StopTestProxy.
+//
+// A test may start several sessions, in turn or at once, to keep the
+// traffic of its phases in separate recordings that can be re-recorded
+// independently; give each a suffix with WithRecordingSuffix:
+//
+//	setup := testproxy.Start(t, testproxy.WithRecordingSuffix("setup"))
+//	verify := testproxy.Start(t, testproxy.WithRecordingSuffix("verify"))
+//
+// Sessions still running when the test completes are stopped in the
+// reverse order they were started. Start fails the test when another
+// session is already recording or playing back the same file.
+func Start(t testing.TB, opts ...TestProxyOption) *TestProxyVariables {
+	t.Helper()
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return StartWithConfig(t, cfg, opts...)
+}
+
+// StartWithConfig is Start for the proxy cfg describes, without reading
+// the environment.
+func StartWithConfig(t testing.TB, cfg Config, opts ...TestProxyOption) *TestProxyVariables {
+	t.Helper()
+	withTest := func(tpv *TestProxyVariables) {
+		tpv.CurrentRecordingPath = getRecordingFilePath(t, GetCurrentDirectory(), tpv.RecordingVariant)
+	}
+	tpv, err := NewTestProxyFromConfig(cfg, append([]TestProxyOption{withTest}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := tpv.CurrentRecordingPath
+	startedSessions.mu.Lock()
+	if _, ok := startedSessions.sessions[path]; ok {
+		startedSessions.mu.Unlock()
+		t.Fatalf("%s already has an active session; give each session of the test its own WithRecordingSuffix", path)
+	}
+	startedSessions.sessions[path] = tpv
+	startedSessions.mu.Unlock()
+	tpv.startedPath = path
+
+	if err := StartTestProxy(tpv); err != nil {
+		tpv.releaseStarted()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if !tpv.started() {
+			return
+		}
+		if err := stopTestProxy(tpv, !t.Failed()); err != nil {
+			t.Errorf("stopping test proxy session %s: %v", tpv.RecordingId, err)
+		}
+	})
+	return tpv
+}
+
+// WithRecordingSuffix appends -suffix to the name of the recording, as in
+// recordings/<test name>-suffix.json. It applies to the recording path set
+// by the options before it, or by Start.
+func WithRecordingSuffix(suffix string) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		if tpv.CurrentRecordingPath == "" {
+			tpv.setOptionErr(fmt.Errorf("recording suffix %q: no recording path to add it to", suffix))
+			return
+		}
+		ext := filepath.Ext(tpv.CurrentRecordingPath)
+		tpv.CurrentRecordingPath = strings.TrimSuffix(tpv.CurrentRecordingPath, ext) + "-" + suffix + ext
+	}
+}
+
+// started reports whether the session started by Start has not been
+// stopped.
+func (tpv *TestProxyVariables) started() bool {
+	startedSessions.mu.Lock()
+	defer startedSessions.mu.Unlock()
+	return tpv.startedPath != "" && startedSessions.sessions[tpv.startedPath] == tpv
+}
+
+// releaseStarted frees the recording path of a session started by Start
+// for another session. It is called by StopTestProxy.
+func (tpv *TestProxyVariables) releaseStarted() {
+	if tpv.startedPath == "" {
+		return
+	}
+	startedSessions.mu.Lock()
+	defer startedSessions.mu.Unlock()
+	if startedSessions.sessions[tpv.startedPath] == tpv {
+		delete(startedSessions.sessions, tpv.startedPath)
+	}
+}
@@ -0,0 +1,109 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStartNamedSessions(t *testing.T) {
+	sp := newStubProxy(t)
+	trustStubProxy(t, sp)
+	var sessions atomic.Int32
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/record/start" {
+			w.Header().Set("x-recording-id", "session-"+strconv.Itoa(int(sessions.Add(1))))
+			return true
+		}
+		return false
+	}
+	host, port := sp.hostPort(t)
+
+	var setup, verify, again *TestProxyVariables
+	t.Run("phases", func(t *testing.T) {
+		setup = Start(t, WithAddress(host, port), WithRecordingSuffix("setup"))
+		verify = Start(t, WithAddress(host, port), WithRecordingSuffix("verify"))
+		if filepath.Base(setup.CurrentRecordingPath) != "phases-setup.json" || filepath.Base(verify.CurrentRecordingPath) != "phases-verify.json" {
+			t.Errorf("got recordings %s and %s", setup.CurrentRecordingPath, verify.CurrentRecordingPath)
+		}
+		if setup.RecordingId == verify.RecordingId {
+			t.Errorf("both sessions have recording ID %s", setup.RecordingId)
+		}
+
+		// Both sessions are active at once, each with its own transport.
+		for _, tpv := range []*TestProxyVariables{setup, verify} {
+			req, _ := http.NewRequest("GET", "https://example.com/items", nil)
+			resp, err := tpv.Transport(sp.Client()).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+
+		// A session stopped by the test frees its recording for another.
+		if err := StopTestProxy(setup); err != nil {
+			t.Fatal(err)
+		}
+		again = Start(t, WithAddress(host, port), WithRecordingSuffix("setup"))
+	})
+
+	var stopped []string
+	for _, r := range sp.Requests() {
+		switch r.Path {
+		case "/record/stop":
+			stopped = append(stopped, r.Header.Get("x-recording-id"))
+		case "/items":
+			if id := r.Header.Get("x-recording-id"); id != "session-1" && id != "session-2" {
+				t.Errorf("request sent in session %q", id)
+			}
+		}
+	}
+	// The cleanup stops the remaining sessions, last started first.
+	want := []string{setup.RecordingId, again.RecordingId, verify.RecordingId}
+	if len(stopped) != len(want) || stopped[0] != want[0] || stopped[1] != want[1] || stopped[2] != want[2] {
+		t.Errorf("got sessions stopped in order %v, want %v", stopped, want)
+	}
+	if again.started() || verify.started() {
+		t.Error("sessions are still registered after the test")
+	}
+}
+
+func TestStartSameRecordingTwice(t *testing.T) {
+	sp := newStubProxy(t)
+	trustStubProxy(t, sp)
+	host, port := sp.hostPort(t)
+	first := Start(t, WithAddress(host, port), WithRecordingSuffix("phase"))
+
+	r := &errorRecorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		// Fatal ends the goroutine.
+		defer close(done)
+		Start(fatalRecorder{r}, WithAddress(host, port), WithRecordingSuffix("phase"))
+	}()
+	<-done
+	if len(r.errors) != 1 || !first.started() {
+		t.Errorf("got errors %v, want the second session refused", r.errors)
+	}
+}
+
+// fatalRecorder records Fatal calls as errors and ends the goroutine.
+type fatalRecorder struct{ *errorRecorder }
+
+func (r fatalRecorder) Fatal(args ...interface{}) {
+	r.Errorf("%s", fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+func (r fatalRecorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
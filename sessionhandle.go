@@ -0,0 +1,159 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// ErrSessionNotStarted is returned by the methods of a Session that
+// StartSession did not return, such as a nil or zero Session.
+var ErrSessionNotStarted = errors.New("the test proxy session was never started")
+
+// ErrSessionStopped is returned by the methods of a Session that has been
+// stopped.
+var ErrSessionStopped = errors.New("the test proxy session has been stopped")
+
+// Session is the handle of a record or playback session started by
+// StartSession. Its methods act on that session only and fail with
+// ErrSessionStopped once it has been stopped:
+//
+//	sess, err := testproxy.StartSession(tpv)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer func() {
+//		if err := sess.Stop(context.Background()); err != nil {
+//			t.Fatal(err)
+//		}
+//	}()
+//	opts, err := sess.ClientOptions()
+type Session struct {
+	tpv *TestProxyVariables
+	// stopping serializes Stop, so only one call stops the session.
+	stopping sync.Mutex
+	// stopped is set once the proxy has stopped the session, by Stop or by
+	// the functions that stop it through tpv.
+	stopped atomic.Bool
+}
+
+// StartSession starts a record or playback session as described by tpv,
+// as StartTestProxy does, and returns its handle. Starting another session
+// with tpv stops the handle of this one from acting on it, as if it had
+// been stopped.
+func StartSession(tpv *TestProxyVariables) (*Session, error) {
+	tpv.sessionMu.Lock()
+	defer tpv.sessionMu.Unlock()
+	if err := tpv.startSession(); err != nil {
+		return nil, err
+	}
+	sess := &Session{tpv: tpv}
+	tpv.session.Store(sess)
+	// The timeout is armed once the handle is published, so its stop
+	// marks this session stopped.
+	if tpv.local == nil {
+		tpv.armSessionTimeout()
+	}
+	return sess, nil
+}
+
+// check returns the error of calling method on sess, if any.
+func (sess *Session) check(method string) error {
+	switch {
+	case sess == nil || sess.tpv == nil:
+		return fmt.Errorf("Session.%s: %w", method, ErrSessionNotStarted)
+	case sess.stopped.Load() || sess.tpv.session.Load() != sess:
+		return fmt.Errorf("Session.%s: %w", method, ErrSessionStopped)
+	}
+	return nil
+}
+
+// Stop stops the session, saving the recording in record mode. The request
+// to stop it is made with ctx. When the proxy cannot be reached, or ctx is
+// done before it answers, the session keeps running and Stop can be called
+// again; once the proxy has stopped it, later calls fail. The first Stop of
+// a session SessionTimeout has stopped returns a *SessionTimeoutError.
+func (sess *Session) Stop(ctx context.Context) error {
+	if sess != nil {
+		sess.stopping.Lock()
+		defer sess.stopping.Unlock()
+	}
+	if err := sess.check("Stop"); err != nil {
+		// The first Stop of a session SessionTimeout stopped reports it.
+		if errors.Is(err, ErrSessionStopped) && sess.tpv.session.Load() == sess {
+			if timeoutErr := sess.tpv.disarmSessionTimeout(); timeoutErr != nil {
+				return timeoutErr
+			}
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return stopTestProxyContext(ctx, sess.tpv, true)
+}
+
+// markSessionStopped marks the handle of the session last started with tpv
+// as stopped, once the proxy has stopped the session.
+func (tpv *TestProxyVariables) markSessionStopped() {
+	if sess := tpv.session.Load(); sess != nil {
+		sess.stopped.Store(true)
+	}
+}
+
+// AddSanitizer registers s for the session's recording; see
+// TestProxyVariables.AddSanitizer.
+func (sess *Session) AddSanitizer(s Sanitizer) error {
+	if err := sess.check("AddSanitizer"); err != nil {
+		return err
+	}
+	return sess.tpv.AddSanitizer(s)
+}
+
+// SetMatcher sets how the session matches requests with the recording. It
+// only has an effect in playback, where it replaces the session's matcher.
+func (sess *Session) SetMatcher(m Matcher) error {
+	if err := sess.check("SetMatcher"); err != nil {
+		return err
+	}
+	sess.tpv.Matcher = m
+	if sess.tpv.Mode != "playback" || sess.tpv.local != nil {
+		return nil
+	}
+	return sess.tpv.setSessionMatcher()
+}
+
+// Variables returns the TestProxyVariables the session was started with,
+// for the functions of this package that take them.
+func (sess *Session) Variables() (*TestProxyVariables, error) {
+	if err := sess.check("Variables"); err != nil {
+		return nil, err
+	}
+	return sess.tpv, nil
+}
+
+// ClientOptions returns azcore client options that send requests through
+// the session; see TestProxyVariables.ClientOptions.
+func (sess *Session) ClientOptions() (policy.ClientOptions, error) {
+	if err := sess.check("ClientOptions"); err != nil {
+		return policy.ClientOptions{}, err
+	}
+	return sess.tpv.ClientOptions(), nil
+}
+
+// Transport returns a transport that sends requests through the session,
+// over the HttpClient of its TestProxyVariables.
+func (sess *Session) Transport() (*TestProxyTransport, error) {
+	if err := sess.check("Transport"); err != nil {
+		return nil, err
+	}
+	return sess.tpv.Transport(sess.tpv.HttpClient), nil
+}
@@ -0,0 +1,247 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sessionErrors calls every method of sess but Stop and returns their
+// errors.
+func sessionErrors(sess *Session) []error {
+	_, variablesErr := sess.Variables()
+	_, optionsErr := sess.ClientOptions()
+	_, transportErr := sess.Transport()
+	return []error{
+		sess.AddSanitizer(BodyRegexSanitizer{Value: "Sanitized", Regex: "secret"}),
+		sess.SetMatcher(Matcher{IgnoreBodies: true}),
+		variablesErr,
+		optionsErr,
+		transportErr,
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	for _, sess := range []*Session{nil, {}} {
+		for _, err := range append(sessionErrors(sess), sess.Stop(context.Background())) {
+			if !errors.Is(err, ErrSessionNotStarted) {
+				t.Errorf("got %v from a session that was never started", err)
+			}
+		}
+	}
+
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	sess, err := StartSession(tpv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sess.Variables(); err != nil || got != tpv {
+		t.Fatalf("Variables: got %p, %v", got, err)
+	}
+	if err := sess.AddSanitizer(BodyRegexSanitizer{Value: "Sanitized", Regex: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.SetMatcher(Matcher{IgnoreBodies: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !tpv.Matcher.IgnoreBodies {
+		t.Error("SetMatcher did not set the matcher of the session")
+	}
+	tpt, err := sess.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "https://account.table.core.windows.net/Tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tpt.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if opts, err := sess.ClientOptions(); err != nil || opts.Transport == nil {
+		t.Errorf("ClientOptions: got %+v, %v", opts, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sess.Stop(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v stopping with a canceled context", err)
+	}
+	if err := sess.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range append(sessionErrors(sess), sess.Stop(context.Background()), StopTestProxy(tpv)) {
+		if !errors.Is(err, ErrSessionStopped) {
+			t.Errorf("got %v from a stopped session", err)
+		}
+	}
+
+	var paths []string
+	for _, r := range sp.Requests() {
+		paths = append(paths, r.Path)
+		if r.Path != "/playback/start" && r.Header.Get("x-recording-id") != "stub-recording-id" {
+			t.Errorf("%s was sent without the recording ID", r.Path)
+		}
+	}
+	want := "/playback/start /Admin/SetMatcher /Admin/AddSanitizer /Admin/SetMatcher /Tables /playback/stop"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("got requests %s, want %s", got, want)
+	}
+}
+
+func TestSessionReplacedByNextStart(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	first, err := StartSession(tpv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first handle cannot stop the session started after it.
+	if err := first.Stop(context.Background()); !errors.Is(err, ErrSessionStopped) {
+		t.Errorf("got %v from the handle of the first session", err)
+	}
+	if _, err := first.Transport(); !errors.Is(err, ErrSessionStopped) {
+		t.Errorf("got %v from the handle of the first session", err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	var stops int
+	for _, r := range sp.Requests() {
+		if r.Path == "/record/stop" {
+			stops++
+		}
+	}
+	if stops != 2 {
+		t.Errorf("got %d stops, want 2", stops)
+	}
+}
+
+func TestSessionStopRetry(t *testing.T) {
+	sp := newStubProxy(t)
+	var stops atomic.Int32
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/record/stop" || stops.Add(1) > 1 {
+			return false
+		}
+		// The first stop never reaches the proxy: the connection drops.
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return true
+		}
+		conn.Close()
+		return true
+	}
+	tpv := sp.variables(t, "record")
+	sess, err := StartSession(tpv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sess.Stop(context.Background()); err == nil || errors.Is(err, ErrSessionStopped) {
+		t.Fatalf("got %v from a stop the proxy never answered", err)
+	}
+	if _, err := sess.Transport(); err != nil {
+		t.Errorf("the session is unusable after a failed stop: %v", err)
+	}
+	if err := sess.Stop(context.Background()); err != nil {
+		t.Fatalf("retrying the stop: %v", err)
+	}
+	if err := sess.Stop(context.Background()); !errors.Is(err, ErrSessionStopped) {
+		t.Errorf("got %v stopping a stopped session", err)
+	}
+	if n := stops.Load(); n != 2 {
+		t.Errorf("the proxy got %d stops, want 2", n)
+	}
+}
+
+func TestSessionErrorStatus(t *testing.T) {
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.URL.Path {
+		case "/playback/start":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Message": "Recording file path TestMissing.json does not exist."}`))
+		case "/record/stop":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("disk full"))
+		default:
+			return false
+		}
+		return true
+	}
+
+	_, err := StartSession(sp.variables(t, "playback"))
+	if want := "starting playback session: 404 Not Found: Recording file path TestMissing.json does not exist."; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+
+	sess, err := StartSession(sp.variables(t, "record"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Stop(context.Background()); err == nil || err.Error() != "stopping record session: 500 Internal Server Error: disk full" {
+		t.Errorf("got %v from a stop the proxy failed", err)
+	}
+	if err := sess.Stop(context.Background()); !errors.Is(err, ErrSessionStopped) {
+		t.Errorf("got %v stopping the failed session again", err)
+	}
+}
+
+// TestSessionStopRacesTimeout stops sessions while their SessionTimeout
+// expires; run it with -race.
+func TestSessionStopRacesTimeout(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.SessionTimeout = time.Millisecond
+
+	for i := 0; i < 20; i++ {
+		sess, err := StartSession(tpv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			time.Sleep(time.Duration(i%3) * time.Millisecond)
+			sessionErrors(sess)
+			done <- sess.Stop(context.Background())
+		}()
+		var timeoutErr *SessionTimeoutError
+		if err := <-done; err != nil && !errors.As(err, &timeoutErr) {
+			t.Fatalf("session %d: %v", i, err)
+		}
+		if err := sess.Stop(context.Background()); !errors.Is(err, ErrSessionStopped) {
+			t.Errorf("session %d: got %v stopping it again", i, err)
+		}
+	}
+
+	stops := 0
+	for _, r := range sp.Requests() {
+		if r.Path == "/playback/stop" {
+			stops++
+		}
+	}
+	if stops != 20 {
+		t.Errorf("the proxy got %d stops for 20 sessions", stops)
+	}
+}
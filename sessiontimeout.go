@@ -0,0 +1,127 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetadataTimedOut is the recording metadata key set to "true" on
+// recordings saved because their session outlived SessionTimeout.
+const MetadataTimedOut = "timedOut"
+
+// SessionTimeoutError is returned by StopTestProxy for a session that was
+// already stopped because it outlived SessionTimeout. Err is the error of
+// that automatic stop, if any.
+type SessionTimeoutError struct {
+	RecordingId string
+	Timeout     time.Duration
+	Err         error
+}
+
+func (e *SessionTimeoutError) Error() string {
+	msg := fmt.Sprintf("test proxy session %s was stopped automatically after SessionTimeout %v", e.RecordingId, e.Timeout)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SessionTimeoutError) Unwrap() error { return e.Err }
+
+// sessionDeadline stops a session that outlives SessionTimeout.
+type sessionDeadline struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	// expired is set when the timer stops the session and closed once
+	// the session is stopped.
+	expired chan struct{}
+	err     *SessionTimeoutError
+}
+
+// WithTimeout stops the session automatically if StopTestProxy is not
+// called within timeout of StartTestProxy; see SessionTimeout.
+func WithTimeout(timeout time.Duration) TestProxyOption {
+	return func(tpv *TestProxyVariables) {
+		tpv.SessionTimeout = timeout
+	}
+}
+
+// armSessionTimeout starts the SessionTimeout of a session StartTestProxy
+// has started. The caller holds tpv.sessionMu, which the stop made on
+// expiry takes as well.
+func (tpv *TestProxyVariables) armSessionTimeout() {
+	d := &tpv.deadline
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer, d.expired, d.err = nil, nil, nil
+	if tpv.SessionTimeout <= 0 {
+		return
+	}
+
+	timeout, recordingId := tpv.SessionTimeout, tpv.RecordingId
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		d.mu.Lock()
+		if d.timer != timer {
+			d.mu.Unlock()
+			return
+		}
+		d.timer = nil
+		expired := make(chan struct{})
+		d.expired = expired
+		d.mu.Unlock()
+
+		tpv.sessionMu.Lock()
+		err := tpv.stopSession(context.Background(), true)
+		if tpv.Logger != nil {
+			tpv.Logger.Warn("test proxy session stopped after SessionTimeout", "session", tpv, "timeout", timeout, "err", err)
+		}
+		tpv.sessionMu.Unlock()
+		d.mu.Lock()
+		d.err = &SessionTimeoutError{RecordingId: recordingId, Timeout: timeout, Err: err}
+		d.mu.Unlock()
+		close(expired)
+	})
+	d.timer = timer
+}
+
+// disarmSessionTimeout stops the SessionTimeout before the session is
+// stopped. For a session the timeout has stopped, it waits for the
+// automatic stop to finish and returns a *SessionTimeoutError.
+func (tpv *TestProxyVariables) disarmSessionTimeout() error {
+	d := &tpv.deadline
+	d.mu.Lock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	expired := d.expired
+	d.mu.Unlock()
+	if expired == nil {
+		return nil
+	}
+
+	<-expired
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.err
+	d.expired, d.err = nil, nil
+	return err
+}
+
+// sessionTimedOut reports whether the session is being stopped because it
+// outlived SessionTimeout.
+func (tpv *TestProxyVariables) sessionTimedOut() bool {
+	tpv.deadline.mu.Lock()
+	defer tpv.deadline.mu.Unlock()
+	return tpv.deadline.expired != nil
+}
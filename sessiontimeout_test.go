@@ -0,0 +1,81 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionTimeout(t *testing.T) {
+	sp := newStubProxy(t)
+	path := filepath.Join(t.TempDir(), "TestSessionTimeout.json")
+	stopped := make(chan struct{}, 1)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path == "/record/stop" {
+			os.WriteFile(path, []byte(`{"Entries": [], "Variables": {}}`), 0o644)
+			stopped <- struct{}{}
+		}
+		return false
+	}
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+	WithTimeout(50 * time.Millisecond)(tpv)
+
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session was not stopped after SessionTimeout")
+	}
+
+	var timeoutErr *SessionTimeoutError
+	if err := StopTestProxy(tpv); !errors.As(err, &timeoutErr) || timeoutErr.Err != nil || timeoutErr.RecordingId != "stub-recording-id" {
+		t.Fatalf("expected a SessionTimeoutError, got %v", err)
+	}
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Metadata()[MetadataTimedOut]; got != "true" {
+		t.Errorf("got %s metadata %q", MetadataTimedOut, got)
+	}
+	stops := 0
+	for _, r := range sp.Requests() {
+		if r.Path == "/record/stop" {
+			stops++
+		}
+	}
+	if stops != 1 {
+		t.Errorf("the session was stopped %d times", stops)
+	}
+
+	// A session stopped in time is neither stopped again nor tagged.
+	os.Remove(path)
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	<-stopped
+	time.Sleep(100 * time.Millisecond)
+	if len(stopped) != 0 {
+		t.Error("the stopped session was stopped again")
+	}
+	rec, err = ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := rec.Metadata()[MetadataTimedOut]; ok {
+		t.Errorf("got %s metadata %q", MetadataTimedOut, got)
+	}
+}
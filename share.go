@@ -0,0 +1,219 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+)
+
+// maxShareExpiry is the longest validity of a user delegation SAS.
+const maxShareExpiry = 7 * 24 * time.Hour
+
+// sasTimeFormat is the time format of SAS parameters.
+const sasTimeFormat = "2006-01-02T15:04:05Z"
+
+// ShareRecording uploads the entry at recordingIndex of the recording of
+// tpv, with the recording's variables, to the RemoteStore container as a
+// recording of its own under shared/, and returns a read-only SAS URL for
+// it valid for expiryHours, at most a week. Pass the URL to a colleague,
+// who downloads it with FetchSharedRecording. The SAS is a user delegation
+// SAS, so the RemoteStore credential needs a role that can get user
+// delegation keys, such as Storage Blob Data Contributor.
+func ShareRecording(tpv *TestProxyVariables, recordingIndex int, expiryHours int) (string, error) {
+	store := tpv.RemoteStore
+	if store.ContainerURL == "" || store.Credential == nil {
+		return "", errors.New("sharing a recording requires RemoteStore with a ContainerURL and a Credential")
+	}
+	expiry := time.Duration(expiryHours) * time.Hour
+	if expiry <= 0 || expiry > maxShareExpiry {
+		return "", fmt.Errorf("expiry of %d hours is not between 1 hour and a week", expiryHours)
+	}
+	rf, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return "", err
+	}
+	if recordingIndex < 0 || recordingIndex >= len(rf.Entries) {
+		return "", fmt.Errorf("%s has no entry %d", tpv.CurrentRecordingPath, recordingIndex)
+	}
+	shared := &RecordingFile{Entries: rf.Entries[recordingIndex : recordingIndex+1], Variables: rf.Variables}
+	data, err := shared.marshalIndented()
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(tpv.CurrentRecordingPath), filepath.Ext(tpv.CurrentRecordingPath))
+	now := time.Now().UTC()
+	blob := fmt.Sprintf("shared/%s-%d-%s.json", name, recordingIndex, now.Format("20060102T150405Z"))
+	ctx := context.Background()
+	blobURL := strings.TrimSuffix(store.ContainerURL, "/") + "/" + blob
+	if err := store.putBlob(ctx, blobURL, data); err != nil {
+		return "", fmt.Errorf("sharing entry %d of %s: %w", recordingIndex, tpv.CurrentRecordingPath, err)
+	}
+
+	// The SAS starts a little early to allow for clock skew.
+	start, end := now.Add(-5*time.Minute), now.Add(expiry)
+	key, err := store.userDelegationKey(ctx, start, end)
+	if err != nil {
+		return "", fmt.Errorf("sharing entry %d of %s: %w", recordingIndex, tpv.CurrentRecordingPath, err)
+	}
+	query, err := key.blobSAS(blobURL, start, end)
+	if err != nil {
+		return "", err
+	}
+	return blobURL + "?" + query, nil
+}
+
+// FetchSharedRecording downloads a recording shared with ShareRecording
+// from its SAS URL to localPath.
+func FetchSharedRecording(url string, localPath string) error {
+	req, err := runtime.NewRequest(context.Background(), http.MethodGet, url)
+	if err != nil {
+		return err
+	}
+	resp, err := BlobStoreConfig{}.pipeline().Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching shared recording: %w", err)
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return fmt.Errorf("fetching shared recording: %w", runtime.NewResponseError(resp))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("fetching shared recording: %w", err)
+	}
+	if err := json.Unmarshal(data, &RecordingFile{}); err != nil {
+		return fmt.Errorf("fetching shared recording: not a recording: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(localPath, data, 0o644)
+}
+
+// userDelegationKey is a key for signing user delegation SAS, as returned
+// by the Get User Delegation Key operation.
+type userDelegationKey struct {
+	SignedOid     string
+	SignedTid     string
+	SignedStart   string
+	SignedExpiry  string
+	SignedService string
+	SignedVersion string
+	Value         string
+}
+
+// userDelegationKey gets a key valid from start to end from the account of
+// the container.
+func (store BlobStoreConfig) userDelegationKey(ctx context.Context, start, end time.Time) (userDelegationKey, error) {
+	container, err := url.Parse(store.ContainerURL)
+	if err != nil {
+		return userDelegationKey{}, err
+	}
+	service := container.Scheme + "://" + container.Host + "/?restype=service&comp=userdelegationkey"
+	req, err := runtime.NewRequest(ctx, http.MethodPost, service)
+	if err != nil {
+		return userDelegationKey{}, err
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"KeyInfo"`
+		Start   string
+		Expiry  string
+	}{Start: start.Format(sasTimeFormat), Expiry: end.Format(sasTimeFormat)})
+	if err != nil {
+		return userDelegationKey{}, err
+	}
+	if err := req.SetBody(streaming.NopCloser(bytes.NewReader(body)), "application/xml"); err != nil {
+		return userDelegationKey{}, err
+	}
+	resp, err := store.pipeline().Do(req)
+	if err != nil {
+		return userDelegationKey{}, err
+	}
+	defer resp.Body.Close()
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return userDelegationKey{}, runtime.NewResponseError(resp)
+	}
+	var key userDelegationKey
+	if err := xml.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return userDelegationKey{}, fmt.Errorf("user delegation key: %w", err)
+	}
+	return key, nil
+}
+
+// blobSAS returns the query of a read-only user delegation SAS for the
+// blob at blobURL, valid from start to end.
+func (key userDelegationKey) blobSAS(blobURL string, start, end time.Time) (string, error) {
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		return "", err
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Value)
+	if err != nil {
+		return "", fmt.Errorf("user delegation key: %w", err)
+	}
+	account, _, _ := strings.Cut(u.Hostname(), ".")
+	params := [][2]string{
+		{"sp", "r"},
+		{"st", start.Format(sasTimeFormat)},
+		{"se", end.Format(sasTimeFormat)},
+		{"skoid", key.SignedOid},
+		{"sktid", key.SignedTid},
+		{"skt", key.SignedStart},
+		{"ske", key.SignedExpiry},
+		{"sks", key.SignedService},
+		{"skv", key.SignedVersion},
+		{"spr", "https"},
+		{"sv", blobStorageVersion},
+		{"sr", "b"},
+	}
+	value := func(name string) string {
+		for _, p := range params {
+			if p[0] == name {
+				return p[1]
+			}
+		}
+		return ""
+	}
+	stringToSign := strings.Join([]string{
+		value("sp"), value("st"), value("se"),
+		"/blob/" + account + u.Path,
+		value("skoid"), value("sktid"), value("skt"), value("ske"), value("sks"), value("skv"),
+		// The authorized and unauthorized user object IDs, correlation ID
+		// and IP range are not used.
+		"", "", "", "",
+		value("spr"), value("sv"), value("sr"),
+		// The snapshot time, encryption scope and response header
+		// overrides are not used.
+		"", "", "", "", "", "", "",
+	}, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	params = append(params, [2]string{"sig", base64.StdEncoding.EncodeToString(mac.Sum(nil))})
+
+	var query []string
+	for _, p := range params {
+		query = append(query, p[0]+"="+url.QueryEscape(p[1]))
+	}
+	return strings.Join(query, "&"), nil
+}
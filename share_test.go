@@ -0,0 +1,89 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+func TestShareRecording(t *testing.T) {
+	container := newStubBlobContainer(t)
+	dir := t.TempDir()
+	rf := &RecordingFile{
+		Entries: []Entry{
+			{RequestUri: "https://example.com/a", RequestMethod: "GET", StatusCode: 200},
+			{RequestUri: "https://example.com/b", RequestMethod: "GET", StatusCode: 404},
+		},
+		Variables: map[string]string{"tableName": "products"},
+	}
+	tpv := &TestProxyVariables{CurrentRecordingPath: filepath.Join(dir, "TestShare.json")}
+	if err := rf.WriteFile(tpv.CurrentRecordingPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ShareRecording(tpv, 1, 24); err == nil || !strings.Contains(err.Error(), "RemoteStore") {
+		t.Errorf("got %v, want RemoteStore required", err)
+	}
+	tpv.RemoteStore = BlobStoreConfig{
+		ContainerURL:  container.URL + "/recordings",
+		Credential:    FakeWorkloadIdentityCredential{},
+		ClientOptions: &policy.ClientOptions{Transport: container.Client()},
+	}
+	for _, tc := range []struct{ index, hours int }{{2, 24}, {-1, 24}, {1, 0}, {1, 24 * 8}} {
+		if _, err := ShareRecording(tpv, tc.index, tc.hours); err == nil {
+			t.Errorf("shared entry %d for %d hours", tc.index, tc.hours)
+		}
+	}
+
+	shared, err := ShareRecording(tpv, 1, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u.Path, "/recordings/shared/TestShare-1-") {
+		t.Errorf("got blob %s", u.Path)
+	}
+	query := u.Query()
+	for name, want := range map[string]string{"sp": "r", "sr": "b", "spr": "https", "skoid": "oid", "sktid": "tid", "sv": blobStorageVersion} {
+		if got := query.Get(name); got != want {
+			t.Errorf("got SAS parameter %s=%q, want %q", name, got, want)
+		}
+	}
+	if query.Get("sig") == "" || query.Get("se") <= query.Get("st") {
+		t.Errorf("got SAS %s", u.RawQuery)
+	}
+
+	// The colleague fetches it without credentials.
+	plain, _ := url.Parse(container.Plain.URL)
+	u.Scheme, u.Host = plain.Scheme, plain.Host
+	fetched := filepath.Join(dir, "fetched", "shared.json")
+	if err := FetchSharedRecording(u.String(), fetched); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRecordingFile(fetched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Entries) != 1 || got.Entries[0].RequestUri != "https://example.com/b" || got.Variables["tableName"] != "products" {
+		t.Errorf("got shared recording %+v", got)
+	}
+
+	u.RawQuery = ""
+	if err := FetchSharedRecording(u.String(), filepath.Join(dir, "denied.json")); err == nil {
+		t.Error("fetched a recording without a SAS")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "denied.json")); !os.IsNotExist(err) {
+		t.Errorf("a failed fetch wrote the file: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSharedKeyAuth(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "record")
+	if err := SanitizeSharedKeyAuth(tpv); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range sp.Requests() {
+		got = append(got, r.Header.Get("x-abstraction-identifier")+" "+string(r.Body))
+	}
+	want := []string{
+		`HeaderRegexSanitizer {"key":"Authorization","value":"SharedKey account:SANITIZED","regex":"SharedKey(Lite)? [^:\\s]+:\\S+"}`,
+		`HeaderRegexSanitizer {"key":"x-ms-date","value":"Mon, 01 Jan 2001 00:00:00 GMT"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got sanitizers:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	re := regexp.MustCompile(sharedKeyRegex)
+	for _, value := range []string{
+		"SharedKey myaccount:ctzMq410TV3wS7upTBcunJTDLEJwMAZuFPfr0mrrA08=",
+		"SharedKeyLite myaccount:Zm9vYmFy",
+	} {
+		if got := re.ReplaceAllString(value, SanitizedSharedKey); got != SanitizedSharedKey {
+			t.Errorf("%s is sanitized to %s", value, got)
+		}
+	}
+	if bearer := "Bearer eyJ0eXAi.eyJhdWQi.c2ln"; re.MatchString(bearer) {
+		t.Errorf("%s matches the shared key sanitizer", bearer)
+	}
+
+	if data, err := marshalNoEscape(DateSanitizer{Header: "Date"}); err != nil || string(data) != `{"key":"Date","value":"Mon, 01 Jan 2001 00:00:00 GMT"}` {
+		t.Errorf("got %s, %v", data, err)
+	}
+}
@@ -0,0 +1,150 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// sizeBudgetAdvice is logged with recordings over their size budget.
+const sizeBudgetAdvice = "trim the large bodies found by SizeReport with TrimBodies and set Matcher.IgnoreBodies if the test does not depend on them, " +
+	"set CompressFormat to store the recording compressed, or keep the recordings in an assets repository with assets.json"
+
+// OverBudget returns the recordings of the report larger than maxBytes,
+// largest first.
+func (r *RecordingSizeReport) OverBudget(maxBytes int64) []RecordingSize {
+	var over []RecordingSize
+	for _, rs := range r.Recordings {
+		if rs.Size > maxBytes {
+			over = append(over, rs)
+		}
+	}
+	return over
+}
+
+// Default limits of the size of a recording saved by a record session;
+// see TestProxyVariables.MaxRecordingFileSizeBytes.
+const (
+	DefaultMaxRecordingFileSizeBytes      = 1 << 20
+	DefaultMaxRecordingFileSizeErrorBytes = 10 << 20
+)
+
+// RecordingSizeError is returned by StopTestProxy when the saved recording
+// is larger than MaxRecordingFileSizeErrorBytes.
+type RecordingSizeError struct {
+	Path  string
+	Size  int64
+	Limit int64
+}
+
+func (e *RecordingSizeError) Error() string {
+	return fmt.Sprintf("recording %s is %d bytes, over the limit of %d bytes; %s, or raise MaxRecordingFileSizeErrorBytes if the size is expected",
+		e.Path, e.Size, e.Limit, sizeBudgetAdvice)
+}
+
+// checkRecordingSize checks the size of the recording saved by a record
+// session, compressed if CompressFormat is set, or its copy in the proxy's
+// .assets directory when the recordings are kept in an assets repository.
+// Over MaxRecordingFileSizeBytes a warning is logged, and over
+// MaxRecordingFileSizeErrorBytes a *RecordingSizeError is returned. It is
+// called by StopTestProxy.
+func (tpv *TestProxyVariables) checkRecordingSize() error {
+	if tpv.Mode != "record" {
+		return nil
+	}
+	warnLimit := sizeLimit(tpv.MaxRecordingFileSizeBytes, DefaultMaxRecordingFileSizeBytes)
+	errorLimit := sizeLimit(tpv.MaxRecordingFileSizeErrorBytes, DefaultMaxRecordingFileSizeErrorBytes)
+	if warnLimit < 0 && errorLimit < 0 {
+		return nil
+	}
+	path, err := tpv.compressedRecordingPath()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		path = tpv.CurrentRecordingPath
+	}
+	path = materializedRecordingPath(path)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// A remote proxy saved the recording where it cannot be seen.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if errorLimit >= 0 && info.Size() > errorLimit {
+		return &RecordingSizeError{Path: path, Size: info.Size(), Limit: errorLimit}
+	}
+	if warnLimit < 0 || info.Size() <= warnLimit {
+		return nil
+	}
+	logger := tpv.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("recording exceeds its size budget",
+		"path", path,
+		"size", info.Size(),
+		"max", warnLimit,
+		"advice", sizeBudgetAdvice)
+	return nil
+}
+
+// sizeLimit returns limit, def when limit is zero, or -1 for no limit when
+// limit is negative.
+func sizeLimit(limit, def int64) int64 {
+	switch {
+	case limit < 0:
+		return -1
+	case limit == 0:
+		return def
+	}
+	return limit
+}
+
+// materializedRecordingPath returns path, or, when no file is there and an
+// assets.json in a parent directory moves the recordings to an assets
+// repository, the copy of the recording the proxy materialized under the
+// .assets directory of the repository root: .assets/<tag directory>/
+// <AssetsRepoPrefixPath>/<path relative to the root>.
+func materializedRecordingPath(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	var assets *AssetsFile
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if assets == nil {
+			if a, err := ReadAssetsFile(filepath.Join(dir, "assets.json")); err == nil {
+				assets = a
+			}
+		}
+		if assets != nil {
+			if info, err := os.Stat(filepath.Join(dir, ".assets")); err == nil && info.IsDir() {
+				rel, err := filepath.Rel(dir, abs)
+				if err != nil {
+					return path
+				}
+				matches, _ := filepath.Glob(filepath.Join(dir, ".assets", "*", filepath.FromSlash(assets.AssetsRepoPrefixPath), rel))
+				if len(matches) > 0 {
+					return matches[0]
+				}
+				return path
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+	}
+}
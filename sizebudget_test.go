@@ -0,0 +1,135 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordingSizeBudget(t *testing.T) {
+	sp := newStubProxy(t)
+	var logged bytes.Buffer
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestBudget.json")
+	tpv.Logger = slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	rec := &RecordingFile{Entries: []Entry{{RequestUri: "https://example.com/", RequestMethod: "GET", StatusCode: 200}}}
+	record := func(max int64) string {
+		t.Helper()
+		logged.Reset()
+		tpv.MaxRecordingFileSizeBytes = max
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		// The stub does not save recordings.
+		if err := rec.WriteFile(tpv.CurrentRecordingPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := StopTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		return logged.String()
+	}
+	record(0)
+	info, err := os.Stat(tpv.CurrentRecordingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := info.Size()
+
+	if got := record(size); got != "" {
+		t.Errorf("warned for a recording at exactly the budget:\n%s", got)
+	}
+	got := record(size - 1)
+	for _, want := range []string{
+		"level=WARN", "msg=\"recording exceeds its size budget\"",
+		fmt.Sprintf("size=%d", size), fmt.Sprintf("max=%d", size-1), "CompressFormat",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("warning %q does not contain %s", got, want)
+		}
+	}
+
+	report := &RecordingSizeReport{Recordings: []RecordingSize{{"a.json", 101}, {"b.json", 100}}}
+	if over := report.OverBudget(100); len(over) != 1 || over[0].Path != "a.json" {
+		t.Errorf("got %v over a budget of 100 bytes", over)
+	}
+}
+
+func TestRecordingSizeLimits(t *testing.T) {
+	sp := newStubProxy(t)
+	var logged bytes.Buffer
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestLimits.json")
+	tpv.Logger = slog.New(slog.NewTextHandler(&logged, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	// record saves a recording of about size bytes, as the proxy would,
+	// to path.
+	record := func(path string, size int) error {
+		t.Helper()
+		logged.Reset()
+		if err := StartTestProxy(tpv); err != nil {
+			t.Fatal(err)
+		}
+		rec := &RecordingFile{Entries: []Entry{{
+			RequestUri: "https://example.com/", RequestMethod: "GET", StatusCode: 200,
+			ResponseBody: []byte(`"` + strings.Repeat("x", size) + `"`),
+		}}}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		return StopTestProxy(tpv)
+	}
+
+	// The default limits.
+	if err := record(tpv.CurrentRecordingPath, 1000); err != nil || logged.Len() != 0 {
+		t.Errorf("under the limits: got %v and log %q", err, logged.String())
+	}
+	if err := record(tpv.CurrentRecordingPath, DefaultMaxRecordingFileSizeBytes); err != nil || !strings.Contains(logged.String(), "recording exceeds its size budget") {
+		t.Errorf("over the warning limit: got %v and log %q", err, logged.String())
+	}
+	err := record(tpv.CurrentRecordingPath, DefaultMaxRecordingFileSizeErrorBytes)
+	var sizeErr *RecordingSizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Limit != DefaultMaxRecordingFileSizeErrorBytes || sizeErr.Path != tpv.CurrentRecordingPath {
+		t.Fatalf("over the error limit: got %v", err)
+	}
+	for _, advice := range []string{"TrimBodies", "Matcher.IgnoreBodies", "assets.json", "MaxRecordingFileSizeErrorBytes"} {
+		if !strings.Contains(err.Error(), advice) {
+			t.Errorf("error %q does not mention %s", err, advice)
+		}
+	}
+
+	// Negative limits turn the checks off.
+	tpv.MaxRecordingFileSizeBytes, tpv.MaxRecordingFileSizeErrorBytes = -1, -1
+	if err := record(tpv.CurrentRecordingPath, DefaultMaxRecordingFileSizeErrorBytes); err != nil || logged.Len() != 0 {
+		t.Errorf("without limits: got %v and log %q", err, logged.String())
+	}
+
+	// With an assets repository, the proxy's copy in .assets is checked.
+	root := t.TempDir()
+	pkg := filepath.Join(root, "sdk", "data", "aztables")
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg, "assets.json"), []byte(`{"AssetsRepo":"Azure/azure-sdk-assets","AssetsRepoPrefixPath":"go","Tag":"go/aztables_1"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tpv.CurrentRecordingPath = filepath.Join(pkg, "recordings", "TestLimits.json")
+	tpv.MaxRecordingFileSizeBytes, tpv.MaxRecordingFileSizeErrorBytes = 0, 5000
+	materialized := filepath.Join(root, ".assets", "Xy3rT9", "go", "sdk", "data", "aztables", "recordings", "TestLimits.json")
+	if err := record(materialized, 6000); !errors.As(err, &sizeErr) || sizeErr.Path != materialized {
+		t.Errorf("with assets: got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetadataCompareBodies is the recording metadata key recording whether the
+// matcher compares request bodies. TrimBodies only runs on recordings where
+// it is "false", i.e. recordings played back with a bodiless matcher.
+const MetadataCompareBodies = "compareBodies"
+
+// RecordingSizeReport lists the recordings under a directory and their
+// bodies, largest first.
+type RecordingSizeReport struct {
+	Recordings []RecordingSize
+	Bodies     []BodySize
+}
+
+// RecordingSize is the size of one recording file.
+type RecordingSize struct {
+	Path string
+	Size int64
+}
+
+// BodySize is the size of one recorded body, as stored in the file.
+type BodySize struct {
+	Path  string
+	Entry int
+	// Location is "RequestBody" or "ResponseBody".
+	Location string
+	Size     int
+}
+
+// SizeReport finds the largest recordings under dir and the largest bodies
+// within them, to spot recordings bloated by captured payloads.
+func SizeReport(dir string) (*RecordingSizeReport, error) {
+	infos, err := ListRecordings(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RecordingSizeReport{}
+	for _, info := range infos {
+		report.Recordings = append(report.Recordings, RecordingSize{info.Path, info.Size})
+		if info.Err != nil {
+			continue
+		}
+
+		err := scanRecordingFile(info.Path, func(index int, raw json.RawMessage) error {
+			var bodies struct {
+				RequestBody  json.RawMessage
+				ResponseBody json.RawMessage
+			}
+			if err := json.Unmarshal(raw, &bodies); err != nil {
+				return err
+			}
+			report.Bodies = append(report.Bodies,
+				BodySize{info.Path, index, "RequestBody", storedBodySize(bodies.RequestBody)},
+				BodySize{info.Path, index, "ResponseBody", storedBodySize(bodies.ResponseBody)})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", info.Path, err)
+		}
+	}
+
+	sort.SliceStable(report.Recordings, func(i, j int) bool { return report.Recordings[i].Size > report.Recordings[j].Size })
+	sort.SliceStable(report.Bodies, func(i, j int) bool { return report.Bodies[i].Size > report.Bodies[j].Size })
+	return report, nil
+}
+
+// String formats the ten largest recordings and bodies.
+func (r *RecordingSizeReport) String() string {
+	const top = 10
+	var b strings.Builder
+	b.WriteString("Largest recordings:\n")
+	for i, rs := range r.Recordings {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(&b, "  %10d  %s\n", rs.Size, rs.Path)
+	}
+	b.WriteString("Largest bodies:\n")
+	for i, bs := range r.Bodies {
+		if i == top || bs.Size == 0 {
+			break
+		}
+		fmt.Fprintf(&b, "  %10d  %s Entries[%d].%s\n", bs.Size, bs.Path, bs.Entry, bs.Location)
+	}
+	return b.String()
+}
+
+// TrimBodies replaces every request and response body larger than maxBytes
+// in the recording at path with placeholder followed by the original size,
+// and returns the number of bodies trimmed. URIs, methods and headers are
+// left untouched, so the recording still plays back with a bodiless
+// matcher; for the same reason TrimBodies refuses to run unless the
+// recording's MetadataCompareBodies metadata is "false".
+func TrimBodies(path string, maxBytes int, placeholder string) (int, error) {
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if rec.Metadata()[MetadataCompareBodies] != "false" {
+		return 0, fmt.Errorf("%s: refusing to trim bodies of a recording matched with body comparison; set the %q metadata to \"false\" once a bodiless matcher is in use",
+			path, MetadataCompareBodies)
+	}
+
+	trimmed := 0
+	for i := range rec.Entries {
+		e := &rec.Entries[i]
+		if body, ok := trimBody(e.RequestBody, e.RequestHeaders, maxBytes, placeholder); ok {
+			e.RequestBody = body
+			trimmed++
+		}
+		if body, ok := trimBody(e.ResponseBody, e.ResponseHeaders, maxBytes, placeholder); ok {
+			e.ResponseBody = body
+			setHeader(e.ResponseHeaders, "Content-Length", strconv.Itoa(len(bodyBytes(body, e.ResponseHeaders))))
+			trimmed++
+		}
+	}
+	if trimmed == 0 {
+		return 0, nil
+	}
+	return trimmed, rec.WriteFile(path)
+}
+
+// trimBody returns the placeholder body for body if it is larger than
+// maxBytes. Binary bodies get a base64 encoded placeholder, so the entry
+// stays consistent with its Content-Type.
+func trimBody(body json.RawMessage, headers Headers, maxBytes int, placeholder string) (json.RawMessage, bool) {
+	size := storedBodySize(body)
+	if size <= maxBytes {
+		return nil, false
+	}
+	text := fmt.Sprintf("%s (%d bytes)", placeholder, size)
+	if _, base64Body, ok := bodyText(body, headers); ok && base64Body {
+		text = base64.StdEncoding.EncodeToString([]byte(text))
+	}
+	replaced, err := marshalNoEscape(text)
+	if err != nil {
+		return nil, false
+	}
+	return replaced, true
+}
+
+// bodyBytes returns the bytes a recorded body stands for on the wire.
+func bodyBytes(body json.RawMessage, headers Headers) []byte {
+	text, base64Body, ok := bodyText(body, headers)
+	if !ok {
+		return nil
+	}
+	if base64Body {
+		if decoded, err := base64.StdEncoding.DecodeString(text); err == nil {
+			return decoded
+		}
+	}
+	return []byte(text)
+}
+
+// storedBodySize is the size of a body as stored in the recording, without
+// the indentation of the file and with null counting as empty.
+func storedBodySize(body json.RawMessage) int {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, body); err != nil {
+		return len(body)
+	}
+	if compacted.String() == "null" {
+		return 0
+	}
+	return compacted.Len()
+}
+
+// setHeader replaces the value of the named header, matched
+// case-insensitively, if it is present.
+func setHeader(headers Headers, name, value string) {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			headers[k] = []string{value}
+		}
+	}
+}
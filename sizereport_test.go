@@ -0,0 +1,113 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSizeFixture(t *testing.T, path string, metadata map[string]string) {
+	rec := &RecordingFile{Entries: []Entry{
+		{
+			RequestUri:      "https://account.blob.core.windows.net/c/big",
+			RequestMethod:   "GET",
+			StatusCode:      200,
+			ResponseHeaders: Headers{"Content-Type": {"application/octet-stream"}, "Content-Length": {"24"}},
+			ResponseBody:    json.RawMessage(`"` + strings.Repeat("A", 32) + `"`),
+		},
+		{
+			RequestUri:      "https://account.table.core.windows.net/Tables",
+			RequestMethod:   "POST",
+			RequestHeaders:  Headers{"Content-Type": {"application/json"}},
+			RequestBody:     json.RawMessage(`{"TableName":"t"}`),
+			StatusCode:      201,
+			ResponseHeaders: Headers{"Content-Type": {"application/json"}},
+			ResponseBody:    json.RawMessage(`{"TableName":"t","odata.metadata":"https://account.table.core.windows.net/$metadata#Tables/@Element"}`),
+		},
+	}}
+	if err := rec.SetMetadata(metadata); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSizeReport(t *testing.T) {
+	dir := t.TempDir()
+	writeSizeFixture(t, filepath.Join(dir, "TestBig.json"), nil)
+	small := &RecordingFile{Entries: []Entry{{RequestUri: "https://example.com", RequestMethod: "GET", StatusCode: 200}}}
+	if err := small.WriteFile(filepath.Join(dir, "TestSmall.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := SizeReport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Recordings) != 2 || filepath.Base(report.Recordings[0].Path) != "TestBig.json" {
+		t.Fatalf("unexpected recordings order: %+v", report.Recordings)
+	}
+	top := report.Bodies[0]
+	if filepath.Base(top.Path) != "TestBig.json" || top.Entry != 1 || top.Location != "ResponseBody" {
+		t.Errorf("unexpected largest body: %+v", top)
+	}
+	if !strings.Contains(report.String(), "TestBig.json Entries[1].ResponseBody") {
+		t.Errorf("report does not list the largest body:\n%s", report)
+	}
+}
+
+func TestTrimBodies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestTrim.json")
+	writeSizeFixture(t, path, map[string]string{MetadataCompareBodies: "false"})
+
+	trimmed, err := TrimBodies(path, 30, "<trimmed>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trimmed != 2 {
+		t.Fatalf("trimmed %d bodies, want 2", trimmed)
+	}
+
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := rec.Entries[0]
+	if got := string(bodyBytes(binary.ResponseBody, binary.ResponseHeaders)); got != "<trimmed> (34 bytes)" {
+		t.Errorf("binary body = %q", got)
+	}
+	if got := binary.ResponseHeaders.Get("Content-Length"); got != "20" {
+		t.Errorf("Content-Length = %q, want 20", got)
+	}
+	if got := compactJSON(t, rec.Entries[1].RequestBody); got != `{"TableName":"t"}` {
+		t.Errorf("small body was rewritten: %s", got)
+	}
+	if got := string(rec.Entries[1].ResponseBody); !strings.HasPrefix(got, `"<trimmed> (`) {
+		t.Errorf("json body = %s", got)
+	}
+	if rec.Entries[1].RequestUri != "https://account.table.core.windows.net/Tables" {
+		t.Errorf("request URI changed: %s", rec.Entries[1].RequestUri)
+	}
+}
+
+func TestTrimBodiesRequiresBodilessMatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TestTrim.json")
+	writeSizeFixture(t, path, nil)
+
+	if _, err := TrimBodies(path, 30, "<trimmed>"); err == nil {
+		t.Fatal("expected TrimBodies to refuse a recording that compares bodies")
+	}
+	rec, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Entries[0].ResponseBody) != 34 {
+		t.Errorf("body was modified: %s", rec.Entries[0].ResponseBody)
+	}
+}
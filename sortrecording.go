@@ -0,0 +1,59 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TimestampHeader carries the time a request was sent, in nanoseconds since
+// the Unix epoch. It is added by AddTimestampAnnotation while recording.
+const TimestampHeader = "X-Recording-Timestamp"
+
+// AddTimestampAnnotation makes transports created with tpv.Transport stamp
+// each request with TimestampHeader while recording, so the entries can later
+// be put back in chronological order with SortRecordingByTimestamp.
+//
+// The header is saved with the entry and differs on every run, so it is
+// excluded from request matching when the recording is played back.
+func AddTimestampAnnotation(tpv *TestProxyVariables) error {
+	tpv.excludedHeaders = append(tpv.excludedHeaders, TimestampHeader)
+	tpv.requestHooks = append(tpv.requestHooks, func(req *http.Request, mode string) {
+		if mode == "record" {
+			req.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+		}
+	})
+	return nil
+}
+
+// SortRecordingByTimestamp reorders the entries of the recording at filePath
+// by their TimestampHeader and rewrites the file. Concurrent SDK clients can
+// interleave entries from different logical operations, and sorting makes the
+// recording read chronologically. Entries without a timestamp keep their
+// relative order and are placed after the timestamped ones.
+func SortRecordingByTimestamp(filePath string) error {
+	rf, err := ReadRecordingFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	timestamp := func(e Entry) (int64, bool) {
+		ts, err := strconv.ParseInt(e.RequestHeaders.Get(TimestampHeader), 10, 64)
+		return ts, err == nil
+	}
+	sort.SliceStable(rf.Entries, func(i, j int) bool {
+		ti, iok := timestamp(rf.Entries[i])
+		tj, jok := timestamp(rf.Entries[j])
+		if iok && jok {
+			return ti < tj
+		}
+		return iok && !jok
+	})
+
+	return rf.WriteFile(filePath)
+}
@@ -0,0 +1,154 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const unsortedRecording = `{
+  "Entries": [
+    {"RequestUri": "https://example.com/c", "RequestMethod": "GET", "RequestHeaders": {"X-Recording-Timestamp": "300"}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null},
+    {"RequestUri": "https://example.com/none", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null},
+    {"RequestUri": "https://example.com/a", "RequestMethod": "GET", "RequestHeaders": {"x-recording-timestamp": "100"}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null},
+    {"RequestUri": "https://example.com/b", "RequestMethod": "PUT", "RequestHeaders": {"X-Recording-Timestamp": "200", "Accept": ["a", "b"]}, "RequestBody": {"name": "b"}, "StatusCode": 201, "ResponseHeaders": {}, "ResponseBody": "ok"}
+  ],
+  "Variables": {"seed": "42"},
+  "Unknown": {"kept": true}
+}`
+
+func TestSortRecordingByTimestamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := os.WriteFile(path, []byte(unsortedRecording), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SortRecordingByTimestamp(path); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := ReadRecordingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/a", "/b", "/c", "/none"}
+	for i, e := range rf.Entries {
+		if !strings.HasSuffix(e.RequestUri, want[i]) {
+			t.Fatalf("entry %d is %s, want %s", i, e.RequestUri, want[i])
+		}
+	}
+	if got := rf.Entries[1].RequestHeaders["Accept"]; len(got) != 2 {
+		t.Errorf("multi-valued header not preserved: %v", got)
+	}
+	var body bytes.Buffer
+	if err := json.Compact(&body, rf.Entries[1].RequestBody); err != nil || body.String() != `{"name":"b"}` {
+		t.Errorf("request body not preserved: %s", rf.Entries[1].RequestBody)
+	}
+	if rf.Variables["seed"] != "42" {
+		t.Errorf("variables not preserved: %v", rf.Variables)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Unknown"`) {
+		t.Errorf("unknown top-level key dropped:\n%s", data)
+	}
+}
+
+func TestAddTimestampAnnotation(t *testing.T) {
+	for _, mode := range []string{"record", "playback"} {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, mode)
+		if err := AddTimestampAnnotation(tpv); err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		got := sp.Requests()[0].Header.Get(TimestampHeader)
+		if mode == "record" && got == "" {
+			t.Error("record: timestamp header missing")
+		}
+		if mode == "playback" && got != "" {
+			t.Errorf("playback: unexpected timestamp header %q", got)
+		}
+	}
+}
+
+func TestAddTimestampAnnotationPlayback(t *testing.T) {
+	// The stub matches like the proxy's default matcher: a recorded header
+	// must be sent with the same value unless the session excludes it.
+	recorded := http.Header{TimestampHeader: {"1600000000000000000"}}
+	var excluded []string
+	sp := newStubProxy(t)
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		switch r.URL.Path {
+		case "/Admin/SetMatcher":
+			var m struct{ ExcludedHeaders string }
+			requests := sp.Requests()
+			if err := json.Unmarshal(requests[len(requests)-1].Body, &m); err != nil {
+				t.Error(err)
+			}
+			excluded = strings.Split(m.ExcludedHeaders, ",")
+			return true
+		case "/":
+			compared := recorded.Clone()
+			for _, h := range excluded {
+				compared.Del(h)
+			}
+			for name := range compared {
+				if r.Header.Get(name) != compared.Get(name) {
+					http.Error(w, "header "+name+" does not match", http.StatusNotFound)
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	tpv := sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = filepath.Join(t.TempDir(), "TestTimestamps.json")
+	if err := AddTimestampAnnotation(tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	defer StopTestProxy(tpv)
+
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+	resp, err := tpv.Transport(tpv.HttpClient).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Errorf("playback did not match: %s: %s", resp.Status, body)
+	}
+}
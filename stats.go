@@ -0,0 +1,164 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordingStats summarizes the recordings under a directory for test
+// suite health dashboards.
+type RecordingStats struct {
+	Recordings int `json:"recordings"`
+	// CorruptRecordings counts files that look like recordings but could
+	// not be parsed; they are not included in the other numbers.
+	CorruptRecordings int `json:"corruptRecordings"`
+	Entries           int `json:"entries"`
+	// Size is the total size in bytes of the parsed recordings.
+	Size int64 `json:"size"`
+	// Hosts counts entries by upstream host, as recorded, i.e. after
+	// sanitization.
+	Hosts map[string]int `json:"hosts"`
+	// UnparsableURIs counts entries whose RequestUri is not an absolute URI.
+	UnparsableURIs int         `json:"unparsableUris"`
+	StatusCodes    map[int]int `json:"statusCodes"`
+	// Oldest and Newest are the least and most recently recorded
+	// recordings, and OldestRecordedAt and NewestRecordedAt the times they
+	// were recorded. They are unset when there are no recordings.
+	//
+	// A recording's time is that of its last entry, read from the entry's
+	// TimestampHeader (see AddTimestampAnnotation) or, failing that, the
+	// Date header of its response, so it survives a git checkout. Only a
+	// recording with neither falls back to the file's modification time,
+	// which after a checkout is the time of the checkout.
+	Oldest           string        `json:"oldest,omitempty"`
+	OldestRecordedAt *time.Time    `json:"oldestRecordedAt,omitempty"`
+	OldestAge        time.Duration `json:"oldestAge"`
+	Newest           string        `json:"newest,omitempty"`
+	NewestRecordedAt *time.Time    `json:"newestRecordedAt,omitempty"`
+}
+
+// Stats computes RecordingStats for the recordings under dir, reading each
+// recording one entry at a time.
+func Stats(dir string) (RecordingStats, error) {
+	stats := RecordingStats{Hosts: map[string]int{}, StatusCodes: map[int]int{}}
+
+	infos, err := ListRecordings(dir)
+	if err != nil {
+		return stats, err
+	}
+	for _, info := range infos {
+		if info.Err != nil {
+			stats.CorruptRecordings++
+			continue
+		}
+		stats.Recordings++
+		stats.Size += info.Size
+		var recordedAt time.Time
+		err := scanRecordingFile(info.Path, func(index int, raw json.RawMessage) error {
+			var entry struct {
+				RequestUri      string
+				RequestHeaders  Headers
+				StatusCode      int
+				ResponseHeaders Headers
+			}
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return err
+			}
+			if t, ok := entryTime(entry.RequestHeaders, entry.ResponseHeaders); ok && t.After(recordedAt) {
+				recordedAt = t
+			}
+			stats.Entries++
+			stats.StatusCodes[entry.StatusCode]++
+			if u, err := url.Parse(entry.RequestUri); err != nil || !u.IsAbs() || u.Host == "" {
+				stats.UnparsableURIs++
+			} else {
+				stats.Hosts[strings.ToLower(u.Host)]++
+			}
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", info.Path, err)
+		}
+
+		if recordedAt.IsZero() {
+			recordedAt = info.ModTime
+		}
+		if stats.OldestRecordedAt == nil || recordedAt.Before(*stats.OldestRecordedAt) {
+			stats.Oldest = info.Path
+			stats.OldestRecordedAt = &recordedAt
+		}
+		if stats.NewestRecordedAt == nil || recordedAt.After(*stats.NewestRecordedAt) {
+			stats.Newest = info.Path
+			stats.NewestRecordedAt = &recordedAt
+		}
+	}
+	if stats.OldestRecordedAt != nil {
+		stats.OldestAge = time.Since(*stats.OldestRecordedAt)
+	}
+	return stats, nil
+}
+
+// entryTime returns the time a recorded entry was made, from its
+// TimestampHeader or the Date header of its response.
+func entryTime(request, response Headers) (time.Time, bool) {
+	if ns, err := strconv.ParseInt(request.Get(TimestampHeader), 10, 64); err == nil {
+		return time.Unix(0, ns).UTC(), true
+	}
+	if t, err := http.ParseTime(response.Get("Date")); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// WriteJSON writes the stats as indented JSON.
+func (s RecordingStats) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+func (s RecordingStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d recordings (%d corrupt), %d entries\n", s.Recordings, s.CorruptRecordings, s.Entries)
+
+	hosts := make([]string, 0, len(s.Hosts))
+	for host := range s.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if s.Hosts[hosts[i]] != s.Hosts[hosts[j]] {
+			return s.Hosts[hosts[i]] > s.Hosts[hosts[j]]
+		}
+		return hosts[i] < hosts[j]
+	})
+	fmt.Fprintf(&b, "Hosts (%d distinct, %d unparsable URIs):\n", len(hosts), s.UnparsableURIs)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "  %6d  %s\n", s.Hosts[host], host)
+	}
+
+	codes := make([]int, 0, len(s.StatusCodes))
+	for code := range s.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	b.WriteString("Status codes:\n")
+	for _, code := range codes {
+		fmt.Fprintf(&b, "  %6d  %d\n", s.StatusCodes[code], code)
+	}
+
+	if s.Oldest != "" {
+		fmt.Fprintf(&b, "Oldest recording: %s (%s old)\n", s.Oldest, s.OldestAge.Round(time.Hour))
+	}
+	return b.String()
+}
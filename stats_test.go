@@ -0,0 +1,116 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	// Give the fixtures fixed, distinct ages, as a checkout sets them all
+	// to the time of the checkout.
+	oldest := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	for path, mtime := range map[string]time.Time{
+		"testdata/stats/TestBlobs.json":             oldest,
+		"testdata/stats/TestTables/TestCreate.json": oldest.Add(24 * time.Hour),
+	} {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := Stats("testdata/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Recordings != 2 || stats.CorruptRecordings != 1 || stats.Entries != 5 || stats.UnparsableURIs != 1 {
+		t.Errorf("got %d recordings, %d corrupt, %d entries, %d unparsable URIs; want 2, 1, 5, 1",
+			stats.Recordings, stats.CorruptRecordings, stats.Entries, stats.UnparsableURIs)
+	}
+	wantHosts := map[string]int{"sanitized.blob.core.windows.net": 2, "sanitized.table.core.windows.net": 2}
+	if !reflect.DeepEqual(stats.Hosts, wantHosts) {
+		t.Errorf("got hosts %v, want %v", stats.Hosts, wantHosts)
+	}
+	wantCodes := map[int]int{200: 2, 201: 2, 404: 1}
+	if !reflect.DeepEqual(stats.StatusCodes, wantCodes) {
+		t.Errorf("got status codes %v, want %v", stats.StatusCodes, wantCodes)
+	}
+	if stats.Oldest != filepath.Join("testdata", "stats", "TestBlobs.json") || stats.OldestRecordedAt == nil || !stats.OldestRecordedAt.Equal(oldest) {
+		t.Errorf("got oldest %s at %s", stats.Oldest, stats.OldestRecordedAt)
+	}
+	if stats.Newest != filepath.Join("testdata", "stats", "TestTables", "TestCreate.json") || stats.NewestRecordedAt == nil || !stats.NewestRecordedAt.Equal(oldest.Add(24*time.Hour)) {
+		t.Errorf("got newest %s at %s", stats.Newest, stats.NewestRecordedAt)
+	}
+
+	var buf bytes.Buffer
+	if err := stats.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded RecordingStats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.StatusCodes, wantCodes) || decoded.Entries != 5 {
+		t.Errorf("JSON does not round trip:\n%s", buf.String())
+	}
+	if !strings.Contains(stats.String(), "2 recordings (1 corrupt), 5 entries") {
+		t.Errorf("unexpected summary:\n%s", stats)
+	}
+}
+
+func TestStatsRecordedAt(t *testing.T) {
+	dir := t.TempDir()
+	dated := time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC)
+	stamped := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	checkout := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for name, e := range map[string]Entry{
+		"TestDated.json": {RequestUri: "https://example.com/", RequestMethod: "GET", StatusCode: 200,
+			ResponseHeaders: Headers{"Date": {dated.Format(http.TimeFormat)}}},
+		"TestStamped.json": {RequestUri: "https://example.com/", RequestMethod: "GET", StatusCode: 200,
+			RequestHeaders:  Headers{TimestampHeader: {strconv.FormatInt(stamped.UnixNano(), 10)}},
+			ResponseHeaders: Headers{"Date": {dated.Format(http.TimeFormat)}}},
+		"TestUndated.json": {RequestUri: "https://example.com/", RequestMethod: "GET", StatusCode: 200},
+	} {
+		path := filepath.Join(dir, name)
+		if err := (&RecordingFile{Entries: []Entry{e}}).WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		// As after a checkout, every file has the same modification time.
+		if err := os.Chtimes(path, checkout, checkout); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := Stats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(stats.Oldest) != "TestDated.json" || !stats.OldestRecordedAt.Equal(dated) {
+		t.Errorf("got oldest %s at %v, want TestDated.json at %s", stats.Oldest, stats.OldestRecordedAt, dated)
+	}
+	// Only the recording without timestamps falls back to its mtime.
+	if filepath.Base(stats.Newest) != "TestUndated.json" || !stats.NewestRecordedAt.Equal(checkout) {
+		t.Errorf("got newest %s at %v, want TestUndated.json at %s", stats.Newest, stats.NewestRecordedAt, checkout)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "TestUndated.json")); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = Stats(dir); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(stats.Newest) != "TestStamped.json" || !stats.NewestRecordedAt.Equal(stamped) {
+		t.Errorf("got newest %s at %v, want TestStamped.json at %s", stats.Newest, stats.NewestRecordedAt, stamped)
+	}
+}
@@ -0,0 +1,111 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// stubProxy is an in-process stand-in for the test proxy. It answers the
+// start and stop calls with a fixed recording ID and remembers every request
+// it receives so tests can assert on what the package sent.
+type stubProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []stubRequest
+
+	// handle, when set, is called before the default handling and reports
+	// whether it fully answered the request.
+	handle func(w http.ResponseWriter, r *http.Request) bool
+}
+
+type stubRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+func newStubProxy(t *testing.T) *stubProxy {
+	sp := &stubProxy{}
+	sp.Server = httptest.NewTLSServer(http.HandlerFunc(sp.serveHTTP))
+	t.Cleanup(sp.Close)
+	return sp
+}
+
+func (sp *stubProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sp.mu.Lock()
+	sp.requests = append(sp.requests, stubRequest{r.Method, r.URL.Path, r.Header.Clone(), body})
+	sp.mu.Unlock()
+
+	if sp.handle != nil && sp.handle(w, r) {
+		return
+	}
+
+	switch r.URL.Path {
+	case "/record/start", "/playback/start":
+		w.Header().Set("x-recording-id", "stub-recording-id")
+	case "/record/stop", "/playback/stop":
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"upstream":"`+r.Header.Get("x-recording-upstream-base-uri")+`"}`)
+	}
+}
+
+// Requests returns a copy of the requests received so far.
+func (sp *stubProxy) Requests() []stubRequest {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return append([]stubRequest(nil), sp.requests...)
+}
+
+// hostPort splits the listener address of the stub into host and port.
+func (sp *stubProxy) hostPort(t *testing.T) (string, int) {
+	u, err := url.Parse(sp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Hostname(), port
+}
+
+// trustStubProxy points TESTPROXY_CA_BUNDLE at the stub's certificate, for
+// tests that create their TestProxyVariables through NewTestProxyVariables.
+func trustStubProxy(t *testing.T, sp *stubProxy) {
+	t.Setenv("TESTPROXY_CA_BUNDLE", sp.caBundle(t))
+}
+
+// caBundle writes the stub's certificate to a PEM file and returns its path.
+func (sp *stubProxy) caBundle(t *testing.T) string {
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: sp.Certificate().Raw})
+	if err := os.WriteFile(caBundle, certPem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return caBundle
+}
+
+// variables returns TestProxyVariables configured to talk to the stub.
+func (sp *stubProxy) variables(t *testing.T, mode string) *TestProxyVariables {
+	tpv := NewTestProxyVariables(t)
+	tpv.Host, tpv.Port = sp.hostPort(t)
+	tpv.Mode = mode
+	tpv.HttpClient = sp.Client()
+	return tpv
+}
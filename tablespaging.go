@@ -0,0 +1,46 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+)
+
+// tablesContinuations are the continuation tokens of aztables pagers:
+// returned in x-ms-continuation-<token> response headers and sent back in
+// the <token> query parameter of the next page's request.
+var tablesContinuations = []string{"NextPartitionKey", "NextRowKey", "NextTableName"}
+
+// ConfigureTablesPaging prepares rec for aztables pagers that span several
+// pages, such as NewListEntitiesPager with a Top smaller than the table.
+// The continuation tokens are sanitized in the response headers and in the
+// request URIs that send them back, and playback ignores them when
+// matching, so the pages are served in the order they were recorded even
+// when the tokens differ between runs. Call it before StartTestProxy; the
+// sanitizers are registered when the session starts. ctx only guards
+// against configuring a test that has already been canceled.
+func ConfigureTablesPaging(ctx context.Context, rec *TestProxyVariables) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, token := range tablesContinuations {
+		rec.sanitizers = append(rec.sanitizers, HeaderRegexSanitizer{Key: "x-ms-continuation-" + token, Value: "Sanitized"})
+	}
+	rec.sanitizers = append(rec.sanitizers, UriRegexSanitizer{
+		Value:           "Sanitized",
+		Regex:           `Next(PartitionKey|RowKey|TableName)=(?<token>[^&]+)`,
+		GroupForReplace: "token",
+	})
+next:
+	for _, token := range tablesContinuations {
+		for _, ignored := range rec.Matcher.IgnoredQueryParameters {
+			if ignored == token {
+				continue next
+			}
+		}
+		rec.Matcher.IgnoredQueryParameters = append(rec.Matcher.IgnoredQueryParameters, token)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/data/aztables"
+)
+
+func TestConfigureTablesPaging(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	tpv.Matcher.IgnoredQueryParameters = []string{"NextRowKey"}
+	if err := ConfigureTablesPaging(context.Background(), tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	var sanitizers []string
+	var matcher map[string]interface{}
+	for _, r := range sp.Requests() {
+		switch r.Path {
+		case "/Admin/AddSanitizer":
+			sanitizers = append(sanitizers, r.Header.Get("x-abstraction-identifier")+" "+string(r.Body))
+		case "/Admin/SetMatcher":
+			if err := json.Unmarshal(r.Body, &matcher); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := []string{
+		`HeaderRegexSanitizer {"key":"x-ms-continuation-NextPartitionKey","value":"Sanitized"}`,
+		`HeaderRegexSanitizer {"key":"x-ms-continuation-NextRowKey","value":"Sanitized"}`,
+		`HeaderRegexSanitizer {"key":"x-ms-continuation-NextTableName","value":"Sanitized"}`,
+		`UriRegexSanitizer {"value":"Sanitized","regex":"Next(PartitionKey|RowKey|TableName)=(?<token>[^&]+)","groupForReplace":"token"}`,
+	}
+	if strings.Join(sanitizers, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got sanitizers:\n%s\nwant:\n%s", strings.Join(sanitizers, "\n"), strings.Join(want, "\n"))
+	}
+	if got := matcher["ignoredQueryParameters"]; got != "NextRowKey,NextPartitionKey,NextTableName" {
+		t.Errorf("got ignored query parameters %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ConfigureTablesPaging(ctx, sp.variables(t, "record")); err == nil {
+		t.Error("configured a canceled test")
+	}
+}
+
+func TestConfigureTablesPagingPlayback(t *testing.T) {
+	sp := newStubProxy(t)
+	var pageQueries []string
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/adventureworks()" {
+			return false
+		}
+		// The stub plays back the sanitized recording: the first page's
+		// continuation tokens were replaced with "Sanitized".
+		pageQueries = append(pageQueries, r.URL.Query().Get("NextPartitionKey")+" "+r.URL.Query().Get("NextRowKey"))
+		w.Header().Set("Content-Type", "application/json;odata=minimalmetadata")
+		if len(pageQueries) == 1 {
+			w.Header().Set("x-ms-continuation-NextPartitionKey", "Sanitized")
+			w.Header().Set("x-ms-continuation-NextRowKey", "Sanitized")
+			io.WriteString(w, `{"value":[{"PartitionKey":"gear","RowKey":"1"},{"PartitionKey":"gear","RowKey":"2"}]}`)
+		} else {
+			io.WriteString(w, `{"value":[{"PartitionKey":"gear","RowKey":"3"}]}`)
+		}
+		return true
+	}
+	tpv := sp.variables(t, "playback")
+	if err := ConfigureTablesPaging(context.Background(), tpv); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	client, err := aztables.NewClientWithNoCredential("https://account.table.core.windows.net/adventureworks", &aztables.ClientOptions{ClientOptions: tpv.ClientOptions()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	top := int32(2)
+	var pages, entities int
+	pager := client.NewListEntitiesPager(&aztables.ListEntitiesOptions{Top: &top})
+	for pager.More() {
+		page, err := pager.NextPage(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		entities += len(page.Entities)
+	}
+	if pages != 2 || entities != 3 {
+		t.Errorf("got %d entities in %d pages, want 3 in 2", entities, pages)
+	}
+	if len(pageQueries) != 2 || pageQueries[0] != " " || pageQueries[1] != "Sanitized Sanitized" {
+		t.Errorf("got page requests with continuations %q", pageQueries)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,18 +6,25 @@ package testproxy
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 // This is an example integration with the Azure record/playback test proxy,
@@ -26,12 +33,6 @@ import (
 // This implementation assumes the test-proxy is already running.
 // Your test framework should start and stop the test-proxy process as needed.
 
-var client = http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	},
-}
-
 // Derived from policy.Transporter, TestProxyTransport provides custom
 // implementations of the abstract methods defined in the base class
 // described in the HTTP Transport section of the following blog post:
@@ -44,8 +45,68 @@ type TestProxyTransport struct {
 	port        int
 	mode        string
 	recordingId string
+	headers     ProxyHeaders
+
+	// variables, when set, supplies the per-session hooks registered on the
+	// TestProxyVariables the transport was created from.
+	variables *TestProxyVariables
+
+	// ExtraHeaders are set on every request after the proxy headers, e.g. a
+	// correlation ID required by a gateway in front of the proxy.
+	// RequestDecorator, when set, is called after ExtraHeaders are applied.
+	// Neither may change the proxy's x-recording-* headers; Do fails if
+	// they do. Note that added headers take part in playback matching
+	// unless the proxy's matcher is told to ignore them.
+	ExtraHeaders     map[string]string
+	RequestDecorator func(req *http.Request)
+
+	// PerAttemptTimeout bounds each request sent to the proxy, so a hung
+	// proxy or an entry it cannot serve fails the call with the recording
+	// ID and URL instead of blocking until the test times out. It defaults
+	// to DefaultPerAttemptTimeout; zero disables it. An earlier deadline
+	// already set on the request's context still applies.
+	PerAttemptTimeout time.Duration
+
+	// RedactRequestHeaders are replaced by RedactedHeaderValue, where
+	// Redaction says, so credentials do not end up in logs. They default
+	// to DefaultRedactedRequestHeaders when nil; an empty slice redacts
+	// nothing.
+	RedactRequestHeaders []string
+	Redaction            HeaderRedaction
+
+	// CanonicalizeJSONBodies rewrites JSON request bodies of up to
+	// CanonicalizeMaxBytes, DefaultCanonicalizeMaxBytes when zero, with
+	// their object keys sorted and insignificant whitespace removed, in
+	// record and playback alike, so bodies built from Go maps match in
+	// playback. Strings and numbers are sent exactly as they were.
+	CanonicalizeJSONBodies bool
+	CanonicalizeMaxBytes   int64
+
+	// NormalizeBody, when set, rewrites text request bodies, such as JSON,
+	// XML and forms, before they are sent to the proxy, in record and
+	// playback alike, so values that differ on every run match in
+	// playback; see NormalizeTimestamps. The service receives the
+	// normalized body while recording. Binary bodies are sent as they are.
+	NormalizeBody func(contentType string, body []byte) []byte
+
+	// RetryProxyDial resends a request up to ProxyDialAttempts times,
+	// ProxyDialBackoff apart, while the proxy refuses connections, e.g.
+	// while an auto-started proxy restarts. Only dial errors are retried,
+	// never responses, and only requests whose body can be rewound. Zero
+	// attempts and backoff mean DefaultProxyDialAttempts and
+	// DefaultProxyDialBackoff.
+	RetryProxyDial    bool
+	ProxyDialAttempts int
+	ProxyDialBackoff  time.Duration
+
+	// Upstream sends the requests that bypass the proxy, such as those made
+	// with Live or for hosts outside IncludedHosts, straight to the service. It defaults to http.DefaultClient.
+	Upstream policy.Transporter
 }
 
+// DefaultPerAttemptTimeout is the PerAttemptTimeout of new transports.
+const DefaultPerAttemptTimeout = 2 * time.Minute
+
 func NewTestProxyTransport(transport policy.Transporter, host string, port int, recordingId string, mode string) *TestProxyTransport {
 	return &TestProxyTransport{
 		transport:   transport,
@@ -53,22 +114,196 @@ func NewTestProxyTransport(transport policy.Transporter, host string, port int,
 		port:        port,
 		recordingId: recordingId,
 		mode:        mode,
+		headers:     DefaultProxyHeaders(),
+
+		PerAttemptTimeout: DefaultPerAttemptTimeout,
+	}
+}
+
+// upstream returns the transporter for requests that bypass the proxy.
+func (tpt *TestProxyTransport) upstream() policy.Transporter {
+	if tpt.Upstream != nil {
+		return tpt.Upstream
+	}
+	return http.DefaultClient
+}
+
+// Transport returns a TestProxyTransport that routes requests through the
+// proxy session described by tpv and applies the hooks registered on it.
+func (tpv *TestProxyVariables) Transport(transport policy.Transporter) *TestProxyTransport {
+	tpt := NewTestProxyTransport(transport, tpv.Host, tpv.Port, tpv.RecordingId, tpv.Mode)
+	tpt.variables = tpv
+	tpt.headers = tpv.ProxyHeaders.withDefaults()
+	tpt.Upstream = tpv.UpstreamTransport
+	// Local playback stands in for the proxy only; requests that bypass the
+	// proxy still go upstream.
+	if tpv.local != nil {
+		tpt.transport = tpv.local
 	}
+	return tpt
 }
 
 func (tpt *TestProxyTransport) Do(req *http.Request) (resp *http.Response, err error) {
 
-	req.Header.Set("x-recording-id", tpt.recordingId)
-	req.Header.Set("x-recording-mode", tpt.mode)
+	// observed is the request the session's observers see; see
+	// RedactRequestHeaders.
+	observed := req
+	if tpt.variables != nil {
+		original := *req.URL
+		defer func() { tpt.variables.inspect(observed, &original, resp, err) }()
+	}
+
+	if isLive(req.Context()) {
+		if tpt.variables != nil {
+			tpt.variables.logLiveRequest(req, tpt.mode)
+		}
+		return tpt.upstream().Do(req)
+	}
+	if tpt.variables != nil && !tpt.variables.routesThroughProxy(req.URL.Hostname()) {
+		return tpt.upstream().Do(req)
+	}
+	if tpt.variables != nil {
+		excluded, err := tpt.variables.excludesURI(req.URL.String())
+		if err != nil {
+			return nil, err
+		}
+		if excluded {
+			return tpt.sendExcluded(req)
+		}
+	}
+	if protocols := upgradeProtocols(req); len(protocols) > 0 {
+		if isWebSocketUpgrade(req) && tpt.variables != nil && tpt.variables.webSocketMode() == WebSocketPassthrough {
+			return tpt.upstream().Do(req)
+		}
+		return nil, fmt.Errorf("%s %s asks to upgrade to %s: %w", req.Method, req.URL, strings.Join(protocols, ", "), ErrUpgradeNotSupported)
+	}
+
+	// Hooks and RequestDecorator may replace the body; see keepGetBody.
+	// Expect and the request's trailers are forwarded as they are.
+	body := req.Body
+
+	if tpt.variables != nil {
+		if err := tpt.variables.gate.waitWhilePaused(req.Context()); err != nil {
+			return nil, err
+		}
+		if err := tpt.variables.applyFuzzyURISegments(req, tpt.mode); err != nil {
+			return nil, err
+		}
+		for _, hook := range tpt.variables.requestHooks {
+			hook(req, tpt.mode)
+		}
+	}
+
+	removeHopByHopHeaders(req.Header)
+
+	req.Header.Set(tpt.headers.RecordingId, tpt.recordingId)
+	req.Header.Set(tpt.headers.RecordingMode, tpt.mode)
 
 	scheme := req.URL.Scheme
 	host := req.URL.Host
 	baseUri := fmt.Sprintf("%v://%v", scheme, host)
-	req.Header.Set("x-recording-upstream-base-uri", baseUri)
+	req.Header.Set(tpt.headers.UpstreamBaseUri, baseUri)
+
+	if err := tpt.decorate(req); err != nil {
+		return nil, err
+	}
+	if err := tpt.canonicalizeJSONBody(req); err != nil {
+		return nil, err
+	}
+	if err := tpt.normalizeBody(req); err != nil {
+		return nil, err
+	}
+	if err := keepGetBody(req, body); err != nil {
+		return nil, err
+	}
+	observed = tpt.redactRequestHeaders(req)
+
+	var tracker *AccessTracker
+	if tpt.variables != nil {
+		tracker = tpt.variables.AccessTracker
+	}
+	uri := req.URL.String()
 
 	req.URL.Host = fmt.Sprintf("%v:%v", tpt.host, tpt.port)
 
-	return tpt.transport.Do(req)
+	var dumpedReq []byte
+	if tpt.variables != nil {
+		// DumpSensitive asks for the credentials the proxy receives.
+		dumped := observed
+		if tpt.variables.DumpSensitive {
+			dumped = req
+		}
+		dumpedReq = tpt.variables.dumpRequest(dumped)
+	}
+	var endSpan func(*http.Response, int, error)
+	if tpt.variables != nil {
+		endSpan = tpt.variables.startRecordingSpan(req, uri)
+	}
+	var sentBody func() []byte
+	if tpt.variables != nil {
+		sentBody = captureBody(req)
+	}
+	start := time.Now()
+	// Requests answered by IncrementalRecord are not sent at all.
+	var attempts int
+	if tpt.variables != nil && tpt.mode == "record" {
+		resp, _ = tpt.variables.incrementalResponse(req, uri)
+	}
+	if resp == nil {
+		resp, attempts, err = tpt.sendWithRetry(req, uri)
+	}
+	if tpt.variables != nil {
+		err = tpt.variables.explainConnectionError(err)
+	}
+	if err == nil && tpt.variables != nil {
+		index := tpt.variables.recordRequestHash(req.Method, uri, sentBody())
+		err = tpt.variables.overrideStatusCode(resp, uri)
+		if err == nil {
+			err = tpt.variables.sortResponseArrays(resp)
+		}
+		if err == nil {
+			err = tpt.variables.applyLatency(req.Context(), tpt.mode, time.Since(start))
+		}
+		if err == nil {
+			tpt.variables.overrideEntryHeaders(resp, index)
+		}
+		if err != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+	}
+	if endSpan != nil {
+		endSpan(resp, attempts, err)
+	}
+	if tpt.variables != nil {
+		if err == nil {
+			tpt.variables.captureGolden(resp)
+		}
+		tpt.variables.writeEntry(dumpedReq, resp, err)
+		if tpt.variables.ArtifactDir != "" {
+			tpt.writeTranscript(observed, uri, sentBody(), resp, err)
+		}
+		tpt.variables.observeExchange(Exchange{
+			Mode:     tpt.mode,
+			URI:      uri,
+			Request:  observed,
+			Response: resp,
+			Err:      err,
+			Duration: time.Since(start),
+			Attempts: attempts,
+		})
+		if err == nil {
+			tpt.variables.watchTrailers(resp, tpt.mode, req.Method, uri)
+		}
+	}
+	if tracker != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		tracker.track(start, req.Method, uri, tpt.mode, statusCode)
+	}
+	return resp, err
 }
 
 // TestProxyVariables class	encapsulates variables that store values
@@ -79,19 +314,297 @@ type TestProxyVariables struct {
 	Port        int
 	Mode        string
 	RecordingId string
+	// ClientId is sent as 'x-recording-client' when starting and stopping a
+	// session, so a shared proxy's logs can attribute sessions to a team or machine.
+	ClientId string
+	// SkipVersionCheck lets StartTestProxy use a proxy older than
+	// MinProxyVersion.
+	SkipVersionCheck bool
 
 	CurrentRecordingPath string
+	// PathMapping, when set, translates CurrentRecordingPath before it is sent
+	// to a proxy running in a container that sees the repository under a
+	// different path.
+	PathMapping *PathMapping
+	// CompressFormat, when "gzip" or "brotli", keeps recordings compressed
+	// next to CurrentRecordingPath (with a .gz or .br extension). The
+	// recording is compressed after a record session is stopped and
+	// unpacked for the proxy while a playback session runs. Playback fails
+	// when both the compressed and the uncompressed recording exist.
+	CompressFormat        string
+	decompressedRecording string
+	// mergedRecording is the file written by MergeSessionIDs, played back
+	// instead of unmergedRecordingPath.
+	mergedRecording       string
+	unmergedRecordingPath string
+	// ScopeByBuildHash records to <name>.<hash>.json, where hash is the
+	// first 8 hex characters of the test binary's SHA-256 build hash, so
+	// that developers recording concurrently to a shared directory do not
+	// overwrite each other. MergeBuildHashRecordings folds the scoped
+	// recordings into the canonical ones, which playback uses.
+	ScopeByBuildHash      bool
+	unscopedRecordingPath string
+	// LocalPlayback plays the recording back in process with a
+	// LocalPlaybackTransport, without a running proxy. Transport then
+	// sends it the requests it would send to the proxy; Live requests and
+	// those routed around the proxy still go through UpstreamTransport.
+	// Only playback mode is supported, and sanitizers are not applied
+	// since the recording already is sanitized. The recording is read
+	// through the process-wide LRURecordingCache, so loops such as
+	// -count 10 or benchmarks read it from disk once.
+	LocalPlayback bool
+	local         *LocalPlaybackTransport
+	// ResponseCodeOverrides replaces the status code of playback responses
+	// to requests whose URI matches a key, a regular expression, with the
+	// key's value, e.g. {`/Tables$`: 429} to test how a client handles
+	// throttling. Only the response returned by Transport changes; the
+	// recording is left as it is, so re-recording is unaffected.
+	ResponseCodeOverrides map[string]int
+	// EntryHeaderOverrides sets headers of playback responses by the index
+	// of the recording entry answering the request, e.g.
+	// {0: {"Retry-After": "0"}} to test how a client parses headers the
+	// service rarely sends. Entries are numbered in the order of the
+	// session's requests, as for FindRecordedEntry. The headers are set
+	// after ResponseCodeOverrides and the other handling of the response,
+	// replacing the recorded values; the recording is left as it is.
+	EntryHeaderOverrides map[int]map[string]string
+	faults               faultInjector
+	// ReplayLatency, when positive, makes playback as slow as the service
+	// was, to reproduce races that real network latency hides. Record
+	// sessions save the duration of each request in the recording's
+	// variables, and playback waits for the duration recorded for each
+	// request multiplied by ReplayLatency, e.g. 0.1 for a tenth, before
+	// returning its response. Cancelling the request's context ends the
+	// wait.
+	ReplayLatency float64
+	latency       latencyReplay
+	// SessionTimeout, when positive, stops a session automatically if
+	// StopTestProxy has not been called that long after StartTestProxy,
+	// so a test that hangs or forgets to stop does not leave the session
+	// running on a shared proxy. The recording is saved, tagged with
+	// MetadataTimedOut, and the late StopTestProxy returns a
+	// *SessionTimeoutError.
+	SessionTimeout time.Duration
+	deadline       sessionDeadline
+	// sessionMu serializes starting and stopping sessions, including the
+	// stop made when SessionTimeout expires.
+	sessionMu sync.Mutex
+	// MaxRecordingFileSizeBytes is the size above which a recording saved
+	// by a record session is logged as a warning with Logger, or
+	// slog.Default when Logger is nil, and MaxRecordingFileSizeErrorBytes
+	// the size above which StopTestProxy fails with a *RecordingSizeError.
+	// They default to DefaultMaxRecordingFileSizeBytes and
+	// DefaultMaxRecordingFileSizeErrorBytes when zero, and negative values
+	// turn the checks off. cmd/lint can enforce the same budget in CI.
+	MaxRecordingFileSizeBytes      int64
+	MaxRecordingFileSizeErrorBytes int64
+	// ResumeMode, in record mode, adds the new entries to the existing
+	// recording instead of replacing it, e.g. to finish recording a long
+	// integration test after a failure. Entry indexes, such as those of
+	// RecordingSpanExporter, continue after the existing entries.
+	ResumeMode bool
+	resumed    *RecordingFile
+	// IncrementalRecord, in record mode, only records the requests that
+	// changed since the existing recording: a request with the RequestHash
+	// of an existing entry is answered from that entry without reaching the
+	// proxy or the service, and the recording is saved with the existing
+	// and new entries in the order of the requests. Entries whose requests
+	// were changed by sanitizers never match, so those requests are always
+	// recorded again.
+	IncrementalRecord bool
+	incremental       incrementalState
+	// RotateRecordings keeps the previous recording when re-recording, by
+	// renaming it to <name>.json.<N> before the record session starts. N
+	// increases with each rotation. MaxRotationCount, when positive, is the
+	// number of archived recordings kept; older ones are deleted.
+	RotateRecordings bool
+	MaxRotationCount int
+	// RecordingVariant, when not empty, stores the recording of a test as
+	// recordings/<test name>.<variant>.json, so that recordings made against
+	// different environments, such as "dev" and "prod", sit side by side.
+	// See SelectVariant.
+	RecordingVariant string
+	// IncludedHosts, when not empty, limits the requests Transport sends to
+	// the proxy to those for these hosts; ExcludedHosts are never sent to
+	// it. Other requests go live through UpstreamTransport, unrecorded,
+	// even in playback. Entries are host names or "*.domain" patterns.
+	IncludedHosts []string
+	ExcludedHosts []string
+	// ExcludeURIPatterns are regular expressions of request URIs, such as
+	// token requests or telemetry, that are never recorded: in record mode
+	// they go straight to the service, and in playback to LiveFallbackURL,
+	// which replaces their scheme and host, or to the service when it is
+	// empty, through UpstreamTransport either way.
+	ExcludeURIPatterns []string
+	LiveFallbackURL    string
+	// UpstreamTransport sends the requests that bypass the proxy straight
+	// to the service, such as those made with Live or for ExcludedHosts. It defaults to
+	// http.DefaultClient, which verifies the service's certificate; the
+	// HttpClient and the transport given to Transport only reach the proxy.
+	UpstreamTransport policy.Transporter
+
+	// ExcludeRequestIDs leaves x-ms-client-request-id random, excluding it
+	// from matching instead of adding DeterministicRequestIDPolicy to
+	// ClientOptions.
+	ExcludeRequestIDs bool
+	requestIDs        requestIDSequence
+	uuids             uuidSequence
+
+	// Matcher is registered for each playback session. The RFC 7230
+	// hop-by-hop headers, which Do never forwards, are always excluded.
+	Matcher Matcher
+
+	// ProxyHeaders overrides the names of the headers sent to and read from
+	// the proxy, for deployments behind a gateway that renames them.
+	ProxyHeaders ProxyHeaders
 	// Maintain an http client for POST-ing to the test proxy to start and stop recording.
 	// For your test client, you can either maintain the lack of certificate validation (the test-proxy
 	// is making real HTTPS calls, so if your actual api call is having cert issues, those will still surface.
+	// When TESTPROXY_CA_BUNDLE is set, the client validates the proxy certificate against that bundle instead.
 	HttpClient *http.Client
+
+	// Variables are saved with the recording when recording is stopped, and
+	// are read back from the proxy when playback is started. Use them for
+	// values that must be identical between record and playback.
+	Variables map[string]string
+
+	// RecordingMetadata tags the recording, e.g. with the service, API
+	// version or owner. StopTestProxy stores it under the recording's
+	// top-level "metadata" key when recording, and StartTestProxy reads
+	// the tags of an existing recording back. ListRecordings reports them.
+	RecordingMetadata map[string]string
+
+	// FuzzyURISegments marks path segments that hold a generated ID which
+	// differs between record and playback. An entry is either a URI template
+	// such as "operations/{operationId}", whose {placeholder} segments are
+	// fuzzy wherever the template's literal segments match, or a plain
+	// segment name such as "operations", which makes the segment after it
+	// fuzzy. A bare placeholder name like "operationId" matches nothing,
+	// since it never appears in the URI itself. During playback, the
+	// transport substitutes the recorded values from the matching entry so
+	// the proxy can find it.
+	FuzzyURISegments []string
+	fuzzyURI         fuzzyURIState
+
+	gate playbackGate
+
+	// DumpSensitive includes requests with an Authorization header, and
+	// their responses, in the output of EnableHTTPDump, with the header
+	// values sent to the proxy rather than the redacted ones.
+	DumpSensitive bool
+	dump          httpDump
+
+	// sanitizers are registered for the session by StartTestProxy; see
+	// WithSanitizers.
+	sanitizers []Sanitizer
+	// registered are the sanitizers AddSanitizer registered, for
+	// SanitizerStats.
+	registered []Sanitizer
+
+	// WebSocketMode is how DialWebSocket handles WebSocket connections,
+	// which the proxy cannot record: WebSocketRecord, WebSocketPlayback or
+	// WebSocketPassthrough. It defaults to Mode, or to passthrough when
+	// Mode is neither record nor playback. Do sends WebSocket upgrade
+	// requests straight to the service through UpstreamTransport in
+	// passthrough and fails them with ErrUpgradeNotSupported otherwise.
+	// DialWebSocket dials the service with the TLS settings of its config,
+	// never those of the proxy's client.
+	WebSocketMode string
+	ws            webSocketState
+
+	// ArtifactDir, when set, is where Transport writes a transcript of the
+	// session's exchanges for CI artifacts; see TranscriptPath. Request
+	// headers in RedactRequestHeaders are redacted and long bodies
+	// truncated. It defaults to TESTPROXY_ARTIFACTS.
+	ArtifactDir string
+	transcript  transcriptState
+
+	// GoldenDir is where CaptureResponse keeps golden files, testdata/golden
+	// in the current directory when empty.
+	GoldenDir string
+	golden    goldenState
+
+	// RecordingSpanExporter, when set, receives an OpenTelemetry span named
+	// testproxy.record.<method> for each request made through Transport in
+	// record mode, with the http.url, http.method, http.status_code and
+	// recording.entry_index attributes. Pass an *otlptrace.Exporter to
+	// send them to an OTLP backend such as Jaeger. Spans are flushed when
+	// the session stops.
+	RecordingSpanExporter sdktrace.SpanExporter
+	spans                 recordingSpans
+
+	// Logger, when set, logs when sessions start and stop. Sessions are
+	// logged with LogValue, which redacts the variables' values.
+	Logger *slog.Logger
+
+	// Observer is notified of each request sent through Transport and of
+	// warnings about proxy behavior, such as dropped response trailers.
+	Observer Observer
+	served   servedEntries
+
+	// LastRequest and LastResponse are shallow copies of the last request
+	// made through Transport and its response, for assertions in tests
+	// that make their requests sequentially. Tests with parallel requests
+	// read them with InspectLastRequest and InspectLastResponse, or use
+	// LastN.
+	LastRequest  *http.Request
+	LastResponse *http.Response
+	inspectMu    sync.RWMutex
+	inspected    []RequestResponsePair
+
+	// RequestHashes maps the RequestHash of each request made through
+	// Transport in the session to the index of its entry in the recording,
+	// counting from the first request of the session, or after the
+	// existing entries with ResumeMode. Read it with FindRecordedEntry
+	// while requests are in flight.
+	RequestHashes map[string]int
+	hashes        requestHashes
+
+	// RemoteStore, when its ContainerURL is set, keeps the recording in
+	// Blob Storage rather than the repository: StartTestProxy downloads it
+	// in playback and with ResumeMode, and StopTestProxy uploads it once
+	// recorded. See ExportToBlob.
+	RemoteStore BlobStoreConfig
+	// Store, when set, keeps the recording in a RecordingStore, such as
+	// an ADORecordingStore, the same way, and takes precedence over
+	// RemoteStore.
+	Store RecordingStore
+
+	// AccessTracker, when set, records every request made through
+	// Transport and is given the recording when the session is stopped.
+	AccessTracker *AccessTracker
+
+	// startedPath is the recording path reserved by Start for the
+	// session.
+	startedPath string
+
+	// optionErr is the first error of the options given to NewTestProxy.
+	optionErr error
+	// createRecordingDir is the recording path set by WithRecordingPath,
+	// whose directory is created when a record session starts.
+	createRecordingDir string
+
+	// arraySorts are the normalizers added by AddArraySortNormalizer.
+	arraySorts []arraySort
+
+	// requestHooks run at the start of TestProxyTransport.Do, before the
+	// request is rerouted to the proxy.
+	requestHooks []func(req *http.Request, mode string)
+	// excludedHeaders are added by request hooks while recording, so
+	// setSessionMatcher leaves them out of playback matching.
+	excludedHeaders []string
+	// session is the handle of the session last started with tpv. It is
+	// read by the methods of earlier handles, which may run concurrently.
+	session atomic.Pointer[Session]
 }
 
 func NewTestProxyVariables(t *testing.T) *TestProxyVariables {
-	return &TestProxyVariables{
-		HttpClient:           &client,
-		CurrentRecordingPath: getRecordingFilePath(t, GetCurrentDirectory()),
+	tpv, err := clientConfigFromEnv().newVariables()
+	if err != nil {
+		t.Fatal(err)
 	}
+	tpv.CurrentRecordingPath = getRecordingFilePath(t, GetCurrentDirectory(), tpv.RecordingVariant)
+	return tpv
 }
 
 func GetCurrentDirectory() string {
@@ -102,36 +615,164 @@ func GetCurrentDirectory() string {
 	return root
 }
 
-func getRecordingFilePath(t *testing.T, recordingPath string) string {
+func getRecordingFilePath(t testing.TB, recordingPath, variant string) string {
+	if variant != "" {
+		return path.Join(recordingPath, "recordings", t.Name()+"."+variant+".json")
+	}
 	return path.Join(recordingPath, "recordings", t.Name()+".json")
 }
 
 // StartTextProxy() will initiate a record or playback session by POST-ing a request
 // to a running instance of the test proxy. The test proxy will return a recording ID
 // value in the response header, which we pull out and save as 'x-recording-id'.
+// The POST is retried if the connection is reset before the proxy answers.
+// Should the proxy have started a session for the lost attempt, that
+// session is never stopped and so never saved. A proxy answering with an
+// error status fails the start with its message.
+// Unless SkipVersionCheck is set, a proxy older than MinProxyVersion is
+// told to discard the session, and a *ProxyVersionError is returned.
+// StartTestProxy is StartSession without the handle.
 func StartTestProxy(tpv *TestProxyVariables) error {
+	_, err := StartSession(tpv)
+	return err
+}
 
-	url := fmt.Sprintf("https://%v:%v/%v/start", tpv.Host, tpv.Port, tpv.Mode)
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
+// startSession starts the record or playback session for StartSession.
+func (tpv *TestProxyVariables) startSession() (err error) {
+	defer func() {
+		if err != nil {
+			tpv.removeDecompressedRecording()
+			tpv.removeMergedRecording()
+		}
+	}()
+	tpv.resetRequestIDs()
+	tpv.served.reset()
+	tpv.resetRequestHashes()
+	tpv.resetUUIDs()
+	tpv.resetLatencies()
+	tpv.fuzzyURI.reset()
+	tpv.closeTranscript()
+	if tpv.AccessTracker != nil {
+		tpv.AccessTracker.reset()
+	}
+
+	if err := tpv.validateHostRouting(); err != nil {
+		return err
+	}
+	if err := tpv.importRemoteRecording(); err != nil {
 		return err
 	}
+	if tpv.LocalPlayback {
+		return tpv.startLocalPlayback()
+	}
 
-	req.Header.Set("Content-Type", "application/json")
-	marshalled, err := json.Marshal(map[string]string{"x-recording-file": tpv.CurrentRecordingPath})
+	url := fmt.Sprintf("https://%v:%v/%v/start", tpv.Host, tpv.Port, tpv.Mode)
+	if tpv.Mode == "playback" {
+		if err := tpv.decompressRecording(); err != nil {
+			return err
+		}
+	}
+	if err := tpv.readRecordingMetadata(); err != nil {
+		return err
+	}
+	tpv.resetWebSockets()
+	if tpv.Mode == "record" && tpv.ScopeByBuildHash {
+		if err := tpv.scopeRecordingPath(); err != nil {
+			return err
+		}
+	}
+	if err := tpv.loadResumedRecording(); err != nil {
+		return err
+	}
+	if err := tpv.loadIncrementalRecording(); err != nil {
+		return err
+	}
+	if tpv.Mode == "record" && tpv.RotateRecordings {
+		if err := tpv.rotateRecording(); err != nil {
+			return err
+		}
+	}
+	if tpv.Mode == "record" && tpv.createRecordingDir == tpv.CurrentRecordingPath && tpv.createRecordingDir != "" {
+		if err := os.MkdirAll(filepath.Dir(tpv.CurrentRecordingPath), 0o755); err != nil {
+			return fmt.Errorf("recording path: %w", err)
+		}
+	}
+	recordingFile := tpv.CurrentRecordingPath
+	if tpv.PathMapping != nil {
+		var err error
+		if recordingFile, err = tpv.PathMapping.Map(recordingFile); err != nil {
+			return err
+		}
+	}
+	marshalled, err := json.Marshal(map[string]string{"x-recording-file": recordingFile})
 	if err != nil {
 		return err
 	}
-	req.Body = io.NopCloser(bytes.NewReader(marshalled))
-	req.ContentLength = int64(len(marshalled))
 
-	resp, err := tpv.HttpClient.Do(req)
-	if err != nil {
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(marshalled))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		setClientId(req, tpv)
+
+		resp, err = tpv.HttpClient.Do(req)
+		if err == nil {
+			break
+		}
+		if attempt == startAttempts || !isConnectionReset(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("starting %s session: %s: %s", tpv.Mode, resp.Status, proxyErrorMessage(body))
+	}
+
+	tpv.RecordingId = resp.Header.Get(tpv.ProxyHeaders.withDefaults().RecordingId)
+	if err := tpv.checkProxyVersion(resp.Header); err != nil {
+		tpv.stopSession(context.Background(), false)
 		return err
 	}
+	if tpv.Mode == "record" {
+		tpv.setRecordingActive(true)
+	}
+
+	// In playback, the proxy answers with the variables saved alongside the
+	// recording.
+	if tpv.Mode == "playback" {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, &tpv.Variables); err != nil {
+				return fmt.Errorf("reading recording variables: %w", err)
+			}
+		}
+	}
+
+	if tpv.Mode == "playback" {
+		if err := tpv.setSessionMatcher(); err != nil {
+			return err
+		}
+	}
 
-	tpv.RecordingId = resp.Header.Get("x-recording-id")
+	// Sanitizers given as options apply to this session only, so they can
+	// only be added once the proxy has assigned its recording ID.
+	for _, s := range tpv.sanitizers {
+		if err := tpv.AddSanitizer(s); err != nil {
+			return err
+		}
+	}
 
+	if tpv.Logger != nil {
+		tpv.Logger.Info("test proxy session started", "session", tpv)
+	}
 	return nil
 }
 
@@ -139,20 +780,141 @@ func StartTestProxy(tpv *TestProxyVariables) error {
 // depending on the mode it is running in. The instruction to stop is made by
 // POST-ing a request to a running instance of the test proxy. We pass in the recording
 // ID and a directive to save the recording (when recording is running).
+// When recording, tpv.Variables are saved alongside the recording.
 //
 // **Note that if you skip this step your recording WILL NOT be saved.**
+// StopTestProxy is Session.Stop for the session last started with tpv. A
+// session started without StartTestProxy, with RecordingId set by hand, is
+// stopped without the checks of Session.
 func StopTestProxy(tpv *TestProxyVariables) error {
+	sess := tpv.session.Load()
+	if sess == nil {
+		return stopTestProxy(tpv, true)
+	}
+	return sess.Stop(context.Background())
+}
+
+// stopTestProxy stops the session, discarding the recording unless save is
+// set.
+func stopTestProxy(tpv *TestProxyVariables, save bool) error {
+	return stopTestProxyContext(context.Background(), tpv, save)
+}
+
+func stopTestProxyContext(ctx context.Context, tpv *TestProxyVariables, save bool) error {
+	defer tpv.closeTranscript()
+	if err := tpv.disarmSessionTimeout(); err != nil {
+		return err
+	}
+	tpv.sessionMu.Lock()
+	defer tpv.sessionMu.Unlock()
+	return tpv.stopSession(ctx, save)
+}
+
+func (tpv *TestProxyVariables) stopSession(ctx context.Context, save bool) error {
+	// The proxy has loaded the recording, so its unpacked copy can go
+	// whichever way the session ends.
+	defer tpv.removeDecompressedRecording()
+	if tpv.local != nil {
+		// Playing back in process, the session ends here whatever the
+		// outcome.
+		tpv.markSessionStopped()
+		defer tpv.removeMergedRecording()
+		return tpv.stopLocalPlayback()
+	}
+	defer tpv.unscopeRecordingPath()
 
 	url := fmt.Sprintf("https://%v:%v/%v/stop", tpv.Host, tpv.Port, tpv.Mode)
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("x-recording-id", tpv.RecordingId)
-	req.Header.Set("x-recording-save", strconv.FormatBool(true))
+	if save && tpv.Mode == "record" && len(tpv.Variables) > 0 {
+		marshalled, err := json.Marshal(tpv.Variables)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Body = io.NopCloser(bytes.NewReader(marshalled))
+		req.ContentLength = int64(len(marshalled))
+	}
 
-	_, err = tpv.HttpClient.Do(req)
+	headers := tpv.ProxyHeaders.withDefaults()
+	req.Header.Set(headers.RecordingId, tpv.RecordingId)
+	req.Header.Set(headers.RecordingSave, strconv.FormatBool(save))
+	setClientId(req, tpv)
 
-	return err
+	resp, err := tpv.HttpClient.Do(req)
+	if err != nil {
+		return tpv.explainConnectionError(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	tpv.markSessionStopped()
+	tpv.setRecordingActive(false)
+	tpv.releaseStarted()
+	// The session has ended, so its merged recording goes however the rest
+	// of the stop turns out.
+	defer tpv.removeMergedRecording()
+	// An error status means the recording was not saved. Stopping again
+	// would not save it either, so the session still counts as stopped.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("stopping %s session: %s: %s", tpv.Mode, resp.Status, proxyErrorMessage(body))
+	}
+
+	if !save {
+		tpv.resumed = nil
+		if tpv.Logger != nil {
+			tpv.Logger.Info("test proxy session discarded", "session", tpv)
+		}
+		return tpv.flushRecordingSpans()
+	}
+	if tpv.Mode == "record" {
+		if err := tpv.appendResumedRecording(); err != nil {
+			return err
+		}
+		if err := tpv.mergeIncrementalRecording(); err != nil {
+			return err
+		}
+		if err := tpv.writeRecordingMetadata(); err != nil {
+			return err
+		}
+		if err := tpv.writeWebSocketSessions(); err != nil {
+			return err
+		}
+		if err := tpv.sortRecordingArrays(); err != nil {
+			return err
+		}
+	}
+	if err := tpv.flushRecordingSpans(); err != nil {
+		return err
+	}
+	if tpv.AccessTracker != nil {
+		if err := tpv.AccessTracker.finish(tpv.CurrentRecordingPath); err != nil {
+			return err
+		}
+	}
+	if err := tpv.removeMergedRecording(); err != nil {
+		return err
+	}
+	if err := tpv.exportRemoteRecording(); err != nil {
+		return err
+	}
+	if err := tpv.compressRecording(); err != nil {
+		return err
+	}
+	if err := tpv.checkRecordingSize(); err != nil {
+		return err
+	}
+
+	if tpv.Logger != nil {
+		tpv.Logger.Info("test proxy session stopped", "session", tpv)
+	}
+	return nil
+}
+
+func setClientId(req *http.Request, tpv *TestProxyVariables) {
+	if tpv.ClientId != "" {
+		req.Header.Set(tpv.ProxyHeaders.withDefaults().RecordingClient, tpv.ClientId)
+	}
 }
@@ -0,0 +1,66 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// watchTrailers wraps the body of resp so that, once it has been read to
+// the end and the trailers are known, a *TrailerWarning is reported for
+// trailers playback will not reproduce. The trailers themselves are left on
+// resp.Trailer for the caller.
+func (tpv *TestProxyVariables) watchTrailers(resp *http.Response, mode, method, uri string) {
+	announced := map[string]bool{}
+	for name := range resp.Trailer {
+		announced[http.CanonicalHeaderKey(name)] = true
+	}
+	// A proxy that re-frames the response with a Content-Length keeps the
+	// upstream Trailer header but cannot send the trailers.
+	for _, value := range resp.Header.Values("Trailer") {
+		for _, name := range splitHeaderList(value) {
+			announced[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	if len(announced) == 0 && mode != "record" {
+		return
+	}
+	resp.Body = &trailerWatcher{ReadCloser: resp.Body, done: func() {
+		w := &TrailerWarning{Mode: mode, Method: method, URI: uri}
+		for name, values := range resp.Trailer {
+			if len(values) > 0 {
+				w.Trailers = append(w.Trailers, http.CanonicalHeaderKey(name))
+			}
+		}
+		for name := range announced {
+			if len(resp.Trailer.Values(name)) == 0 {
+				w.Dropped = append(w.Dropped, name)
+			}
+		}
+		sort.Strings(w.Trailers)
+		sort.Strings(w.Dropped)
+		if len(w.Dropped) > 0 || (mode == "record" && len(w.Trailers) > 0) {
+			tpv.warn(w)
+		}
+	}}
+}
+
+// trailerWatcher calls done once, when its body reaches EOF.
+type trailerWatcher struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (t *trailerWatcher) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if err == io.EOF {
+		t.once.Do(t.done)
+	}
+	return n, err
+}
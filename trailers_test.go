@@ -0,0 +1,220 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// proxyServer starts a TLS server standing in for the proxy and returns
+// variables for a session on it.
+func proxyServer(t *testing.T, mode string, handler http.HandlerFunc) (*httptest.Server, *TestProxyVariables) {
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, &TestProxyVariables{Host: u.Hostname(), Port: port, Mode: mode, RecordingId: "rec-1"}
+}
+
+// readTracker records whether the transport read the request body.
+type readTracker struct {
+	r    io.Reader
+	mu   sync.Mutex
+	read bool
+}
+
+func (rt *readTracker) Read(p []byte) (int, error) {
+	rt.mu.Lock()
+	rt.read = true
+	rt.mu.Unlock()
+	return rt.r.Read(p)
+}
+
+func (rt *readTracker) wasRead() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.read
+}
+
+func TestTransportExpectContinue(t *testing.T) {
+	srv, tpv := proxyServer(t, "record", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/container/too-large" {
+			// Answer without reading the body, so the server never sends
+			// 100 Continue.
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, "got "+string(body))
+	})
+	client := srv.Client()
+	client.Transport.(*http.Transport).ExpectContinueTimeout = time.Minute
+	tpt := tpv.Transport(client)
+
+	for _, tc := range []struct {
+		path     string
+		status   int
+		bodySent bool
+	}{
+		{"/container/too-large", http.StatusRequestEntityTooLarge, false},
+		{"/container/blob", http.StatusOK, true},
+	} {
+		body := &readTracker{r: strings.NewReader("block data")}
+		req, err := http.NewRequest("PUT", "https://account.blob.core.windows.net"+tc.path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = int64(len("block data"))
+		req.Header.Set("Expect", "100-continue")
+
+		start := time.Now()
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if time.Since(start) > 30*time.Second {
+			t.Errorf("%s: the transport waited for the continue timeout instead of the handshake", tc.path)
+		}
+		if resp.StatusCode != tc.status || body.wasRead() != tc.bodySent {
+			t.Errorf("%s: got status %d, body sent %v", tc.path, resp.StatusCode, body.wasRead())
+		}
+		if tc.bodySent && string(got) != "got block data" {
+			t.Errorf("%s: got %q", tc.path, got)
+		}
+	}
+}
+
+func TestTransportKeepsGetBodyOfReplacedBody(t *testing.T) {
+	srv, tpv := proxyServer(t, "record", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/Tables" {
+			http.Redirect(w, r, "/Tables/moved", http.StatusTemporaryRedirect)
+			return
+		}
+		io.WriteString(w, string(body))
+	})
+	tpt := tpv.Transport(srv.Client())
+	tpt.RequestDecorator = func(req *http.Request) {
+		req.Body = io.NopCloser(strings.NewReader(`{"TableName":"decorated"}`))
+	}
+
+	req, err := http.NewRequest("POST", "https://account.table.core.windows.net/Tables", strings.NewReader(`{"TableName":"original"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tpt.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if string(got) != `{"TableName":"decorated"}` {
+		t.Fatalf("redirected request sent body %s", got)
+	}
+}
+
+func TestTransportTrailers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		handler  http.HandlerFunc
+		trailer  string
+		warnings []TrailerWarning
+	}{
+		{
+			name: "record",
+			mode: "record",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "X-Checksum")
+				io.WriteString(w, "data")
+				w.Header().Set("X-Checksum", "abc")
+			},
+			trailer: "abc",
+			warnings: []TrailerWarning{{
+				Mode: "record", Method: "GET", URI: "https://account.blob.core.windows.net/container/blob",
+				Trailers: []string{"X-Checksum"},
+			}},
+		},
+		{
+			name: "playback",
+			mode: "playback",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "X-Checksum")
+				io.WriteString(w, "data")
+				w.Header().Set("X-Checksum", "abc")
+			},
+			trailer: "abc",
+		},
+		{
+			name: "dropped by proxy",
+			mode: "playback",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "X-Checksum")
+				w.Header().Set("Content-Length", "4")
+				io.WriteString(w, "data")
+			},
+			warnings: []TrailerWarning{{
+				Mode: "playback", Method: "GET", URI: "https://account.blob.core.windows.net/container/blob",
+				Dropped: []string{"X-Checksum"},
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, tpv := proxyServer(t, tc.mode, tc.handler)
+			var warnings []TrailerWarning
+			var exchanges []Exchange
+			tpv.Observer = Observer{
+				Exchange: func(e Exchange) { exchanges = append(exchanges, e) },
+				Warning: func(err error) {
+					var tw *TrailerWarning
+					if !errors.As(err, &tw) {
+						t.Errorf("unexpected warning %v", err)
+						return
+					}
+					warnings = append(warnings, *tw)
+				},
+			}
+
+			req, err := http.NewRequest("GET", "https://account.blob.core.windows.net/container/blob", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tpv.Transport(srv.Client()).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if string(body) != "data" || resp.Trailer.Get("X-Checksum") != tc.trailer {
+				t.Errorf("got body %q and trailer %q", body, resp.Trailer.Get("X-Checksum"))
+			}
+			if !reflect.DeepEqual(warnings, tc.warnings) {
+				t.Errorf("got warnings %+v, want %+v", warnings, tc.warnings)
+			}
+			if len(exchanges) != 1 || exchanges[0].URI != "https://account.blob.core.windows.net/container/blob" || exchanges[0].Response != resp {
+				t.Errorf("unexpected exchanges %+v", exchanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// uuidsVariable is the recording variable holding the UUIDs returned by
+// NewUUID in record mode, comma-separated in order.
+const uuidsVariable = "uuids"
+
+// uuidSequence is the state of NewUUID.
+type uuidSequence struct {
+	mu   sync.Mutex
+	next int
+}
+
+// resetUUIDs restarts NewUUID for a new session, dropping the UUIDs of a
+// previous record session. It is called by StartTestProxy.
+func (tpv *TestProxyVariables) resetUUIDs() {
+	tpv.uuids.mu.Lock()
+	defer tpv.uuids.mu.Unlock()
+	tpv.uuids.next = 0
+	if tpv.Mode == "record" {
+		delete(tpv.Variables, uuidsVariable)
+	}
+}
+
+// NewUUID returns a UUID for a value the client generates and the
+// service sees, such as a message ID or an idempotency key, which must be
+// the same in record and playback for requests to match. In record mode
+// it returns a random version 4 UUID and saves it in the recording's
+// variables; in playback it returns the saved UUIDs in the order they
+// were generated, and fails once they are used up. It is safe to call
+// concurrently, although UUIDs then only match if the calls happen in the
+// same order in record and playback.
+func (tpv *TestProxyVariables) NewUUID() (string, error) {
+	tpv.uuids.mu.Lock()
+	defer tpv.uuids.mu.Unlock()
+	index := tpv.uuids.next
+
+	if tpv.Mode == "playback" {
+		var recorded []string
+		if list := tpv.Variables[uuidsVariable]; list != "" {
+			recorded = strings.Split(list, ",")
+		}
+		if index >= len(recorded) {
+			return "", fmt.Errorf("UUID %d requested in playback, but only %d were recorded", index, len(recorded))
+		}
+		tpv.uuids.next++
+		return recorded[index], nil
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	uuid := formatUUID(b)
+	if tpv.Mode == "record" {
+		if tpv.Variables == nil {
+			tpv.Variables = map[string]string{}
+		}
+		if list := tpv.Variables[uuidsVariable]; list != "" {
+			tpv.Variables[uuidsVariable] = list + "," + uuid
+		} else {
+			tpv.Variables[uuidsVariable] = uuid
+		}
+	}
+	tpv.uuids.next++
+	return uuid, nil
+}
@@ -0,0 +1,89 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewUUID(t *testing.T) {
+	sp := newStubProxy(t)
+	record := sp.variables(t, "record")
+	if err := StartTestProxy(record); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	generated := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uuid, err := record.NewUUID()
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			generated[uuid] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if err := StopTestProxy(record); err != nil {
+		t.Fatal(err)
+	}
+
+	// The UUIDs are saved with the recording, in order.
+	requests := sp.Requests()
+	var saved map[string]string
+	if err := json.Unmarshal(requests[len(requests)-1].Body, &saved); err != nil {
+		t.Fatal(err)
+	}
+	recorded := strings.Split(saved[uuidsVariable], ",")
+	if len(recorded) != 20 || len(generated) != 20 {
+		t.Fatalf("got %d recorded and %d unique UUIDs, want 20", len(recorded), len(generated))
+	}
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, uuid := range recorded {
+		if !generated[uuid] || !uuidPattern.MatchString(uuid) {
+			t.Errorf("recorded %q", uuid)
+		}
+	}
+
+	// Playback returns the recorded UUIDs in order, then fails.
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != "/playback/start" {
+			return false
+		}
+		w.Header().Set("x-recording-id", "stub-recording-id")
+		w.Write(requests[len(requests)-1].Body)
+		return true
+	}
+	playback := sp.variables(t, "playback")
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range recorded {
+		if uuid, err := playback.NewUUID(); err != nil || uuid != want {
+			t.Fatalf("UUID %d is %q, %v in playback, want %q", i, uuid, err, want)
+		}
+	}
+	if _, err := playback.NewUUID(); err == nil || err.Error() != "UUID 20 requested in playback, but only 20 were recorded" {
+		t.Errorf("got error %v once the UUIDs are used up", err)
+	}
+
+	// A new session starts from the first UUID again.
+	if err := StartTestProxy(playback); err != nil {
+		t.Fatal(err)
+	}
+	if uuid, err := playback.NewUUID(); err != nil || uuid != recorded[0] {
+		t.Errorf("got %q, %v in a new session, want %q", uuid, err, recorded[0])
+	}
+}
@@ -0,0 +1,199 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidationIssue is a structural problem found in a recording file.
+type ValidationIssue struct {
+	File string
+	// Path locates the problem within the document, e.g.
+	// "Entries[3].ResponseHeaders".
+	Path    string
+	Message string
+}
+
+func (vi ValidationIssue) String() string {
+	if vi.Path == "" {
+		return fmt.Sprintf("%s: %s", vi.File, vi.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", vi.File, vi.Path, vi.Message)
+}
+
+// ValidateRecording checks that the file at path has the shape the test
+// proxy expects, so hand edits and bad merges are caught with a precise
+// location instead of an opaque error from the proxy at playback time.
+// It returns nil when the recording is valid.
+func ValidateRecording(path string) []ValidationIssue {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+	return validateRecordingData(path, data)
+}
+
+// validateRecordingData is ValidateRecording for the contents of the
+// recording at path.
+func validateRecordingData(path string, data []byte) []ValidationIssue {
+	var issues []ValidationIssue
+	report := func(at, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{File: path, Path: at, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		report("", "not a JSON object: %v", err)
+		return issues
+	}
+
+	if vars, ok := doc["Variables"]; ok {
+		validateStringMap(vars, "Variables", false, report)
+	}
+
+	rawEntries, ok := doc["Entries"]
+	if !ok {
+		report("Entries", "missing")
+		return issues
+	}
+	entries, ok := rawEntries.([]interface{})
+	if !ok {
+		report("Entries", "must be an array")
+		return issues
+	}
+
+	for i, raw := range entries {
+		at := fmt.Sprintf("Entries[%d]", i)
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			report(at, "must be an object")
+			continue
+		}
+
+		if uri, ok := entry["RequestUri"].(string); !ok || uri == "" {
+			report(at+".RequestUri", "missing or not a string")
+		} else if u, err := url.Parse(uri); err != nil || !u.IsAbs() {
+			report(at+".RequestUri", "not an absolute URI: %q", uri)
+		}
+		if method, ok := entry["RequestMethod"].(string); !ok || method == "" {
+			report(at+".RequestMethod", "missing or not a string")
+		}
+		if status, ok := entry["StatusCode"].(float64); !ok {
+			report(at+".StatusCode", "missing or not a number")
+		} else if status != float64(int(status)) || status < 100 || status > 599 {
+			report(at+".StatusCode", "not a valid HTTP status: %v", status)
+		}
+
+		for _, side := range []string{"Request", "Response"} {
+			headers, ok := entry[side+"Headers"]
+			if !ok {
+				report(at+"."+side+"Headers", "missing")
+				continue
+			}
+			contentType := validateStringMap(headers, at+"."+side+"Headers", true, report)
+			validateBody(entry[side+"Body"], contentType, at+"."+side+"Body", report)
+		}
+	}
+
+	return issues
+}
+
+// ValidateRecordingsDir runs ValidateRecording on every recording under
+// dir, for use as a CI gate. JSON objects without Entries, such as
+// assets.json or golden files, are not recordings and are skipped; files
+// that are not JSON objects at all are reported. It returns an error only
+// if dir cannot be walked; problems in the recordings are returned as
+// issues.
+func ValidateRecordingsDir(dir string) ([]ValidationIssue, error) {
+	var issues []ValidationIssue
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			issues = append(issues, ValidationIssue{File: path, Message: err.Error()})
+			return nil
+		}
+		var doc map[string]json.RawMessage
+		if json.Unmarshal(data, &doc) == nil {
+			if _, ok := doc["Entries"]; !ok {
+				return nil
+			}
+		}
+		issues = append(issues, validateRecordingData(path, data)...)
+		return nil
+	})
+	return issues, err
+}
+
+// validateStringMap checks that v is an object of strings (or, for headers,
+// of strings or string arrays) and returns the Content-Type value, if any.
+func validateStringMap(v interface{}, at string, allowArrays bool, report func(at, format string, args ...interface{})) string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		if v != nil {
+			report(at, "must be an object")
+		}
+		return ""
+	}
+	contentType := ""
+	for name, value := range m {
+		switch value := value.(type) {
+		case string:
+			if strings.EqualFold(name, "Content-Type") {
+				contentType = value
+			}
+		case []interface{}:
+			if !allowArrays {
+				report(at+"."+name, "must be a string")
+				continue
+			}
+			for _, item := range value {
+				if _, ok := item.(string); !ok {
+					report(at+"."+name, "must be a string or an array of strings")
+					break
+				}
+			}
+		default:
+			if allowArrays {
+				report(at+"."+name, "must be a string or an array of strings")
+			} else {
+				report(at+"."+name, "must be a string")
+			}
+		}
+	}
+	return contentType
+}
+
+// validateBody checks that a body is stored the way the proxy stores bodies
+// of the given content type: JSON values only for JSON content, and base64
+// strings for binary content.
+func validateBody(body interface{}, contentType, at string, report func(at, format string, args ...interface{})) {
+	switch body := body.(type) {
+	case nil:
+	case string:
+		if contentType != "" && !isTextContentType(contentType) {
+			if _, err := base64.StdEncoding.DecodeString(body); err != nil {
+				report(at, "binary body for Content-Type %q is not valid base64", contentType)
+			}
+		}
+	default:
+		if !isJSONContentType(contentType) {
+			report(at, "JSON body stored for Content-Type %q", contentType)
+		}
+	}
+}
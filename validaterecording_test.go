@@ -0,0 +1,99 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRecordingValid(t *testing.T) {
+	for _, path := range []string{
+		"recordings/TestCosmosDBTables.json",
+		"testdata/listrecordings/TestValid.json",
+		"testdata/har/binary.json",
+	} {
+		if issues := ValidateRecording(path); len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", path, issues)
+		}
+	}
+}
+
+func TestValidateRecordingCorrupted(t *testing.T) {
+	const entry = `{"RequestUri": "https://example.com/a", "RequestMethod": "GET", "RequestHeaders": {}, "RequestBody": null, "StatusCode": 200, "ResponseHeaders": {}, "ResponseBody": null}`
+
+	tests := []struct {
+		name     string
+		content  string
+		wantPath string
+		wantMsg  string
+	}{
+		{"not json", `{"Entries": [`, "", "not a JSON object"},
+		{"no entries", `{"Variables": {}}`, "Entries", "missing"},
+		{"entries not array", `{"Entries": {}}`, "Entries", "must be an array"},
+		{"missing uri", `{"Entries": [` + entry + `, {"RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 200, "ResponseHeaders": {}}]}`, "Entries[1].RequestUri", "missing"},
+		{"relative uri", `{"Entries": [{"RequestUri": "/a", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 200, "ResponseHeaders": {}}]}`, "Entries[0].RequestUri", "not an absolute URI"},
+		{"missing method", `{"Entries": [{"RequestUri": "https://example.com", "RequestHeaders": {}, "StatusCode": 200, "ResponseHeaders": {}}]}`, "Entries[0].RequestMethod", "missing"},
+		{"bad status", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": "OK", "ResponseHeaders": {}}]}`, "Entries[0].StatusCode", "not a number"},
+		{"status out of range", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 42, "ResponseHeaders": {}}]}`, "Entries[0].StatusCode", "not a valid HTTP status"},
+		{"missing response headers", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 200}]}`, "Entries[0].ResponseHeaders", "missing"},
+		{"numeric header", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 200, "ResponseHeaders": {"Content-Length": 12}}]}`, "Entries[0].ResponseHeaders.Content-Length", "string or an array"},
+		{"binary body not base64", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "PUT", "RequestHeaders": {"Content-Type": "application/octet-stream"}, "RequestBody": "not base64!", "StatusCode": 201, "ResponseHeaders": {}}]}`, "Entries[0].RequestBody", "not valid base64"},
+		{"json body for text", `{"Entries": [{"RequestUri": "https://example.com", "RequestMethod": "GET", "RequestHeaders": {}, "StatusCode": 200, "ResponseHeaders": {"Content-Type": "text/plain"}, "ResponseBody": {"a": 1}}]}`, "Entries[0].ResponseBody", "JSON body stored"},
+		{"non-string variable", `{"Entries": [], "Variables": {"seed": 42}}`, "Variables.seed", "must be a string"},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_")+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			issues := ValidateRecording(path)
+			for _, issue := range issues {
+				if issue.Path == tt.wantPath && strings.Contains(issue.Message, tt.wantMsg) {
+					return
+				}
+			}
+			t.Fatalf("no issue at %q containing %q, got %v", tt.wantPath, tt.wantMsg, issues)
+		})
+	}
+
+	// Other JSON files are not recordings, and neither is the test case
+	// without Entries.
+	for name, content := range map[string]string{
+		"assets.json":           `{"AssetsRepo": "Azure/azure-sdk-assets", "Tag": "go/tables_1"}`,
+		".recording_index.json": `{"TestA": "recordings/TestA.json"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues, err := ValidateRecordingsDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) < len(tests)-1 {
+		t.Fatalf("directory validation found %d issues, want at least %d", len(issues), len(tests)-1)
+	}
+	for _, issue := range issues {
+		if base := filepath.Base(issue.File); base == "assets.json" || base == ".recording_index.json" || base == "no_entries.json" {
+			t.Errorf("validated %s, which is not a recording: %v", base, issue)
+		}
+	}
+}
+
+func TestValidateRecordingsDirValid(t *testing.T) {
+	issues, err := ValidateRecordingsDir("recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+}
@@ -0,0 +1,139 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// VerifyOption configures VerifyRecording.
+type VerifyOption func(o *verifyOptions)
+
+type verifyOptions struct {
+	keep bool
+}
+
+// KeepVerifiedRecording has VerifyRecording record to the session's
+// CurrentRecordingPath, replacing its recording, instead of a temporary
+// file that is removed afterwards.
+func KeepVerifiedRecording() VerifyOption {
+	return func(o *verifyOptions) { o.keep = true }
+}
+
+// VerifyRecording checks that testFn is deterministic enough to be played
+// back: it runs testFn in a record session on a clone of tpv, then at once
+// in a playback session of the recording just saved, and reports with
+// t.Errorf when the playback run fails or does not send the same
+// requests, compared by method and path, in the same order. testFn gets
+// client options routed through the session in which it runs.
+//
+// The recording is saved next to CurrentRecordingPath as
+// <name>.verify.json, where the proxy can write it, and removed
+// afterwards; see KeepVerifiedRecording.
+func VerifyRecording(t testing.TB, tpv *TestProxyVariables, testFn func(opts *arm.ClientOptions) error, opts ...VerifyOption) {
+	t.Helper()
+	var o verifyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	path := tpv.CurrentRecordingPath
+	if !o.keep {
+		path = strings.TrimSuffix(path, ".json") + ".verify.json"
+		defer os.Remove(path)
+	}
+
+	recorded, err := runTranscribed(tpv, "record", path, testFn)
+	if err != nil {
+		t.Errorf("verifying %s: recording: %v", tpv.CurrentRecordingPath, err)
+		return
+	}
+	played, err := runTranscribed(tpv, "playback", path, testFn)
+	if err != nil {
+		t.Errorf("verifying %s: playback: %v", tpv.CurrentRecordingPath, err)
+	}
+	for _, divergence := range diffTranscripts(recorded, played) {
+		t.Errorf("verifying %s: %s", tpv.CurrentRecordingPath, divergence)
+	}
+}
+
+// runTranscribed runs testFn in a session of a clone of tpv in mode, and
+// returns the method and path of the requests it sent, in order. The
+// recording is discarded when testFn fails.
+func runTranscribed(tpv *TestProxyVariables, mode, path string, testFn func(opts *arm.ClientOptions) error) ([]string, error) {
+	session := tpv.Clone()
+	session.Mode = mode
+	session.CurrentRecordingPath = path
+	var mu sync.Mutex
+	var transcript []string
+	observe := tpv.Observer.Exchange
+	session.Observer.Exchange = func(e Exchange) {
+		request := e.Request.Method + " " + e.URI
+		if u, err := url.Parse(e.URI); err == nil {
+			request = e.Request.Method + " " + u.Path
+		}
+		mu.Lock()
+		transcript = append(transcript, request)
+		mu.Unlock()
+		if observe != nil {
+			observe(e)
+		}
+	}
+
+	if err := StartTestProxy(session); err != nil {
+		return nil, err
+	}
+	if err := testFn(&arm.ClientOptions{ClientOptions: session.ClientOptions()}); err != nil {
+		if stopErr := stopTestProxy(session, false); stopErr != nil {
+			return nil, fmt.Errorf("%w; stopping the session: %v", err, stopErr)
+		}
+		return transcript, err
+	}
+	return transcript, StopTestProxy(session)
+}
+
+// diffTranscripts describes how the playback transcript differs from the
+// recorded one, by request index, and the request counts that differ.
+func diffTranscripts(recorded, played []string) []string {
+	var divergences []string
+	for i := 0; i < len(recorded) || i < len(played); i++ {
+		switch {
+		case i >= len(played):
+			divergences = append(divergences, fmt.Sprintf("request %d: recorded %s, not sent in playback", i, recorded[i]))
+		case i >= len(recorded):
+			divergences = append(divergences, fmt.Sprintf("request %d: playback sent %s, not recorded", i, played[i]))
+		case recorded[i] != played[i]:
+			divergences = append(divergences, fmt.Sprintf("request %d: recorded %s, playback sent %s", i, recorded[i], played[i]))
+		}
+	}
+	if len(divergences) == 0 {
+		return nil
+	}
+
+	counts := map[string][2]int{}
+	var order []string
+	for run, transcript := range [][]string{recorded, played} {
+		for _, request := range transcript {
+			c, ok := counts[request]
+			if !ok {
+				order = append(order, request)
+			}
+			c[run]++
+			counts[request] = c
+		}
+	}
+	for _, request := range order {
+		if c := counts[request]; c[0] != c[1] {
+			divergences = append(divergences, fmt.Sprintf("%s: recorded %d times, sent %d times in playback", request, c[0], c[1]))
+		}
+	}
+	return divergences
+}
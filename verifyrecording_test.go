@@ -0,0 +1,108 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+func TestVerifyRecording(t *testing.T) {
+	// The stub saves a recording to the file each record session names.
+	sp := newStubProxy(t)
+	var mu sync.Mutex
+	var file string
+	sp.handle = func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		requests := sp.Requests()
+		switch r.URL.Path {
+		case "/record/start":
+			var body map[string]string
+			json.Unmarshal(requests[len(requests)-1].Body, &body)
+			file = body["x-recording-file"]
+		case "/record/stop":
+			(&RecordingFile{}).WriteFile(file)
+		}
+		return false
+	}
+	path := filepath.Join(t.TempDir(), "TestVerifyRecording.json")
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = path
+
+	get := func(opts *arm.ClientOptions, uri string) error {
+		req, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := opts.Transport.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	deterministic := func(opts *arm.ClientOptions) error {
+		if err := get(opts, "https://example.com/tables"); err != nil {
+			return err
+		}
+		return get(opts, "https://example.com/tables/products?timeout=30")
+	}
+	runs := 0
+	nondeterministic := func(opts *arm.ClientOptions) error {
+		runs++
+		if err := get(opts, fmt.Sprintf("https://example.com/tables/t%d", runs)); err != nil {
+			return err
+		}
+		if runs == 1 {
+			return get(opts, "https://example.com/tables")
+		}
+		return nil
+	}
+
+	r := &errorRecorder{TB: t}
+	VerifyRecording(r, tpv, deterministic)
+	if len(r.errors) != 0 {
+		t.Errorf("got errors %q for a deterministic test", r.errors)
+	}
+	if file != strings.TrimSuffix(path, ".json")+".verify.json" {
+		t.Errorf("recorded to %s", file)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the temporary recording was not removed: %v", err)
+	}
+
+	r = &errorRecorder{TB: t}
+	VerifyRecording(r, tpv, nondeterministic)
+	want := []string{
+		"request 0: recorded GET /tables/t1, playback sent GET /tables/t2",
+		"request 1: recorded GET /tables, not sent in playback",
+		"GET /tables/t1: recorded 1 times, sent 0 times in playback",
+		"GET /tables: recorded 1 times, sent 0 times in playback",
+		"GET /tables/t2: recorded 0 times, sent 1 times in playback",
+	}
+	if len(r.errors) != len(want) {
+		t.Fatalf("got errors %q, want %q", r.errors, want)
+	}
+	for i, w := range want {
+		if !strings.HasSuffix(r.errors[i], w) {
+			t.Errorf("error %d is %q, want %q", i, r.errors[i], w)
+		}
+	}
+
+	// KeepVerifiedRecording records to the session's recording.
+	r = &errorRecorder{TB: t}
+	VerifyRecording(r, tpv, deterministic, KeepVerifiedRecording())
+	if _, err := os.Stat(path); len(r.errors) != 0 || file != path || err != nil {
+		t.Errorf("got errors %q, recorded to %s: %v", r.errors, file, err)
+	}
+}
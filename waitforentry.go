@@ -0,0 +1,79 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// servedEntries are the requests the proxy has answered in the current
+// session, for WaitForEntry.
+type servedEntries struct {
+	mu      sync.Mutex
+	entries []servedEntry
+	// changed is closed, and replaced, whenever an entry is added.
+	changed chan struct{}
+}
+
+type servedEntry struct {
+	method string
+	uri    string
+}
+
+// serve records an exchange the proxy answered.
+func (s *servedEntries) serve(method, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, servedEntry{method, uri})
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+func (s *servedEntries) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+}
+
+// WaitForEntry blocks until the proxy has answered a request made through
+// Transport with the given method, compared case-insensitively, and a URL
+// matching the regular expression uriPattern, or until ctx is done. Requests
+// answered since the session started count, so it returns at once if the
+// entry was served before it was called. Use it instead of time.Sleep to
+// wait for requests made by other goroutines.
+func (tpv *TestProxyVariables) WaitForEntry(ctx context.Context, method, uriPattern string) error {
+	pattern, err := regexp.Compile(uriPattern)
+	if err != nil {
+		return err
+	}
+	checked := 0
+	for {
+		tpv.served.mu.Lock()
+		for ; checked < len(tpv.served.entries); checked++ {
+			e := tpv.served.entries[checked]
+			if strings.EqualFold(e.method, method) && pattern.MatchString(e.uri) {
+				tpv.served.mu.Unlock()
+				return nil
+			}
+		}
+		if tpv.served.changed == nil {
+			tpv.served.changed = make(chan struct{})
+		}
+		changed := tpv.served.changed
+		tpv.served.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s %s: %w", method, uriPattern, ctx.Err())
+		}
+	}
+}
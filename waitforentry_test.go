@@ -0,0 +1,65 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForEntry(t *testing.T) {
+	sp := newStubProxy(t)
+	tpv := sp.variables(t, "playback")
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	tpt := tpv.Transport(sp.Client())
+
+	send := func(method, uri string) {
+		req, err := http.NewRequest(method, uri, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := tpt.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}
+
+	// Served by another goroutine while waiting.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		send("GET", "https://account.table.core.windows.net/Tables('products')")
+		time.Sleep(20 * time.Millisecond)
+		send("DELETE", "https://account.table.core.windows.net/Tables('products')")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tpv.WaitForEntry(ctx, "delete", `/Tables\('products'\)$`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Served before waiting.
+	if err := tpv.WaitForEntry(ctx, "GET", `Tables\('products'\)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Never served.
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if err := tpv.WaitForEntry(short, "POST", `/Tables$`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+
+	if err := tpv.WaitForEntry(ctx, "GET", `(`); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,403 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// The test proxy only records request/response pairs, so WebSocket
+// connections, e.g. to Event Grid or Notification Hubs, do not go through
+// it. DialWebSocket connects to the service directly and, when recording,
+// keeps the messages exchanged on each connection. StopTestProxy stores
+// them under the recording's top-level "WebSocketSessions" key, and
+// connections dialed in playback replay them without a network connection.
+
+// WebSocket modes for TestProxyVariables.WebSocketMode.
+const (
+	WebSocketRecord      = "record"
+	WebSocketPlayback    = "playback"
+	WebSocketPassthrough = "passthrough"
+)
+
+// WSFrame is a message sent or received on a WebSocket connection.
+type WSFrame struct {
+	// Type is "text" or "binary".
+	Type string
+	// Sent is true for messages the client sent.
+	Sent    bool
+	Payload []byte
+}
+
+// MarshalJSON writes text payloads as strings, so they can be read and
+// reviewed in the recording, and binary payloads base64-encoded.
+func (f WSFrame) MarshalJSON() ([]byte, error) {
+	payload := string(f.Payload)
+	if f.Type != "text" {
+		payload = base64.StdEncoding.EncodeToString(f.Payload)
+	}
+	return marshalNoEscape(struct {
+		Type    string
+		Sent    bool
+		Payload string
+	}{f.Type, f.Sent, payload})
+}
+
+func (f *WSFrame) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    string
+		Sent    bool
+		Payload string
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = WSFrame{Type: raw.Type, Sent: raw.Sent, Payload: []byte(raw.Payload)}
+	if raw.Type != "text" {
+		payload, err := base64.StdEncoding.DecodeString(raw.Payload)
+		if err != nil {
+			return fmt.Errorf("WebSocket frame payload: %w", err)
+		}
+		f.Payload = payload
+	}
+	return nil
+}
+
+// WebSocketSession is the messages exchanged on one WebSocket connection,
+// in order.
+type WebSocketSession struct {
+	URL    string
+	Frames []WSFrame
+}
+
+// WebSocketSessions returns the connections stored in the recording, in
+// the order they were dialed.
+func (rf *RecordingFile) WebSocketSessions() []WebSocketSession {
+	var sessions []WebSocketSession
+	rf.getExtra("WebSocketSessions", &sessions)
+	return sessions
+}
+
+// SetWebSocketSessions replaces the connections stored in the recording.
+func (rf *RecordingFile) SetWebSocketSessions(sessions []WebSocketSession) error {
+	if len(sessions) == 0 {
+		return rf.setExtra("WebSocketSessions", nil)
+	}
+	return rf.setExtra("WebSocketSessions", sessions)
+}
+
+// webSocketState holds the connections of the current session.
+type webSocketState struct {
+	mu       sync.Mutex
+	recorded []*recordedWebSocket
+	// playback holds the recorded connections, once loaded, and next the
+	// index of the one the next dial replays.
+	playback []WebSocketSession
+	loaded   bool
+	next     int
+}
+
+type recordedWebSocket struct {
+	mu      sync.Mutex
+	session WebSocketSession
+}
+
+func (tpv *TestProxyVariables) webSocketMode() string {
+	if tpv.WebSocketMode != "" {
+		return tpv.WebSocketMode
+	}
+	switch tpv.Mode {
+	case "record":
+		return WebSocketRecord
+	case "playback":
+		return WebSocketPlayback
+	}
+	return WebSocketPassthrough
+}
+
+// WebSocketConn is a WebSocket connection dialed with DialWebSocket.
+type WebSocketConn struct {
+	// conn is nil in playback.
+	conn     *websocket.Conn
+	recorded *recordedWebSocket
+
+	mu       sync.Mutex
+	changed  *sync.Cond
+	frames   []WSFrame
+	sent     int
+	nextSend int
+	nextRecv int
+	closed   bool
+}
+
+// DialWebSocket opens a WebSocket connection for the session according to
+// WebSocketMode. In playback, the connections recorded for the session are
+// replayed in the order they were dialed, and config must name the same
+// URL as the recorded connection.
+func (tpv *TestProxyVariables) DialWebSocket(config *websocket.Config) (*WebSocketConn, error) {
+	mode := tpv.webSocketMode()
+	switch mode {
+	case WebSocketRecord, WebSocketPassthrough:
+		conn, err := websocket.DialConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		c := &WebSocketConn{conn: conn}
+		if mode == WebSocketRecord {
+			c.recorded = &recordedWebSocket{session: WebSocketSession{URL: config.Location.String()}}
+			tpv.ws.mu.Lock()
+			tpv.ws.recorded = append(tpv.ws.recorded, c.recorded)
+			tpv.ws.mu.Unlock()
+		}
+		return c, nil
+	case WebSocketPlayback:
+		session, err := tpv.nextPlaybackWebSocket(config.Location.String())
+		if err != nil {
+			return nil, err
+		}
+		c := &WebSocketConn{frames: session.Frames}
+		c.changed = sync.NewCond(&c.mu)
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown WebSocketMode %q", mode)
+}
+
+func (tpv *TestProxyVariables) nextPlaybackWebSocket(url string) (WebSocketSession, error) {
+	tpv.ws.mu.Lock()
+	defer tpv.ws.mu.Unlock()
+	if !tpv.ws.loaded {
+		rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+		if err != nil {
+			return WebSocketSession{}, err
+		}
+		tpv.ws.playback = rec.WebSocketSessions()
+		tpv.ws.loaded = true
+	}
+	if tpv.ws.next >= len(tpv.ws.playback) {
+		return WebSocketSession{}, fmt.Errorf("%s: no recorded WebSocket connection left for %s", tpv.CurrentRecordingPath, url)
+	}
+	session := tpv.ws.playback[tpv.ws.next]
+	if session.URL != url {
+		return WebSocketSession{}, fmt.Errorf("%s: WebSocket connection %d was recorded for %s, not %s",
+			tpv.CurrentRecordingPath, tpv.ws.next, session.URL, url)
+	}
+	tpv.ws.next++
+	return session, nil
+}
+
+// frameCodec sends and receives whole messages as WSFrames.
+var frameCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		f := v.(WSFrame)
+		if f.Type == "text" {
+			return f.Payload, websocket.TextFrame, nil
+		}
+		return f.Payload, websocket.BinaryFrame, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		f := v.(*WSFrame)
+		f.Type = "binary"
+		if payloadType == websocket.TextFrame {
+			f.Type = "text"
+		}
+		f.Payload = data
+		return nil
+	},
+}
+
+// SendText sends a text message.
+func (c *WebSocketConn) SendText(text string) error {
+	return c.send(WSFrame{Type: "text", Sent: true, Payload: []byte(text)})
+}
+
+// SendBinary sends a binary message.
+func (c *WebSocketConn) SendBinary(data []byte) error {
+	return c.send(WSFrame{Type: "binary", Sent: true, Payload: data})
+}
+
+func (c *WebSocketConn) send(f WSFrame) error {
+	if c.conn != nil {
+		if err := frameCodec.Send(c.conn, f); err != nil {
+			return err
+		}
+		c.record(f)
+		return nil
+	}
+
+	// In playback, the message must be the next one the client sent when
+	// recording.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	for ; c.nextSend < len(c.frames); c.nextSend++ {
+		if c.frames[c.nextSend].Sent {
+			break
+		}
+	}
+	if c.nextSend == len(c.frames) {
+		return fmt.Errorf("WebSocket message %d was not sent when recording", c.sent)
+	}
+	if want := c.frames[c.nextSend]; want.Type != f.Type || !bytes.Equal(want.Payload, f.Payload) {
+		return fmt.Errorf("WebSocket message %d differs from the recording: got %s %q, want %s %q",
+			c.sent, f.Type, f.Payload, want.Type, want.Payload)
+	}
+	c.nextSend++
+	c.sent++
+	c.changed.Broadcast()
+	return nil
+}
+
+// Receive returns the next message from the server. In playback, a
+// recorded message is returned once the client has sent every message it
+// sent before receiving it when recording, and io.EOF once all recorded
+// messages have been received.
+func (c *WebSocketConn) Receive() (WSFrame, error) {
+	if c.conn != nil {
+		var f WSFrame
+		if err := frameCodec.Receive(c.conn, &f); err != nil {
+			return WSFrame{}, err
+		}
+		c.record(f)
+		return f, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ; c.nextRecv < len(c.frames); c.nextRecv++ {
+		if !c.frames[c.nextRecv].Sent {
+			break
+		}
+	}
+	if c.nextRecv == len(c.frames) {
+		return WSFrame{}, io.EOF
+	}
+	sentBefore := 0
+	for _, f := range c.frames[:c.nextRecv] {
+		if f.Sent {
+			sentBefore++
+		}
+	}
+	for c.sent < sentBefore && !c.closed {
+		c.changed.Wait()
+	}
+	if c.closed {
+		return WSFrame{}, net.ErrClosed
+	}
+	f := c.frames[c.nextRecv]
+	c.nextRecv++
+	return f, nil
+}
+
+func (c *WebSocketConn) record(f WSFrame) {
+	if c.recorded == nil {
+		return
+	}
+	c.recorded.mu.Lock()
+	defer c.recorded.mu.Unlock()
+	c.recorded.session.Frames = append(c.recorded.session.Frames, f)
+}
+
+// Close closes the connection. In playback, it unblocks pending calls to
+// Receive.
+func (c *WebSocketConn) Close() error {
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.changed.Broadcast()
+	return nil
+}
+
+// writeWebSocketSessions stores the connections recorded in the session in
+// the recording the proxy saved. It is called by StopTestProxy in record
+// mode.
+func (tpv *TestProxyVariables) writeWebSocketSessions() error {
+	tpv.ws.mu.Lock()
+	recorded := tpv.ws.recorded
+	tpv.ws.mu.Unlock()
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	sessions := make([]WebSocketSession, len(recorded))
+	for i, r := range recorded {
+		r.mu.Lock()
+		sessions[i] = r.session
+		r.mu.Unlock()
+	}
+	rec, err := ReadRecordingFile(tpv.CurrentRecordingPath)
+	if err != nil {
+		return err
+	}
+	if err := rec.SetWebSocketSessions(sessions); err != nil {
+		return err
+	}
+	return rec.WriteFile(tpv.CurrentRecordingPath)
+}
+
+// resetWebSockets forgets the connections of the previous session. It is
+// called by StartTestProxy.
+func (tpv *TestProxyVariables) resetWebSockets() {
+	tpv.ws.mu.Lock()
+	defer tpv.ws.mu.Unlock()
+	tpv.ws.recorded, tpv.ws.playback, tpv.ws.loaded, tpv.ws.next = nil, nil, false, 0
+}
+
+// upgradeProtocols returns the protocols req asks to switch to, or nil
+// when req is an ordinary request. An upgrade needs both the Upgrade header
+// and the "upgrade" token in Connection, so an Upgrade header that a proxy
+// or client left on an ordinary request, or "upgrade" in other headers,
+// does not count.
+func upgradeProtocols(req *http.Request) []string {
+	connectionUpgrade := false
+	for _, value := range req.Header.Values("Connection") {
+		for _, token := range splitHeaderList(value) {
+			if strings.EqualFold(token, "upgrade") {
+				connectionUpgrade = true
+			}
+		}
+	}
+	if !connectionUpgrade {
+		return nil
+	}
+	var protocols []string
+	for _, value := range req.Header.Values("Upgrade") {
+		protocols = append(protocols, splitHeaderList(value)...)
+	}
+	return protocols
+}
+
+// isWebSocketUpgrade reports whether req asks to switch to the WebSocket
+// protocol.
+func isWebSocketUpgrade(req *http.Request) bool {
+	for _, protocol := range upgradeProtocols(req) {
+		if strings.EqualFold(protocol, "websocket") {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUpgradeNotSupported is returned, wrapped, by Do for requests that ask
+// to upgrade the connection, e.g. to WebSocket, whose traffic the test
+// proxy cannot record.
+var ErrUpgradeNotSupported = errors.New("the test proxy cannot record upgraded connections such as WebSockets; " +
+	"send the request with a Live context or add its host to ExcludedHosts to reach the service directly, " +
+	"dial WebSockets with TestProxyVariables.DialWebSocket, or set WebSocketMode to passthrough")
@@ -0,0 +1,216 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// eventServer greets each connection, then echoes text messages in upper
+// case and binary messages reversed.
+func eventServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		frameCodec.Send(ws, WSFrame{Type: "text", Payload: []byte("welcome")})
+		for {
+			var f WSFrame
+			if err := frameCodec.Receive(ws, &f); err != nil {
+				return
+			}
+			if f.Type == "text" {
+				f.Payload = bytes.ToUpper(f.Payload)
+			} else {
+				for i, j := 0, len(f.Payload)-1; i < j; i, j = i+1, j-1 {
+					f.Payload[i], f.Payload[j] = f.Payload[j], f.Payload[i]
+				}
+			}
+			frameCodec.Send(ws, f)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func wantFrame(t *testing.T, c *WebSocketConn, typ, payload string) {
+	t.Helper()
+	f, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != typ || string(f.Payload) != payload || f.Sent {
+		t.Fatalf("got %s %q, want %s %q", f.Type, f.Payload, typ, payload)
+	}
+}
+
+func TestWebSocketRecordAndPlayback(t *testing.T) {
+	srv := eventServer(t)
+	config, err := websocket.NewConfig(strings.Replace(srv.URL, "http", "ws", 1)+"/events", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := newStubProxy(t)
+	recording := filepath.Join(t.TempDir(), "TestEvents.json")
+
+	// Record, with the stub standing in for the proxy saving the recording.
+	tpv := sp.variables(t, "record")
+	tpv.CurrentRecordingPath = recording
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	c, err := tpv.DialWebSocket(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrame(t, c, "text", "welcome")
+	if err := c.SendText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	wantFrame(t, c, "text", "HELLO")
+	if err := c.SendBinary([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	wantFrame(t, c, "binary", "\x03\x02\x01")
+	c.Close()
+	if err := (&RecordingFile{}).WriteFile(recording); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Payload": "hello"`, `"Payload": "AQID"`, `"URL": "` + config.Location.String() + `"`} {
+		if !bytes.Contains(saved, []byte(want)) {
+			t.Errorf("recording is missing %s:\n%s", want, saved)
+		}
+	}
+
+	// Play back without the service.
+	srv.Close()
+	tpv = sp.variables(t, "playback")
+	tpv.CurrentRecordingPath = recording
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+	c, err = tpv.DialWebSocket(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrame(t, c, "text", "welcome")
+
+	// HELLO was received after hello was sent, so it waits for the send.
+	received := make(chan WSFrame)
+	go func() {
+		f, _ := c.Receive()
+		received <- f
+	}()
+	select {
+	case f := <-received:
+		t.Fatalf("received %q before sending hello", f.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := c.SendText("goodbye"); err == nil {
+		t.Fatal("expected a message that differs from the recording to fail")
+	}
+	if err := c.SendText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if f := <-received; string(f.Payload) != "HELLO" {
+		t.Fatalf("got %q", f.Payload)
+	}
+	if err := c.SendBinary([]byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	wantFrame(t, c, "binary", "\x03\x02\x01")
+	if _, err := c.Receive(); err != io.EOF {
+		t.Fatalf("got %v after the recorded messages, want io.EOF", err)
+	}
+
+	other, _ := websocket.NewConfig("ws://localhost/other", "http://localhost/")
+	if _, err := tpv.DialWebSocket(other); err == nil {
+		t.Fatal("expected an error for a connection that was not recorded")
+	}
+}
+
+func TestTransportWebSocketUpgrade(t *testing.T) {
+	for mode, wantErr := range map[string]bool{
+		"":                   true,
+		WebSocketPassthrough: false,
+	} {
+		var passedThrough bool
+		tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: "record", WebSocketMode: mode}
+		tpv.UpstreamTransport = transporterFunc(func(req *http.Request) (*http.Response, error) {
+			passedThrough = req.URL.Host == "account.servicebus.windows.net" && req.Header.Get("Upgrade") == "websocket"
+			return &http.Response{StatusCode: http.StatusSwitchingProtocols, Body: http.NoBody}, nil
+		})
+		tpt := tpv.Transport(transporterFunc(func(req *http.Request) (*http.Response, error) {
+			t.Errorf("WebSocketMode %q: sent %s through the proxy's client", mode, req.URL)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}))
+		req, err := http.NewRequest("GET", "https://account.servicebus.windows.net/$servicebus/websocket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+
+		_, err = tpt.Do(req)
+		if wantErr != errors.Is(err, ErrUpgradeNotSupported) || passedThrough == wantErr {
+			t.Errorf("WebSocketMode %q: got error %v, passed through %v", mode, err, passedThrough)
+		}
+	}
+}
+
+func TestUpgradeNotSupported(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		upgrade bool
+	}{
+		{"websocket", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"}, true},
+		{"keep-alive and upgrade", map[string]string{"Connection": "keep-alive, Upgrade", "Upgrade": "WebSocket"}, true},
+		{"h2c", map[string]string{"Connection": "Upgrade, HTTP2-Settings", "Upgrade": "h2c"}, true},
+		{"no Connection token", map[string]string{"Upgrade": "websocket"}, false},
+		{"no Upgrade header", map[string]string{"Connection": "Upgrade"}, false},
+		{"keep-alive", map[string]string{"Connection": "keep-alive"}, false},
+		{"upgrade in other headers", map[string]string{"Connection": "x-upgrade-hint", "x-ms-upgrade": "websocket", "User-Agent": "upgrade-client"}, false},
+		{"Upgrade-Insecure-Requests", map[string]string{"Upgrade-Insecure-Requests": "1"}, false},
+	} {
+		var sent bool
+		tpv := &TestProxyVariables{Host: "localhost", Port: 5001, Mode: "record"}
+		tpt := tpv.Transport(transporterFunc(func(req *http.Request) (*http.Response, error) {
+			sent = true
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}))
+		req, err := http.NewRequest("GET", "https://account.servicebus.windows.net/$servicebus/websocket", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+
+		_, err = tpt.Do(req)
+		if got := errors.Is(err, ErrUpgradeNotSupported); got != tc.upgrade || sent == tc.upgrade {
+			t.Errorf("%s: got error %v, sent %v", tc.name, err, sent)
+		}
+		if tc.upgrade && !strings.Contains(err.Error(), "account.servicebus.windows.net") {
+			t.Errorf("%s: the error %q does not name the request", tc.name, err)
+		}
+	}
+}
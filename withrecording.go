@@ -0,0 +1,43 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"testing"
+)
+
+// WithRecording runs fn inside a test proxy session: it starts the session,
+// calls fn and always stops the session afterwards, even when fn panics or
+// calls t.FailNow. The recording is saved only when fn returns normally and
+// the test has not failed; otherwise it is discarded, so a broken run never
+// replaces a good recording. A panic in fn is raised again once the session
+// is stopped, and an error stopping the session is reported with t.Error.
+//
+//	testproxy.WithRecording(t, tpv, func(tpv *testproxy.TestProxyVariables) {
+//		client, err := aztables.NewServiceClientWithNoCredential(url, &aztables.ClientOptions{ClientOptions: tpv.ClientOptions()})
+//		...
+//	})
+func WithRecording(t testing.TB, tpv *TestProxyVariables, fn func(tpv *TestProxyVariables)) {
+	t.Helper()
+	if err := StartTestProxy(tpv); err != nil {
+		t.Fatal(err)
+	}
+
+	// completed stays false when fn panics or calls runtime.Goexit, as
+	// t.FailNow does.
+	completed := false
+	defer func() {
+		r := recover()
+		save := completed && r == nil && !t.Failed()
+		if err := stopTestProxy(tpv, save); err != nil {
+			t.Errorf("stopping test proxy session %s: %v", tpv.RecordingId, err)
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+	fn(tpv)
+	completed = true
+}
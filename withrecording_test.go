@@ -0,0 +1,84 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"fmt"
+	"testing"
+)
+
+// errorRecorder collects the errors reported through it instead of failing
+// the test.
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *errorRecorder) Failed() bool {
+	return len(r.errors) > 0
+}
+
+func TestWithRecording(t *testing.T) {
+	stopSave := func(sp *stubProxy) []string {
+		var saves []string
+		for _, r := range sp.Requests() {
+			if r.Path == "/record/stop" {
+				saves = append(saves, r.Header.Get("x-recording-save"))
+			}
+		}
+		return saves
+	}
+
+	t.Run("saves", func(t *testing.T) {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, "record")
+		called := false
+		WithRecording(t, tpv, func(*TestProxyVariables) { called = true })
+		if !called {
+			t.Error("fn was not called")
+		}
+		if got := stopSave(sp); len(got) != 1 || got[0] != "true" {
+			t.Errorf("got stop requests with x-recording-save %v, want [true]", got)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, "record")
+		func() {
+			defer func() {
+				if r := recover(); r != "boom" {
+					t.Errorf("recovered %v, want the original panic", r)
+				}
+			}()
+			WithRecording(t, tpv, func(*TestProxyVariables) { panic("boom") })
+			t.Error("WithRecording returned after a panic")
+		}()
+		if got := stopSave(sp); len(got) != 1 || got[0] != "false" {
+			t.Errorf("got stop requests with x-recording-save %v, want [false]", got)
+		}
+	})
+
+	t.Run("stop error", func(t *testing.T) {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, "record")
+		rec := &errorRecorder{TB: t}
+		func() {
+			defer func() { recover() }()
+			WithRecording(rec, tpv, func(*TestProxyVariables) {
+				// Stopping fails once the proxy is gone.
+				sp.Close()
+				panic("boom")
+			})
+		}()
+		if len(rec.errors) != 1 {
+			t.Errorf("got reported errors %q, want the stop error", rec.errors)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// jwtRegex matches a JSON Web Token: a base64url encoded JSON header and
+// payload, both starting with "eyJ", and a signature.
+const jwtRegex = `eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`
+
+// SanitizeWorkloadIdentityTokens registers the sanitizers for tests that
+// authenticate with Workload Identity, as pods in AKS do. The credential
+// exchanges the service account token from the projected volume for an
+// Azure AD access token, and both are JWTs in the bodies of the token
+// request and response. The access token is then sent in the Authorization
+// header of every call to the service.
+func SanitizeWorkloadIdentityTokens(tpv *TestProxyVariables) error {
+	for _, s := range []Sanitizer{
+		BodyRegexSanitizer{Value: "Sanitized", Regex: jwtRegex},
+		HeaderRegexSanitizer{Key: "Authorization", Value: "Sanitized", Regex: jwtRegex},
+	} {
+		if err := tpv.AddSanitizer(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FakeWorkloadIdentityCredential is an azcore.TokenCredential for playback,
+// where neither the projected service account token nor Azure AD is
+// available. It returns an unsigned JWT shaped like an Azure AD access
+// token, valid for an hour, for the scope requested.
+type FakeWorkloadIdentityCredential struct {
+	TenantID string
+	ClientID string
+}
+
+// GetToken implements azcore.TokenCredential.
+func (c FakeWorkloadIdentityCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresOn := now.Add(time.Hour)
+	audience := ""
+	if len(opts.Scopes) > 0 {
+		audience = strings.TrimSuffix(opts.Scopes[0], "/.default")
+	}
+	payload := map[string]interface{}{
+		"aud":   audience,
+		"iss":   "https://sts.windows.net/" + c.TenantID + "/",
+		"tid":   c.TenantID,
+		"appid": c.ClientID,
+		"sub":   c.ClientID,
+		"iat":   now.Unix(),
+		"nbf":   now.Unix(),
+		"exp":   expiresOn.Unix(),
+	}
+	header := map[string]string{"alg": "none", "typ": "JWT"}
+	var parts []string
+	for _, v := range []interface{}{header, payload} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return azcore.AccessToken{}, err
+		}
+		parts = append(parts, base64.RawURLEncoding.EncodeToString(data))
+	}
+	parts = append(parts, base64.RawURLEncoding.EncodeToString([]byte("fake-signature")))
+	return azcore.AccessToken{Token: strings.Join(parts, "."), ExpiresOn: expiresOn}, nil
+}
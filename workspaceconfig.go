@@ -0,0 +1,239 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// workspaceConfigNames are the names of config files, in order of
+// preference when a directory has both.
+var workspaceConfigNames = []string{"testproxy.yaml", "testproxy.json"}
+
+// ErrNoWorkspaceConfig is returned by FindWorkspaceConfig when neither the
+// current directory nor its parents have a config file.
+var ErrNoWorkspaceConfig = errors.New("no testproxy.yaml or testproxy.json found")
+
+// ProxyConfig is the content of a testproxy.yaml or testproxy.json file.
+// Unknown keys are rejected, so a typo fails rather than being ignored.
+type ProxyConfig struct {
+	Host              string            `yaml:"host" json:"host"`
+	Port              int               `yaml:"port" json:"port"`
+	Mode              string            `yaml:"mode" json:"mode"`
+	ClientId          string            `yaml:"clientId" json:"clientId"`
+	IncludedHosts     []string          `yaml:"includedHosts" json:"includedHosts"`
+	ExcludedHosts     []string          `yaml:"excludedHosts" json:"excludedHosts"`
+	Matcher           MatcherConfig     `yaml:"matcher" json:"matcher"`
+	Variables         map[string]string `yaml:"variables" json:"variables"`
+	RecordingMetadata map[string]string `yaml:"recordingMetadata" json:"recordingMetadata"`
+	CompressFormat    string            `yaml:"compressFormat" json:"compressFormat"`
+	// MaxRecordingFileSizeBytes and MaxRecordingFileSizeErrorBytes are
+	// those of TestProxyVariables.
+	MaxRecordingFileSizeBytes      int64 `yaml:"maxRecordingFileSizeBytes" json:"maxRecordingFileSizeBytes"`
+	MaxRecordingFileSizeErrorBytes int64 `yaml:"maxRecordingFileSizeErrorBytes" json:"maxRecordingFileSizeErrorBytes"`
+}
+
+// MatcherConfig is the Matcher of a ProxyConfig.
+type MatcherConfig struct {
+	IgnoreBodies           bool     `yaml:"ignoreBodies" json:"ignoreBodies"`
+	ExcludedHeaders        []string `yaml:"excludedHeaders" json:"excludedHeaders"`
+	IgnoredHeaders         []string `yaml:"ignoredHeaders" json:"ignoredHeaders"`
+	IgnoredQueryParameters []string `yaml:"ignoredQueryParameters" json:"ignoredQueryParameters"`
+	IgnoreQueryOrdering    bool     `yaml:"ignoreQueryOrdering" json:"ignoreQueryOrdering"`
+}
+
+// workspaceConfig caches the workspace config of the process.
+var workspaceConfig struct {
+	once sync.Once
+	cfg  *ProxyConfig
+	err  error
+}
+
+// FindWorkspaceConfig returns TestProxyVariables configured by the config
+// files of the workspace, so the packages of a monorepo can share one
+// proxy configuration. The workspace config is the first testproxy.yaml or
+// testproxy.json found walking up from the parent of the current
+// directory, and is read once per process. A config file in the current
+// directory, the package's, is merged on top of it: its values take
+// precedence where set, lists replace the workspace's, and variables and
+// metadata are merged key by key. Settings neither sets default as for
+// NewTestProxyFromEnv, without reading the environment other than
+// TESTPROXY_CA_BUNDLE and TESTPROXY_CLIENT_ID. ErrNoWorkspaceConfig is
+// returned when there is no config file at all.
+func FindWorkspaceConfig() (*TestProxyVariables, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	workspaceConfig.once.Do(func() {
+		workspaceConfig.cfg, _, workspaceConfig.err = findConfigFile(filepath.Dir(dir))
+	})
+	if workspaceConfig.err != nil {
+		return nil, workspaceConfig.err
+	}
+	pkg, err := readConfigDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	cfg := mergeConfigs(workspaceConfig.cfg, pkg)
+	if cfg == nil {
+		return nil, ErrNoWorkspaceConfig
+	}
+	return NewTestProxy(cfg.apply)
+}
+
+// findConfigFile returns the first config file found in dir or its
+// parents, and its path, or nil when there is none.
+func findConfigFile(dir string) (*ProxyConfig, string, error) {
+	for {
+		for _, name := range workspaceConfigNames {
+			path := filepath.Join(dir, name)
+			cfg, err := readConfigFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return cfg, path, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, "", nil
+		}
+		dir = parent
+	}
+}
+
+// readConfigDir reads the config file of dir, or returns nil when it has
+// none.
+func readConfigDir(dir string) (*ProxyConfig, error) {
+	for _, name := range workspaceConfigNames {
+		cfg, err := readConfigFile(filepath.Join(dir, name))
+		if !errors.Is(err, os.ErrNotExist) {
+			return cfg, err
+		}
+	}
+	return nil, nil
+}
+
+func readConfigFile(path string) (*ProxyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ProxyConfig{}
+	if filepath.Ext(path) == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); errors.Is(err, io.EOF) {
+			// An empty file configures nothing.
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// mergeConfigs returns base with the settings of override on top. Either
+// may be nil.
+func mergeConfigs(base, override *ProxyConfig) *ProxyConfig {
+	if base == nil || override == nil {
+		if base == nil {
+			return override
+		}
+		return base
+	}
+	merged := *base
+	setString := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	setStrings := func(dst *[]string, v []string) {
+		if v != nil {
+			*dst = v
+		}
+	}
+	mergeMap := func(dst map[string]string, v map[string]string) map[string]string {
+		if len(v) == 0 {
+			return dst
+		}
+		merged := cloneStringMap(dst)
+		if merged == nil {
+			merged = map[string]string{}
+		}
+		for k, val := range v {
+			merged[k] = val
+		}
+		return merged
+	}
+	setString(&merged.Host, override.Host)
+	if override.Port != 0 {
+		merged.Port = override.Port
+	}
+	setString(&merged.Mode, override.Mode)
+	setString(&merged.ClientId, override.ClientId)
+	setStrings(&merged.IncludedHosts, override.IncludedHosts)
+	setStrings(&merged.ExcludedHosts, override.ExcludedHosts)
+	merged.Matcher.IgnoreBodies = merged.Matcher.IgnoreBodies || override.Matcher.IgnoreBodies
+	setStrings(&merged.Matcher.ExcludedHeaders, override.Matcher.ExcludedHeaders)
+	setStrings(&merged.Matcher.IgnoredHeaders, override.Matcher.IgnoredHeaders)
+	setStrings(&merged.Matcher.IgnoredQueryParameters, override.Matcher.IgnoredQueryParameters)
+	merged.Matcher.IgnoreQueryOrdering = merged.Matcher.IgnoreQueryOrdering || override.Matcher.IgnoreQueryOrdering
+	merged.Variables = mergeMap(base.Variables, override.Variables)
+	merged.RecordingMetadata = mergeMap(base.RecordingMetadata, override.RecordingMetadata)
+	setString(&merged.CompressFormat, override.CompressFormat)
+	if override.MaxRecordingFileSizeBytes != 0 {
+		merged.MaxRecordingFileSizeBytes = override.MaxRecordingFileSizeBytes
+	}
+	if override.MaxRecordingFileSizeErrorBytes != 0 {
+		merged.MaxRecordingFileSizeErrorBytes = override.MaxRecordingFileSizeErrorBytes
+	}
+	return &merged
+}
+
+// apply configures tpv as a TestProxyOption.
+func (cfg *ProxyConfig) apply(tpv *TestProxyVariables) {
+	tpv.Host, tpv.Port, tpv.Mode = DefaultProxyHost, DefaultProxyPort, DefaultProxyMode
+	if cfg.Host != "" {
+		tpv.Host = cfg.Host
+	}
+	if cfg.Port != 0 {
+		tpv.Port = cfg.Port
+	}
+	if cfg.Mode != "" {
+		tpv.Mode = cfg.Mode
+	}
+	if cfg.ClientId != "" {
+		tpv.ClientId = cfg.ClientId
+	}
+	tpv.IncludedHosts = cloneStrings(cfg.IncludedHosts)
+	tpv.ExcludedHosts = cloneStrings(cfg.ExcludedHosts)
+	tpv.Matcher = Matcher{
+		IgnoreBodies:           cfg.Matcher.IgnoreBodies,
+		ExcludedHeaders:        cloneStrings(cfg.Matcher.ExcludedHeaders),
+		IgnoredHeaders:         cloneStrings(cfg.Matcher.IgnoredHeaders),
+		IgnoredQueryParameters: cloneStrings(cfg.Matcher.IgnoredQueryParameters),
+		IgnoreQueryOrdering:    cfg.Matcher.IgnoreQueryOrdering,
+	}
+	tpv.Variables = cloneStringMap(cfg.Variables)
+	tpv.RecordingMetadata = cloneStringMap(cfg.RecordingMetadata)
+	tpv.CompressFormat = cfg.CompressFormat
+	tpv.MaxRecordingFileSizeBytes = cfg.MaxRecordingFileSizeBytes
+	tpv.MaxRecordingFileSizeErrorBytes = cfg.MaxRecordingFileSizeErrorBytes
+}
@@ -0,0 +1,99 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindWorkspaceConfig(t *testing.T) {
+	root := t.TempDir()
+	writeConfig(t, filepath.Join(root, "testproxy.yaml"), `
+host: proxy.example.com
+port: 5443
+includedHosts: ["*.table.core.windows.net"]
+matcher:
+  excludedHeaders: [x-ms-date]
+variables:
+  location: westus
+  tableName: shared
+`)
+	pkg := filepath.Join(root, "sdk", "tables")
+	writeConfig(t, filepath.Join(pkg, "testproxy.json"), `{
+  "mode": "playback",
+  "matcher": {"ignoreQueryOrdering": true},
+  "variables": {"tableName": "products"}
+}`)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(pkg); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tpv, err := FindWorkspaceConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpv.Host != "proxy.example.com" || tpv.Port != 5443 || tpv.Mode != "playback" {
+		t.Errorf("got %s:%d in %s mode", tpv.Host, tpv.Port, tpv.Mode)
+	}
+	if !reflect.DeepEqual(tpv.IncludedHosts, []string{"*.table.core.windows.net"}) ||
+		!reflect.DeepEqual(tpv.Matcher.ExcludedHeaders, []string{"x-ms-date"}) || !tpv.Matcher.IgnoreQueryOrdering {
+		t.Errorf("got included hosts %v and matcher %+v", tpv.IncludedHosts, tpv.Matcher)
+	}
+	if want := map[string]string{"location": "westus", "tableName": "products"}; !reflect.DeepEqual(tpv.Variables, want) {
+		t.Errorf("got variables %v, want %v", tpv.Variables, want)
+	}
+	if tpv.HttpClient == nil {
+		t.Error("no HTTP client")
+	}
+
+	// The workspace config is read once per process.
+	writeConfig(t, filepath.Join(root, "testproxy.yaml"), "port: 1\n")
+	if tpv, err := FindWorkspaceConfig(); err != nil || tpv.Port != 5443 {
+		t.Errorf("got port %d, %v after changing the workspace config", tpv.Port, err)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	root := t.TempDir()
+	writeConfig(t, filepath.Join(root, "testproxy.json"), `{"port": 6000}`)
+	writeConfig(t, filepath.Join(root, "a", "testproxy.yaml"), "port: 7000\n")
+	writeConfig(t, filepath.Join(root, "a", "testproxy.json"), `{"port": 8000}`)
+
+	cfg, path, err := findConfigFile(filepath.Join(root, "a", "b", "c"))
+	if err != nil || cfg.Port != 7000 || path != filepath.Join(root, "a", "testproxy.yaml") {
+		t.Errorf("got %+v at %s, %v, want the nearest file, preferring YAML", cfg, path, err)
+	}
+	if cfg, err := readConfigDir(filepath.Join(root, "a", "b")); cfg != nil || err != nil {
+		t.Errorf("got %+v, %v for a directory without a config", cfg, err)
+	}
+
+	writeConfig(t, filepath.Join(root, "typo", "testproxy.yaml"), "hots: localhost\n")
+	if _, _, err := findConfigFile(filepath.Join(root, "typo")); err == nil || !strings.Contains(err.Error(), "hots") {
+		t.Errorf("got %v, want the unknown key reported", err)
+	}
+	if merged := mergeConfigs(nil, nil); merged != nil {
+		t.Errorf("merged nothing into %+v", merged)
+	}
+}
@@ -0,0 +1,96 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// AddXMLBodyNormalizer makes transports created with tpv.Transport rewrite
+// XML request bodies, such as Storage block lists and blob tags, in a
+// canonical form in record and playback alike, so the serializer's choice
+// of attribute order and namespace prefixes never causes a playback
+// mismatch. In the canonical form, attributes are sorted, namespaces are
+// declared by the encoding/xml encoder rather than with the original
+// prefixes, and comments and whitespace between elements are removed.
+// Bodies that are not well-formed XML are sent as they are.
+func AddXMLBodyNormalizer(tpv *TestProxyVariables) error {
+	tpv.requestHooks = append(tpv.requestHooks, func(req *http.Request, mode string) {
+		if req.Body == nil || req.Body == http.NoBody {
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != "application/xml" && mediaType != "text/xml" && !strings.HasSuffix(mediaType, "+xml") {
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+			return
+		}
+		if canonical, err := canonicalXML(body); err == nil {
+			body = canonical
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	})
+	return nil
+}
+
+// canonicalXML round-trips body through encoding/xml; see
+// AddXMLBodyNormalizer.
+func canonicalXML(body []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			attrs := make([]xml.Attr, 0, len(t.Attr))
+			for _, a := range t.Attr {
+				// The encoder declares the namespaces it uses.
+				if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+					continue
+				}
+				attrs = append(attrs, a)
+			}
+			sort.Slice(attrs, func(i, j int) bool {
+				if attrs[i].Name.Space != attrs[j].Name.Space {
+					return attrs[i].Name.Space < attrs[j].Name.Space
+				}
+				return attrs[i].Name.Local < attrs[j].Name.Local
+			})
+			t.Attr = attrs
+			tok = t
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+		case xml.Comment:
+			continue
+		}
+		if err := enc.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
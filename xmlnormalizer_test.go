@@ -0,0 +1,60 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestXMLBodyNormalizer(t *testing.T) {
+	for _, mode := range []string{"record", "playback"} {
+		sp := newStubProxy(t)
+		tpv := sp.variables(t, mode)
+		if err := AddXMLBodyNormalizer(tpv); err != nil {
+			t.Fatal(err)
+		}
+		tpt := tpv.Transport(sp.Client())
+		send := func(contentType, body string) string {
+			t.Helper()
+			req, err := http.NewRequest("PUT", "https://account.blob.core.windows.net/c/b?comp=blocklist", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			resp, err := tpt.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			requests := sp.Requests()
+			return string(requests[len(requests)-1].Body)
+		}
+
+		first := send("application/xml", `<?xml version="1.0" encoding="utf-8"?>
+<s:Tags xmlns:s="urn:storage" xmlns:m="urn:meta" version="1" m:owner="a">
+  <!-- generated -->
+  <s:Tag key="k" value="v &amp; w"/>
+</s:Tags>`)
+		second := send("application/xml; charset=utf-8", `<?xml version="1.0" encoding="utf-8"?><x:Tags m2:owner="a" version="1" xmlns:m2="urn:meta" xmlns:x="urn:storage"><x:Tag value="v &amp; w" key="k"></x:Tag></x:Tags>`)
+		if first != second {
+			t.Errorf("%s: equivalent bodies were sent differently:\n%s\n%s", mode, first, second)
+		}
+		if !strings.Contains(first, `key="k" value="v &amp; w"`) || strings.Contains(first, "generated") {
+			t.Errorf("%s: sent %s", mode, first)
+		}
+
+		for _, tc := range []struct{ contentType, body string }{
+			{"application/json", `{"b": 1, "a": 2}`},
+			{"application/xml", `<Tags b="2" a="1"><Tag></Tags>`},
+			{"application/octet-stream", `<Tags b="2" a="1"/>`},
+		} {
+			if got := send(tc.contentType, tc.body); got != tc.body {
+				t.Errorf("%s: %s body %s was sent as %s", mode, tc.contentType, tc.body, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// ------------------------------------------------------------
+// Copyright (c) Microsoft Corporation.  All rights reserved.
+// ------------------------------------------------------------
+
+package testproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportYAML writes rec as YAML, which is easier to read and review than
+// the proxy's JSON. The conversion is lossless: keys keep their order and
+// numbers their exact representation, so ImportYAML gives back the same
+// recording.
+func ExportYAML(rec *RecordingFile, w io.Writer) error {
+	data, err := marshalNoEscape(rec)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := jsonToYAMLNode(dec)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ImportYAML reads a recording written by ExportYAML.
+func ImportYAML(r io.Reader) (*RecordingFile, error) {
+	var doc yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := yamlNodeToJSON(&doc, &buf); err != nil {
+		return nil, err
+	}
+	rec := &RecordingFile{}
+	if err := json.Unmarshal(buf.Bytes(), rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// jsonToYAMLNode converts the next JSON value of dec to a YAML node.
+func jsonToYAMLNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if tok == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			child, err := jsonToYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tok}
+		if literalSafe(tok) {
+			node.Style = yaml.LiteralStyle
+		} else if strings.ContainsAny(tok, "\n\r") {
+			// The encoder would pick a literal block on its own.
+			node.Style = yaml.DoubleQuotedStyle
+		}
+		return node, nil
+	case json.Number:
+		tag := "!!float"
+		if _, err := strconv.ParseInt(tok.String(), 10, 64); err == nil {
+			tag = "!!int"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: tok.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(tok)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// literalSafe reports whether s is multi-line text that reads back
+// unchanged from a YAML literal block. Leading whitespace, carriage returns
+// and trailing spaces are lost or rejected by the encoder, so strings with
+// them are double-quoted instead.
+func literalSafe(s string) bool {
+	if !strings.Contains(s, "\n") || strings.ContainsRune(s, '\r') || strings.TrimLeft(s, " \t\n") != s {
+		return false
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlNodeToJSON writes node as JSON, keeping the order of mapping keys.
+func yamlNodeToJSON(node *yaml.Node, buf *bytes.Buffer) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) != 1 {
+			return errors.New("empty YAML document")
+		}
+		return yamlNodeToJSON(node.Content[0], buf)
+	case yaml.AliasNode:
+		return yamlNodeToJSON(node.Alias, buf)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := marshalNoEscape(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := yamlNodeToJSON(node.Content[i+1], buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, child := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := yamlNodeToJSON(child, buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+			return nil
+		case "!!bool", "!!int", "!!float":
+			// YAML spellings such as 0x1F or .inf are not JSON; decode
+			// those and re-encode them.
+			if json.Valid([]byte(node.Value)) {
+				buf.WriteString(node.Value)
+				return nil
+			}
+			var v interface{}
+			if err := node.Decode(&v); err != nil {
+				return err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", node.Line, err)
+			}
+			buf.Write(data)
+			return nil
+		}
+		data, err := marshalNoEscape(node.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
+	return fmt.Errorf("line %d: unsupported YAML node", node.Line)
+}